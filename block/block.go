@@ -8,7 +8,9 @@ import (
 	"math/big"
 
 	u "github.com/lobiCode/prog_btc_go/btcutils"
+	"github.com/lobiCode/prog_btc_go/chaincfg"
 	"github.com/lobiCode/prog_btc_go/merkletree"
+	"github.com/lobiCode/prog_btc_go/tx"
 )
 
 type Block struct {
@@ -19,6 +21,8 @@ type Block struct {
 	Bits       []byte
 	Nonce      []byte
 	TxHashes   [][]byte
+	// Txs are the transactions of a block parsed with ParseWithTxs
+	Txs []*tx.Tx
 }
 
 func (b *Block) ValidateMerkleRoot() bool {
@@ -77,6 +81,37 @@ func Parse(r io.Reader) (*Block, error) {
 	return block, nil
 }
 
+// ParseWithTxs parses a full block, the header followed by its
+// transactions.
+func ParseWithTxs(r io.Reader) (*Block, error) {
+	block, err := Parse(r)
+	if err != nil {
+		return nil, err
+	}
+
+	n, err := u.ReadVariant(r)
+	if err != nil {
+		return nil, err
+	}
+
+	for i := uint64(0); i < n; i++ {
+		transaction, err := tx.ParseTx(r)
+		if err != nil {
+			return nil, err
+		}
+		txHash, _ := hex.DecodeString(transaction.TxId())
+		block.Txs = append(block.Txs, transaction)
+		block.TxHashes = append(block.TxHashes, txHash)
+	}
+
+	return block, nil
+}
+
+// Genesis returns the header of the first block of a network.
+func Genesis(params *chaincfg.Params) (*Block, error) {
+	return Parse(bytes.NewReader(params.GenesisBlock))
+}
+
 func (b *Block) String() string {
 	return b.Hash()
 }
@@ -7,6 +7,7 @@ import (
 	"testing"
 
 	u "github.com/lobiCode/prog_btc_go/btcutils"
+	"github.com/lobiCode/prog_btc_go/chaincfg"
 )
 
 func TestParseSerialize(t *testing.T) {
@@ -112,11 +113,35 @@ func TestCalNewBits(t *testing.T) {
 
 	expected, _ := hex.DecodeString("308d0118")
 
-	result := u.CalculateNewBits(timeDiff, blockLast.Bits)
+	result := u.CalculateNewBits(timeDiff, blockLast.Bits, &chaincfg.MainNetParams)
 
 	check(expected, result, t)
 }
 
+func TestGenesis(t *testing.T) {
+	for _, params := range chaincfg.Networks {
+		genesis, err := Genesis(params)
+		check(nil, err, t)
+		check(params.GenesisHash, genesis.Hash(), t)
+		check(true, genesis.CheckPow(), t)
+		check(make([]byte, 32), genesis.PrevBlock, t)
+	}
+}
+
+func TestParseWithTxs(t *testing.T) {
+	params := &chaincfg.MainNetParams
+	coinbase := "01000000010000000000000000000000000000000000000000000000000000000000000000ffffffff4d04ffff001d0104455468652054696d65732030332f4a616e2f32303039204368616e63656c6c6f72206f6e206272696e6b206f66207365636f6e64206261696c6f757420666f722062616e6b73ffffffff0100f2052a01000000434104678afdb0fe5548271967f1a67130b7105cd6a828e03909a67962e0ea1f61deb649f6bc3f4cef38c4f35504e51ec112de5c384df7ba0b8d578a4c702b6bf11d5fac00000000"
+	raw, _ := hex.DecodeString(hex.EncodeToString(params.GenesisBlock) + "01" + coinbase)
+
+	genesis, err := ParseWithTxs(bytes.NewReader(raw))
+	check(nil, err, t)
+	check(params.GenesisHash, genesis.Hash(), t)
+	check(1, len(genesis.Txs), t)
+	check(true, genesis.Txs[0].IsCoinbase(), t)
+	check(uint64(5000000000), genesis.Txs[0].TxOuts[0].Amount, t)
+	check(true, genesis.ValidateMerkleRoot(), t)
+}
+
 func TestValidateMerkleRoot(t *testing.T) {
 	hexHashes := []string{
 		"f54cb69e5dc1bd38ee6901e4ec2007a5030e14bdd60afb4d2f3428c88eea17c1",
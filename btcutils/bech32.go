@@ -0,0 +1,212 @@
+package btcutils
+
+import (
+	"errors"
+	"strings"
+
+	"github.com/lobiCode/prog_btc_go/chaincfg"
+)
+
+var ErrBech32 = errors.New("invalid bech32 string")
+
+// Bech32Encoding is the checksum variant of a bech32 string, BIP173 bech32
+// or BIP350 bech32m.
+type Bech32Encoding int
+
+const (
+	BECH32 Bech32Encoding = iota + 1
+	BECH32M
+)
+
+const (
+	bech32Charset   = "qpzry9x8gf2tvdw0s3jn54khce6mua7l"
+	bech32mConst    = 0x2bc830a3
+	bech32MaxLength = 90
+)
+
+func bech32Polymod(values []byte) uint32 {
+	generator := []uint32{0x3b6a57b2, 0x26508e6d, 0x1ea119fa, 0x3d4233dd, 0x2a1462b3}
+	chk := uint32(1)
+	for _, v := range values {
+		top := chk >> 25
+		chk = (chk&0x1ffffff)<<5 ^ uint32(v)
+		for i := uint(0); i < 5; i++ {
+			if (top>>i)&1 == 1 {
+				chk ^= generator[i]
+			}
+		}
+	}
+
+	return chk
+}
+
+func bech32HrpExpand(hrp string) []byte {
+	result := make([]byte, 0, len(hrp)*2+1)
+	for i := 0; i < len(hrp); i++ {
+		result = append(result, hrp[i]>>5)
+	}
+	result = append(result, 0)
+	for i := 0; i < len(hrp); i++ {
+		result = append(result, hrp[i]&31)
+	}
+
+	return result
+}
+
+func bech32Const(enc Bech32Encoding) uint32 {
+	if enc == BECH32M {
+		return bech32mConst
+	}
+
+	return 1
+}
+
+// EncodeBech32 encodes the 5 bit values with the human readable part hrp.
+func EncodeBech32(hrp string, values []byte, enc Bech32Encoding) (string, error) {
+	for _, v := range values {
+		if v > 31 {
+			return "", ErrBech32
+		}
+	}
+
+	hrp = strings.ToLower(hrp)
+	data := append(bech32HrpExpand(hrp), values...)
+	polymod := bech32Polymod(append(data, make([]byte, 6)...)) ^ bech32Const(enc)
+
+	var sb strings.Builder
+	sb.WriteString(hrp)
+	sb.WriteByte('1')
+	for _, v := range values {
+		sb.WriteByte(bech32Charset[v])
+	}
+	for i := uint(0); i < 6; i++ {
+		sb.WriteByte(bech32Charset[(polymod>>(5*(5-i)))&31])
+	}
+
+	return sb.String(), nil
+}
+
+// DecodeBech32 returns the human readable part and the 5 bit values of a
+// bech32 or bech32m string.
+func DecodeBech32(s string) (string, []byte, Bech32Encoding, error) {
+	if len(s) > bech32MaxLength || (strings.ToLower(s) != s && strings.ToUpper(s) != s) {
+		return "", nil, 0, ErrBech32
+	}
+	s = strings.ToLower(s)
+
+	pos := strings.LastIndexByte(s, '1')
+	if pos < 1 || pos+7 > len(s) {
+		return "", nil, 0, ErrBech32
+	}
+
+	hrp := s[:pos]
+	for i := 0; i < len(hrp); i++ {
+		if hrp[i] < 33 || hrp[i] > 126 {
+			return "", nil, 0, ErrBech32
+		}
+	}
+
+	values := make([]byte, 0, len(s)-pos-1)
+	for i := pos + 1; i < len(s); i++ {
+		v := strings.IndexByte(bech32Charset, s[i])
+		if v < 0 {
+			return "", nil, 0, ErrBech32
+		}
+		values = append(values, byte(v))
+	}
+
+	var enc Bech32Encoding
+	switch bech32Polymod(append(bech32HrpExpand(hrp), values...)) {
+	case 1:
+		enc = BECH32
+	case bech32mConst:
+		enc = BECH32M
+	default:
+		return "", nil, 0, ErrBech32
+	}
+
+	return hrp, values[:len(values)-6], enc, nil
+}
+
+// ConvertBits regroups data of from bit values into to bit values, the last
+// group is padded with zeros when pad is set and has to be zero otherwise.
+func ConvertBits(data []byte, from, to uint, pad bool) ([]byte, error) {
+	acc, bits := uint32(0), uint(0)
+	maxv := uint32(1)<<to - 1
+	result := []byte{}
+	for _, v := range data {
+		if uint32(v)>>from != 0 {
+			return nil, ErrBech32
+		}
+		acc = acc<<from | uint32(v)
+		bits += from
+		for bits >= to {
+			bits -= to
+			result = append(result, byte(acc>>bits&maxv))
+		}
+	}
+
+	if pad {
+		if bits > 0 {
+			result = append(result, byte(acc<<(to-bits)&maxv))
+		}
+	} else if bits >= from || acc<<(to-bits)&maxv != 0 {
+		return nil, ErrBech32
+	}
+
+	return result, nil
+}
+
+// EncodeSegwitAddress returns the BIP173 address of a witness program,
+// bech32m for the versions from 1 on.
+func EncodeSegwitAddress(hrp string, version byte, program []byte) (string, error) {
+	if !isValidWitnessProgram(version, program) {
+		return "", ErrBadAddress
+	}
+
+	values, err := ConvertBits(program, 8, 5, true)
+	if err != nil {
+		return "", err
+	}
+
+	enc := BECH32
+	if version > 0 {
+		enc = BECH32M
+	}
+
+	return EncodeBech32(hrp, append([]byte{version}, values...), enc)
+}
+
+// DecodeSegwitAddress returns the witness version and program of an address
+// with the human readable part hrp.
+func DecodeSegwitAddress(hrp, address string) (byte, []byte, error) {
+	gotHrp, values, enc, err := DecodeBech32(address)
+	if err != nil || gotHrp != hrp || len(values) == 0 {
+		return 0, nil, ErrBadAddress
+	}
+
+	version := values[0]
+	if (version == 0) != (enc == BECH32) {
+		return 0, nil, ErrBadAddress
+	}
+
+	program, err := ConvertBits(values[1:], 5, 8, false)
+	if err != nil || !isValidWitnessProgram(version, program) {
+		return 0, nil, ErrBadAddress
+	}
+
+	return version, program, nil
+}
+
+func isValidWitnessProgram(version byte, program []byte) bool {
+	if version > 16 || len(program) < 2 || len(program) > 40 {
+		return false
+	}
+
+	return version != 0 || len(program) == 20 || len(program) == 32
+}
+
+// AddressSegwit returns the address of a witness program on a network.
+func AddressSegwit(version byte, program []byte, params *chaincfg.Params) (string, error) {
+	return EncodeSegwitAddress(params.Bech32HRP, version, program)
+}
@@ -0,0 +1,118 @@
+package btcutils
+
+import (
+	"encoding/hex"
+	"strings"
+	"testing"
+)
+
+func TestBech32(t *testing.T) {
+	// BIP173 and BIP350
+	tests := []struct {
+		s   string
+		enc Bech32Encoding
+	}{
+		{"A12UEL5L", BECH32},
+		{"a12uel5l", BECH32},
+		{"an83characterlonghumanreadablepartthatcontainsthenumber1andtheexcludedcharactersbio1tt5tgs", BECH32},
+		{"abcdef1qpzry9x8gf2tvdw0s3jn54khce6mua7lmqqqxw", BECH32},
+		{"split1checkupstagehandshakeupstreamerranterredcaperred2y9e3w", BECH32},
+		{"A1LQFN3A", BECH32M},
+		{"abcdef1l7aum6echk45nj3s0wdvt2fg8x9yrzpqzd3ryx", BECH32M},
+		{"split1checkupstagehandshakeupstreamerranterredcaperredlc445v", BECH32M},
+		{"?1v759aa", BECH32M},
+	}
+
+	for _, test := range tests {
+		hrp, values, enc, err := DecodeBech32(test.s)
+		check(nil, err, t)
+		check(test.enc, enc, t)
+		s, err := EncodeBech32(hrp, values, enc)
+		check(nil, err, t)
+		check(strings.ToLower(test.s), s, t)
+	}
+
+	// values are 5 bits
+	_, err := EncodeBech32("bc", []byte{0, 31, 32}, BECH32)
+	check(ErrBech32, err, t)
+
+	invalid := []string{
+		"\x201nwldj5",
+		"an84characterslonghumanreadablepartthatcontainsthenumber1andtheexcludedcharactersbio1569pvx",
+		"pzry9x0s0muk",
+		"1pzry9x0s0muk",
+		"x1b4n0q5v",
+		"li1dgmt3",
+		"A1G7SGD8",
+		"10a06t8",
+		"1qzzfhee",
+		"tb1qrp33g0q5c5txsp9arysrx4k6zdkfs4nce4xj0gdcccefvpysxf3q0sL5k7",
+	}
+
+	for _, s := range invalid {
+		_, _, _, err := DecodeBech32(s)
+		check(ErrBech32, err, t)
+	}
+}
+
+func TestSegwitAddress(t *testing.T) {
+	// BIP350
+	tests := []struct {
+		address string
+		script  string
+	}{
+		{"BC1QW508D6QEJXTDG4Y5R3ZARVARY0C5XW7KV8F3T4", "0014751e76e8199196d454941c45d1b3a323f1433bd6"},
+		{"tb1qrp33g0q5c5txsp9arysrx4k6zdkfs4nce4xj0gdcccefvpysxf3q0sl5k7", "00201863143c14c5166804bd19203356da136c985678cd4d27a1b8c6329604903262"},
+		{"bc1pw508d6qejxtdg4y5r3zarvary0c5xw7kw508d6qejxtdg4y5r3zarvary0c5xw7kt5nd6y", "5128751e76e8199196d454941c45d1b3a323f1433bd6751e76e8199196d454941c45d1b3a323f1433bd6"},
+		{"BC1SW50QGDZ25J", "6002751e"},
+		{"bc1zw508d6qejxtdg4y5r3zarvaryvaxxpcs", "5210751e76e8199196d454941c45d1b3a323"},
+		{"tb1qqqqqp399et2xygdj5xreqhjjvcmzhxw4aywxecjdzew6hylgvsesrxh6hy", "0020000000c4a5cad46221b2a187905e5266362b99d5e91c6ce24d165dab93e86433"},
+		{"tb1pqqqqp399et2xygdj5xreqhjjvcmzhxw4aywxecjdzew6hylgvsesf3hn0c", "5120000000c4a5cad46221b2a187905e5266362b99d5e91c6ce24d165dab93e86433"},
+		{"bc1p0xlxvlhemja6c4dqv22uapctqupfhlxm9h8z3k2e72q4k9hcz7vqzk5jj0", "512079be667ef9dcbbac55a06295ce870b07029bfcdb2dce28d959f2815b16f81798"},
+	}
+
+	for _, test := range tests {
+		hrp := strings.ToLower(test.address[:2])
+		version, program, err := DecodeSegwitAddress(hrp, test.address)
+		check(nil, err, t)
+
+		script, _ := hex.DecodeString(test.script)
+		if version > 0 {
+			check(script[0]-0x50, version, t)
+		} else {
+			check(script[0], version, t)
+		}
+		check(script[2:], program, t)
+
+		address, err := EncodeSegwitAddress(hrp, version, program)
+		check(nil, err, t)
+		check(strings.ToLower(test.address), address, t)
+	}
+
+	invalid := []string{
+		"tc1p0xlxvlhemja6c4dqv22uapctqupfhlxm9h8z3k2e72q4k9hcz7vq5zuyut",
+		"bc1p0xlxvlhemja6c4dqv22uapctqupfhlxm9h8z3k2e72q4k9hcz7vqh2y7hd",
+		"tb1z0xlxvlhemja6c4dqv22uapctqupfhlxm9h8z3k2e72q4k9hcz7vqglt7rf",
+		"BC1S0XLXVLHEMJA6C4DQV22UAPCTQUPFHLXM9H8Z3K2E72Q4K9HCZ7VQ54WELL",
+		"bc1qw508d6qejxtdg4y5r3zarvary0c5xw7kemeawh",
+		"tb1q0xlxvlhemja6c4dqv22uapctqupfhlxm9h8z3k2e72q4k9hcz7vq24jc47",
+		"bc1p38j9r5y49hruaue7wxjce0updqjuyyx0kh56v8s25huc6995vvpql3jow4",
+		"BC130XLXVLHEMJA6C4DQV22UAPCTQUPFHLXM9H8Z3K2E72Q4K9HCZ7VQ7ZWS8R",
+		"bc1pw5dgrnzv",
+		"bc1p0xlxvlhemja6c4dqv22uapctqupfhlxm9h8z3k2e72q4k9hcz7v8n0nx0muaewav253zgeav",
+		"BC1QR508D6QEJXTDG4Y5R3ZARVARYV98GJ9P",
+		"tb1p0xlxvlhemja6c4dqv22uapctqupfhlxm9h8z3k2e72q4k9hcz7vq47Zagq",
+		"bc1p0xlxvlhemja6c4dqv22uapctqupfhlxm9h8z3k2e72q4k9hcz7v07qwwzcrf",
+		"tb1p0xlxvlhemja6c4dqv22uapctqupfhlxm9h8z3k2e72q4k9hcz7vpggkg4j",
+		"bc1gmk9yu",
+	}
+
+	for _, address := range invalid {
+		hrp := "bc"
+		if strings.HasPrefix(strings.ToLower(address), "tb") {
+			hrp = "tb"
+		}
+		_, _, err := DecodeSegwitAddress(hrp, address)
+		check(ErrBadAddress, err, t)
+	}
+}
@@ -9,6 +9,7 @@ import (
 	"math/big"
 	"strings"
 
+	"github.com/lobiCode/prog_btc_go/chaincfg"
 	"golang.org/x/crypto/ripemd160"
 )
 
@@ -156,6 +157,15 @@ func BigIntToLittleEndian(i *big.Int, l uint) []byte {
 	return tmp
 }
 
+func BigIntToBytes(i *big.Int, l uint) []byte {
+	tmp := make([]byte, l)
+
+	b := i.Bytes()
+	copy(tmp[int(l)-len(b):], b)
+
+	return tmp
+}
+
 func ReverseBytes(b []byte) {
 	l := len(b)
 	for i := 0; i < l/2; i++ {
@@ -252,6 +262,9 @@ func EncodeBase58Checksum(b []byte) string {
 
 func DecodeBase58Checksum(s string) ([]byte, error) {
 	b := Base58Decode(s)
+	if len(b) < 4 {
+		return nil, ErrBadAddress
+	}
 	checksum := b[len(b)-4:]
 	b256 := Hash256(b[:len(b)-4])[:4]
 	if !bytes.Equal(b256, checksum) {
@@ -315,26 +328,12 @@ func Base58Decode(s string) []byte {
 	return b
 }
 
-func H160ToP2pkhAddress(h160 []byte, testnet bool) string {
-	address := make([]byte, 1, len(h160)+1)
-	if testnet {
-		address[0] = 0x6f
-	} else {
-		address[0] = 0x00
-	}
-
-	return EncodeBase58Checksum(address)
+func H160ToP2pkhAddress(h160 []byte, params *chaincfg.Params) string {
+	return AddressP2pkh(h160, params)
 }
 
-func H160ToP2shAddress(h160 []byte, testnet bool) string {
-	address := make([]byte, 1, len(h160)+1)
-	if testnet {
-		address[0] = 0xc4
-	} else {
-		address[0] = 0x05
-	}
-
-	return EncodeBase58Checksum(address)
+func H160ToP2shAddress(h160 []byte, params *chaincfg.Params) string {
+	return AddressP2sh(h160, params)
 }
 
 func ReadByetes(r io.Reader, n int64) ([]byte, error) {
@@ -347,27 +346,6 @@ func ReadByetes(r io.Reader, n int64) ([]byte, error) {
 	return b, nil
 }
 
-func EncodeNum(i int64) ([]byte, error) {
-	buf := new(bytes.Buffer)
-	err := binary.Write(buf, binary.BigEndian, i)
-	if err != nil {
-		return nil, err
-	}
-
-	return buf.Bytes(), nil
-}
-
-func DecodeNum(b []byte) (int64, error) {
-	var i int64
-	buf := bytes.NewReader(b)
-	err := binary.Read(buf, binary.BigEndian, &i)
-	if err != nil {
-		return 0, err
-	}
-
-	return i, nil
-}
-
 func DecodeNumLittleEndian(b []byte) (int64, error) {
 	var i int64
 	bb := make([]byte, 8)
@@ -450,7 +428,7 @@ func TargetToBits(target *big.Int) []byte {
 	var exp int
 	coefficient := make([]byte, 3, 4)
 
-	if targetB[0] == 0x7f {
+	if targetB[0] > 0x7f {
 		exp = len(targetB) + 1
 		coefficient[0] = 0x00
 		copy(coefficient[1:], targetB[:2])
@@ -471,22 +449,25 @@ func IsZeroPrefix(r rune) bool {
 	return false
 }
 
-var (
-	TWO_WEEKS   int64 = 60 * 60 * 24 * 14
-	EIGHT_WEEKS int64 = TWO_WEEKS * 4
-	HALF_WEEK   int64 = TWO_WEEKS / 4
-)
-
-func CalculateNewBits(timeDiff int64, prevBits []byte) []byte {
+// CalculateNewBits returns the bits of the next retarget period, timeDiff is
+// how long the last one took.
+func CalculateNewBits(timeDiff int64, prevBits []byte, params *chaincfg.Params) []byte {
+	if params.PoWNoRetargeting {
+		return Copyb(prevBits)
+	}
 
-	if timeDiff > EIGHT_WEEKS {
-		timeDiff = EIGHT_WEEKS
-	} else if timeDiff < HALF_WEEK {
-		timeDiff = HALF_WEEK
+	timespan := params.TargetTimespan
+	if max := timespan * params.RetargetAdjustmentFactor; timeDiff > max {
+		timeDiff = max
+	} else if min := timespan / params.RetargetAdjustmentFactor; timeDiff < min {
+		timeDiff = min
 	}
 
 	prevTarger := BitsToTarget(prevBits)
-	newTarget := DivInt(MulInt(prevTarger, NewInt(timeDiff)), NewInt(TWO_WEEKS))
+	newTarget := DivInt(MulInt(prevTarger, NewInt(timeDiff)), NewInt(timespan))
+	if newTarget.Cmp(params.PowLimit) > 0 {
+		return Copyb(params.PowLimitBits)
+	}
 
 	return TargetToBits(newTarget)
 }
@@ -519,26 +500,18 @@ func BitsToBytes(bits []byte) []byte {
 	return b
 }
 
-func AddressP2pkh(hash160 []byte, testnet bool) string {
+func AddressP2pkh(hash160 []byte, params *chaincfg.Params) string {
 	result := make([]byte, 1, len(hash160)+1)
-	if testnet {
-		result[0] = 0x6f
-	} else {
-		result[0] = 0x00
-	}
+	result[0] = params.PubKeyHashAddrID
 
 	result = append(result, hash160...)
 
 	return EncodeBase58Checksum(result)
 }
 
-func AddressP2sh(hash160 []byte, testnet bool) string {
+func AddressP2sh(hash160 []byte, params *chaincfg.Params) string {
 	result := make([]byte, 1, len(hash160)+1)
-	if testnet {
-		result[0] = 0xc4
-	} else {
-		result[0] = 0x05
-	}
+	result[0] = params.ScriptHashAddrID
 
 	result = append(result, hash160...)
 
@@ -5,6 +5,8 @@ import (
 	"math/big"
 	"reflect"
 	"testing"
+
+	"github.com/lobiCode/prog_btc_go/chaincfg"
 )
 
 func TestLittleEndianToBigInt(t *testing.T) {
@@ -84,14 +86,40 @@ func TestBitsToTarget(t *testing.T) {
 	check("30353962581764818649842367179120467226026534727449575424", target.String(), t)
 }
 
+func TestTargetToBits(t *testing.T) {
+	check(chaincfg.MainNetParams.PowLimitBits, TargetToBits(chaincfg.MainNetParams.PowLimit), t)
+
+	// a coefficient with the high bit set would be negative
+	bits, _ := hex.DecodeString("00800017")
+	check(bits, TargetToBits(BitsToTarget(bits)), t)
+	bits, _ = hex.DecodeString("ffff7f17")
+	check(bits, TargetToBits(BitsToTarget(bits)), t)
+}
+
 func TestCalculateNewBits(t *testing.T) {
 	prevBits, _ := hex.DecodeString("54d80118")
 	timeDiff := int64(302400)
 	expected, _ := hex.DecodeString("00157617")
 
-	result := CalculateNewBits(timeDiff, prevBits)
+	result := CalculateNewBits(timeDiff, prevBits, &chaincfg.MainNetParams)
 
 	check(expected, result, t)
+
+	// the target never goes above the proof of work limit
+	result = CalculateNewBits(chaincfg.MainNetParams.TargetTimespan*4, chaincfg.MainNetParams.PowLimitBits, &chaincfg.MainNetParams)
+	check(chaincfg.MainNetParams.PowLimitBits, result, t)
+
+	result = CalculateNewBits(timeDiff, prevBits, &chaincfg.RegressionNetParams)
+	check(prevBits, result, t)
+}
+
+func TestH160ToAddress(t *testing.T) {
+	h160, _ := hex.DecodeString("7dd65592d0ab2fe0d0257d571abf032cd9db93dc")
+	check("1CUNEBjYrCn2y1SdiUMohaKUi4wpP326Lb", H160ToP2pkhAddress(h160, &chaincfg.MainNetParams), t)
+	check("mrzKXEpXfEDHk7vFS3LBXVXoa4YXFcCkje", H160ToP2pkhAddress(h160, &chaincfg.TestNet3Params), t)
+
+	h160, _ = hex.DecodeString("69ea5ff598a286f418ae77503ce85d83da4ae88e")
+	check("3BM3eLQZbwubG3XwwxJmd9qxwMJn7yUTSn", H160ToP2shAddress(h160, &chaincfg.MainNetParams), t)
 }
 
 func TestByteToBits(t *testing.T) {
@@ -0,0 +1,300 @@
+// Package chaincfg defines the parameters of the bitcoin networks: mainnet,
+// testnet3, testnet4, signet and regtest.
+package chaincfg
+
+import (
+	"encoding/hex"
+	"errors"
+	"math/big"
+)
+
+var ErrUnknownNetwork = errors.New("unknown network")
+
+// Params are the consensus rules and encodings of a network.
+type Params struct {
+	Name string
+
+	// Net is the message start of the p2p envelopes, little endian
+	Net         uint32
+	DefaultPort string
+	DNSSeeds    []string
+
+	// GenesisBlock is the serialized header of the genesis block
+	GenesisBlock []byte
+	GenesisHash  string
+
+	// PowLimit is the highest target, PowLimitBits its compact form as
+	// stored in a block header
+	PowLimit     *big.Int
+	PowLimitBits []byte
+
+	// retarget rules, the times are in seconds
+	TargetTimespan           int64
+	TargetTimePerBlock       int64
+	RetargetAdjustmentFactor int64
+	// ReduceMinDifficulty allows a block at PowLimit after
+	// MinDiffReductionTime without one
+	ReduceMinDifficulty  bool
+	MinDiffReductionTime int64
+	// EnforceBIP94 retargets from the first block of the period instead of
+	// a min difficulty one
+	EnforceBIP94     bool
+	PoWNoRetargeting bool
+
+	// heights from which the buried deployments are enforced
+	BIP34Height  int32
+	BIP65Height  int32
+	BIP66Height  int32
+	CSVHeight    int32
+	SegwitHeight int32
+
+	PubKeyHashAddrID byte
+	ScriptHashAddrID byte
+	PrivateKeyID     byte
+	Bech32HRP        string
+
+	HDPrivateKeyID [4]byte
+	HDPublicKeyID  [4]byte
+	// the extended key versions of BIP84 native segwit accounts, zprv and
+	// zpub on mainnet
+	HDSegwitPrivateKeyID [4]byte
+	HDSegwitPublicKeyID  [4]byte
+}
+
+// RetargetInterval is the number of blocks between difficulty changes.
+func (p *Params) RetargetInterval() int64 {
+	return p.TargetTimespan / p.TargetTimePerBlock
+}
+
+const (
+	targetTimespan     = 60 * 60 * 24 * 14
+	targetTimePerBlock = 60 * 10
+)
+
+var (
+	mainPowLimit   = newPowLimit("00000000ffffffffffffffffffffffffffffffffffffffffffffffffffffffff")
+	signetPowLimit = newPowLimit("00000377ae000000000000000000000000000000000000000000000000000000")
+	regPowLimit    = newPowLimit("7fffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffff")
+)
+
+var MainNetParams = Params{
+	Name:        "mainnet",
+	Net:         0xd9b4bef9,
+	DefaultPort: "8333",
+	DNSSeeds: []string{
+		"seed.bitcoin.sipa.be",
+		"dnsseed.bluematt.me",
+		"dnsseed.bitcoin.dashjr-list-of-p2p-nodes.us",
+		"seed.bitcoinstats.com",
+		"seed.bitcoin.jonasschnelli.ch",
+		"seed.btc.petertodd.net",
+		"seed.bitcoin.sprovoost.nl",
+		"dnsseed.emzy.de",
+		"seed.bitcoin.wiz.biz",
+	},
+
+	GenesisBlock: mustDecodeHex("0100000000000000000000000000000000000000000000000000000000000000000000003ba3edfd7a7b12b27ac72c3e67768f617fc81bc3888a51323a9fb8aa4b1e5e4a29ab5f49ffff001d1dac2b7c"),
+	GenesisHash:  "000000000019d6689c085ae165831e934ff763ae46a2a6c172b3f1b60a8ce26f",
+
+	PowLimit:                 mainPowLimit,
+	PowLimitBits:             []byte{0xff, 0xff, 0x00, 0x1d},
+	TargetTimespan:           targetTimespan,
+	TargetTimePerBlock:       targetTimePerBlock,
+	RetargetAdjustmentFactor: 4,
+
+	BIP34Height:  227931,
+	BIP65Height:  388381,
+	BIP66Height:  363725,
+	CSVHeight:    419328,
+	SegwitHeight: 481824,
+
+	PubKeyHashAddrID: 0x00,
+	ScriptHashAddrID: 0x05,
+	PrivateKeyID:     0x80,
+	Bech32HRP:        "bc",
+
+	HDPrivateKeyID:       [4]byte{0x04, 0x88, 0xad, 0xe4},
+	HDPublicKeyID:        [4]byte{0x04, 0x88, 0xb2, 0x1e},
+	HDSegwitPrivateKeyID: [4]byte{0x04, 0xb2, 0x43, 0x0c},
+	HDSegwitPublicKeyID:  [4]byte{0x04, 0xb2, 0x47, 0x46},
+}
+
+var TestNet3Params = Params{
+	Name:        "testnet3",
+	Net:         0x0709110b,
+	DefaultPort: "18333",
+	DNSSeeds: []string{
+		"testnet-seed.bitcoin.jonasschnelli.ch",
+		"seed.tbtc.petertodd.net",
+		"seed.testnet.bitcoin.sprovoost.nl",
+		"testnet-seed.bluematt.me",
+	},
+
+	GenesisBlock: mustDecodeHex("0100000000000000000000000000000000000000000000000000000000000000000000003ba3edfd7a7b12b27ac72c3e67768f617fc81bc3888a51323a9fb8aa4b1e5e4adae5494dffff001d1aa4ae18"),
+	GenesisHash:  "000000000933ea01ad0ee984209779baaec3ced90fa3f408719526f8d77f4943",
+
+	PowLimit:                 mainPowLimit,
+	PowLimitBits:             []byte{0xff, 0xff, 0x00, 0x1d},
+	TargetTimespan:           targetTimespan,
+	TargetTimePerBlock:       targetTimePerBlock,
+	RetargetAdjustmentFactor: 4,
+	ReduceMinDifficulty:      true,
+	MinDiffReductionTime:     targetTimePerBlock * 2,
+
+	BIP34Height:  21111,
+	BIP65Height:  581885,
+	BIP66Height:  330776,
+	CSVHeight:    770112,
+	SegwitHeight: 834624,
+
+	PubKeyHashAddrID: 0x6f,
+	ScriptHashAddrID: 0xc4,
+	PrivateKeyID:     0xef,
+	Bech32HRP:        "tb",
+
+	HDPrivateKeyID:       [4]byte{0x04, 0x35, 0x83, 0x94},
+	HDPublicKeyID:        [4]byte{0x04, 0x35, 0x87, 0xcf},
+	HDSegwitPrivateKeyID: [4]byte{0x04, 0x5f, 0x18, 0xbc},
+	HDSegwitPublicKeyID:  [4]byte{0x04, 0x5f, 0x1c, 0xf6},
+}
+
+var TestNet4Params = Params{
+	Name:        "testnet4",
+	Net:         0x283f161c,
+	DefaultPort: "48333",
+	DNSSeeds: []string{
+		"seed.testnet4.bitcoin.sprovoost.nl",
+		"seed.testnet4.wiz.biz",
+	},
+
+	GenesisBlock: mustDecodeHex("0100000000000000000000000000000000000000000000000000000000000000000000004e7b2b9128fe0291db0693af2ae418b767e657cd407e80cb1434221eaea7a07a046f3566ffff001dbb0c7817"),
+	GenesisHash:  "00000000da84f2bafbbc53dee25a72ae507ff4914b867c565be350b0da8bf043",
+
+	PowLimit:                 mainPowLimit,
+	PowLimitBits:             []byte{0xff, 0xff, 0x00, 0x1d},
+	TargetTimespan:           targetTimespan,
+	TargetTimePerBlock:       targetTimePerBlock,
+	RetargetAdjustmentFactor: 4,
+	ReduceMinDifficulty:      true,
+	MinDiffReductionTime:     targetTimePerBlock * 2,
+	EnforceBIP94:             true,
+
+	BIP34Height:  1,
+	BIP65Height:  1,
+	BIP66Height:  1,
+	CSVHeight:    1,
+	SegwitHeight: 1,
+
+	PubKeyHashAddrID: 0x6f,
+	ScriptHashAddrID: 0xc4,
+	PrivateKeyID:     0xef,
+	Bech32HRP:        "tb",
+
+	HDPrivateKeyID:       [4]byte{0x04, 0x35, 0x83, 0x94},
+	HDPublicKeyID:        [4]byte{0x04, 0x35, 0x87, 0xcf},
+	HDSegwitPrivateKeyID: [4]byte{0x04, 0x5f, 0x18, 0xbc},
+	HDSegwitPublicKeyID:  [4]byte{0x04, 0x5f, 0x1c, 0xf6},
+}
+
+// SigNetParams are the parameters of the default signet.
+var SigNetParams = Params{
+	Name:        "signet",
+	Net:         0x40cf030a,
+	DefaultPort: "38333",
+	DNSSeeds: []string{
+		"seed.signet.bitcoin.sprovoost.nl",
+	},
+
+	GenesisBlock: mustDecodeHex("0100000000000000000000000000000000000000000000000000000000000000000000003ba3edfd7a7b12b27ac72c3e67768f617fc81bc3888a51323a9fb8aa4b1e5e4a008f4d5fae77031e8ad22203"),
+	GenesisHash:  "00000008819873e925422c1ff0f99f7cc9bbb232af63a077a480a3633bee1ef6",
+
+	PowLimit:                 signetPowLimit,
+	PowLimitBits:             []byte{0xae, 0x77, 0x03, 0x1e},
+	TargetTimespan:           targetTimespan,
+	TargetTimePerBlock:       targetTimePerBlock,
+	RetargetAdjustmentFactor: 4,
+
+	BIP34Height:  1,
+	BIP65Height:  1,
+	BIP66Height:  1,
+	CSVHeight:    1,
+	SegwitHeight: 1,
+
+	PubKeyHashAddrID: 0x6f,
+	ScriptHashAddrID: 0xc4,
+	PrivateKeyID:     0xef,
+	Bech32HRP:        "tb",
+
+	HDPrivateKeyID:       [4]byte{0x04, 0x35, 0x83, 0x94},
+	HDPublicKeyID:        [4]byte{0x04, 0x35, 0x87, 0xcf},
+	HDSegwitPrivateKeyID: [4]byte{0x04, 0x5f, 0x18, 0xbc},
+	HDSegwitPublicKeyID:  [4]byte{0x04, 0x5f, 0x1c, 0xf6},
+}
+
+var RegressionNetParams = Params{
+	Name:        "regtest",
+	Net:         0xdab5bffa,
+	DefaultPort: "18444",
+	DNSSeeds:    []string{},
+
+	GenesisBlock: mustDecodeHex("0100000000000000000000000000000000000000000000000000000000000000000000003ba3edfd7a7b12b27ac72c3e67768f617fc81bc3888a51323a9fb8aa4b1e5e4adae5494dffff7f2002000000"),
+	GenesisHash:  "0f9188f13cb7b2c71f2a335e3a4fc328bf5beb436012afca590b1a11466e2206",
+
+	PowLimit:                 regPowLimit,
+	PowLimitBits:             []byte{0xff, 0xff, 0x7f, 0x20},
+	TargetTimespan:           targetTimespan,
+	TargetTimePerBlock:       targetTimePerBlock,
+	RetargetAdjustmentFactor: 4,
+	ReduceMinDifficulty:      true,
+	MinDiffReductionTime:     targetTimePerBlock * 2,
+	PoWNoRetargeting:         true,
+
+	BIP34Height:  1,
+	BIP65Height:  1,
+	BIP66Height:  1,
+	CSVHeight:    1,
+	SegwitHeight: 0,
+
+	PubKeyHashAddrID: 0x6f,
+	ScriptHashAddrID: 0xc4,
+	PrivateKeyID:     0xef,
+	Bech32HRP:        "bcrt",
+
+	HDPrivateKeyID:       [4]byte{0x04, 0x35, 0x83, 0x94},
+	HDPublicKeyID:        [4]byte{0x04, 0x35, 0x87, 0xcf},
+	HDSegwitPrivateKeyID: [4]byte{0x04, 0x5f, 0x18, 0xbc},
+	HDSegwitPublicKeyID:  [4]byte{0x04, 0x5f, 0x1c, 0xf6},
+}
+
+// Networks are the known networks, mainnet first.
+var Networks = []*Params{
+	&MainNetParams,
+	&TestNet3Params,
+	&TestNet4Params,
+	&SigNetParams,
+	&RegressionNetParams,
+}
+
+// ParamsByName returns the network called name.
+func ParamsByName(name string) (*Params, error) {
+	for _, p := range Networks {
+		if p.Name == name {
+			return p, nil
+		}
+	}
+
+	return nil, ErrUnknownNetwork
+}
+
+func newPowLimit(s string) *big.Int {
+	return new(big.Int).SetBytes(mustDecodeHex(s))
+}
+
+func mustDecodeHex(s string) []byte {
+	b, err := hex.DecodeString(s)
+	if err != nil {
+		panic(err)
+	}
+
+	return b
+}
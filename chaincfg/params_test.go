@@ -0,0 +1,39 @@
+package chaincfg
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"reflect"
+	"testing"
+)
+
+func TestGenesisHash(t *testing.T) {
+	for _, p := range Networks {
+		first := sha256.Sum256(p.GenesisBlock)
+		hash := sha256.Sum256(first[:])
+		for i, j := 0, len(hash)-1; i < j; i, j = i+1, j-1 {
+			hash[i], hash[j] = hash[j], hash[i]
+		}
+		check(p.GenesisHash, hex.EncodeToString(hash[:]), t)
+
+		// every genesis block is mined at the proof of work limit
+		check(p.PowLimitBits, p.GenesisBlock[72:76], t)
+	}
+}
+
+func TestParamsByName(t *testing.T) {
+	p, err := ParamsByName("signet")
+	check(nil, err, t)
+	check(&SigNetParams, p, t)
+	check(int64(2016), p.RetargetInterval(), t)
+
+	_, err = ParamsByName("testnet")
+	check(ErrUnknownNetwork, err, t)
+}
+
+func check(expected, recived interface{}, t *testing.T) {
+	t.Helper()
+	if !reflect.DeepEqual(recived, expected) {
+		t.Errorf("Received\n%+v\ndoesn't match expected\n%+v\n", recived, expected)
+	}
+}
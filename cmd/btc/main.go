@@ -0,0 +1,37 @@
+// Command btc is a toolbox for working with bitcoin scripts and
+// transactions.
+//
+//	btc script debug [flags] SCRIPTSIG SCRIPTPUBKEY
+//	btc script debug [flags] -tx HEX [-input N] [-network NAME]
+package main
+
+import (
+	"fmt"
+	"os"
+)
+
+func usage() {
+	fmt.Fprintln(os.Stderr, `usage:
+	btc script debug [flags] SCRIPTSIG SCRIPTPUBKEY
+	btc script debug [flags] -tx HEX [-input N] [-network NAME]`)
+	os.Exit(2)
+}
+
+func main() {
+	if len(os.Args) < 3 {
+		usage()
+	}
+
+	var err error
+	switch os.Args[1] + " " + os.Args[2] {
+	case "script debug":
+		err = scriptDebug(os.Args[3:])
+	default:
+		usage()
+	}
+
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "btc:", err)
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,188 @@
+package main
+
+import (
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"flag"
+	"fmt"
+	"strings"
+
+	"github.com/lobiCode/prog_btc_go/chaincfg"
+	"github.com/lobiCode/prog_btc_go/script"
+	"github.com/lobiCode/prog_btc_go/tx"
+)
+
+var errNoTx = errors.New("signature checks need a transaction, use -tx")
+
+// scriptDebug steps through the scripts of a spend, printing the next
+// instruction and the stacks before each step like btcdeb does.
+func scriptDebug(args []string) error {
+	fs := flag.NewFlagSet("script debug", flag.ExitOnError)
+	flagsS := fs.String("flags", "MANDATORY", "comma separated verify flags, MANDATORY or STANDARD")
+	witnessS := fs.String("witness", "", "comma separated hex witness items")
+	txS := fs.String("tx", "", "hex of the spending transaction")
+	input := fs.Int("input", 0, "index of the input to debug")
+	network := fs.String("network", "mainnet", "network to fetch the previous output from")
+	fs.Parse(args)
+
+	flags, err := parseFlags(*flagsS)
+	if err != nil {
+		return err
+	}
+
+	params, err := chaincfg.ParamsByName(*network)
+	if err != nil {
+		return err
+	}
+
+	var engine *script.Engine
+	if *txS != "" {
+		engine, err = txEngine(*txS, *input, params, flags)
+	} else {
+		engine, err = scriptsEngine(fs.Args(), *witnessS, flags)
+	}
+	if err != nil {
+		return err
+	}
+
+	step := 0
+	engine.SetTraceHook(func(e *script.Engine) {
+		step++
+		printStep(step, e)
+	})
+
+	err = engine.Execute()
+	fmt.Println("final stack")
+	printStack(engine.Stack())
+	if err != nil {
+		return err
+	}
+	fmt.Println("ok")
+
+	return nil
+}
+
+func parseFlags(s string) (script.ScriptFlags, error) {
+	switch s {
+	case "MANDATORY":
+		return script.MANDATORY_SCRIPT_VERIFY_FLAGS, nil
+	case "STANDARD":
+		return script.STANDARD_SCRIPT_VERIFY_FLAGS, nil
+	}
+
+	return script.ParseScriptFlags(s)
+}
+
+func txEngine(txHex string, input int, params *chaincfg.Params, flags script.ScriptFlags) (*script.Engine, error) {
+	raw, err := hex.DecodeString(txHex)
+	if err != nil {
+		return nil, err
+	}
+
+	transaction, err := tx.ParseTx(bytes.NewReader(raw))
+	if err != nil {
+		return nil, err
+	}
+
+	if input < 0 || input >= len(transaction.TxIns) {
+		return nil, fmt.Errorf("no input %d", input)
+	}
+
+	return transaction.NewEngine(tx.NewExplorerFetcher(params), input, flags)
+}
+
+// scriptsEngine runs the scripts given in asm outside of a transaction.
+func scriptsEngine(args []string, witnessS string, flags script.ScriptFlags) (*script.Engine, error) {
+	if len(args) != 2 {
+		usage()
+	}
+
+	scriptSig, err := script.ParseASM(args[0])
+	if err != nil {
+		return nil, err
+	}
+
+	scriptPubKey, err := script.ParseASM(args[1])
+	if err != nil {
+		return nil, err
+	}
+
+	var witness [][]byte
+	for _, item := range strings.Split(witnessS, ",") {
+		if item == "" {
+			continue
+		}
+		b, err := hex.DecodeString(item)
+		if err != nil {
+			return nil, err
+		}
+		witness = append(witness, b)
+	}
+
+	txContext := &script.TxContext{
+		SigHash: func(hashType uint32, ext *script.SigHashExt) ([]byte, error) {
+			return nil, errNoTx
+		},
+	}
+
+	return script.NewEngine(txContext, scriptSig, scriptPubKey, witness, flags)
+}
+
+func printStep(step int, e *script.Engine) {
+	op, data, ok := e.Opcode()
+
+	instruction := "<push past the end of the script>"
+	if ok {
+		instruction = instructionString(op, data)
+	}
+	// conditionals run in branches that aren't taken too
+	if !e.Executing() && (op < 99 || op > 104) {
+		instruction += " (not executed)"
+	}
+
+	fmt.Printf("#%04d %s @%d: %s\n", step, e.Phase(), e.PC(), instruction)
+	if branches := e.Branches(); len(branches) > 0 {
+		fmt.Printf("      branches %v\n", branches)
+	}
+	printStack(e.Stack())
+	if alt := e.AltStack(); len(alt) > 0 {
+		fmt.Println("      altstack")
+		for i := len(alt) - 1; i >= 0; i-- {
+			fmt.Printf("        %s\n", itemString(alt[i]))
+		}
+	}
+}
+
+// printStack prints the stack top first.
+func printStack(stack [][]byte) {
+	if len(stack) == 0 {
+		fmt.Println("      stack empty")
+		return
+	}
+
+	fmt.Println("      stack")
+	for i := len(stack) - 1; i >= 0; i-- {
+		fmt.Printf("        %s\n", itemString(stack[i]))
+	}
+}
+
+func instructionString(op byte, data []byte) string {
+	if op > 0 && op <= 78 {
+		return "PUSH " + itemString(data)
+	}
+
+	if name := script.GetOpCodeName(op); name != "" {
+		return name
+	}
+
+	return fmt.Sprintf("0x%02x", op)
+}
+
+func itemString(b []byte) string {
+	if len(b) == 0 {
+		return "<empty>"
+	}
+
+	return hex.EncodeToString(b)
+}
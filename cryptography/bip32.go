@@ -0,0 +1,285 @@
+package cryptography
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha512"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math/big"
+	"strconv"
+	"strings"
+
+	u "github.com/lobiCode/prog_btc_go/btcutils"
+	"github.com/lobiCode/prog_btc_go/chaincfg"
+	ec "github.com/lobiCode/prog_btc_go/ellipticcurve"
+)
+
+var ErrExtendedKey = errors.New("invalid extended key")
+var ErrHardenedFromPublic = errors.New("hardened child of a public extended key")
+var ErrDerivation = errors.New("child key derivation produced an invalid key")
+var ErrSeedLength = errors.New("seed must be 16 to 64 bytes")
+var ErrPath = errors.New("invalid derivation path")
+
+// HardenedKeyStart is the first hardened child index.
+const HardenedKeyStart uint32 = 0x80000000
+
+const extendedKeySize = 78
+
+var masterKey = []byte("Bitcoin seed")
+
+// ExtendedKey is a BIP32 extended private or public key.
+type ExtendedKey struct {
+	Depth             byte
+	ParentFingerprint []byte
+	ChildNumber       uint32
+	ChainCode         []byte
+	Params            *chaincfg.Params
+	// Segwit keys serialize with the BIP84 versions, zprv and zpub
+	Segwit bool
+
+	privateKey *PrivateKey
+	publicKey  *ec.Point
+}
+
+// NewMasterKey returns the master key of the seed.
+func NewMasterKey(seed []byte, params *chaincfg.Params) (*ExtendedKey, error) {
+	if len(seed) < 16 || len(seed) > 64 {
+		return nil, ErrSeedLength
+	}
+
+	mac := hmac.New(sha512.New, masterKey)
+	mac.Write(seed)
+	sum := mac.Sum(nil)
+
+	secret := new(big.Int).SetBytes(sum[:32])
+	if !inScalarRange(secret) {
+		return nil, ErrDerivation
+	}
+	privateKey := NewPrivateKey(secret)
+
+	return &ExtendedKey{
+		ParentFingerprint: make([]byte, 4),
+		ChainCode:         sum[32:],
+		Params:            params,
+		privateKey:        privateKey,
+		publicKey:         privateKey.point,
+	}, nil
+}
+
+// ParseExtendedKey parses a base58 extended key with the versions of the
+// network, xprv and xpub on mainnet, tprv and tpub on the test networks, or
+// with the BIP84 ones.
+func ParseExtendedKey(s string, params *chaincfg.Params) (*ExtendedKey, error) {
+	b, err := u.DecodeBase58Checksum(s)
+	if err != nil || len(b) != extendedKeySize {
+		return nil, ErrExtendedKey
+	}
+
+	version, key := b[:4], b[45:]
+	k := &ExtendedKey{
+		Depth:             b[4],
+		ParentFingerprint: b[5:9],
+		ChildNumber:       binary.BigEndian.Uint32(b[9:13]),
+		ChainCode:         b[13:45],
+		Params:            params,
+	}
+
+	if k.Depth == 0 && (k.ChildNumber != 0 || !bytes.Equal(k.ParentFingerprint, make([]byte, 4))) {
+		return nil, ErrExtendedKey
+	}
+
+	if bytes.Equal(version, params.HDSegwitPrivateKeyID[:]) || bytes.Equal(version, params.HDSegwitPublicKeyID[:]) {
+		k.Segwit = true
+	}
+
+	switch {
+	case bytes.Equal(version, params.HDPrivateKeyID[:]), bytes.Equal(version, params.HDSegwitPrivateKeyID[:]):
+		secret := u.ParseBytes(key[1:])
+		if key[0] != 0 || !inScalarRange(secret) {
+			return nil, ErrExtendedKey
+		}
+		k.privateKey = NewPrivateKey(secret)
+		k.publicKey = k.privateKey.point
+	case bytes.Equal(version, params.HDPublicKeyID[:]), bytes.Equal(version, params.HDSegwitPublicKeyID[:]):
+		if key[0] != 2 && key[0] != 3 {
+			return nil, ErrExtendedKey
+		}
+		if k.publicKey, err = ParsePublicKey(key); err != nil {
+			return nil, ErrExtendedKey
+		}
+	default:
+		return nil, ErrExtendedKey
+	}
+
+	return k, nil
+}
+
+// String returns the base58 serialization of the key.
+func (k *ExtendedKey) String() string {
+	privateID, publicID := k.Params.HDPrivateKeyID, k.Params.HDPublicKeyID
+	if k.Segwit {
+		privateID, publicID = k.Params.HDSegwitPrivateKeyID, k.Params.HDSegwitPublicKeyID
+	}
+
+	version, key := publicID, SerializePublicKey(k.publicKey)
+	if k.IsPrivate() {
+		version, key = privateID, append([]byte{0}, u.BigIntToBytes(k.privateKey.secret, 32)...)
+	}
+
+	b := append([]byte{}, version[:]...)
+	b = append(b, k.Depth)
+	b = append(b, k.ParentFingerprint...)
+	b = append(b, u.MustEncodeNumBigEndian(k.ChildNumber)...)
+	b = append(b, k.ChainCode...)
+	b = append(b, key...)
+
+	return u.EncodeBase58Checksum(b)
+}
+
+func (k *ExtendedKey) IsPrivate() bool {
+	return k.privateKey != nil
+}
+
+// PrivateKey returns the private key, nil for a public extended key.
+func (k *ExtendedKey) PrivateKey() *PrivateKey {
+	return k.privateKey
+}
+
+func (k *ExtendedKey) PublicKey() *ec.Point {
+	return k.publicKey
+}
+
+// Fingerprint returns the first 4 bytes of the hash160 of the public key.
+func (k *ExtendedKey) Fingerprint() []byte {
+	return u.Hash160(SerializePublicKey(k.publicKey))[:4]
+}
+
+// Neuter returns the public extended key of k.
+func (k *ExtendedKey) Neuter() *ExtendedKey {
+	n := *k
+	n.privateKey = nil
+
+	return &n
+}
+
+// Child derives the child key at index i, the indexes from HardenedKeyStart
+// on are hardened and need a private key.
+func (k *ExtendedKey) Child(i uint32) (*ExtendedKey, error) {
+	var data []byte
+	if i >= HardenedKeyStart {
+		if !k.IsPrivate() {
+			return nil, ErrHardenedFromPublic
+		}
+		data = append([]byte{0}, u.BigIntToBytes(k.privateKey.secret, 32)...)
+	} else {
+		data = SerializePublicKey(k.publicKey)
+	}
+	data = append(data, u.MustEncodeNumBigEndian(i)...)
+
+	mac := hmac.New(sha512.New, k.ChainCode)
+	mac.Write(data)
+	sum := mac.Sum(nil)
+
+	tweak := new(big.Int).SetBytes(sum[:32])
+	if tweak.Cmp(ec.BTCCurve.N) >= 0 {
+		return nil, ErrDerivation
+	}
+
+	child := &ExtendedKey{
+		Depth:             k.Depth + 1,
+		ParentFingerprint: k.Fingerprint(),
+		ChildNumber:       i,
+		ChainCode:         sum[32:],
+		Params:            k.Params,
+		Segwit:            k.Segwit,
+	}
+
+	if k.IsPrivate() {
+		secret := u.ModInt(u.AddInt(k.privateKey.secret, tweak), ec.BTCCurve.N)
+		if secret.Sign() == 0 {
+			return nil, ErrDerivation
+		}
+		child.privateKey = NewPrivateKey(secret)
+		child.publicKey = child.privateKey.point
+	} else {
+		child.publicKey = ec.Add(ec.RMul(ec.BTCCurve.G, tweak), k.publicKey)
+		if child.publicKey.GetX() == nil {
+			return nil, ErrDerivation
+		}
+	}
+
+	return child, nil
+}
+
+// Derive derives the descendant of k at path, relative to k.
+func (k *ExtendedKey) Derive(path []uint32) (*ExtendedKey, error) {
+	var err error
+	for _, i := range path {
+		if k, err = k.Child(i); err != nil {
+			return nil, err
+		}
+	}
+
+	return k, nil
+}
+
+// DerivePath derives the key at a path like m/84'/1'/0'/0/5 from the master
+// key k.
+func (k *ExtendedKey) DerivePath(path string) (*ExtendedKey, error) {
+	if k.Depth != 0 {
+		return nil, ErrPath
+	}
+
+	indexes, err := ParsePath(path)
+	if err != nil {
+		return nil, err
+	}
+
+	return k.Derive(indexes)
+}
+
+// ParsePath parses a derivation path starting with m, hardened indexes end
+// with ' or h.
+func ParsePath(path string) ([]uint32, error) {
+	elements := strings.Split(path, "/")
+	if elements[0] != "m" {
+		return nil, ErrPath
+	}
+
+	indexes := []uint32{}
+	for _, e := range elements[1:] {
+		hardened := strings.HasSuffix(e, "'") || strings.HasSuffix(e, "h")
+		if hardened {
+			e = e[:len(e)-1]
+		}
+
+		i, err := strconv.ParseUint(e, 10, 32)
+		if err != nil || uint32(i) >= HardenedKeyStart {
+			return nil, ErrPath
+		}
+		if hardened {
+			i += uint64(HardenedKeyStart)
+		}
+		indexes = append(indexes, uint32(i))
+	}
+
+	return indexes, nil
+}
+
+// PathString returns path in the form ParsePath reads, with ' for the
+// hardened indexes.
+func PathString(path []uint32) string {
+	var b strings.Builder
+	b.WriteString("m")
+	for _, i := range path {
+		if i >= HardenedKeyStart {
+			fmt.Fprintf(&b, "/%d'", i-HardenedKeyStart)
+		} else {
+			fmt.Fprintf(&b, "/%d", i)
+		}
+	}
+
+	return b.String()
+}
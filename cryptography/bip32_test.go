@@ -0,0 +1,252 @@
+package cryptography
+
+import (
+	"encoding/hex"
+	"strings"
+	"testing"
+
+	u "github.com/lobiCode/prog_btc_go/btcutils"
+	"github.com/lobiCode/prog_btc_go/chaincfg"
+)
+
+var bip32Vectors = []struct {
+	seed string
+	path string
+	xpub string
+	xprv string
+}{
+	// test vector 1
+	{
+		"000102030405060708090a0b0c0d0e0f",
+		"m",
+		"xpub661MyMwAqRbcFtXgS5sYJABqqG9YLmC4Q1Rdap9gSE8NqtwybGhePY2gZ29ESFjqJoCu1Rupje8YtGqsefD265TMg7usUDFdp6W1EGMcet8",
+		"xprv9s21ZrQH143K3QTDL4LXw2F7HEK3wJUD2nW2nRk4stbPy6cq3jPPqjiChkVvvNKmPGJxWUtg6LnF5kejMRNNU3TGtRBeJgk33yuGBxrMPHi",
+	},
+	{
+		"000102030405060708090a0b0c0d0e0f",
+		"m/0'",
+		"xpub68Gmy5EdvgibQVfPdqkBBCHxA5htiqg55crXYuXoQRKfDBFA1WEjWgP6LHhwBZeNK1VTsfTFUHCdrfp1bgwQ9xv5ski8PX9rL2dZXvgGDnw",
+		"xprv9uHRZZhk6KAJC1avXpDAp4MDc3sQKNxDiPvvkX8Br5ngLNv1TxvUxt4cV1rGL5hj6KCesnDYUhd7oWgT11eZG7XnxHrnYeSvkzY7d2bhkJ7",
+	},
+	{
+		"000102030405060708090a0b0c0d0e0f",
+		"m/0'/1",
+		"xpub6ASuArnXKPbfEwhqN6e3mwBcDTgzisQN1wXN9BJcM47sSikHjJf3UFHKkNAWbWMiGj7Wf5uMash7SyYq527Hqck2AxYysAA7xmALppuCkwQ",
+		"xprv9wTYmMFdV23N2TdNG573QoEsfRrWKQgWeibmLntzniatZvR9BmLnvSxqu53Kw1UmYPxLgboyZQaXwTCg8MSY3H2EU4pWcQDnRnrVA1xe8fs",
+	},
+	{
+		"000102030405060708090a0b0c0d0e0f",
+		"m/0'/1/2'",
+		"xpub6D4BDPcP2GT577Vvch3R8wDkScZWzQzMMUm3PWbmWvVJrZwQY4VUNgqFJPMM3No2dFDFGTsxxpG5uJh7n7epu4trkrX7x7DogT5Uv6fcLW5",
+		"xprv9z4pot5VBttmtdRTWfWQmoH1taj2axGVzFqSb8C9xaxKymcFzXBDptWmT7FwuEzG3ryjH4ktypQSAewRiNMjANTtpgP4mLTj34bhnZX7UiM",
+	},
+	{
+		"000102030405060708090a0b0c0d0e0f",
+		"m/0'/1/2'/2",
+		"xpub6FHa3pjLCk84BayeJxFW2SP4XRrFd1JYnxeLeU8EqN3vDfZmbqBqaGJAyiLjTAwm6ZLRQUMv1ZACTj37sR62cfN7fe5JnJ7dh8zL4fiyLHV",
+		"xprvA2JDeKCSNNZky6uBCviVfJSKyQ1mDYahRjijr5idH2WwLsEd4Hsb2Tyh8RfQMuPh7f7RtyzTtdrbdqqsunu5Mm3wDvUAKRHSC34sJ7in334",
+	},
+	{
+		"000102030405060708090a0b0c0d0e0f",
+		"m/0'/1/2'/2/1000000000",
+		"xpub6H1LXWLaKsWFhvm6RVpEL9P4KfRZSW7abD2ttkWP3SSQvnyA8FSVqNTEcYFgJS2UaFcxupHiYkro49S8yGasTvXEYBVPamhGW6cFJodrTHy",
+		"xprvA41z7zogVVwxVSgdKUHDy1SKmdb533PjDz7J6N6mV6uS3ze1ai8FHa8kmHScGpWmj4WggLyQjgPie1rFSruoUihUZREPSL39UNdE3BBDu76",
+	},
+	// test vector 2
+	{
+		"fffcf9f6f3f0edeae7e4e1dedbd8d5d2cfccc9c6c3c0bdbab7b4b1aeaba8a5a29f9c999693908d8a8784817e7b7875726f6c696663605d5a5754514e4b484542",
+		"m",
+		"xpub661MyMwAqRbcFW31YEwpkMuc5THy2PSt5bDMsktWQcFF8syAmRUapSCGu8ED9W6oDMSgv6Zz8idoc4a6mr8BDzTJY47LJhkJ8UB7WEGuduB",
+		"xprv9s21ZrQH143K31xYSDQpPDxsXRTUcvj2iNHm5NUtrGiGG5e2DtALGdso3pGz6ssrdK4PFmM8NSpSBHNqPqm55Qn3LqFtT2emdEXVYsCzC2U",
+	},
+	{
+		"fffcf9f6f3f0edeae7e4e1dedbd8d5d2cfccc9c6c3c0bdbab7b4b1aeaba8a5a29f9c999693908d8a8784817e7b7875726f6c696663605d5a5754514e4b484542",
+		"m/0",
+		"xpub69H7F5d8KSRgmmdJg2KhpAK8SR3DjMwAdkxj3ZuxV27CprR9LgpeyGmXUbC6wb7ERfvrnKZjXoUmmDznezpbZb7ap6r1D3tgFxHmwMkQTPH",
+		"xprv9vHkqa6EV4sPZHYqZznhT2NPtPCjKuDKGY38FBWLvgaDx45zo9WQRUT3dKYnjwih2yJD9mkrocEZXo1ex8G81dwSM1fwqWpWkeS3v86pgKt",
+	},
+	{
+		"fffcf9f6f3f0edeae7e4e1dedbd8d5d2cfccc9c6c3c0bdbab7b4b1aeaba8a5a29f9c999693908d8a8784817e7b7875726f6c696663605d5a5754514e4b484542",
+		"m/0/2147483647'",
+		"xpub6ASAVgeehLbnwdqV6UKMHVzgqAG8Gr6riv3Fxxpj8ksbH9ebxaEyBLZ85ySDhKiLDBrQSARLq1uNRts8RuJiHjaDMBU4Zn9h8LZNnBC5y4a",
+		"xprv9wSp6B7kry3Vj9m1zSnLvN3xH8RdsPP1Mh7fAaR7aRLcQMKTR2vidYEeEg2mUCTAwCd6vnxVrcjfy2kRgVsFawNzmjuHc2YmYRmagcEPdU9",
+	},
+	{
+		"fffcf9f6f3f0edeae7e4e1dedbd8d5d2cfccc9c6c3c0bdbab7b4b1aeaba8a5a29f9c999693908d8a8784817e7b7875726f6c696663605d5a5754514e4b484542",
+		"m/0/2147483647'/1",
+		"xpub6DF8uhdarytz3FWdA8TvFSvvAh8dP3283MY7p2V4SeE2wyWmG5mg5EwVvmdMVCQcoNJxGoWaU9DCWh89LojfZ537wTfunKau47EL2dhHKon",
+		"xprv9zFnWC6h2cLgpmSA46vutJzBcfJ8yaJGg8cX1e5StJh45BBciYTRXSd25UEPVuesF9yog62tGAQtHjXajPPdbRCHuWS6T8XA2ECKADdw4Ef",
+	},
+	{
+		"fffcf9f6f3f0edeae7e4e1dedbd8d5d2cfccc9c6c3c0bdbab7b4b1aeaba8a5a29f9c999693908d8a8784817e7b7875726f6c696663605d5a5754514e4b484542",
+		"m/0/2147483647'/1/2147483646'",
+		"xpub6ERApfZwUNrhLCkDtcHTcxd75RbzS1ed54G1LkBUHQVHQKqhMkhgbmJbZRkrgZw4koxb5JaHWkY4ALHY2grBGRjaDMzQLcgJvLJuZZvRcEL",
+		"xprvA1RpRA33e1JQ7ifknakTFpgNXPmW2YvmhqLQYMmrj4xJXXWYpDPS3xz7iAxn8L39njGVyuoseXzU6rcxFLJ8HFsTjSyQbLYnMpCqE2VbFWc",
+	},
+	{
+		"fffcf9f6f3f0edeae7e4e1dedbd8d5d2cfccc9c6c3c0bdbab7b4b1aeaba8a5a29f9c999693908d8a8784817e7b7875726f6c696663605d5a5754514e4b484542",
+		"m/0/2147483647'/1/2147483646'/2",
+		"xpub6FnCn6nSzZAw5Tw7cgR9bi15UV96gLZhjDstkXXxvCLsUXBGXPdSnLFbdpq8p9HmGsApME5hQTZ3emM2rnY5agb9rXpVGyy3bdW6EEgAtqt",
+		"xprvA2nrNbFZABcdryreWet9Ea4LvTJcGsqrMzxHx98MMrotbir7yrKCEXw7nadnHM8Dq38EGfSh6dqA9QWTyefMLEcBYJUuekgW4BYPJcr9E7j",
+	},
+	// test vector 3
+	{
+		"4b381541583be4423346c643850da4b320e46a87ae3d2a4e6da11eba819cd4acba45d239319ac14f863b8d5ab5a0d0c64d2e8a1e7d1457df2e5a3c51c73235be",
+		"m",
+		"xpub661MyMwAqRbcEZVB4dScxMAdx6d4nFc9nvyvH3v4gJL378CSRZiYmhRoP7mBy6gSPSCYk6SzXPTf3ND1cZAceL7SfJ1Z3GC8vBgp2epUt13",
+		"xprv9s21ZrQH143K25QhxbucbDDuQ4naNntJRi4KUfWT7xo4EKsHt2QJDu7KXp1A3u7Bi1j8ph3EGsZ9Xvz9dGuVrtHHs7pXeTzjuxBrCmmhgC6",
+	},
+	{
+		"4b381541583be4423346c643850da4b320e46a87ae3d2a4e6da11eba819cd4acba45d239319ac14f863b8d5ab5a0d0c64d2e8a1e7d1457df2e5a3c51c73235be",
+		"m/0'",
+		"xpub68NZiKmJWnxxS6aaHmn81bvJeTESw724CRDs6HbuccFQN9Ku14VQrADWgqbhhTHBaohPX4CjNLf9fq9MYo6oDaPPLPxSb7gwQN3ih19Zm4Y",
+		"xprv9uPDJpEQgRQfDcW7BkF7eTya6RPxXeJCqCJGHuCJ4GiRVLzkTXBAJMu2qaMWPrS7AANYqdq6vcBcBUdJCVVFceUvJFjaPdGZ2y9WACViL4L",
+	},
+	// test vector 4
+	{
+		"3ddd5602285899a946114506157c7997e5444528f3003f6134712147db19b678",
+		"m",
+		"xpub661MyMwAqRbcGczjuMoRm6dXaLDEhW1u34gKenbeYqAix21mdUKJyuyu5F1rzYGVxyL6tmgBUAEPrEz92mBXjByMRiJdba9wpnN37RLLAXa",
+		"xprv9s21ZrQH143K48vGoLGRPxgo2JNkJ3J3fqkirQC2zVdk5Dgd5w14S7fRDyHH4dWNHUgkvsvNDCkvAwcSHNAQwhwgNMgZhLtQC63zxwhQmRv",
+	},
+	{
+		"3ddd5602285899a946114506157c7997e5444528f3003f6134712147db19b678",
+		"m/0'",
+		"xpub69AUMk3qDBi3uW1sXgjCmVjJ2G6WQoYSnNHyzkmdCHEhSZ4tBok37xfFEqHd2AddP56Tqp4o56AePAgCjYdvpW2PU2jbUPFKsav5ut6Ch1m",
+		"xprv9vB7xEWwNp9kh1wQRfCCQMnZUEG21LpbR9NPCNN1dwhiZkjjeGRnaALmPXCX7SgjFTiCTT6bXes17boXtjq3xLpcDjzEuGLQBM5ohqkao9G",
+	},
+	{
+		"3ddd5602285899a946114506157c7997e5444528f3003f6134712147db19b678",
+		"m/0'/1'",
+		"xpub6BJA1jSqiukeaesWfxe6sNK9CCGaujFFSJLomWHprUL9DePQ4JDkM5d88n49sMGJxrhpjazuXYWdMf17C9T5XnxkopaeS7jGk1GyyVziaMt",
+		"xprv9xJocDuwtYCMNAo3Zw76WENQeAS6WGXQ55RCy7tDJ8oALr4FWkuVoHJeHVAcAqiZLE7Je3vZJHxspZdFHfnBEjHqU5hG1Jaj32dVoS6XLT1",
+	},
+}
+
+func TestBip32Vectors(t *testing.T) {
+	params := &chaincfg.MainNetParams
+	for _, v := range bip32Vectors {
+		seed, _ := hex.DecodeString(v.seed)
+		master, err := NewMasterKey(seed, params)
+		check(nil, err, t)
+
+		k, err := master.DerivePath(v.path)
+		check(nil, err, t)
+		check(v.xprv, k.String(), t)
+		check(v.xpub, k.Neuter().String(), t)
+
+		parsed, err := ParseExtendedKey(v.xprv, params)
+		check(nil, err, t)
+		check(v.xprv, parsed.String(), t)
+		parsed, err = ParseExtendedKey(v.xpub, params)
+		check(nil, err, t)
+		check(v.xpub, parsed.String(), t)
+		check(false, parsed.IsPrivate(), t)
+
+		// the public parent derives the same normal child
+		path, _ := ParsePath(v.path)
+		if n := len(path); n > 0 && path[n-1] < HardenedKeyStart {
+			parent, err := master.Derive(path[:n-1])
+			check(nil, err, t)
+			child, err := parent.Neuter().Child(path[n-1])
+			check(nil, err, t)
+			check(v.xpub, child.String(), t)
+		}
+	}
+}
+
+func TestParsePath(t *testing.T) {
+	path, err := ParsePath("m/84'/1'/0'/0/5")
+	check(nil, err, t)
+	check([]uint32{HardenedKeyStart + 84, HardenedKeyStart + 1, HardenedKeyStart, 0, 5}, path, t)
+	check("m/84'/1'/0'/0/5", PathString(path), t)
+
+	path, err = ParsePath("m/0h/2147483647")
+	check(nil, err, t)
+	check([]uint32{HardenedKeyStart, HardenedKeyStart - 1}, path, t)
+
+	path, err = ParsePath("m")
+	check(nil, err, t)
+	check([]uint32{}, path, t)
+
+	for _, s := range []string{"", "84'/0'", "m/", "m/x", "m/-1", "m/2147483648", "m/0''", "M/0"} {
+		_, err = ParsePath(s)
+		check(ErrPath, err, t)
+	}
+}
+
+func TestNewMasterKey(t *testing.T) {
+	_, err := NewMasterKey(make([]byte, 15), &chaincfg.MainNetParams)
+	check(ErrSeedLength, err, t)
+	_, err = NewMasterKey(make([]byte, 65), &chaincfg.MainNetParams)
+	check(ErrSeedLength, err, t)
+
+	master, _ := NewMasterKey(make([]byte, 16), &chaincfg.MainNetParams)
+	child, _ := master.Child(0)
+	_, err = child.DerivePath("m/0")
+	check(ErrPath, err, t)
+	_, err = master.Neuter().Child(HardenedKeyStart)
+	check(ErrHardenedFromPublic, err, t)
+}
+
+func TestExtendedKeyVersions(t *testing.T) {
+	seed, _ := hex.DecodeString(bip32Vectors[0].seed)
+	for _, v := range []struct {
+		params            *chaincfg.Params
+		private, public   string
+		segwit, segwitPub string
+	}{
+		{&chaincfg.MainNetParams, "xprv", "xpub", "zprv", "zpub"},
+		{&chaincfg.TestNet3Params, "tprv", "tpub", "vprv", "vpub"},
+	} {
+		master, _ := NewMasterKey(seed, v.params)
+		account, err := master.DerivePath("m/84'/1'/0'")
+		check(nil, err, t)
+		check(v.private, account.String()[:4], t)
+		check(v.public, account.Neuter().String()[:4], t)
+
+		account.Segwit = true
+		check(v.segwit, account.String()[:4], t)
+		zpub := account.Neuter().String()
+		check(v.segwitPub, zpub[:4], t)
+
+		parsed, err := ParseExtendedKey(zpub, v.params)
+		check(nil, err, t)
+		check(true, parsed.Segwit, t)
+		check(zpub, parsed.String(), t)
+
+		// children keep the versions of their parent
+		child, _ := parsed.Child(5)
+		check(v.segwitPub, child.String()[:4], t)
+	}
+}
+
+func TestParseExtendedKeyInvalid(t *testing.T) {
+	params := &chaincfg.MainNetParams
+	xprv := bip32Vectors[0].xprv
+	b, _ := u.DecodeBase58Checksum(xprv)
+
+	// a key of another network
+	_, err := ParseExtendedKey(xprv, &chaincfg.TestNet3Params)
+	check(ErrExtendedKey, err, t)
+
+	// a bad checksum
+	_, err = ParseExtendedKey(xprv[:len(xprv)-1]+"1", params)
+	check(ErrExtendedKey, err, t)
+
+	for _, modify := range []func(b []byte){
+		// a private key with a prefix other than zero
+		func(b []byte) { b[45] = 1 },
+		// a master key with a parent fingerprint
+		func(b []byte) { b[5] = 1 },
+		// a master key with a child number
+		func(b []byte) { b[12] = 1 },
+		// a private key out of range
+		func(b []byte) { copy(b[46:], strings.Repeat("\xff", 32)) },
+	} {
+		invalid := append([]byte{}, b...)
+		modify(invalid)
+		_, err = ParseExtendedKey(u.EncodeBase58Checksum(invalid), params)
+		check(ErrExtendedKey, err, t)
+	}
+}
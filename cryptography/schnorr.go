@@ -0,0 +1,157 @@
+package cryptography
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"math/big"
+
+	u "github.com/lobiCode/prog_btc_go/btcutils"
+	ec "github.com/lobiCode/prog_btc_go/ellipticcurve"
+	ff "github.com/lobiCode/prog_btc_go/finitefield"
+)
+
+// SchnorrSignature is a BIP340 signature, r is the x coordinate of the nonce
+// point.
+type SchnorrSignature struct {
+	r, s *big.Int
+}
+
+func (sig *SchnorrSignature) Serialize() []byte {
+	return append(u.BigIntToBytes(sig.r, 32), u.BigIntToBytes(sig.s, 32)...)
+}
+
+func (sig *SchnorrSignature) String() string {
+	return hex.EncodeToString(sig.Serialize())
+}
+
+func ParseSchnorrSignature(sig []byte) (*SchnorrSignature, error) {
+	if len(sig) != 64 {
+		return nil, ErrBadSigLength
+	}
+
+	r := u.ParseBytes(sig[:32])
+	s := u.ParseBytes(sig[32:])
+	if r.Cmp(ec.BTCCurve.P) >= 0 || s.Cmp(ec.BTCCurve.N) >= 0 {
+		return nil, ErrBadSig
+	}
+
+	return &SchnorrSignature{r, s}, nil
+}
+
+// TaggedHash returns sha256(sha256(tag) || sha256(tag) || data...).
+func TaggedHash(tag string, data ...[]byte) []byte {
+	tagHash := sha256.Sum256([]byte(tag))
+
+	h := sha256.New()
+	h.Write(tagHash[:])
+	h.Write(tagHash[:])
+	for _, d := range data {
+		h.Write(d)
+	}
+
+	return h.Sum(nil)
+}
+
+// SerializeXOnly returns the 32 byte x coordinate of the point.
+func SerializeXOnly(p *ec.Point) []byte {
+	return u.BigIntToBytes(p.GetX().GetNum(), 32)
+}
+
+// ParseXOnlyPublicKey returns the point with the given x coordinate and an
+// even y.
+func ParseXOnlyPublicKey(key []byte) (*ec.Point, error) {
+	if len(key) != 32 {
+		return nil, ErrPubKeyInvalidFormat
+	}
+
+	return liftX(u.ParseBytes(key))
+}
+
+func (pk *PrivateKey) XOnly() []byte {
+	return SerializeXOnly(pk.point)
+}
+
+func (pk *PrivateKey) SignSchnorr(msg []byte) *SchnorrSignature {
+	return pk.SignSchnorrWithAuxRand(msg, make([]byte, 32))
+}
+
+// SignSchnorrWithAuxRand signs msg as described in BIP340, auxRand should be
+// 32 bytes of fresh randomness.
+func (pk *PrivateKey) SignSchnorrWithAuxRand(msg, auxRand []byte) *SchnorrSignature {
+	n := ec.BTCCurve.N
+	d := pk.evenYSecret()
+	px := pk.XOnly()
+
+	t := u.BigIntToBytes(d, 32)
+	for i, b := range TaggedHash("BIP0340/aux", auxRand) {
+		t[i] ^= b
+	}
+
+	k := u.ModInt(u.ParseBytes(TaggedHash("BIP0340/nonce", t, px, msg)), n)
+	r := ec.RMul(ec.BTCCurve.G, k)
+	if !r.IsYeven() {
+		k = u.SubInt(n, k)
+	}
+
+	rx := SerializeXOnly(r)
+	e := schnorrChallenge(rx, px, msg)
+	s := u.ModInt(u.AddInt(k, u.MulInt(e, d)), n)
+
+	return &SchnorrSignature{r.GetX().GetNum(), s}
+}
+
+// VerifySchnorr checks the signature against the x-only form of publicKey.
+func VerifySchnorr(msg []byte, signature *SchnorrSignature, publicKey *ec.Point) bool {
+	n := ec.BTCCurve.N
+	if signature.r.Cmp(ec.BTCCurve.P) >= 0 || signature.s.Cmp(n) >= 0 {
+		return false
+	}
+
+	p, err := liftX(publicKey.GetX().GetNum())
+	if err != nil {
+		return false
+	}
+
+	e := schnorrChallenge(u.BigIntToBytes(signature.r, 32), SerializeXOnly(p), msg)
+	r := ec.Add(ec.RMul(ec.BTCCurve.G, signature.s), ec.RMul(p, u.SubInt(n, e)))
+	if r.GetX() == nil || !r.IsYeven() {
+		return false
+	}
+
+	return r.GetX().GetNum().Cmp(signature.r) == 0
+}
+
+// evenYSecret returns the secret of the key's even y twin, the one its x-only
+// public key stands for.
+func (pk *PrivateKey) evenYSecret() *big.Int {
+	if pk.point.IsYeven() {
+		return pk.secret
+	}
+
+	return u.SubInt(ec.BTCCurve.N, pk.secret)
+}
+
+func schnorrChallenge(rx, px, msg []byte) *big.Int {
+	return u.ModInt(u.ParseBytes(TaggedHash("BIP0340/challenge", rx, px, msg)), ec.BTCCurve.N)
+}
+
+func liftX(x *big.Int) (*ec.Point, error) {
+	if x.Cmp(ec.BTCCurve.P) >= 0 {
+		return nil, ErrPubKeyInvalidFormat
+	}
+
+	xf, err := ff.NewS256Field(x, ec.BTCCurve.P)
+	if err != nil {
+		return nil, err
+	}
+
+	yf := calculateY(xf)
+	if !yf.IsEven() {
+		yf, err = ff.NewS256Field(u.SubInt(ec.BTCCurve.P, yf.GetNum()), ec.BTCCurve.P)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return ec.NewS256Point(xf, yf)
+}
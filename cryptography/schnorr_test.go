@@ -0,0 +1,68 @@
+package cryptography
+
+import (
+	"encoding/csv"
+	"encoding/hex"
+	"os"
+	"strings"
+	"testing"
+
+	u "github.com/lobiCode/prog_btc_go/btcutils"
+)
+
+func TestSchnorrVectors(t *testing.T) {
+	f, err := os.Open("testdata/bip340_test_vectors.csv")
+	check(nil, err, t)
+	defer f.Close()
+
+	records, err := csv.NewReader(f).ReadAll()
+	check(nil, err, t)
+
+	for _, record := range records[1:] {
+		t.Run(record[0], func(t *testing.T) {
+			secretKey := record[1]
+			publicKey, _ := hex.DecodeString(record[2])
+			auxRand, _ := hex.DecodeString(record[3])
+			msg, _ := hex.DecodeString(record[4])
+			sigB, _ := hex.DecodeString(record[5])
+			expected := record[6] == "TRUE"
+
+			if secretKey != "" {
+				secret, _ := u.ParseInt(secretKey, 16)
+				pk := NewPrivateKey(secret)
+				check(strings.ToLower(record[2]), hex.EncodeToString(pk.XOnly()), t)
+				sig := pk.SignSchnorrWithAuxRand(msg, auxRand)
+				check(strings.ToLower(record[5]), sig.String(), t)
+			}
+
+			point, err := ParseXOnlyPublicKey(publicKey)
+			if err != nil {
+				check(false, expected, t)
+				return
+			}
+			sig, err := ParseSchnorrSignature(sigB)
+			if err != nil {
+				check(false, expected, t)
+				return
+			}
+			check(expected, VerifySchnorr(msg, sig, point), t)
+		})
+	}
+}
+
+func TestSignSchnorrOddY(t *testing.T) {
+	// the public key of secret 6 has an odd y, signing must use its negation
+	pk := NewPrivateKey(u.NewInt(6))
+	check(false, pk.point.IsYeven(), t)
+
+	msg := u.Hash256([]byte("Bitcoin Bitcoin"))
+	sig := pk.SignSchnorr(msg)
+	check(true, VerifySchnorr(msg, sig, pk.point), t)
+
+	other := u.Hash256([]byte("Bitcoin"))
+	check(false, VerifySchnorr(other, sig, pk.point), t)
+
+	parsed, err := ParseSchnorrSignature(sig.Serialize())
+	check(nil, err, t)
+	check(sig, parsed, t)
+}
@@ -2,11 +2,15 @@ package cryptography
 
 import (
 	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/binary"
 	"encoding/hex"
 	"errors"
 	"math/big"
 
 	u "github.com/lobiCode/prog_btc_go/btcutils"
+	"github.com/lobiCode/prog_btc_go/chaincfg"
 	ec "github.com/lobiCode/prog_btc_go/ellipticcurve"
 	ff "github.com/lobiCode/prog_btc_go/finitefield"
 )
@@ -15,6 +19,7 @@ var (
 	ErrPubKeyInvalidFormat = errors.New("publick key invalid format")
 	ErrBadSig              = errors.New("bad signature")
 	ErrBadSigLength        = errors.New("bad signature length")
+	ErrInvalidWif          = errors.New("invalid WIF private key")
 )
 
 type Signature struct {
@@ -88,6 +93,86 @@ func ParseSignature(sig []byte) (*Signature, error) {
 	return &Signature{r, s}, nil
 }
 
+// ParseSignatureLax parses a DER signature the way Bitcoin Core does without
+// BIP66, it allows long form lengths, padding and trailing data. R or S that
+// don't fit 32 bytes give a signature that never verifies.
+func ParseSignatureLax(sig []byte) (*Signature, error) {
+	pos := 0
+	if pos == len(sig) || sig[pos] != 0x30 {
+		return nil, ErrBadSig
+	}
+	pos++
+
+	// the sequence length is skipped
+	if pos == len(sig) {
+		return nil, ErrBadSigLength
+	}
+	lenByte := int(sig[pos])
+	pos++
+	if lenByte&0x80 != 0 {
+		lenByte -= 0x80
+		if lenByte > len(sig)-pos {
+			return nil, ErrBadSigLength
+		}
+		pos += lenByte
+	}
+
+	ints := [2][]byte{}
+	for i := range ints {
+		if pos == len(sig) || sig[pos] != 0x02 {
+			return nil, ErrBadSig
+		}
+		pos++
+
+		l, n, err := parseLaxLength(sig[pos:])
+		if err != nil {
+			return nil, err
+		}
+		pos += n
+		if l > len(sig)-pos {
+			return nil, ErrBadSigLength
+		}
+		ints[i] = bytes.TrimLeft(sig[pos:pos+l], "\x00")
+		pos += l
+	}
+
+	if len(ints[0]) > 32 || len(ints[1]) > 32 {
+		return &Signature{big.NewInt(0), big.NewInt(0)}, nil
+	}
+
+	return &Signature{u.ParseBytes(ints[0]), u.ParseBytes(ints[1])}, nil
+}
+
+// parseLaxLength returns a DER length and how many bytes encode it.
+func parseLaxLength(b []byte) (int, int, error) {
+	if len(b) == 0 {
+		return 0, 0, ErrBadSigLength
+	}
+
+	lenByte := int(b[0])
+	if lenByte&0x80 == 0 {
+		return lenByte, 1, nil
+	}
+
+	lenByte -= 0x80
+	if lenByte > len(b)-1 {
+		return 0, 0, ErrBadSigLength
+	}
+
+	n := 1 + lenByte
+	digits := bytes.TrimLeft(b[1:n], "\x00")
+	if len(digits) >= 4 {
+		return 0, 0, ErrBadSigLength
+	}
+
+	l := 0
+	for _, d := range digits {
+		l = l<<8 | int(d)
+	}
+
+	return l, n, nil
+}
+
 func (sig *Signature) String() string {
 	return hex.EncodeToString(sig.Der())
 }
@@ -102,42 +187,38 @@ func (pk *PrivateKey) Point() *ec.Point {
 }
 
 func (pk *PrivateKey) Sec(compressed bool) []byte {
+	if compressed {
+		return SerializePublicKey(pk.point)
+	}
 
-	xb := pk.point.GetXbytes()
-	result := make([]byte, 1, len(xb)+1)
-	result = append(result, xb...)
+	result := append([]byte{0x04}, SerializeXOnly(pk.point)...)
+	y := pk.point.GetYbytes()
+	result = append(result, make([]byte, 32-len(y))...)
 
-	if compressed {
-		if pk.point.IsYeven() {
-			result[0] = 0x02
-		} else {
-			result[0] = 0x03
-		}
-	} else {
-		result[0] = 0x04
-		result = append(result, pk.point.GetYbytes()...)
+	return append(result, y...)
+}
+
+// SerializePublicKey returns the compressed SEC serialization of p.
+func SerializePublicKey(p *ec.Point) []byte {
+	prefix := byte(0x03)
+	if p.IsYeven() {
+		prefix = 0x02
 	}
 
-	return result
+	return append([]byte{prefix}, SerializeXOnly(p)...)
 }
 
-func (pk *PrivateKey) AddressP2pkh(compressed, testnet bool) string {
+func (pk *PrivateKey) AddressP2pkh(compressed bool, params *chaincfg.Params) string {
 	b160 := u.Hash160(pk.Sec(compressed))
 
-	return u.AddressP2pkh(b160, testnet)
+	return u.AddressP2pkh(b160, params)
 }
 
-func (pk *PrivateKey) Wif(compressed, testnet bool) string {
-	// TODO
-	sb := pk.secret.Bytes()
+func (pk *PrivateKey) Wif(compressed bool, params *chaincfg.Params) string {
+	sb := u.BigIntToBytes(pk.secret, 32)
 	result := make([]byte, 1, len(sb)+2)
 	result = append(result, sb...)
-
-	if testnet {
-		result[0] = 0xef
-	} else {
-		result[0] = 0x80
-	}
+	result[0] = params.PrivateKeyID
 
 	if compressed {
 		result = append(result, 0x01)
@@ -146,8 +227,35 @@ func (pk *PrivateKey) Wif(compressed, testnet bool) string {
 	return u.EncodeBase58Checksum(result)
 }
 
+// ParseWif returns the private key of a WIF string of the network and
+// whether its public key is compressed.
+func ParseWif(s string, params *chaincfg.Params) (*PrivateKey, bool, error) {
+	b, err := u.DecodeBase58Checksum(s)
+	if err != nil || len(b) == 0 || b[0] != params.PrivateKeyID {
+		return nil, false, ErrInvalidWif
+	}
+
+	compressed := len(b) == 34 && b[33] == 0x01
+	if len(b) != 33 && !compressed {
+		return nil, false, ErrInvalidWif
+	}
+
+	secret := u.ParseBytes(b[1:33])
+	if !inScalarRange(secret) {
+		return nil, false, ErrInvalidWif
+	}
+
+	return NewPrivateKey(secret), compressed, nil
+}
+
 func ParsePublicKey(key []byte) (*ec.Point, error) {
-	// TODO len
+	// hybrid keys are uncompressed keys whose prefix repeats the parity of y
+	switch {
+	case len(key) == 33 && (key[0] == 2 || key[0] == 3):
+	case len(key) == 65 && (key[0] == 4 || key[0] == 6 || key[0] == 7):
+	default:
+		return nil, ErrPubKeyInvalidFormat
+	}
 
 	x := u.ParseBytes(key[1:33])
 	xf, err := ff.NewS256Field(x, ec.BTCCurve.P)
@@ -157,8 +265,11 @@ func ParsePublicKey(key []byte) (*ec.Point, error) {
 
 	format := key[0]
 
-	if format == 4 {
+	if format >= 4 {
 		y := u.ParseBytes(key[33:65])
+		if format != 4 && (y.Bit(0) == 1) != (format == 7) {
+			return nil, ErrPubKeyInvalidFormat
+		}
 		yf, err := ff.NewS256Field(y, ec.BTCCurve.P)
 		if err != nil {
 			return nil, err
@@ -195,7 +306,14 @@ func NewPrivateKey(secret *big.Int) *PrivateKey {
 }
 
 func (pk *PrivateKey) Sign(z *big.Int) *Signature {
-	k := getDeterministicK()
+	return pk.SignWithEntropy(z, nil)
+}
+
+// SignWithEntropy signs z with an RFC 6979 nonce. A 32 byte extraEntropy is
+// mixed into the nonce derivation the same way libsecp256k1 does it, any other
+// length is ignored.
+func (pk *PrivateKey) SignWithEntropy(z *big.Int, extraEntropy []byte) *Signature {
+	k := getDeterministicK(pk.secret, z, extraEntropy)
 	r := ec.RMul(ec.BTCCurve.G, k).GetX().GetNum()
 	kInv := u.InvInt(k, ec.BTCCurve.N)
 	s := u.ModInt(u.MulInt(u.AddInt(z, u.MulInt(r, pk.secret)), kInv), ec.BTCCurve.N)
@@ -206,11 +324,37 @@ func (pk *PrivateKey) Sign(z *big.Int) *Signature {
 	return &Signature{r, s}
 }
 
+// SignLowR grinds the extra entropy with a counter until the signature has a
+// low R value, like Bitcoin Core does, so the DER encoding is at most 71 bytes.
+func (pk *PrivateKey) SignLowR(z *big.Int) *Signature {
+	sig := pk.Sign(z)
+	extraEntropy := make([]byte, 32)
+	for counter := uint32(1); !sig.hasLowR(); counter++ {
+		binary.LittleEndian.PutUint32(extraEntropy, counter)
+		sig = pk.SignWithEntropy(z, extraEntropy)
+	}
+
+	return sig
+}
+
+func (sig *Signature) hasLowR() bool {
+	return sig.r.BitLen() < 256
+}
+
 func Verify(z *big.Int, signature *Signature, publicKey *ec.Point) bool {
+	if !inScalarRange(signature.r) || !inScalarRange(signature.s) {
+		return false
+	}
+
 	sInv := u.InvInt(signature.s, ec.BTCCurve.N)
 	uu := u.ModInt(u.MulInt(z, sInv), ec.BTCCurve.N)
 	v := u.ModInt(u.MulInt(signature.r, sInv), ec.BTCCurve.N)
-	sum := ec.Add(ec.RMul(ec.BTCCurve.G, uu), ec.RMul(publicKey, v)).GetX().GetNum()
+	x := ec.Add(ec.RMul(ec.BTCCurve.G, uu), ec.RMul(publicKey, v)).GetX()
+	if x == nil {
+		return false
+	}
+
+	sum := u.ModInt(x.GetNum(), ec.BTCCurve.N)
 	if sum.Cmp(signature.r) == 0 {
 		return true
 	}
@@ -218,6 +362,11 @@ func Verify(z *big.Int, signature *Signature, publicKey *ec.Point) bool {
 	return false
 }
 
+// inScalarRange reports whether i is between 1 and the curve order.
+func inScalarRange(i *big.Int) bool {
+	return i.Sign() > 0 && i.Cmp(ec.BTCCurve.N) < 0
+}
+
 func GetH160Address(address string) ([]byte, error) {
 	b, err := u.DecodeBase58Checksum(address)
 	if err != nil {
@@ -234,9 +383,44 @@ func GetHash256Int(s string) *big.Int {
 	return i
 }
 
-func getDeterministicK() *big.Int {
-	// TODO
-	return big.NewInt(100)
+// getDeterministicK derives the nonce as described in RFC 6979 section 3.2
+// using HMAC-SHA256.
+func getDeterministicK(secret, z *big.Int, extraEntropy []byte) *big.Int {
+	n := ec.BTCCurve.N
+
+	secretBytes := u.BigIntToBytes(secret, 32)
+	zBytes := u.BigIntToBytes(u.ModInt(z, n), 32)
+	data := append(secretBytes, zBytes...)
+	if len(extraEntropy) == 32 {
+		data = append(data, extraEntropy...)
+	}
+
+	k := make([]byte, 32)
+	v := bytes.Repeat([]byte{0x01}, 32)
+
+	k = hmacSha256(k, v, []byte{0x00}, data)
+	v = hmacSha256(k, v)
+	k = hmacSha256(k, v, []byte{0x01}, data)
+	v = hmacSha256(k, v)
+
+	for {
+		v = hmacSha256(k, v)
+		candidate := u.ParseBytes(v)
+		if candidate.Sign() > 0 && candidate.Cmp(n) < 0 {
+			return candidate
+		}
+		k = hmacSha256(k, v, []byte{0x00})
+		v = hmacSha256(k, v)
+	}
+}
+
+func hmacSha256(key []byte, data ...[]byte) []byte {
+	h := hmac.New(sha256.New, key)
+	for _, d := range data {
+		h.Write(d)
+	}
+
+	return h.Sum(nil)
 }
 
 func calculateY(x *ff.Element) *ff.Element {
@@ -1,11 +1,13 @@
 package cryptography
 
 import (
+	"crypto/sha256"
 	"encoding/hex"
 	"reflect"
 	"testing"
 
 	u "github.com/lobiCode/prog_btc_go/btcutils"
+	"github.com/lobiCode/prog_btc_go/chaincfg"
 	ec "github.com/lobiCode/prog_btc_go/ellipticcurve"
 )
 
@@ -19,6 +21,76 @@ func TestSign(t *testing.T) {
 	check(true, ok, t)
 }
 
+func TestDeterministicK(t *testing.T) {
+	testCase := []struct {
+		test         string
+		secret       string
+		msg          string
+		extraEntropy string
+		expected     string
+	}{
+		{"t 1", "cca9fbcc1b41e5a95d369eaa6ddcff73b61a4efaa279cfc6567e8daa39cbaf50", "sample", "", "2df40ca70e639d89528a6b670d9d48d9165fdc0febc0974056bdce192b8e16a3"},
+		{"t 2", "0000000000000000000000000000000000000000000000000000000000000001", "Satoshi Nakamoto", "", "8f8a276c19f4149656b280621e358cce24f5f52542772691ee69063b74f15d15"},
+		{"t 3", "fffffffffffffffffffffffffffffffebaaedce6af48a03bbfd25e8cd0364140", "Satoshi Nakamoto", "", "33a19b60e25fb6f4435af53a3d42d493644827367e6453928554f43e49aa6f90"},
+		{"t 4", "f8b8af8ce3c7cca5e300d33939540c10d45ce001b8f252bfbc57ba0342904181", "Alan Turing", "", "525a82b70e67874398067543fd84c83d30c175fdc45fdeee082fe13b1d7cfdf1"},
+		{"t 5", "0000000000000000000000000000000000000000000000000000000000000001", "All those moments will be lost in time, like tears in rain. Time to die...", "", "38aa22d72376b4dbc472e06c3ba403ee0a394da63fc58d88686c611aba98d6b3"},
+		{"t 6", "e91671c46231f833a6406ccbea0e3e392c76c167bac1cb013f6f1013980455c2", "There is a computer disease that anybody who works with computers knows about. It's a very serious disease and it interferes completely with the work. The trouble with computers is that you 'play' with them!", "", "1f4b84c23a86a221d233f2521be018d9318639d5b8bbd6374a8a59232d16ad3d"},
+		{"t 7", "0000000000000000000000000000000000000000000000000000000000000001", "Satoshi Nakamoto", "00000000000000000000000000000000000000000000000000000000000002", "8f8a276c19f4149656b280621e358cce24f5f52542772691ee69063b74f15d15"},
+	}
+
+	for _, test := range testCase {
+		t.Run(test.test, func(t *testing.T) {
+			secret, _ := u.ParseInt(test.secret, 16)
+			sum := sha256.Sum256([]byte(test.msg))
+			extraEntropy, _ := hex.DecodeString(test.extraEntropy)
+			k := getDeterministicK(secret, u.ParseBytes(sum[:]), extraEntropy)
+			check(test.expected, hex.EncodeToString(k.Bytes()), t)
+		})
+	}
+}
+
+func TestDeterministicKExtraEntropy(t *testing.T) {
+	secret, _ := u.ParseInt("0011111111111111111111111111111111111111111111111111111111111111", 16)
+	extraEntropy, _ := hex.DecodeString("0000000000000000000000000000000000000000000000000000000000000002")
+	k := getDeterministicK(secret, u.NewInt(1), extraEntropy)
+	check("67893461ade51cde61824b20bc293b585d058e6b9f40fb68453d5143f15116ae", hex.EncodeToString(k.Bytes()), t)
+}
+
+func TestSignRFC6979(t *testing.T) {
+	testCase := []struct {
+		test     string
+		secret   string
+		msg      string
+		expected string
+	}{
+		{"t 1", "0000000000000000000000000000000000000000000000000000000000000001", "Satoshi Nakamoto", "3045022100934b1ea10a4b3c1757e2b0c017d0b6143ce3c9a7e6a4a49860d7a6ab210ee3d802202442ce9d2b916064108014783e923ec36b49743e2ffa1c4496f01a512aafd9e5"},
+		{"t 2", "fffffffffffffffffffffffffffffffebaaedce6af48a03bbfd25e8cd0364140", "Satoshi Nakamoto", "3045022100fd567d121db66e382991534ada77a6bd3106f0a1098c231e47993447cd6af2d002206b39cd0eb1bc8603e159ef5c20a5c8ad685a45b06ce9bebed3f153d10d93bed5"},
+		{"t 3", "f8b8af8ce3c7cca5e300d33939540c10d45ce001b8f252bfbc57ba0342904181", "Alan Turing", "304402207063ae83e7f62bbb171798131b4a0564b956930092b33b07b395615d9ec7e15c022058dfcc1e00a35e1572f366ffe34ba0fc47db1e7189759b9fb233c5b05ab388ea"},
+	}
+
+	for _, test := range testCase {
+		t.Run(test.test, func(t *testing.T) {
+			secret, _ := u.ParseInt(test.secret, 16)
+			sum := sha256.Sum256([]byte(test.msg))
+			pk := NewPrivateKey(secret)
+			sig := pk.Sign(u.ParseBytes(sum[:]))
+			check(test.expected, sig.String(), t)
+			check(true, Verify(u.ParseBytes(sum[:]), sig, pk.point), t)
+		})
+	}
+}
+
+func TestSignLowR(t *testing.T) {
+	secret, _ := u.ParseInt("0000000000000000000000000000000000000000000000000000000000000001", 16)
+	sum := sha256.Sum256([]byte("Satoshi Nakamoto"))
+	z := u.ParseBytes(sum[:])
+	pk := NewPrivateKey(secret)
+
+	sig := pk.SignLowR(z)
+	check(true, len(sig.Der()) <= 70, t)
+	check(true, Verify(z, sig, pk.point), t)
+}
+
 func TestSignFail(t *testing.T) {
 	z := GetHash256Int("Bitcoin Bitcoin")
 	pk1 := NewPrivateKey(GetHash256Int("ifkdafkfkfiasfiodidafpasfjadsf"))
@@ -60,8 +132,34 @@ func TestSignParse(t *testing.T) {
 func TestAddress(t *testing.T) {
 	secret, _ := u.ParseInt("0x12345deadbeef", 0)
 	pk := NewPrivateKey(secret)
-	address := pk.AddressP2pkh(true, false)
+	address := pk.AddressP2pkh(true, &chaincfg.MainNetParams)
 	check("1F1Pn2y6pDb68E5nYJJeba4TLg2U7B6KF1", address, t)
+
+	pk = NewPrivateKey(u.NewInt(2020 * 2020 * 2020 * 2020 * 2020))
+	address = pk.AddressP2pkh(true, &chaincfg.TestNet3Params)
+	check("mopVkxp8UhXqRYbCYJsbeE1h1fiF64jcoH", address, t)
+}
+
+func TestWif(t *testing.T) {
+	secret := u.NewInt(1)
+	pk := NewPrivateKey(secret)
+	wif := pk.Wif(true, &chaincfg.MainNetParams)
+	check("KwDiBf89QgGbjEhKnhXJuH7LrciVrZi3qYjgd9M7rFU73sVHnoWn", wif, t)
+
+	parsed, compressed, err := ParseWif(wif, &chaincfg.MainNetParams)
+	check(nil, err, t)
+	check(true, compressed, t)
+	check(0, parsed.secret.Cmp(secret), t)
+
+	// testnet, signet and regtest share the prefix
+	wif = pk.Wif(false, &chaincfg.RegressionNetParams)
+	parsed, compressed, err = ParseWif(wif, &chaincfg.SigNetParams)
+	check(nil, err, t)
+	check(false, compressed, t)
+	check(0, parsed.secret.Cmp(secret), t)
+
+	_, _, err = ParseWif(wif, &chaincfg.MainNetParams)
+	check(ErrInvalidWif, err, t)
 }
 
 func TestDer(t *testing.T) {
@@ -88,6 +186,34 @@ func TestDer2(t *testing.T) {
 	check(text, sigResult.String(), t)
 }
 
+func TestParseSignatureLax(t *testing.T) {
+	strict := "3045022037206a0610995c58074999cb9767b87af4c4978db68c06e8e6e81d282047a7c60221008ca63759c1157ebeaec0d03cecca119fc9a75bf8e6d0fa65c841c8e2738cdaec"
+	b, _ := hex.DecodeString(strict)
+	expected, _ := ParseSignature(b)
+
+	tests := []struct {
+		test string
+		sig  string
+	}{
+		{"strict", strict},
+		{"long form lengths", "308146028120" + "37206a0610995c58074999cb9767b87af4c4978db68c06e8e6e81d282047a7c6" + "0221008ca63759c1157ebeaec0d03cecca119fc9a75bf8e6d0fa65c841c8e2738cdaec"},
+		{"padded r", "304602210037206a0610995c58074999cb9767b87af4c4978db68c06e8e6e81d282047a7c60221008ca63759c1157ebeaec0d03cecca119fc9a75bf8e6d0fa65c841c8e2738cdaec"},
+		{"trailing data", strict + "0000"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.test, func(t *testing.T) {
+			b, _ := hex.DecodeString(test.sig)
+			sig, err := ParseSignatureLax(b)
+			check(nil, err, t)
+			check(expected, sig, t)
+		})
+	}
+
+	_, err := ParseSignatureLax([]byte{0x30, 0x06, 0x02, 0x05, 0x01})
+	check(ErrBadSigLength, err, t)
+}
+
 func TestGetH160Address(t *testing.T) {
 	addr := "mnrVtF8DWjMu839VW3rBfgYaAfKk8983Xf"
 	b, err := GetH160Address(addr)
@@ -0,0 +1,57 @@
+package cryptography
+
+import (
+	"errors"
+	"math/big"
+
+	u "github.com/lobiCode/prog_btc_go/btcutils"
+	ec "github.com/lobiCode/prog_btc_go/ellipticcurve"
+)
+
+var ErrTaprootTweak = errors.New("invalid taproot tweak")
+
+// TaprootTweakPublicKey returns the BIP341 output key of internalKey
+// committing to merkleRoot, a nil merkleRoot commits to the key alone.
+func TaprootTweakPublicKey(internalKey *ec.Point, merkleRoot []byte) (*ec.Point, error) {
+	p, err := liftX(internalKey.GetX().GetNum())
+	if err != nil {
+		return nil, err
+	}
+
+	t, err := taprootTweak(SerializeXOnly(p), merkleRoot)
+	if err != nil {
+		return nil, err
+	}
+
+	q := ec.Add(p, ec.RMul(ec.BTCCurve.G, t))
+	if q.GetX() == nil {
+		return nil, ErrTaprootTweak
+	}
+
+	return q, nil
+}
+
+// TaprootTweak returns the private key of the output key that
+// TaprootTweakPublicKey derives from the key's public key.
+func (pk *PrivateKey) TaprootTweak(merkleRoot []byte) (*PrivateKey, error) {
+	t, err := taprootTweak(pk.XOnly(), merkleRoot)
+	if err != nil {
+		return nil, err
+	}
+
+	secret := u.ModInt(u.AddInt(pk.evenYSecret(), t), ec.BTCCurve.N)
+	if secret.Sign() == 0 {
+		return nil, ErrTaprootTweak
+	}
+
+	return NewPrivateKey(secret), nil
+}
+
+func taprootTweak(xOnly, merkleRoot []byte) (*big.Int, error) {
+	t := u.ParseBytes(TaggedHash("TapTweak", xOnly, merkleRoot))
+	if t.Cmp(ec.BTCCurve.N) >= 0 {
+		return nil, ErrTaprootTweak
+	}
+
+	return t, nil
+}
@@ -0,0 +1,32 @@
+package cryptography
+
+import (
+	"encoding/hex"
+	"testing"
+
+	u "github.com/lobiCode/prog_btc_go/btcutils"
+)
+
+func TestTaprootTweakPublicKey(t *testing.T) {
+	// first receiving key of the BIP86 test vectors
+	internalKey, _ := hex.DecodeString("cc8a4bc64d897bddc5fbc2f670f7a8ba0b386779106cf1223c6fc5d7cd6fc115")
+	p, err := ParseXOnlyPublicKey(internalKey)
+	check(nil, err, t)
+
+	outputKey, err := TaprootTweakPublicKey(p, nil)
+	check(nil, err, t)
+	check("a60869f0dbcf1dc659c9cecbaf8050135ea9e8cdc487053f1dc6880949dc684c", hex.EncodeToString(SerializeXOnly(outputKey)), t)
+}
+
+func TestTaprootTweak(t *testing.T) {
+	merkleRoot := TaggedHash("TapLeaf", []byte("leaf"))
+	for _, secret := range []int64{3, 6} {
+		pk := NewPrivateKey(u.NewInt(secret))
+		tweaked, err := pk.TaprootTweak(merkleRoot)
+		check(nil, err, t)
+
+		outputKey, err := TaprootTweakPublicKey(pk.point, merkleRoot)
+		check(nil, err, t)
+		check(SerializeXOnly(outputKey), tweaked.XOnly(), t)
+	}
+}
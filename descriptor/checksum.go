@@ -0,0 +1,80 @@
+package descriptor
+
+import "strings"
+
+const (
+	inputCharset    = "0123456789()[],'/*abcdefgh@:$%{}IJKLMNOPQRSTUVWXYZ&+-.;<=>?!^_|~ijklmnopqrstuvwxyzABCDEFGH`#\"\\ "
+	checksumCharset = "qpzry9x8gf2tvdw0s3jn54khce6mua7l"
+	checksumLength  = 8
+)
+
+func polymod(c uint64, value int) uint64 {
+	generator := []uint64{0xf5dee51989, 0xa9fdca3312, 0x1bab10e32d, 0x3706b1677a, 0x644d626ffd}
+	top := c >> 35
+	c = (c&0x7ffffffff)<<5 ^ uint64(value)
+	for i := uint(0); i < 5; i++ {
+		if (top>>i)&1 == 1 {
+			c ^= generator[i]
+		}
+	}
+
+	return c
+}
+
+// Checksum returns the BIP380 checksum of a descriptor without one.
+func Checksum(desc string) (string, error) {
+	c := uint64(1)
+	groups := []int{}
+	for _, ch := range desc {
+		pos := strings.IndexRune(inputCharset, ch)
+		if pos < 0 {
+			return "", ErrParse
+		}
+
+		// the low 5 bits of each character, then the high bits of 3 of them
+		c = polymod(c, pos&31)
+		groups = append(groups, pos>>5)
+		if len(groups) == 3 {
+			c = polymod(c, groups[0]*9+groups[1]*3+groups[2])
+			groups = groups[:0]
+		}
+	}
+	switch len(groups) {
+	case 1:
+		c = polymod(c, groups[0])
+	case 2:
+		c = polymod(c, groups[0]*3+groups[1])
+	}
+
+	for i := 0; i < checksumLength; i++ {
+		c = polymod(c, 0)
+	}
+	c ^= 1
+
+	result := make([]byte, checksumLength)
+	for i := range result {
+		result[i] = checksumCharset[(c>>(5*uint(7-i)))&31]
+	}
+
+	return string(result), nil
+}
+
+// splitChecksum returns the descriptor without its checksum, after checking
+// it when it has one.
+func splitChecksum(s string) (string, error) {
+	i := strings.IndexByte(s, '#')
+	if i < 0 {
+		return s, nil
+	}
+
+	desc, checksum := s[:i], s[i+1:]
+	want, err := Checksum(desc)
+	if err != nil {
+		return "", err
+	}
+	if checksum != want {
+		return "", ErrChecksum
+	}
+
+	return desc, nil
+}
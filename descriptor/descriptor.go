@@ -0,0 +1,453 @@
+// Package descriptor implements output script descriptors, BIP380 to BIP386:
+// pk, pkh, wpkh, sh, wsh, multi, sortedmulti, tr, addr and raw with their
+// checksum and ranged extended key derivation.
+package descriptor
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"sort"
+	"strconv"
+	"strings"
+
+	u "github.com/lobiCode/prog_btc_go/btcutils"
+	"github.com/lobiCode/prog_btc_go/chaincfg"
+	c "github.com/lobiCode/prog_btc_go/cryptography"
+	"github.com/lobiCode/prog_btc_go/script"
+)
+
+var ErrParse = errors.New("parsing descriptor failed")
+var ErrChecksum = errors.New("descriptor checksum mismatch")
+var ErrKey = errors.New("invalid descriptor key")
+var ErrContext = errors.New("descriptor not allowed here")
+var ErrThreshold = errors.New("invalid multisig threshold or key count")
+var ErrScriptSize = errors.New("descriptor script too large")
+var ErrIndex = errors.New("invalid derivation index")
+
+// context is where a descriptor is, the witness one is inside wsh and the
+// key of wpkh.
+type context int
+
+const (
+	contextTop context = iota
+	contextSh
+	contextWitness
+	contextTap
+)
+
+const (
+	maxScriptElementSize   = 520
+	maxStandardP2wshScript = 3600
+	maxPubKeysPerMultisig  = 20
+	maxP2shMultisigKeys    = 16
+	maxBareMultisigKeys    = 3
+)
+
+// Descriptor is a parsed output script descriptor. Sub is the descriptor
+// inside sh and wsh, Threshold the k of multi and sortedmulti.
+type Descriptor struct {
+	Type      string
+	Keys      []*Key
+	Threshold int
+	Sub       *Descriptor
+	Tree      *Tree
+	Raw       []byte
+
+	// address of addr and its script
+	address string
+	script  *script.Script
+	params  *chaincfg.Params
+}
+
+// Tree is the script tree of tr, either a leaf descriptor or a branch.
+type Tree struct {
+	Leaf        *Descriptor
+	Left, Right *Tree
+}
+
+// Parse parses a descriptor with the keys and addresses of a network, its
+// checksum is checked when it has one.
+func Parse(s string, params *chaincfg.Params) (*Descriptor, error) {
+	desc, err := splitChecksum(s)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &parser{s: desc, params: params}
+	d, err := p.parseDescriptor(contextTop)
+	if err != nil {
+		return nil, err
+	}
+	if p.pos != len(desc) {
+		return nil, ErrParse
+	}
+
+	return d, nil
+}
+
+type parser struct {
+	s      string
+	pos    int
+	params *chaincfg.Params
+}
+
+// arg reads up to the next separator.
+func (p *parser) arg() string {
+	start := p.pos
+	for p.pos < len(p.s) && !strings.ContainsRune("(),{}", rune(p.s[p.pos])) {
+		p.pos++
+	}
+
+	return p.s[start:p.pos]
+}
+
+func (p *parser) consume(c byte) bool {
+	if p.pos < len(p.s) && p.s[p.pos] == c {
+		p.pos++
+		return true
+	}
+
+	return false
+}
+
+func (p *parser) parseDescriptor(ctx context) (*Descriptor, error) {
+	name := p.arg()
+	if !p.consume('(') {
+		return nil, ErrParse
+	}
+
+	d := &Descriptor{Type: name, params: p.params}
+	var err error
+	switch name {
+	case "pk", "pkh", "wpkh":
+		keyCtx := ctx
+		if name == "wpkh" {
+			if ctx != contextTop && ctx != contextSh {
+				return nil, ErrContext
+			}
+			keyCtx = contextWitness
+		}
+		if name == "pkh" && ctx == contextTap {
+			return nil, ErrContext
+		}
+
+		key, err := parseKey(p.arg(), keyCtx, p.params)
+		if err != nil {
+			return nil, err
+		}
+		d.Keys = []*Key{key}
+	case "sh", "wsh":
+		subCtx := contextSh
+		if name == "wsh" {
+			if ctx != contextTop && ctx != contextSh {
+				return nil, ErrContext
+			}
+			subCtx = contextWitness
+		} else if ctx != contextTop {
+			return nil, ErrContext
+		}
+
+		if d.Sub, err = p.parseDescriptor(subCtx); err != nil {
+			return nil, err
+		}
+	case "multi", "sortedmulti":
+		if err = p.parseMulti(d, ctx); err != nil {
+			return nil, err
+		}
+	case "tr":
+		if ctx != contextTop {
+			return nil, ErrContext
+		}
+
+		key, err := parseKey(p.arg(), contextTap, p.params)
+		if err != nil {
+			return nil, err
+		}
+		d.Keys = []*Key{key}
+
+		if p.consume(',') {
+			if d.Tree, err = p.parseTree(); err != nil {
+				return nil, err
+			}
+		}
+	case "addr", "raw":
+		if ctx != contextTop {
+			return nil, ErrContext
+		}
+
+		arg := p.arg()
+		if name == "addr" {
+			d.address = arg
+			if d.script, err = script.DecodeAddress(arg, p.params); err != nil {
+				return nil, err
+			}
+		} else if d.Raw, err = hex.DecodeString(arg); err != nil {
+			return nil, ErrParse
+		}
+	default:
+		return nil, ErrParse
+	}
+
+	if !p.consume(')') {
+		return nil, ErrParse
+	}
+
+	return d, d.checkSize()
+}
+
+func (p *parser) parseMulti(d *Descriptor, ctx context) error {
+	if ctx == contextTap {
+		return ErrContext
+	}
+
+	k, err := strconv.Atoi(p.arg())
+	if err != nil {
+		return ErrParse
+	}
+
+	for p.consume(',') {
+		key, err := parseKey(p.arg(), ctx, p.params)
+		if err != nil {
+			return err
+		}
+		d.Keys = append(d.Keys, key)
+	}
+
+	maxKeys := maxP2shMultisigKeys
+	switch ctx {
+	case contextTop:
+		maxKeys = maxBareMultisigKeys
+	case contextWitness:
+		maxKeys = maxPubKeysPerMultisig
+	}
+	if k < 1 || k > len(d.Keys) || len(d.Keys) > maxKeys {
+		return ErrThreshold
+	}
+	d.Threshold = k
+
+	return nil
+}
+
+func (p *parser) parseTree() (*Tree, error) {
+	if !p.consume('{') {
+		leaf, err := p.parseDescriptor(contextTap)
+		if err != nil {
+			return nil, err
+		}
+		if leaf.Type != "pk" {
+			return nil, ErrContext
+		}
+
+		return &Tree{Leaf: leaf}, nil
+	}
+
+	left, err := p.parseTree()
+	if err != nil {
+		return nil, err
+	}
+	if !p.consume(',') {
+		return nil, ErrParse
+	}
+	right, err := p.parseTree()
+	if err != nil {
+		return nil, err
+	}
+	if !p.consume('}') {
+		return nil, ErrParse
+	}
+
+	return &Tree{Left: left, Right: right}, nil
+}
+
+// checkSize checks the redeem and witness scripts of sh and wsh, the key
+// sizes don't depend on the index.
+func (d *Descriptor) checkSize() error {
+	if d.Sub == nil {
+		return nil
+	}
+
+	s, err := d.Sub.Script(0)
+	if err != nil {
+		return err
+	}
+
+	limit := maxScriptElementSize
+	if d.Type == "wsh" {
+		limit = maxStandardP2wshScript
+	}
+	if len(s.RawSerialize()) > limit {
+		return ErrScriptSize
+	}
+
+	return nil
+}
+
+func (d *Descriptor) allKeys() []*Key {
+	keys := append([]*Key{}, d.Keys...)
+	if d.Sub != nil {
+		keys = append(keys, d.Sub.allKeys()...)
+	}
+	if d.Tree != nil {
+		keys = append(keys, d.Tree.allKeys()...)
+	}
+
+	return keys
+}
+
+func (t *Tree) allKeys() []*Key {
+	if t.Leaf != nil {
+		return t.Leaf.allKeys()
+	}
+
+	return append(t.Left.allKeys(), t.Right.allKeys()...)
+}
+
+// IsRange reports whether the descriptor has a key derived at an index.
+func (d *Descriptor) IsRange() bool {
+	for _, k := range d.allKeys() {
+		if k.IsRange() {
+			return true
+		}
+	}
+
+	return false
+}
+
+// String returns the descriptor with its checksum.
+func (d *Descriptor) String() string {
+	desc := d.body()
+	// every character of a descriptor is in the checksum charset
+	checksum, _ := Checksum(desc)
+
+	return desc + "#" + checksum
+}
+
+func (d *Descriptor) body() string {
+	args := []string{}
+	switch d.Type {
+	case "sh", "wsh":
+		args = append(args, d.Sub.body())
+	case "multi", "sortedmulti":
+		args = append(args, strconv.Itoa(d.Threshold))
+	case "addr":
+		args = append(args, d.address)
+	case "raw":
+		args = append(args, hex.EncodeToString(d.Raw))
+	}
+	for _, k := range d.Keys {
+		args = append(args, k.String())
+	}
+	if d.Tree != nil {
+		args = append(args, d.Tree.String())
+	}
+
+	return d.Type + "(" + strings.Join(args, ",") + ")"
+}
+
+func (t *Tree) String() string {
+	if t.Leaf != nil {
+		return t.Leaf.body()
+	}
+
+	return "{" + t.Left.String() + "," + t.Right.String() + "}"
+}
+
+// Script returns the script pubkey of the descriptor with its keys derived
+// at index, sh and wsh return the script pubkey paying to their script.
+func (d *Descriptor) Script(index uint32) (*script.Script, error) {
+	keys := [][]byte{}
+	for _, k := range d.Keys {
+		key, err := k.PubKey(index)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, key)
+	}
+
+	switch d.Type {
+	case "pk":
+		return script.ParseRaw(append(script.PushData(keys[0]), 0xac))
+	case "pkh":
+		return script.P2pkh(u.Hash160(keys[0])), nil
+	case "wpkh":
+		return script.P2wpkh(u.Hash160(keys[0])), nil
+	case "sh", "wsh":
+		sub, err := d.Sub.Script(index)
+		if err != nil {
+			return nil, err
+		}
+		if d.Type == "sh" {
+			return script.P2sh(u.Hash160(sub.RawSerialize())), nil
+		}
+		sum := sha256.Sum256(sub.RawSerialize())
+		return script.P2wsh(sum[:]), nil
+	case "multi", "sortedmulti":
+		if d.Type == "sortedmulti" {
+			sort.Slice(keys, func(i, j int) bool {
+				return bytes.Compare(keys[i], keys[j]) < 0
+			})
+		}
+		raw := script.PushNum(int64(d.Threshold))
+		for _, key := range keys {
+			raw = append(raw, script.PushData(key)...)
+		}
+		raw = append(raw, script.PushNum(int64(len(keys)))...)
+		return script.ParseRaw(append(raw, 0xae))
+	case "tr":
+		internalKey, err := c.ParseXOnlyPublicKey(keys[0])
+		if err != nil {
+			return nil, err
+		}
+		var tree *script.TapTree
+		if d.Tree != nil {
+			if tree, err = d.Tree.tapTree(index); err != nil {
+				return nil, err
+			}
+		}
+		return script.P2trFromTree(internalKey, tree)
+	case "addr":
+		return d.script, nil
+	case "raw":
+		return script.ParseRaw(d.Raw)
+	}
+
+	return nil, ErrParse
+}
+
+func (t *Tree) tapTree(index uint32) (*script.TapTree, error) {
+	if t.Leaf != nil {
+		s, err := t.Leaf.Script(index)
+		if err != nil {
+			return nil, err
+		}
+		return script.NewTapLeaf(s), nil
+	}
+
+	left, err := t.Left.tapTree(index)
+	if err != nil {
+		return nil, err
+	}
+	right, err := t.Right.tapTree(index)
+	if err != nil {
+		return nil, err
+	}
+
+	return script.NewTapBranch(left, right), nil
+}
+
+// Address returns the address of the descriptor at index, addr returns its
+// address as written.
+func (d *Descriptor) Address(index uint32) (string, error) {
+	if d.Type == "addr" {
+		return d.address, nil
+	}
+
+	s, err := d.Script(index)
+	if err != nil {
+		return "", err
+	}
+
+	return s.GetAddress(d.params)
+}
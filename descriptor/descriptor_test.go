@@ -0,0 +1,202 @@
+package descriptor
+
+import (
+	"encoding/hex"
+	"reflect"
+	"testing"
+
+	u "github.com/lobiCode/prog_btc_go/btcutils"
+	"github.com/lobiCode/prog_btc_go/chaincfg"
+	c "github.com/lobiCode/prog_btc_go/cryptography"
+)
+
+var mainnet = &chaincfg.MainNetParams
+
+const (
+	testKey1 = "03a34b99f22c790c4e36b2b3c2c35a36db06226e41c692fc82b8b56ac1c540c5bd"
+	testKey2 = "02f9308a019258c31049344f85f89d5229b531c845836f99b08601f113bce036f9"
+	testKey3 = "02c6047f9441ed7d6d3045406e95c07cd85c778e4b8cef3ca7abac09b95c709ee5"
+	// the root key of the BIP84 and BIP86 test mnemonic, fingerprint 73c5da0a
+	testXprv = "xprv9s21ZrQH143K3GJpoapnV8SFfukcVBSfeCficPSGfubmSFDxo1kuHnLisriDvSnRRuL2Qrg5ggqHKNVpxR86QEC8w35uxmGoggxtQTPvfUu"
+	testTprv = "tprv8ZgxMBicQKsPe5YMU9gHen4Ez3ApihUfykaqUorj9t6FDqy3nP6eoXiAo2ssvpAjoLroQxHqr3R5nE3a5dU3DHTjTgJDd7zrbniJr6nrCzd"
+)
+
+func TestChecksum(t *testing.T) {
+	// BIP380
+	checksum, err := Checksum("raw(deadbeef)")
+	check(nil, err, t)
+	check("89f8spxm", checksum, t)
+
+	_, err = Parse("raw(deadbeef)#89f8spxm", mainnet)
+	check(nil, err, t)
+	_, err = Parse("raw(deadbeef)#89f8spxn", mainnet)
+	check(ErrChecksum, err, t)
+	_, err = Parse("raw(deadbeef)#", mainnet)
+	check(ErrChecksum, err, t)
+}
+
+func TestScript(t *testing.T) {
+	tests := []struct {
+		desc   string
+		script string
+	}{
+		{"pk(" + testKey1 + ")#9pcxlpvx", "21" + testKey1 + "ac"},
+		{"pkh(" + testKey2 + ")#9tvfrq3z", "76a9147dd65592d0ab2fe0d0257d571abf032cd9db93dc88ac"},
+		{"wpkh(" + testKey2 + ")#8zl0zxma", "00147dd65592d0ab2fe0d0257d571abf032cd9db93dc"},
+		{"sh(wpkh(" + testKey2 + "))#hyahcv3t", "a91469ea5ff598a286f418ae77503ce85d83da4ae88e87"},
+		{"wsh(multi(2," + testKey1 + "," + testKey2 + "))#ruvvugc2", "0020c0586fcd8be2c2c00a1c2cd515665eef5caba46ad538316baf903bbe9b79f970"},
+		{"sh(sortedmulti(1," + testKey1 + "," + testKey2 + "))#e4ud6xuk", "a914e60333d42b4a653dbc3dc811852836a43eb983ad87"},
+		{"tr(" + testKey2 + ")#v4awp5dh", "5120418c46636d9e1a683f58e35b42336e776fdcc3b2d4e39e7a0bf1ab0716e3c5fa"},
+		{"tr(" + testKey2 + ",{pk(" + testKey1 + "),pk(" + testKey3 + ")})#9dp6wm29", "5120d2add86d6dc720a59aa193067c3ad87277dc0e6ff3952a6de4767bdc6a8817c3"},
+		{"addr(3NfDBB7zG3gMHD8Um212FeMKdpoKGX6Vzc)#vzs6228a", "a914e60333d42b4a653dbc3dc811852836a43eb983ad87"},
+		{"addr(bc1qcr8te4kr609gcawutmrza0j4xv80jy8z306fyu)#lpewvaaa", "0014c0cebcd6c3d3ca8c75dc5ec62ebe55330ef910e2"},
+		{"raw(deadbeef)#89f8spxm", "deadbeef"},
+	}
+
+	for _, test := range tests {
+		d, err := Parse(test.desc, mainnet)
+		check(nil, err, t)
+		check(test.desc, d.String(), t)
+		check(false, d.IsRange(), t)
+
+		s, err := d.Script(0)
+		check(nil, err, t)
+		check(test.script, hex.EncodeToString(s.RawSerialize()), t)
+	}
+}
+
+func TestAddress(t *testing.T) {
+	tests := []struct {
+		desc    string
+		index   uint32
+		params  *chaincfg.Params
+		address string
+	}{
+		// BIP44, BIP49, BIP84 and BIP86 test vectors
+		{"pkh(" + testXprv + "/44'/0'/0'/0/*)", 0, mainnet, "1LqBGSKuX5yYUonjxT5qGfpUsXKYYWeabA"},
+		{"sh(wpkh(" + testTprv + "/49'/1'/0'/0/*))", 0, &chaincfg.TestNet3Params, "2Mww8dCYPUpKHofjgcXcBCEGmniw9CoaiD2"},
+		{"wpkh(" + testXprv + "/84h/0h/0h/0/*)", 0, mainnet, "bc1qcr8te4kr609gcawutmrza0j4xv80jy8z306fyu"},
+		{"wpkh(" + testXprv + "/84h/0h/0h/0/*)", 1, mainnet, "bc1qnjg0jd8228aq7egyzacy8cys3knf9xvrerkf9g"},
+		{"wpkh(" + testXprv + "/84h/0h/0h/1/*)", 0, mainnet, "bc1q8c6fshw2dlwun7ekn9qwf37cu2rn755upcp6el"},
+		{"wpkh([73c5da0a/84'/0'/0']xpub6CatWdiZiodmUeTDp8LT5or8nmbKNcuyvz7WyksVFkKB4RHwCD3XyuvPEbvqAQY3rAPshWcMLoP2fMFMKHPJ4ZeZXYVUhLv1VMrjPC7PW6V/0/*)#wc3n3van", 0, mainnet, "bc1qcr8te4kr609gcawutmrza0j4xv80jy8z306fyu"},
+		{"tr(" + testXprv + "/86'/0'/0'/0/*)", 0, mainnet, "bc1p5cyxnuxmeuwuvkwfem96lqzszd02n6xdcjrs20cac6yqjjwudpxqkedrcr"},
+		{"tr(" + testXprv + "/86'/0'/0'/0/*')", 3, mainnet, "bc1pgv9th696rytwyv5l7tcatdu7t0c0k22s5srtnaa925gkrxj50xgqnar7td"},
+		{"pkh(" + testKey2 + ")", 0, mainnet, "1CUNEBjYrCn2y1SdiUMohaKUi4wpP326Lb"},
+		{"pkh(" + testKey2 + ")", 0, &chaincfg.TestNet3Params, "mrzKXEpXfEDHk7vFS3LBXVXoa4YXFcCkje"},
+		{"sh(wpkh(" + testKey2 + "))", 0, mainnet, "3BM3eLQZbwubG3XwwxJmd9qxwMJn7yUTSn"},
+		{"sh(sortedmulti(1," + testKey2 + "," + testKey1 + "))", 0, mainnet, "3NfDBB7zG3gMHD8Um212FeMKdpoKGX6Vzc"},
+		{"sh(sortedmulti(1," + testKey2 + "," + testKey1 + "))", 0, &chaincfg.TestNet3Params, "2NEDREv41sWBhUzm2S9ctsbLarB1V722X16"},
+		{"wsh(multi(2," + testKey1 + "," + testKey2 + "))", 5, mainnet, "bc1qcpvxlnvtutpvqzsu9n232ej7aaw2hfr265urz6a0jqamaxmel9cqnqafs0"},
+		{"tr(" + testKey2 + ")", 0, mainnet, "bc1pgxxyvcmdncdxs06cudd5yvmwwahaesaj6n3eu7st7x4sw9hrchaqjy33gs"},
+		{"addr(3NfDBB7zG3gMHD8Um212FeMKdpoKGX6Vzc)", 0, mainnet, "3NfDBB7zG3gMHD8Um212FeMKdpoKGX6Vzc"},
+		{"addr(bc1qcr8te4kr609gcawutmrza0j4xv80jy8z306fyu)", 0, mainnet, "bc1qcr8te4kr609gcawutmrza0j4xv80jy8z306fyu"},
+		{"wpkh(" + testKey2 + ")", 0, &chaincfg.RegressionNetParams, "bcrt1q0ht9tyks4vh7p5p904t340cr9nvahy7uevmqwj"},
+	}
+
+	for _, test := range tests {
+		d, err := Parse(test.desc, test.params)
+		check(nil, err, t)
+
+		address, err := d.Address(test.index)
+		check(nil, err, t)
+		check(test.address, address, t)
+	}
+}
+
+func TestKey(t *testing.T) {
+	d, err := Parse("pkh([73c5da0a/44h/0h/0h]"+testKey1+")", mainnet)
+	check(nil, err, t)
+	check("pkh([73c5da0a/44'/0'/0']"+testKey1+")#rsz2ar7j", d.String(), t)
+
+	key := d.Keys[0]
+	check([]byte{0x73, 0xc5, 0xda, 0x0a}, key.Fingerprint, t)
+	check([]uint32{44 + c.HardenedKeyStart, c.HardenedKeyStart, c.HardenedKeyStart}, key.OriginPath, t)
+
+	pubKey, err := key.PubKey(0)
+	check(nil, err, t)
+	check(testKey1, hex.EncodeToString(pubKey), t)
+
+	d, err = Parse("wpkh([73c5da0a/84h/0h/0h]"+testXprv+"/84h/0h/0h/0/*)", mainnet)
+	check(nil, err, t)
+	check(true, d.IsRange(), t)
+	check("wpkh([73c5da0a/84'/0'/0']"+testXprv+"/84'/0'/0'/0/*)#sxg5k9ax", d.String(), t)
+
+	key = d.Keys[0]
+	check([]byte{0x73, 0xc5, 0xda, 0x0a}, key.Fingerprint, t)
+	check([]uint32{84 + c.HardenedKeyStart, c.HardenedKeyStart, c.HardenedKeyStart}, key.OriginPath, t)
+	check([]uint32{84 + c.HardenedKeyStart, c.HardenedKeyStart, c.HardenedKeyStart, 0}, key.Path, t)
+
+	pubKey, err = key.PubKey(0)
+	check(nil, err, t)
+	check("0330d54fd0dd420a6e5f8d3624f5f3482cae350f79d5f0753bf5beef9c2d91af3c", hex.EncodeToString(pubKey), t)
+
+	_, err = key.PubKey(c.HardenedKeyStart)
+	check(ErrIndex, err, t)
+
+	// a WIF key is its public key
+	d, err = Parse("pkh(KwDiBf89QgGbjEhKnhXJuH7LrciVrZi3qYjgd9M7rFU73sVHnoWn)", mainnet)
+	check(nil, err, t)
+	s, err := d.Script(0)
+	check(nil, err, t)
+	check(u.Hash160(decodeHex("0279be667ef9dcbbac55a06295ce870b07029bfcdb2dce28d959f2815b16f81798")), s.Cmds[2], t)
+}
+
+func TestParseError(t *testing.T) {
+	uncompressed := "04a34b99f22c790c4e36b2b3c2c35a36db06226e41c692fc82b8b56ac1c540c5bda47213adca5f0578ddb89388f63fdaa61c558c55fc6e745d2b6d1157a54159fa"
+	xpub := "xpub6CatWdiZiodmUeTDp8LT5or8nmbKNcuyvz7WyksVFkKB4RHwCD3XyuvPEbvqAQY3rAPshWcMLoP2fMFMKHPJ4ZeZXYVUhLv1VMrjPC7PW6V"
+
+	tests := []struct {
+		desc string
+		err  error
+	}{
+		{"pk(" + testKey1, ErrParse},
+		{"pk(" + testKey1 + "))", ErrParse},
+		{"foo(" + testKey1 + ")", ErrParse},
+		{"raw(xyz)", ErrParse},
+		{"pk(" + testKey1[2:] + ")", ErrKey},
+		{"pk(" + testKey1 + "/0)", ErrKey},
+		{"pk([73c5da0a]" + xpub + "/0h/*)", ErrKey},
+		{"pk(" + xpub + "/*h)", ErrKey},
+		{"pk([73c5da]" + testKey1 + ")", ErrKey},
+		// segwit needs compressed keys
+		{"pk(" + uncompressed + ")", nil},
+		{"wpkh(" + uncompressed + ")", ErrKey},
+		{"wsh(pk(" + uncompressed + "))", ErrKey},
+		{"sh(sh(pk(" + testKey1 + ")))", ErrContext},
+		{"wsh(wpkh(" + testKey1 + "))", ErrContext},
+		{"wsh(wsh(pk(" + testKey1 + ")))", ErrContext},
+		{"sh(tr(" + testKey1 + "))", ErrContext},
+		{"tr(" + testKey1 + ",pkh(" + testKey2 + "))", ErrContext},
+		{"tr(" + testKey1 + ",{pk(" + testKey2 + ")})", ErrParse},
+		{"multi(0," + testKey1 + ")", ErrThreshold},
+		{"multi(2," + testKey1 + ")", ErrThreshold},
+		{"multi(1," + testKey1 + "," + testKey2 + "," + testKey3 + "," + testKey1 + ")", ErrThreshold},
+		{"addr(3NfDBB7zG3gMHD8Um212FeMKdpoKGX6Vzd)", u.ErrBadAddress},
+		{"addr(bc1qcr8te4kr609gcawutmrza0j4xv80jy8z306fyv)", u.ErrBadAddress},
+		// keys and addresses of another network
+		{"pkh(cMahea7zqjxrtgAbB7LSGbcQUr1uX1ojuat9jZodMN87JcbXMTcA)", ErrKey},
+		{"wpkh(" + testTprv + "/0/*)", ErrKey},
+		{"addr(tb1qrp33g0q5c5txsp9arysrx4k6zdkfs4nce4xj0gdcccefvpysxf3q0sl5k7)", u.ErrBadAddress},
+	}
+
+	for _, test := range tests {
+		_, err := Parse(test.desc, mainnet)
+		check(test.err, err, t)
+	}
+}
+
+func decodeHex(s string) []byte {
+	b, err := hex.DecodeString(s)
+	if err != nil {
+		panic(err)
+	}
+
+	return b
+}
+
+func check(expected, recived interface{}, t *testing.T) {
+	t.Helper()
+	if !reflect.DeepEqual(recived, expected) {
+		t.Errorf("Received\n%+v\ndoesn't match expected\n%+v\n", recived, expected)
+	}
+}
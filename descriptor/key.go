@@ -0,0 +1,243 @@
+package descriptor
+
+import (
+	"encoding/hex"
+	"strconv"
+	"strings"
+
+	"github.com/lobiCode/prog_btc_go/chaincfg"
+	c "github.com/lobiCode/prog_btc_go/cryptography"
+)
+
+type wildcard int
+
+const (
+	wildcardNone wildcard = iota
+	wildcardNormal
+	wildcardHardened
+)
+
+// Key is a key expression: a hex public key, a WIF private key or an
+// extended key with a derivation path, optionally after its origin.
+type Key struct {
+	// Fingerprint and OriginPath are the origin of the key, nil when it
+	// has none
+	Fingerprint []byte
+	OriginPath  []uint32
+	// Path is derived from the extended key, before the wildcard
+	Path []uint32
+
+	// text is the key as written, without origin and path
+	text       string
+	pubKey     []byte
+	privateKey *c.PrivateKey
+	compressed bool
+	extended   *c.ExtendedKey
+	wildcard   wildcard
+	xonly      bool
+}
+
+func parseKey(s string, ctx context, params *chaincfg.Params) (*Key, error) {
+	k := &Key{}
+
+	if strings.HasPrefix(s, "[") {
+		end := strings.IndexByte(s, ']')
+		if end < 0 {
+			return nil, ErrKey
+		}
+
+		origin := strings.Split(s[1:end], "/")
+		fingerprint, err := hex.DecodeString(origin[0])
+		if err != nil || len(fingerprint) != 4 {
+			return nil, ErrKey
+		}
+		if k.OriginPath, err = parsePath(origin[1:]); err != nil {
+			return nil, err
+		}
+		k.Fingerprint = fingerprint
+		s = s[end+1:]
+	}
+
+	parts := strings.Split(s, "/")
+	k.text = parts[0]
+	path := parts[1:]
+	if n := len(path); n > 0 {
+		switch path[n-1] {
+		case "*":
+			k.wildcard = wildcardNormal
+		case "*'", "*h":
+			k.wildcard = wildcardHardened
+		}
+		if k.wildcard != wildcardNone {
+			path = path[:n-1]
+		}
+	}
+
+	var err error
+	if k.Path, err = parsePath(path); err != nil {
+		return nil, err
+	}
+
+	if extended, err := c.ParseExtendedKey(k.text, params); err == nil {
+		// descriptors only take the xpub versions
+		if extended.Segwit {
+			return nil, ErrKey
+		}
+		k.extended = extended
+		k.compressed = true
+		if !extended.IsPrivate() && (k.wildcard == wildcardHardened || hasHardened(k.Path)) {
+			return nil, ErrKey
+		}
+	} else {
+		if len(parts) > 1 {
+			return nil, ErrKey
+		}
+		if err := k.parseSingleKey(ctx, params); err != nil {
+			return nil, err
+		}
+	}
+
+	if !k.compressed && (ctx == contextWitness || ctx == contextTap) {
+		return nil, ErrKey
+	}
+	k.xonly = ctx == contextTap
+
+	return k, nil
+}
+
+// parseSingleKey parses a hex public key or a WIF private key.
+func (k *Key) parseSingleKey(ctx context, params *chaincfg.Params) error {
+	if privateKey, compressed, err := c.ParseWif(k.text, params); err == nil {
+		k.privateKey, k.compressed = privateKey, compressed
+		return nil
+	}
+
+	key, err := hex.DecodeString(k.text)
+	if err != nil {
+		return ErrKey
+	}
+
+	if len(key) == 32 && ctx == contextTap {
+		if _, err := c.ParseXOnlyPublicKey(key); err != nil {
+			return ErrKey
+		}
+		k.pubKey, k.compressed = key, true
+		return nil
+	}
+
+	if len(key) != 33 && (len(key) != 65 || key[0] != 4) {
+		return ErrKey
+	}
+	if _, err := c.ParsePublicKey(key); err != nil {
+		return ErrKey
+	}
+	k.pubKey, k.compressed = key, len(key) == 33
+
+	return nil
+}
+
+func parsePath(elements []string) ([]uint32, error) {
+	path := []uint32{}
+	for _, e := range elements {
+		hardened := strings.HasSuffix(e, "'") || strings.HasSuffix(e, "h")
+		if hardened {
+			e = e[:len(e)-1]
+		}
+
+		i, err := strconv.ParseUint(e, 10, 32)
+		if err != nil || uint32(i) >= c.HardenedKeyStart {
+			return nil, ErrKey
+		}
+		if hardened {
+			i += uint64(c.HardenedKeyStart)
+		}
+		path = append(path, uint32(i))
+	}
+
+	return path, nil
+}
+
+func hasHardened(path []uint32) bool {
+	for _, i := range path {
+		if i >= c.HardenedKeyStart {
+			return true
+		}
+	}
+
+	return false
+}
+
+func formatPath(path []uint32) string {
+	var sb strings.Builder
+	for _, i := range path {
+		sb.WriteByte('/')
+		if i >= c.HardenedKeyStart {
+			sb.WriteString(strconv.FormatUint(uint64(i-c.HardenedKeyStart), 10) + "'")
+		} else {
+			sb.WriteString(strconv.FormatUint(uint64(i), 10))
+		}
+	}
+
+	return sb.String()
+}
+
+// IsRange reports whether the key is derived at the index of the
+// descriptor.
+func (k *Key) IsRange() bool {
+	return k.wildcard != wildcardNone
+}
+
+// PubKey returns the public key at index, x-only in taproot.
+func (k *Key) PubKey(index uint32) ([]byte, error) {
+	var key []byte
+	switch {
+	case k.extended != nil:
+		if index >= c.HardenedKeyStart {
+			return nil, ErrIndex
+		}
+
+		path := k.Path
+		switch k.wildcard {
+		case wildcardNormal:
+			path = append(append([]uint32{}, path...), index)
+		case wildcardHardened:
+			path = append(append([]uint32{}, path...), index+c.HardenedKeyStart)
+		}
+
+		xkey := k.extended
+		for _, i := range path {
+			var err error
+			if xkey, err = xkey.Child(i); err != nil {
+				return nil, err
+			}
+		}
+		key = c.SerializePublicKey(xkey.PublicKey())
+	case k.privateKey != nil:
+		key = k.privateKey.Sec(k.compressed)
+	default:
+		key = k.pubKey
+	}
+
+	if k.xonly && len(key) == 33 {
+		return key[1:], nil
+	}
+
+	return key, nil
+}
+
+func (k *Key) String() string {
+	var sb strings.Builder
+	if k.Fingerprint != nil {
+		sb.WriteString("[" + hex.EncodeToString(k.Fingerprint) + formatPath(k.OriginPath) + "]")
+	}
+	sb.WriteString(k.text)
+	sb.WriteString(formatPath(k.Path))
+	switch k.wildcard {
+	case wildcardNormal:
+		sb.WriteString("/*")
+	case wildcardHardened:
+		sb.WriteString("/*'")
+	}
+
+	return sb.String()
+}
@@ -1,12 +1,16 @@
 module github.com/lobiCode/prog_btc_go
 
-go 1.12
+go 1.17
 
 require (
-	github.com/btcsuite/btcd v0.20.0-beta // indirect
 	github.com/btcsuite/btcutil v0.0.0-20190425235716-9e5f4b9a998d
 	github.com/spaolacci/murmur3 v1.1.0
 	github.com/twmb/murmur3 v1.0.0
 	golang.org/x/crypto v0.0.0-20190701094942-4def268fd1a4
-	golang.org/x/tools v0.0.0-20190920225731-5eefd052ad72 // indirect
+	golang.org/x/text v0.13.0
+)
+
+require (
+	github.com/btcsuite/btcd v0.20.0-beta // indirect
+	golang.org/x/tools v0.6.0 // indirect
 )
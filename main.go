@@ -3,6 +3,7 @@ package main
 import (
 	"fmt"
 
+	"github.com/lobiCode/prog_btc_go/chaincfg"
 	c "github.com/lobiCode/prog_btc_go/cryptography"
 	"github.com/lobiCode/prog_btc_go/script"
 	"github.com/lobiCode/prog_btc_go/tx"
@@ -11,11 +12,18 @@ import (
 func main() {
 	secret := c.GetHash256Int("")
 	key := c.NewPrivateKey(secret)
-	fmt.Println(key.Address(true, true))
+	params := &chaincfg.TestNet3Params
+	fmt.Println(key.AddressP2pkh(true, params))
 
-	targetH160, err := c.GetH160Address("miKegze5FQNCnGw6PKyqUbYUeBa4x2hFeM")
-	targetH1602, err := c.GetH160Address("2MtwTo5PCjTiGdKHfVVWFp4HGEdRk1TmZ9K")
-	targetH1603, err := c.GetH160Address(key.Address(true, true))
+	target, err := script.DecodeAddress("miKegze5FQNCnGw6PKyqUbYUeBa4x2hFeM", params)
+	if err != nil {
+		panic(err)
+	}
+	target2, err := script.DecodeAddress("2MtwTo5PCjTiGdKHfVVWFp4HGEdRk1TmZ9K", params)
+	if err != nil {
+		panic(err)
+	}
+	target3, err := script.DecodeAddress(key.AddressP2pkh(true, params), params)
 	if err != nil {
 		panic(err)
 	}
@@ -32,27 +40,27 @@ func main() {
 	}
 	txOut1 := &tx.TxOut{
 		Amount:       uint64(0.00000023 * 100000000),
-		ScriptPubKey: script.P2pkh(targetH160),
+		ScriptPubKey: target,
 	}
 	txOut2 := &tx.TxOut{
 		Amount:       uint64(0.00000023 * 100000000),
-		ScriptPubKey: script.P2pkh(targetH1602),
+		ScriptPubKey: target2,
 	}
 	txOut3 := &tx.TxOut{
 		Amount:       uint64(0.03115 * 100000000),
-		ScriptPubKey: script.P2pkh(targetH1603),
+		ScriptPubKey: target3,
 	}
 
 	transaction := &tx.Tx{
 		Version:  1,
 		Locktime: 0,
-		Testnet:  true,
 		TxIns:    []*tx.TxIn{txIn1, txIn2},
 		TxOuts:   []*tx.TxOut{txOut1, txOut2, txOut3},
 	}
 
-	err = transaction.SingInput(0, key)
-	err = transaction.SingInput(1, key)
+	fetcher := tx.NewExplorerFetcher(params)
+	err = transaction.SingInput(fetcher, 0, key)
+	err = transaction.SingInput(fetcher, 1, key)
 
 	if err != nil {
 		panic(err)
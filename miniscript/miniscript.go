@@ -0,0 +1,558 @@
+// Package miniscript implements miniscript for P2WSH, as defined in BIP379:
+// typed expressions that encode to bitcoin scripts, a satisfier producing
+// their witnesses and a compiler from spending policies.
+package miniscript
+
+import (
+	"encoding/hex"
+	"errors"
+	"strconv"
+	"strings"
+
+	"github.com/lobiCode/prog_btc_go/script"
+)
+
+var ErrParse = errors.New("parsing miniscript failed")
+var ErrType = errors.New("miniscript isn't well typed")
+var ErrNotTopLevel = errors.New("miniscript isn't of type B")
+var ErrMalleable = errors.New("miniscript has no non-malleable satisfaction")
+var ErrNoSignature = errors.New("miniscript can be satisfied without a signature")
+var ErrTimelockMix = errors.New("miniscript mixes time and height timelocks")
+var ErrDuplicateKey = errors.New("miniscript repeats a key")
+var ErrScriptSize = errors.New("miniscript script too large")
+
+// Fragment is the kind of a miniscript expression, the names follow Bitcoin
+// Core.
+type Fragment int
+
+const (
+	JUST_0 Fragment = iota
+	JUST_1
+	PK_K
+	PK_H
+	OLDER
+	AFTER
+	SHA256
+	HASH256
+	RIPEMD160
+	HASH160
+	WRAP_A
+	WRAP_S
+	WRAP_C
+	WRAP_D
+	WRAP_V
+	WRAP_J
+	WRAP_N
+	AND_V
+	AND_B
+	OR_B
+	OR_C
+	OR_D
+	OR_I
+	ANDOR
+	THRESH
+	MULTI
+)
+
+const (
+	maxPubKeysPerMultisig  = 20
+	maxStandardP2wshScript = 3600
+	compressedPubKeySize   = 33
+)
+
+var fragmentNames = map[Fragment]string{
+	JUST_0:    "0",
+	JUST_1:    "1",
+	PK_K:      "pk_k",
+	PK_H:      "pk_h",
+	OLDER:     "older",
+	AFTER:     "after",
+	SHA256:    "sha256",
+	HASH256:   "hash256",
+	RIPEMD160: "ripemd160",
+	HASH160:   "hash160",
+	AND_V:     "and_v",
+	AND_B:     "and_b",
+	OR_B:      "or_b",
+	OR_C:      "or_c",
+	OR_D:      "or_d",
+	OR_I:      "or_i",
+	ANDOR:     "andor",
+	THRESH:    "thresh",
+	MULTI:     "multi",
+}
+
+var wrapperLetters = map[Fragment]byte{
+	WRAP_A: 'a',
+	WRAP_S: 's',
+	WRAP_C: 'c',
+	WRAP_D: 'd',
+	WRAP_V: 'v',
+	WRAP_J: 'j',
+	WRAP_N: 'n',
+}
+
+// Node is a miniscript expression. K is the threshold of thresh and multi
+// and the value of older and after, Data the hash of the hash fragments.
+// Keys are names, resolved to public keys by a KeyMap.
+type Node struct {
+	Fragment Fragment
+	K        uint32
+	Keys     []string
+	Data     []byte
+	Subs     []*Node
+
+	typ Type
+	// size is the length of the script
+	size int
+}
+
+func newNode(frag Fragment, k uint32, keys []string, data []byte, subs ...*Node) *Node {
+	n := &Node{Fragment: frag, K: k, Keys: keys, Data: data, Subs: subs}
+
+	types := make([]Type, len(subs))
+	for i, sub := range subs {
+		types[i] = sub.typ
+	}
+	n.typ = computeType(frag, k, types)
+	if !n.typ.isValid() {
+		n.typ = 0
+	}
+	n.size = n.scriptSize()
+
+	return n
+}
+
+// Type returns the properties of the expression, it has no basic type when
+// the expression isn't valid.
+func (n *Node) Type() Type {
+	return n.typ
+}
+
+// Size returns the length of the script of the expression.
+func (n *Node) Size() int {
+	return n.size
+}
+
+// scriptSize is Bitcoin Core's ComputeScriptLen with compressed keys.
+func (n *Node) scriptSize() int {
+	subs := 0
+	for _, sub := range n.Subs {
+		subs += sub.size
+	}
+
+	switch n.Fragment {
+	case JUST_0, JUST_1:
+		return 1
+	case PK_K:
+		return 1 + compressedPubKeySize
+	case PK_H:
+		return 3 + 21
+	case OLDER, AFTER:
+		return 1 + len(script.PushNum(int64(n.K)))
+	case SHA256, HASH256:
+		return 4 + 2 + 33
+	case RIPEMD160, HASH160:
+		return 4 + 2 + 21
+	case MULTI:
+		return 1 + len(script.PushNum(int64(len(n.Keys)))) + len(script.PushNum(int64(n.K))) +
+			(1+compressedPubKeySize)*len(n.Keys)
+	case AND_V:
+		return subs
+	case WRAP_V:
+		if n.Subs[0].typ.Has("x") {
+			return subs + 1
+		}
+		return subs
+	case WRAP_S, WRAP_C, WRAP_N, AND_B, OR_B:
+		return subs + 1
+	case WRAP_A, OR_C:
+		return subs + 2
+	case WRAP_D, OR_D, OR_I, ANDOR:
+		return subs + 3
+	case WRAP_J:
+		return subs + 4
+	case THRESH:
+		return subs + len(n.Subs) - 1 + len(script.PushNum(int64(n.K))) + 1
+	}
+
+	return 0
+}
+
+// CheckSane returns why the expression isn't safe to use as a P2WSH
+// script: it has to be of type B, every satisfaction needs a signature and
+// is non-malleable, no branch mixes timelock kinds, keys aren't repeated
+// and the script is standard in size.
+func (n *Node) CheckSane() error {
+	if !n.typ.Has("B") {
+		return ErrNotTopLevel
+	}
+
+	if !n.typ.Has("m") {
+		return ErrMalleable
+	}
+
+	if !n.typ.Has("s") {
+		return ErrNoSignature
+	}
+
+	if !n.typ.Has("k") {
+		return ErrTimelockMix
+	}
+
+	seen := map[string]bool{}
+	for _, key := range n.allKeys() {
+		if seen[key] {
+			return ErrDuplicateKey
+		}
+		seen[key] = true
+	}
+
+	if n.size > maxStandardP2wshScript {
+		return ErrScriptSize
+	}
+
+	return nil
+}
+
+func (n *Node) allKeys() []string {
+	keys := append([]string{}, n.Keys...)
+	for _, sub := range n.Subs {
+		keys = append(keys, sub.allKeys()...)
+	}
+
+	return keys
+}
+
+// Parse parses a miniscript expression, such as
+// and_v(v:pk(A),or_d(pk(B),older(144))).
+func Parse(s string) (*Node, error) {
+	p := &parser{s: s}
+	n, err := p.parseNode()
+	if err != nil {
+		return nil, err
+	}
+	if p.pos != len(s) {
+		return nil, ErrParse
+	}
+
+	return n, nil
+}
+
+type parser struct {
+	s   string
+	pos int
+}
+
+// word reads up to the next separator.
+func (p *parser) word() string {
+	start := p.pos
+	for p.pos < len(p.s) && !strings.ContainsRune(":(),", rune(p.s[p.pos])) {
+		p.pos++
+	}
+
+	return p.s[start:p.pos]
+}
+
+func (p *parser) consume(c byte) bool {
+	if p.pos < len(p.s) && p.s[p.pos] == c {
+		p.pos++
+		return true
+	}
+
+	return false
+}
+
+func (p *parser) parseNode() (*Node, error) {
+	name := p.word()
+
+	if p.consume(':') {
+		sub, err := p.parseNode()
+		if err != nil {
+			return nil, err
+		}
+
+		for i := len(name) - 1; i >= 0; i-- {
+			if sub, err = wrap(name[i], sub); err != nil {
+				return nil, err
+			}
+		}
+
+		return sub, nil
+	}
+
+	if !p.consume('(') {
+		switch name {
+		case "0":
+			return newNode(JUST_0, 0, nil, nil), nil
+		case "1":
+			return newNode(JUST_1, 0, nil, nil), nil
+		}
+		return nil, ErrParse
+	}
+
+	n, err := p.parseFragment(name)
+	if err != nil {
+		return nil, err
+	}
+
+	if !p.consume(')') {
+		return nil, ErrParse
+	}
+
+	if !n.typ.isValid() {
+		return nil, ErrType
+	}
+
+	return n, nil
+}
+
+func (p *parser) parseFragment(name string) (*Node, error) {
+	switch name {
+	case "pk_k", "pk_h", "pk", "pkh":
+		key := p.word()
+		if key == "" {
+			return nil, ErrParse
+		}
+
+		frag := PK_K
+		if strings.HasPrefix(name, "pkh") || name == "pk_h" {
+			frag = PK_H
+		}
+		n := newNode(frag, 0, []string{key}, nil)
+		if name == "pk" || name == "pkh" {
+			n = newNode(WRAP_C, 0, nil, nil, n)
+		}
+
+		return n, nil
+	case "older", "after":
+		k, err := strconv.ParseUint(p.word(), 10, 32)
+		if err != nil || k < 1 || k >= 0x80000000 {
+			return nil, ErrParse
+		}
+
+		frag := OLDER
+		if name == "after" {
+			frag = AFTER
+		}
+
+		return newNode(frag, uint32(k), nil, nil), nil
+	case "sha256", "hash256", "ripemd160", "hash160":
+		frag, size := map[string]Fragment{"sha256": SHA256, "hash256": HASH256, "ripemd160": RIPEMD160, "hash160": HASH160}[name], 32
+		if frag == RIPEMD160 || frag == HASH160 {
+			size = 20
+		}
+
+		data, err := hex.DecodeString(p.word())
+		if err != nil || len(data) != size {
+			return nil, ErrParse
+		}
+
+		return newNode(frag, 0, nil, data), nil
+	case "multi":
+		k, err := p.threshold()
+		if err != nil {
+			return nil, err
+		}
+
+		keys := []string{}
+		for p.consume(',') {
+			key := p.word()
+			if key == "" {
+				return nil, ErrParse
+			}
+			keys = append(keys, key)
+		}
+		if k < 1 || int(k) > len(keys) || len(keys) > maxPubKeysPerMultisig {
+			return nil, ErrParse
+		}
+
+		return newNode(MULTI, k, keys, nil), nil
+	case "thresh":
+		k, err := p.threshold()
+		if err != nil {
+			return nil, err
+		}
+
+		subs, err := p.parseSubs(-1)
+		if err != nil {
+			return nil, err
+		}
+		if k < 1 || int(k) > len(subs) {
+			return nil, ErrParse
+		}
+
+		return newNode(THRESH, k, nil, nil, subs...), nil
+	}
+
+	frags := map[string]Fragment{"and_v": AND_V, "and_b": AND_B, "or_b": OR_B, "or_c": OR_C, "or_d": OR_D, "or_i": OR_I}
+	if frag, ok := frags[name]; ok {
+		subs, err := p.parseSubs(2)
+		if err != nil {
+			return nil, err
+		}
+
+		return newNode(frag, 0, nil, nil, subs...), nil
+	}
+
+	switch name {
+	case "and_n":
+		subs, err := p.parseSubs(2)
+		if err != nil {
+			return nil, err
+		}
+
+		return newNode(ANDOR, 0, nil, nil, subs[0], subs[1], newNode(JUST_0, 0, nil, nil)), nil
+	case "andor":
+		subs, err := p.parseSubs(3)
+		if err != nil {
+			return nil, err
+		}
+
+		return newNode(ANDOR, 0, nil, nil, subs...), nil
+	}
+
+	return nil, ErrParse
+}
+
+// threshold reads the k of thresh and multi.
+func (p *parser) threshold() (uint32, error) {
+	k, err := strconv.ParseUint(p.word(), 10, 32)
+	if err != nil {
+		return 0, ErrParse
+	}
+
+	return uint32(k), nil
+}
+
+// parseSubs parses comma separated expressions, n of them or, when n is
+// negative, the ones following a comma.
+func (p *parser) parseSubs(n int) ([]*Node, error) {
+	subs := []*Node{}
+	for i := 0; n < 0 || i < n; i++ {
+		if (n < 0 || i > 0) && !p.consume(',') {
+			if n < 0 {
+				break
+			}
+			return nil, ErrParse
+		}
+
+		sub, err := p.parseNode()
+		if err != nil {
+			return nil, err
+		}
+		subs = append(subs, sub)
+	}
+
+	return subs, nil
+}
+
+// wrap applies the wrapper of letter to sub.
+func wrap(letter byte, sub *Node) (*Node, error) {
+	var n *Node
+	switch letter {
+	case 't':
+		n = newNode(AND_V, 0, nil, nil, sub, newNode(JUST_1, 0, nil, nil))
+	case 'l':
+		n = newNode(OR_I, 0, nil, nil, newNode(JUST_0, 0, nil, nil), sub)
+	case 'u':
+		n = newNode(OR_I, 0, nil, nil, sub, newNode(JUST_0, 0, nil, nil))
+	default:
+		for frag, l := range wrapperLetters {
+			if l == letter {
+				n = newNode(frag, 0, nil, nil, sub)
+			}
+		}
+	}
+
+	if n == nil {
+		return nil, ErrParse
+	}
+	if !n.typ.isValid() {
+		return nil, ErrType
+	}
+
+	return n, nil
+}
+
+// wrapper returns the letter of a wrapper, the sugared t:, l: and u: ones
+// included, and the expression it wraps.
+func (n *Node) wrapper() (byte, *Node, bool) {
+	switch n.Fragment {
+	case WRAP_C:
+		if f := n.Subs[0].Fragment; f == PK_K || f == PK_H {
+			return 0, nil, false
+		}
+	case AND_V:
+		if n.Subs[1].Fragment == JUST_1 {
+			return 't', n.Subs[0], true
+		}
+		return 0, nil, false
+	case OR_I:
+		if n.Subs[0].Fragment == JUST_0 {
+			return 'l', n.Subs[1], true
+		}
+		if n.Subs[1].Fragment == JUST_0 {
+			return 'u', n.Subs[0], true
+		}
+		return 0, nil, false
+	}
+
+	l, ok := wrapperLetters[n.Fragment]
+	if !ok {
+		return 0, nil, false
+	}
+
+	return l, n.Subs[0], true
+}
+
+func (n *Node) String() string {
+	if l, sub, ok := n.wrapper(); ok {
+		letters := []byte{l}
+		for {
+			l, inner, ok := sub.wrapper()
+			if !ok {
+				break
+			}
+			letters = append(letters, l)
+			sub = inner
+		}
+
+		return string(letters) + ":" + sub.String()
+	}
+
+	args := []string{}
+	name := fragmentNames[n.Fragment]
+	switch n.Fragment {
+	case JUST_0, JUST_1:
+		return name
+	case WRAP_C:
+		name = "pk"
+		if n.Subs[0].Fragment == PK_H {
+			name = "pkh"
+		}
+		args = n.Subs[0].Keys
+	case PK_K, PK_H:
+		args = n.Keys
+	case OLDER, AFTER:
+		args = []string{strconv.FormatUint(uint64(n.K), 10)}
+	case SHA256, HASH256, RIPEMD160, HASH160:
+		args = []string{hex.EncodeToString(n.Data)}
+	case MULTI:
+		args = append([]string{strconv.FormatUint(uint64(n.K), 10)}, n.Keys...)
+	case THRESH:
+		args = []string{strconv.FormatUint(uint64(n.K), 10)}
+	case ANDOR:
+		if n.Subs[2].Fragment == JUST_0 {
+			return "and_n(" + n.Subs[0].String() + "," + n.Subs[1].String() + ")"
+		}
+	}
+
+	for _, sub := range n.Subs {
+		if n.Fragment != WRAP_C {
+			args = append(args, sub.String())
+		}
+	}
+
+	return name + "(" + strings.Join(args, ",") + ")"
+}
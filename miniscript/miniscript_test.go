@@ -0,0 +1,176 @@
+package miniscript
+
+import (
+	"encoding/hex"
+	"reflect"
+	"testing"
+)
+
+// Bitcoin Core's miniscript_tests vectors
+func TestParseScript(t *testing.T) {
+	tests := []struct {
+		ms     string
+		script string
+		typ    string
+	}{
+		{
+			"lltvln:after(1231488000)",
+			"6300676300676300670400046749b1926869516868",
+			"Bdumxik",
+		},
+		{
+			"uuj:and_v(v:multi(2,03d01115d548e7561b15c38f004d734633687cf4419620095bc5b0f47070afe85a,025601570cb47f238d2b0286db4a990fa0f3ba28d1a319f5e7cf55c2a2444da7cc),after(1231488000))",
+			"6363829263522103d01115d548e7561b15c38f004d734633687cf4419620095bc5b0f47070afe85a21025601570cb47f238d2b0286db4a990fa0f3ba28d1a319f5e7cf55c2a2444da7cc52af0400046749b168670068670068",
+			"Bdsmxik",
+		},
+		{
+			"or_b(un:multi(2,03daed4f2be3a8bf278e70132fb0beb7522f570e144bf615c07e996d443dee8729,024ce119c96e2fa357200b559b2f7dd5a5f02d5290aff74b03f3e471b273211c97),al:older(16))",
+			"63522103daed4f2be3a8bf278e70132fb0beb7522f570e144bf615c07e996d443dee872921024ce119c96e2fa357200b559b2f7dd5a5f02d5290aff74b03f3e471b273211c9752ae926700686b63006760b2686c9b",
+			"Bduxhk",
+		},
+		{
+			"j:and_v(vdv:after(1567547623),older(2016))",
+			"829263766304e7e06e5db169686902e007b268",
+			"Bondemxhik",
+		},
+		{
+			"t:and_v(vu:hash256(131772552c01444cd81360818376a040b7c3b2b7b0a53550ee3edde216cec61b),v:sha256(ec4916dd28fc4c10d78e287ca5d9cc51ee1ae73cbfde08c6b37324cbfaac8bc5))",
+			"6382012088aa20131772552c01444cd81360818376a040b7c3b2b7b0a53550ee3edde216cec61b876700686982012088a820ec4916dd28fc4c10d78e287ca5d9cc51ee1ae73cbfde08c6b37324cbfaac8bc58851",
+			"Bufmxk",
+		},
+		{
+			"t:andor(multi(3,02d7924d4f7d43ea965a465ae3095ff41131e5946f3c85f79e44adbcf8e27e080e,03fff97bd5755eeea420453a14355235d382f6472f8568a18b2f057a1460297556,02e493dbf1c10d80f3581e4904930b1404cc6c13900ee0758474fa94abe8c4cd13),v:older(4194305),v:sha256(9267d3dbed802941483f1afa2a6bc68de5f653128aca9bf1461c5d0a3ad36ed2))",
+			"532102d7924d4f7d43ea965a465ae3095ff41131e5946f3c85f79e44adbcf8e27e080e2103fff97bd5755eeea420453a14355235d382f6472f8568a18b2f057a14602975562102e493dbf1c10d80f3581e4904930b1404cc6c13900ee0758474fa94abe8c4cd1353ae6482012088a8209267d3dbed802941483f1afa2a6bc68de5f653128aca9bf1461c5d0a3ad36ed2886703010040b2696851",
+			"Bufmxgk",
+		},
+		{
+			"or_d(multi(1,02f9308a019258c31049344f85f89d5229b531c845836f99b08601f113bce036f9),or_b(multi(3,022f01e5e15cca351daff3843fb70f3c2f0a1bdd05e5af888a67784ef3e10a2a01,032fa2104d6b38d11b0230010559879124e42ab8dfeff5ff29dc9cdadd4ecacc3f,03d01115d548e7561b15c38f004d734633687cf4419620095bc5b0f47070afe85a),su:after(500000)))",
+			"512102f9308a019258c31049344f85f89d5229b531c845836f99b08601f113bce036f951ae73645321022f01e5e15cca351daff3843fb70f3c2f0a1bdd05e5af888a67784ef3e10a2a0121032fa2104d6b38d11b0230010559879124e42ab8dfeff5ff29dc9cdadd4ecacc3f2103d01115d548e7561b15c38f004d734633687cf4419620095bc5b0f47070afe85a53ae7c630320a107b16700689b68",
+			"Bduemxjk",
+		},
+	}
+
+	for _, test := range tests {
+		n, err := Parse(test.ms)
+		check(nil, err, t)
+		check(test.ms, n.String(), t)
+		check(test.typ, n.Type().String(), t)
+
+		s, err := n.Script(nil)
+		check(nil, err, t)
+		check(test.script, hex.EncodeToString(s.RawSerialize()), t)
+		check(len(s.RawSerialize()), n.Size(), t)
+	}
+}
+
+func TestParseSugar(t *testing.T) {
+	tests := []struct {
+		ms       string
+		expanded string
+	}{
+		{"pk(A)", "c:pk_k(A)"},
+		{"pkh(A)", "c:pk_h(A)"},
+		{"and_n(pk(A),older(1))", "andor(pk(A),older(1),0)"},
+		{"tv:pk(A)", "and_v(v:pk(A),1)"},
+		{"l:pk(A)", "or_i(0,pk(A))"},
+		{"u:pk(A)", "or_i(pk(A),0)"},
+	}
+
+	for _, test := range tests {
+		sugared, err := Parse(test.ms)
+		check(nil, err, t)
+		check(test.ms, sugared.String(), t)
+
+		// the expanded forms have the same type and print sugared
+		n, err := Parse(test.expanded)
+		check(nil, err, t)
+		check(sugared.Type(), n.Type(), t)
+		check(test.ms, n.String(), t)
+	}
+}
+
+func TestParseError(t *testing.T) {
+	tests := []struct {
+		ms  string
+		err error
+	}{
+		{"", ErrParse},
+		{"pk()", ErrParse},
+		{"pk(A", ErrParse},
+		{"pk(A))", ErrParse},
+		{"older(0)", ErrParse},
+		{"after(2147483648)", ErrParse},
+		{"sha256(abcd)", ErrParse},
+		{"multi(3,A,B)", ErrParse},
+		{"thresh(0,pk(A))", ErrParse},
+		{"x:pk(A)", ErrParse},
+		{"foo(A)", ErrParse},
+		// a K expression can't be verified
+		{"v:pk_k(A)", ErrType},
+		// or_b needs a W second argument
+		{"or_b(pk(A),pk(B))", ErrType},
+		{"and_v(pk(A),pk(B))", ErrType},
+	}
+
+	for _, test := range tests {
+		_, err := Parse(test.ms)
+		check(test.err, err, t)
+	}
+}
+
+func TestCheckSane(t *testing.T) {
+	tests := []struct {
+		ms  string
+		err error
+	}{
+		{"pk(A)", nil},
+		{"or_d(pk(A),and_v(v:pk(B),older(144)))", nil},
+		{"pk_k(A)", ErrNotTopLevel},
+		{"older(144)", ErrNoSignature},
+		// a third party can satisfy or_i(older,older) with either branch
+		{"and_v(v:pk(A),or_i(older(1),older(2)))", ErrMalleable},
+		{"and_v(v:pk(A),and_v(v:after(100),after(500000001)))", ErrTimelockMix},
+		{"and_v(v:pk(A),pk(A))", ErrDuplicateKey},
+	}
+
+	for _, test := range tests {
+		n, err := Parse(test.ms)
+		check(nil, err, t)
+		check(test.err, n.CheckSane(), t)
+	}
+}
+
+func TestScriptKeys(t *testing.T) {
+	n, err := Parse("pk(A)")
+	check(nil, err, t)
+
+	_, err = n.Script(nil)
+	check(ErrUnknownKey, err, t)
+
+	key := decodeHex(testKey)
+	s, err := n.Script(KeyMap{"A": key})
+	check(nil, err, t)
+	check("21"+testKey+"ac", hex.EncodeToString(s.RawSerialize()), t)
+
+	// an uncompressed key isn't allowed in P2WSH
+	_, err = n.Script(KeyMap{"A": append([]byte{4}, make([]byte, 64)...)})
+	check(ErrUnknownKey, err, t)
+}
+
+const testKey = "03d01115d548e7561b15c38f004d734633687cf4419620095bc5b0f47070afe85a"
+
+func decodeHex(s string) []byte {
+	b, err := hex.DecodeString(s)
+	if err != nil {
+		panic(err)
+	}
+
+	return b
+}
+
+func check(expected, recived interface{}, t *testing.T) {
+	t.Helper()
+	if !reflect.DeepEqual(recived, expected) {
+		t.Errorf("Received\n%+v\ndoesn't match expected\n%+v\n", recived, expected)
+	}
+}
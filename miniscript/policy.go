@@ -0,0 +1,398 @@
+package miniscript
+
+import (
+	"errors"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+var ErrPolicyParse = errors.New("parsing policy failed")
+var ErrPolicyCompile = errors.New("policy has no miniscript")
+
+// policy is a spending policy, weights are the relative probabilities of
+// the branches of or.
+type policy struct {
+	name    string
+	k       uint32
+	key     string
+	node    *Node
+	subs    []*policy
+	weights []uint32
+}
+
+// CompilePolicy compiles a spending policy, such as
+// or(99@pk(A),1@and(pk(B),older(144))), to the miniscript with the smallest
+// script and expected witness. A policy is made of pk, after, older, sha256,
+// hash256, ripemd160, hash160, and, or, with optional weights, and thresh.
+func CompilePolicy(s string) (*Node, error) {
+	p := &parser{s: s}
+	pol, weight, err := p.parsePolicy()
+	if err != nil {
+		return nil, err
+	}
+	if weight != 0 || p.pos != len(s) {
+		return nil, ErrPolicyParse
+	}
+
+	c := compiler{cache: map[*policy]candidates{}}
+	var best *candidate
+	var insane error
+	for _, cand := range c.compile(pol).sorted() {
+		if !cand.node.typ.Has("B") {
+			continue
+		}
+		if err := cand.node.CheckSane(); err != nil {
+			if insane == nil {
+				insane = err
+			}
+			continue
+		}
+		if best == nil || cand.better(best) {
+			best = cand
+		}
+	}
+
+	if best == nil {
+		if insane != nil {
+			return nil, insane
+		}
+		return nil, ErrPolicyCompile
+	}
+
+	return best.node, nil
+}
+
+// parsePolicy parses a policy and the weight before it, 0 when it has none.
+func (p *parser) parsePolicy() (*policy, uint32, error) {
+	name := p.word()
+
+	var weight uint32
+	if i := strings.IndexByte(name, '@'); i >= 0 {
+		w, err := strconv.ParseUint(name[:i], 10, 32)
+		if err != nil || w == 0 {
+			return nil, 0, ErrPolicyParse
+		}
+		weight, name = uint32(w), name[i+1:]
+	}
+
+	if !p.consume('(') {
+		return nil, 0, ErrPolicyParse
+	}
+
+	pol := &policy{name: name}
+	switch name {
+	case "pk":
+		pol.key = p.word()
+		if pol.key == "" {
+			return nil, 0, ErrPolicyParse
+		}
+	case "after", "older", "sha256", "hash256", "ripemd160", "hash160":
+		// the leaves are the miniscript fragments they compile to
+		n, err := Parse(name + "(" + p.word() + ")")
+		if err != nil {
+			return nil, 0, ErrPolicyParse
+		}
+		pol.node = n
+	case "and", "or":
+		for i := 0; i < 2; i++ {
+			if i > 0 && !p.consume(',') {
+				return nil, 0, ErrPolicyParse
+			}
+			sub, w, err := p.parsePolicy()
+			if err != nil {
+				return nil, 0, err
+			}
+			if w != 0 && name == "and" {
+				return nil, 0, ErrPolicyParse
+			}
+			if w == 0 {
+				w = 1
+			}
+			pol.subs = append(pol.subs, sub)
+			pol.weights = append(pol.weights, w)
+		}
+	case "thresh":
+		k, err := strconv.ParseUint(p.word(), 10, 32)
+		if err != nil {
+			return nil, 0, ErrPolicyParse
+		}
+		for p.consume(',') {
+			sub, w, err := p.parsePolicy()
+			if err != nil {
+				return nil, 0, err
+			}
+			if w != 0 {
+				return nil, 0, ErrPolicyParse
+			}
+			pol.subs = append(pol.subs, sub)
+		}
+		if k < 1 || int(k) > len(pol.subs) {
+			return nil, 0, ErrPolicyParse
+		}
+		pol.k = uint32(k)
+	default:
+		return nil, 0, ErrPolicyParse
+	}
+
+	if !p.consume(')') {
+		return nil, 0, ErrPolicyParse
+	}
+
+	return pol, weight, nil
+}
+
+// candidate is a miniscript for a policy with the expected size of its
+// satisfactions and the size of its dissatisfactions, infinite when it has
+// none.
+type candidate struct {
+	node *Node
+	sat  float64
+	dsat float64
+}
+
+func (c *candidate) cost() float64 {
+	return float64(c.node.size) + c.sat
+}
+
+func (c *candidate) better(other *candidate) bool {
+	if c.cost() != other.cost() {
+		return c.cost() < other.cost()
+	}
+	if c.dsat != other.dsat {
+		return c.dsat < other.dsat
+	}
+
+	return c.node.String() < other.node.String()
+}
+
+// candidates are the best miniscripts of a policy, one for each type.
+type candidates map[Type]*candidate
+
+// add keeps c if it is the best of its type, the ones that are malleable or
+// mix timelocks can't be part of a sane miniscript and are dropped.
+func (cs candidates) add(c *candidate) bool {
+	t := c.node.typ
+	if !t.isValid() || !t.Has("mk") || math.IsInf(c.sat, 1) {
+		return false
+	}
+
+	if old, ok := cs[t]; ok && !c.better(old) {
+		return false
+	}
+	cs[t] = c
+
+	return true
+}
+
+func (cs candidates) sorted() []*candidate {
+	result := make([]*candidate, 0, len(cs))
+	for _, c := range cs {
+		result = append(result, c)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].node.typ < result[j].node.typ
+	})
+
+	return result
+}
+
+// bestOf returns the candidate of type letters with the smallest size and
+// expected witness when satisfied with probability p.
+func (cs candidates) bestOf(letters string, p float64) *candidate {
+	var best *candidate
+	var bestCost float64
+	for _, c := range cs.sorted() {
+		if !c.node.typ.Has(letters) {
+			continue
+		}
+		cost := float64(c.node.size) + expect(p, c.sat, 1-p, c.dsat)
+		if best == nil || cost < bestCost {
+			best, bestCost = c, cost
+		}
+	}
+
+	return best
+}
+
+// expect returns the expected size of a with probability p and b with q.
+func expect(p, a, q, b float64) float64 {
+	result := 0.0
+	if p > 0 {
+		result += p * a
+	}
+	if q > 0 {
+		result += q * b
+	}
+
+	return result
+}
+
+var inf = math.Inf(1)
+
+type compiler struct {
+	cache map[*policy]candidates
+}
+
+func (c *compiler) compile(pol *policy) candidates {
+	if cs, ok := c.cache[pol]; ok {
+		return cs
+	}
+
+	cs := candidates{}
+	switch pol.name {
+	case "pk":
+		cs.add(&candidate{newNode(PK_K, 0, []string{pol.key}, nil), 73, 1})
+		cs.add(&candidate{newNode(PK_H, 0, []string{pol.key}, nil), 73 + 34, 1 + 34})
+	case "after", "older":
+		cs.add(&candidate{pol.node, 0, inf})
+	case "sha256", "hash256", "ripemd160", "hash160":
+		cs.add(&candidate{pol.node, 33, 33})
+	case "and":
+		c.compileAnd(cs, c.compile(pol.subs[0]), c.compile(pol.subs[1]))
+	case "or":
+		c.compileOr(cs, pol)
+	case "thresh":
+		c.compileThresh(cs, pol)
+	}
+
+	closeWrappers(cs)
+	c.cache[pol] = cs
+
+	return cs
+}
+
+func (c *compiler) compileAnd(cs, a, b candidates) {
+	for _, order := range [][2]candidates{{a, b}, {b, a}} {
+		for _, x := range order[0].sorted() {
+			for _, y := range order[1].sorted() {
+				sat := x.sat + y.sat
+				cs.add(&candidate{newNode(AND_V, 0, nil, nil, x.node, y.node), sat, x.sat + y.dsat})
+				cs.add(&candidate{newNode(AND_B, 0, nil, nil, x.node, y.node), sat, x.dsat + y.dsat})
+				cs.add(&candidate{newNode(ANDOR, 0, nil, nil, x.node, y.node, newNode(JUST_0, 0, nil, nil)),
+					sat, math.Min(x.sat+y.dsat, x.dsat)})
+			}
+		}
+	}
+}
+
+func (c *compiler) compileOr(cs candidates, pol *policy) {
+	total := float64(pol.weights[0] + pol.weights[1])
+	for i := 0; i < 2; i++ {
+		left, right := pol.subs[i], pol.subs[1-i]
+		p, q := float64(pol.weights[i])/total, float64(pol.weights[1-i])/total
+
+		for _, x := range c.compile(left).sorted() {
+			for _, z := range c.compile(right).sorted() {
+				dsat := x.dsat + z.dsat
+				cs.add(&candidate{newNode(OR_B, 0, nil, nil, x.node, z.node),
+					expect(p, x.sat+z.dsat, q, x.dsat+z.sat), dsat})
+				cs.add(&candidate{newNode(OR_C, 0, nil, nil, x.node, z.node),
+					expect(p, x.sat, q, x.dsat+z.sat), inf})
+				cs.add(&candidate{newNode(OR_D, 0, nil, nil, x.node, z.node),
+					expect(p, x.sat, q, x.dsat+z.sat), dsat})
+				cs.add(&candidate{newNode(OR_I, 0, nil, nil, x.node, z.node),
+					expect(p, x.sat+2, q, z.sat+1), math.Min(x.dsat+2, z.dsat+1)})
+			}
+		}
+
+		// or(and(x,y),z) is andor(x,y,z)
+		if left.name != "and" {
+			continue
+		}
+		for j := 0; j < 2; j++ {
+			for _, x := range c.compile(left.subs[j]).sorted() {
+				for _, y := range c.compile(left.subs[1-j]).sorted() {
+					for _, z := range c.compile(right).sorted() {
+						cs.add(&candidate{newNode(ANDOR, 0, nil, nil, x.node, y.node, z.node),
+							expect(p, x.sat+y.sat, q, x.dsat+z.sat),
+							math.Min(x.sat+y.dsat, x.dsat+z.dsat)})
+					}
+				}
+			}
+		}
+	}
+}
+
+func (c *compiler) compileThresh(cs candidates, pol *policy) {
+	n := len(pol.subs)
+
+	keys := []string{}
+	for _, sub := range pol.subs {
+		if sub.name == "pk" {
+			keys = append(keys, sub.key)
+		}
+	}
+	if len(keys) == n && n <= maxPubKeysPerMultisig {
+		cs.add(&candidate{newNode(MULTI, pol.k, keys, nil), 1 + 73*float64(pol.k), 1 + float64(pol.k)})
+	}
+
+	// thresh of all or one of the subexpressions is also an and or an or
+	switch {
+	case n == 1:
+		for _, sub := range c.compile(pol.subs[0]).sorted() {
+			cs.add(sub)
+		}
+	case int(pol.k) == n:
+		rest := &policy{name: "thresh", k: pol.k - 1, subs: pol.subs[1:]}
+		c.compileAnd(cs, c.compile(pol.subs[0]), c.compile(rest))
+	case pol.k == 1:
+		rest := &policy{name: "thresh", k: 1, subs: pol.subs[1:]}
+		c.compileOr(cs, &policy{name: "or", subs: []*policy{pol.subs[0], rest},
+			weights: []uint32{1, uint32(n - 1)}})
+	}
+
+	p := float64(pol.k) / float64(n)
+	subs := []*Node{}
+	sat, dsat := 0.0, 0.0
+	for i, sub := range pol.subs {
+		letters := "Wdu"
+		if i == 0 {
+			letters = "Bdu"
+		}
+		best := c.compile(sub).bestOf(letters, p)
+		if best == nil {
+			return
+		}
+		subs = append(subs, best.node)
+		sat += expect(p, best.sat, 1-p, best.dsat)
+		dsat += best.dsat
+	}
+	cs.add(&candidate{newNode(THRESH, pol.k, nil, nil, subs...), sat, dsat})
+}
+
+// closeWrappers adds the candidates wrapping the others.
+func closeWrappers(cs candidates) {
+	queue := cs.sorted()
+	for len(queue) > 0 {
+		c := queue[0]
+		queue = queue[1:]
+
+		for _, letter := range []byte("asctdvjnlu") {
+			n, err := wrap(letter, c.node)
+			if err != nil {
+				continue
+			}
+
+			sat, dsat := c.sat, c.dsat
+			switch letter {
+			case 'd':
+				sat, dsat = c.sat+2, 1
+			case 'v', 't':
+				dsat = inf
+			case 'j':
+				dsat = 1
+			case 'l':
+				sat, dsat = c.sat+1, math.Min(2, c.dsat+1)
+			case 'u':
+				sat, dsat = c.sat+2, 1
+			}
+
+			w := &candidate{n, sat, dsat}
+			if cs.add(w) {
+				queue = append(queue, w)
+			}
+		}
+	}
+}
@@ -0,0 +1,76 @@
+package miniscript
+
+import "testing"
+
+func TestCompilePolicy(t *testing.T) {
+	tests := []struct {
+		policy string
+		ms     string
+	}{
+		{"pk(A)", "pk(A)"},
+		{"or(pk(A),and(pk(B),older(144)))", "andor(pk(B),older(144),pk(A))"},
+		{"and(pk(A),pk(B))", "and_v(v:pk(A),pk(B))"},
+		{"or(pk(A),pk(B))", "or_b(pk(A),s:pk(B))"},
+		{"thresh(2,pk(A),pk(B),pk(C))", "multi(2,A,B,C)"},
+		{"thresh(2,pk(A),pk(B),older(1000))", "thresh(2,pk(A),s:pk(B),sln:older(1000))"},
+	}
+
+	for _, test := range tests {
+		n, err := CompilePolicy(test.policy)
+		check(nil, err, t)
+		check(test.ms, n.String(), t)
+		check(nil, n.CheckSane(), t)
+	}
+}
+
+// The compiled miniscripts of every branch of a policy are spendable.
+func TestCompilePolicySpend(t *testing.T) {
+	keys, sigs := testKeys("A", "B", "C")
+	tests := []struct {
+		policy   string
+		sigs     []string
+		sequence uint32
+		locktime uint32
+	}{
+		{"or(99@pk(A),1@and(pk(B),older(144)))", []string{"A"}, 0, 0},
+		{"or(99@pk(A),1@and(pk(B),older(144)))", []string{"B"}, 144, 0},
+		{"or(pk(A),and(pk(B),or(pk(C),after(50000))))", []string{"B", "C"}, 0, 0},
+		{"or(pk(A),and(pk(B),or(pk(C),after(50000))))", []string{"B"}, 0, 50000},
+		{"thresh(2,pk(A),pk(B),older(1000))", []string{"A", "B"}, 0, 0},
+		{"thresh(2,pk(A),pk(B),older(1000))", []string{"B"}, 1000, 0},
+	}
+
+	for _, test := range tests {
+		n, err := CompilePolicy(test.policy)
+		check(nil, err, t)
+
+		s := &Satisfier{Keys: keys, Signatures: map[string][]byte{}, Sequence: test.sequence, LockTime: test.locktime}
+		for _, name := range test.sigs {
+			s.Signatures[name] = sigs[name]
+		}
+		_, err = spend(n, s)
+		check(nil, err, t)
+	}
+}
+
+func TestCompilePolicyError(t *testing.T) {
+	tests := []struct {
+		policy string
+		err    error
+	}{
+		{"pk(A", ErrPolicyParse},
+		{"pk_k(A)", ErrPolicyParse},
+		{"1@pk(A)", ErrPolicyParse},
+		{"and(1@pk(A),pk(B))", ErrPolicyParse},
+		{"or(0@pk(A),pk(B))", ErrPolicyParse},
+		{"thresh(3,pk(A),pk(B))", ErrPolicyParse},
+		{"older(0)", ErrPolicyParse},
+		{"older(144)", ErrNoSignature},
+		{"and(pk(A),pk(A))", ErrDuplicateKey},
+	}
+
+	for _, test := range tests {
+		_, err := CompilePolicy(test.policy)
+		check(test.err, err, t)
+	}
+}
@@ -0,0 +1,285 @@
+package miniscript
+
+import (
+	"encoding/hex"
+	"errors"
+)
+
+var ErrNotSatisfiable = errors.New("miniscript can't be satisfied with what is available")
+
+// Satisfier is what satisfying an expression can use.
+type Satisfier struct {
+	Keys KeyMap
+	// Signatures by key name, with their sighash type byte
+	Signatures map[string][]byte
+	// Preimages by the hex of their hash
+	Preimages map[string][]byte
+	// Sequence of the spending input and LockTime of its transaction, they
+	// satisfy older and after the way OP_CHECKSEQUENCEVERIFY and
+	// OP_CHECKLOCKTIMEVERIFY check them
+	Sequence uint32
+	LockTime uint32
+}
+
+func (s *Satisfier) checkOlder(n uint32) bool {
+	const mask = sequenceTypeFlag | 0xffff
+
+	return s.Sequence&(1<<31) == 0 && s.Sequence&sequenceTypeFlag == n&sequenceTypeFlag &&
+		s.Sequence&mask >= n&mask
+}
+
+func (s *Satisfier) checkAfter(n uint32) bool {
+	return (s.LockTime < locktimeThreshold) == (n < locktimeThreshold) && s.LockTime >= n
+}
+
+// inputStack is a witness stack that satisfies or dissatisfies an
+// expression, size is its serialized size.
+type inputStack struct {
+	available bool
+	hasSig    bool
+	malleable bool
+	stack     [][]byte
+	size      int
+}
+
+var invalidStack = inputStack{}
+
+func stackOf(items ...[]byte) inputStack {
+	s := inputStack{available: true, stack: items}
+	for _, item := range items {
+		s.size += len(item) + 1
+	}
+
+	return s
+}
+
+func (s inputStack) withSig() inputStack {
+	s.hasSig = true
+	return s
+}
+
+func (s inputStack) withMalleable(malleable bool) inputStack {
+	s.malleable = s.malleable || malleable
+	return s
+}
+
+func (s inputStack) withAvailable(available bool) inputStack {
+	s.available = s.available && available
+	return s
+}
+
+// plus returns the stack of a with b on top.
+func plus(a, b inputStack) inputStack {
+	return inputStack{
+		available: a.available && b.available,
+		hasSig:    a.hasSig || b.hasSig,
+		malleable: a.malleable || b.malleable,
+		stack:     append(append([][]byte{}, a.stack...), b.stack...),
+		size:      a.size + b.size,
+	}
+}
+
+// choose is Bitcoin Core's choice between two ways of satisfying: a third
+// party can't turn one that needs a signature into one that doesn't, then
+// non-malleable ones are preferred and the smaller one wins.
+func choose(a, b inputStack) inputStack {
+	if !a.available {
+		return b
+	}
+	if !b.available {
+		return a
+	}
+
+	if !a.hasSig && b.hasSig {
+		return a
+	}
+	if !b.hasSig && a.hasSig {
+		return b
+	}
+
+	if !a.hasSig && !b.hasSig {
+		a.malleable = true
+		b.malleable = true
+	} else {
+		if b.malleable && !a.malleable {
+			return a
+		}
+		if a.malleable && !b.malleable {
+			return b
+		}
+	}
+
+	if a.size <= b.size {
+		return a
+	}
+
+	return b
+}
+
+var (
+	zeroStack   = stackOf([]byte{})
+	oneStack    = stackOf([]byte{1})
+	zero32Stack = stackOf(make([]byte, 32)).withMalleable(true)
+	emptyStack  = stackOf()
+)
+
+// Satisfy returns the smallest non-malleable witness stack satisfying the
+// expression, without the witness script.
+func (n *Node) Satisfy(s *Satisfier) ([][]byte, error) {
+	_, sat, err := n.produce(s)
+	if err != nil {
+		return nil, err
+	}
+
+	if !sat.available {
+		return nil, ErrNotSatisfiable
+	}
+	if sat.malleable {
+		return nil, ErrMalleable
+	}
+	if !sat.hasSig {
+		return nil, ErrNoSignature
+	}
+
+	return sat.stack, nil
+}
+
+// produce returns the best dissatisfaction and satisfaction of the
+// expression, it follows Bitcoin Core's ProduceInput.
+func (n *Node) produce(s *Satisfier) (inputStack, inputStack, error) {
+	nsats := make([]inputStack, len(n.Subs))
+	sats := make([]inputStack, len(n.Subs))
+	for i, sub := range n.Subs {
+		var err error
+		if nsats[i], sats[i], err = sub.produce(s); err != nil {
+			return invalidStack, invalidStack, err
+		}
+	}
+
+	switch n.Fragment {
+	case JUST_0:
+		return emptyStack, invalidStack, nil
+	case JUST_1:
+		return invalidStack, emptyStack, nil
+	case PK_K:
+		sig, ok := s.Signatures[n.Keys[0]]
+		return zeroStack, stackOf(sig).withSig().withAvailable(ok), nil
+	case PK_H:
+		key, err := s.Keys.resolve(n.Keys[0])
+		if err != nil {
+			return invalidStack, invalidStack, err
+		}
+		sig, ok := s.Signatures[n.Keys[0]]
+		return stackOf([]byte{}, key), stackOf(sig, key).withSig().withAvailable(ok), nil
+	case OLDER:
+		if s.checkOlder(n.K) {
+			return invalidStack, emptyStack, nil
+		}
+		return invalidStack, invalidStack, nil
+	case AFTER:
+		if s.checkAfter(n.K) {
+			return invalidStack, emptyStack, nil
+		}
+		return invalidStack, invalidStack, nil
+	case SHA256, HASH256, RIPEMD160, HASH160:
+		preimage, ok := s.Preimages[hex.EncodeToString(n.Data)]
+		return zero32Stack, stackOf(preimage).withAvailable(ok && len(preimage) == 32), nil
+	case WRAP_A, WRAP_S, WRAP_C, WRAP_N:
+		return nsats[0], sats[0], nil
+	case WRAP_D:
+		return zeroStack, plus(sats[0], oneStack), nil
+	case WRAP_V:
+		return invalidStack, sats[0], nil
+	case WRAP_J:
+		return zeroStack.withMalleable(nsats[0].available && !nsats[0].hasSig), sats[0], nil
+	case AND_V:
+		x, y := 0, 1
+		return plus(nsats[y], sats[x]), plus(sats[y], sats[x]), nil
+	case AND_B:
+		x, y := 0, 1
+		nsat := choose(choose(plus(nsats[y], nsats[x]),
+			plus(sats[y], nsats[x]).withMalleable(true)),
+			plus(nsats[y], sats[x]).withMalleable(true))
+		return nsat, plus(sats[y], sats[x]), nil
+	case OR_B:
+		x, z := 0, 1
+		sat := choose(choose(plus(nsats[z], sats[x]), plus(sats[z], nsats[x])),
+			plus(sats[z], sats[x]).withMalleable(true))
+		return plus(nsats[z], nsats[x]), sat, nil
+	case OR_C:
+		x, z := 0, 1
+		return invalidStack, choose(sats[x], plus(sats[z], nsats[x])), nil
+	case OR_D:
+		x, z := 0, 1
+		return plus(nsats[z], nsats[x]), choose(sats[x], plus(sats[z], nsats[x])), nil
+	case OR_I:
+		x, z := 0, 1
+		nsat := choose(plus(nsats[x], oneStack), plus(nsats[z], zeroStack))
+		sat := choose(plus(sats[x], oneStack), plus(sats[z], zeroStack))
+		return nsat, sat, nil
+	case ANDOR:
+		x, y, z := 0, 1, 2
+		nsat := choose(plus(nsats[y], sats[x]), plus(nsats[z], nsats[x]))
+		sat := choose(plus(sats[y], sats[x]), plus(sats[z], nsats[x]))
+		return nsat, sat, nil
+	case MULTI:
+		return n.produceMulti(s)
+	case THRESH:
+		return n.produceThresh(nsats, sats)
+	}
+
+	return invalidStack, invalidStack, ErrType
+}
+
+// produceMulti finds the best choice of k signatures, best[j] is the best
+// stack with j of the signatures of the keys so far.
+func (n *Node) produceMulti(s *Satisfier) (inputStack, inputStack, error) {
+	// the extra element OP_CHECKMULTISIG pops
+	best := []inputStack{zeroStack}
+	for _, key := range n.Keys {
+		sig, ok := s.Signatures[key]
+		sat := stackOf(sig).withSig().withAvailable(ok)
+
+		next := []inputStack{best[0]}
+		for j := 1; j < len(best); j++ {
+			next = append(next, choose(best[j], plus(best[j-1], sat)))
+		}
+		next = append(next, plus(best[len(best)-1], sat))
+		best = next
+	}
+
+	nsat := zeroStack
+	for i := uint32(0); i < n.K; i++ {
+		nsat = plus(nsat, zeroStack)
+	}
+
+	return nsat, best[n.K], nil
+}
+
+// produceThresh finds the best choice of k satisfied subexpressions, best[j]
+// is the best stack satisfying j of the last ones so far.
+func (n *Node) produceThresh(nsats, sats []inputStack) (inputStack, inputStack, error) {
+	best := []inputStack{emptyStack}
+	for i := len(n.Subs) - 1; i >= 0; i-- {
+		next := []inputStack{plus(best[0], nsats[i])}
+		for j := 1; j < len(best); j++ {
+			next = append(next, choose(plus(best[j], nsats[i]), plus(best[j-1], sats[i])))
+		}
+		next = append(next, plus(best[len(best)-1], sats[i]))
+		best = next
+	}
+
+	// dissatisfying all is the canonical dissatisfaction, the others that
+	// don't satisfy exactly k are malleable
+	nsat := invalidStack
+	for j := range best {
+		if j != 0 && j != int(n.K) {
+			best[j] = best[j].withMalleable(true)
+		}
+		if j != int(n.K) {
+			nsat = choose(nsat, best[j])
+		}
+	}
+
+	return nsat, best[n.K], nil
+}
@@ -0,0 +1,113 @@
+package miniscript
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"math/big"
+	"testing"
+
+	u "github.com/lobiCode/prog_btc_go/btcutils"
+	c "github.com/lobiCode/prog_btc_go/cryptography"
+	"github.com/lobiCode/prog_btc_go/script"
+)
+
+var testZ = u.Hash256([]byte("miniscript"))
+
+// testKeys returns the public keys of the names and their signatures of
+// testZ, the secret of a name is its position plus one.
+func testKeys(names ...string) (KeyMap, map[string][]byte) {
+	keys, sigs := KeyMap{}, map[string][]byte{}
+	for i, name := range names {
+		key := c.NewPrivateKey(big.NewInt(int64(i + 1)))
+		keys[name] = key.Sec(true)
+		// SIGHASH_ALL
+		sigs[name] = append(key.Sign(u.ParseBytes(testZ)).Der(), 0x01)
+	}
+
+	return keys, sigs
+}
+
+// spend satisfies the expression and evaluates the witness against its
+// P2WSH script pubkey.
+func spend(n *Node, s *Satisfier) ([][]byte, error) {
+	witness, err := n.Satisfy(s)
+	if err != nil {
+		return nil, err
+	}
+
+	witnessScript, err := n.Script(s.Keys)
+	if err != nil {
+		return nil, err
+	}
+	scriptPubKey, err := n.WitnessScriptHash(s.Keys)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx := &script.TxContext{
+		SigHash: func(hashType uint32, ext *script.SigHashExt) ([]byte, error) {
+			return testZ, nil
+		},
+		Version:  2,
+		LockTime: s.LockTime,
+		Sequence: s.Sequence,
+	}
+	stack := append(append([][]byte{}, witness...), witnessScript.RawSerialize())
+
+	return witness, script.Evaluate(ctx, &script.Script{}, scriptPubKey, stack, script.STANDARD_SCRIPT_VERIFY_FLAGS)
+}
+
+func TestSatisfy(t *testing.T) {
+	keys, sigs := testKeys("A", "B", "C")
+	preimage := make([]byte, 32)
+	preimage[0] = 1
+	hash := sha256.Sum256(preimage)
+	h := hex.EncodeToString(hash[:])
+
+	tests := []struct {
+		ms       string
+		sigs     []string
+		sequence uint32
+		locktime uint32
+		stack    [][]byte
+		err      error
+	}{
+		{"pk(A)", []string{"A"}, 0, 0, [][]byte{sigs["A"]}, nil},
+		{"pk(A)", []string{"B"}, 0, 0, nil, ErrNotSatisfiable},
+		{"pkh(A)", []string{"A"}, 0, 0, [][]byte{sigs["A"], keys["A"]}, nil},
+		{"or_d(pk(A),and_v(v:pk(B),older(144)))", []string{"A", "B"}, 0, 0, [][]byte{sigs["A"]}, nil},
+		// the other branch dissatisfies pk(A) with an empty signature
+		{"or_d(pk(A),and_v(v:pk(B),older(144)))", []string{"B"}, 144, 0, [][]byte{sigs["B"], {}}, nil},
+		{"or_d(pk(A),and_v(v:pk(B),older(144)))", []string{"B"}, 143, 0, nil, ErrNotSatisfiable},
+		{"or_d(pk(A),and_v(v:pk(B),older(144)))", []string{"B"}, 144 | 1<<22, 0, nil, ErrNotSatisfiable},
+		{"and_v(v:pk(A),after(1000))", []string{"A"}, 0, 1000, [][]byte{sigs["A"]}, nil},
+		{"and_v(v:pk(A),after(1000))", []string{"A"}, 0, 500000000, nil, ErrNotSatisfiable},
+		// the signatures are in the order of the keys
+		{"multi(2,A,B,C)", []string{"C", "A"}, 0, 0, [][]byte{{}, sigs["A"], sigs["C"]}, nil},
+		{"multi(2,A,B,C)", []string{"C"}, 0, 0, nil, ErrNotSatisfiable},
+		{"and_v(v:pk(A),sha256(" + h + "))", []string{"A"}, 0, 0, [][]byte{preimage, sigs["A"]}, nil},
+		{"thresh(2,pk(A),s:pk(B),sln:older(10))", []string{"B"}, 10, 0, [][]byte{{}, sigs["B"], {}}, nil},
+		{"or_i(pk(A),pk(B))", []string{"B"}, 0, 0, [][]byte{sigs["B"], {}}, nil},
+		{"older(10)", nil, 10, 0, nil, ErrNoSignature},
+	}
+
+	for _, test := range tests {
+		n, err := Parse(test.ms)
+		check(nil, err, t)
+
+		s := &Satisfier{
+			Keys:       keys,
+			Signatures: map[string][]byte{},
+			Preimages:  map[string][]byte{h: preimage},
+			Sequence:   test.sequence,
+			LockTime:   test.locktime,
+		}
+		for _, name := range test.sigs {
+			s.Signatures[name] = sigs[name]
+		}
+
+		stack, err := spend(n, s)
+		check(test.err, err, t)
+		check(test.stack, stack, t)
+	}
+}
@@ -0,0 +1,156 @@
+package miniscript
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+
+	u "github.com/lobiCode/prog_btc_go/btcutils"
+	"github.com/lobiCode/prog_btc_go/script"
+)
+
+var ErrUnknownKey = errors.New("miniscript key isn't a compressed public key")
+
+// KeyMap resolves the key names of expressions to public keys, a name it
+// doesn't have has to be the hex of a compressed public key.
+type KeyMap map[string][]byte
+
+func (keys KeyMap) resolve(name string) ([]byte, error) {
+	key, ok := keys[name]
+	if !ok {
+		var err error
+		if key, err = hex.DecodeString(name); err != nil {
+			return nil, ErrUnknownKey
+		}
+	}
+
+	if len(key) != compressedPubKeySize || (key[0] != 2 && key[0] != 3) {
+		return nil, ErrUnknownKey
+	}
+
+	return key, nil
+}
+
+// Script returns the script of the expression.
+func (n *Node) Script(keys KeyMap) (*script.Script, error) {
+	raw, err := n.encode(keys)
+	if err != nil {
+		return nil, err
+	}
+
+	return script.ParseRaw(raw)
+}
+
+// WitnessScriptHash returns the P2WSH script pubkey paying to the expression.
+func (n *Node) WitnessScriptHash(keys KeyMap) (*script.Script, error) {
+	raw, err := n.encode(keys)
+	if err != nil {
+		return nil, err
+	}
+
+	sum := sha256.Sum256(raw)
+
+	return script.P2wsh(sum[:]), nil
+}
+
+// verifyOpcodes are the opcodes that have a VERIFY form one after them.
+var verifyOpcodes = map[byte]bool{0x87: true, 0x9c: true, 0xac: true, 0xae: true}
+
+func (n *Node) encode(keys KeyMap) ([]byte, error) {
+	subs := make([][]byte, len(n.Subs))
+	for i, sub := range n.Subs {
+		raw, err := sub.encode(keys)
+		if err != nil {
+			return nil, err
+		}
+		subs[i] = raw
+	}
+
+	cat := func(parts ...[]byte) []byte {
+		result := []byte{}
+		for _, p := range parts {
+			result = append(result, p...)
+		}
+		return result
+	}
+	op := func(ops ...byte) []byte {
+		return ops
+	}
+
+	switch n.Fragment {
+	case JUST_0:
+		return op(0x00), nil
+	case JUST_1:
+		return op(0x51), nil
+	case PK_K:
+		key, err := keys.resolve(n.Keys[0])
+		if err != nil {
+			return nil, err
+		}
+		return script.PushData(key), nil
+	case PK_H:
+		key, err := keys.resolve(n.Keys[0])
+		if err != nil {
+			return nil, err
+		}
+		return cat(op(0x76, 0xa9), script.PushData(u.Hash160(key)), op(0x88)), nil
+	case OLDER:
+		return cat(script.PushNum(int64(n.K)), op(0xb2)), nil
+	case AFTER:
+		return cat(script.PushNum(int64(n.K)), op(0xb1)), nil
+	case SHA256, HASH256, RIPEMD160, HASH160:
+		hashOp := map[Fragment]byte{SHA256: 0xa8, HASH256: 0xaa, RIPEMD160: 0xa6, HASH160: 0xa9}[n.Fragment]
+		return cat(op(0x82), script.PushNum(32), op(0x88, hashOp), script.PushData(n.Data), op(0x87)), nil
+	case WRAP_A:
+		return cat(op(0x6b), subs[0], op(0x6c)), nil
+	case WRAP_S:
+		return cat(op(0x7c), subs[0]), nil
+	case WRAP_C:
+		return cat(subs[0], op(0xac)), nil
+	case WRAP_D:
+		return cat(op(0x76, 0x63), subs[0], op(0x68)), nil
+	case WRAP_V:
+		raw := subs[0]
+		if last := len(raw) - 1; !n.Subs[0].typ.Has("x") && last >= 0 && verifyOpcodes[raw[last]] {
+			raw[last]++
+			return raw, nil
+		}
+		return cat(raw, op(0x69)), nil
+	case WRAP_J:
+		return cat(op(0x82, 0x92, 0x63), subs[0], op(0x68)), nil
+	case WRAP_N:
+		return cat(subs[0], op(0x92)), nil
+	case AND_V:
+		return cat(subs[0], subs[1]), nil
+	case AND_B:
+		return cat(subs[0], subs[1], op(0x9a)), nil
+	case OR_B:
+		return cat(subs[0], subs[1], op(0x9b)), nil
+	case OR_C:
+		return cat(subs[0], op(0x64), subs[1], op(0x68)), nil
+	case OR_D:
+		return cat(subs[0], op(0x73, 0x64), subs[1], op(0x68)), nil
+	case OR_I:
+		return cat(op(0x63), subs[0], op(0x67), subs[1], op(0x68)), nil
+	case ANDOR:
+		return cat(subs[0], op(0x64), subs[2], op(0x67), subs[1], op(0x68)), nil
+	case THRESH:
+		result := subs[0]
+		for _, sub := range subs[1:] {
+			result = cat(result, sub, op(0x93))
+		}
+		return cat(result, script.PushNum(int64(n.K)), op(0x87)), nil
+	case MULTI:
+		result := script.PushNum(int64(n.K))
+		for _, name := range n.Keys {
+			key, err := keys.resolve(name)
+			if err != nil {
+				return nil, err
+			}
+			result = cat(result, script.PushData(key))
+		}
+		return cat(result, script.PushNum(int64(len(n.Keys))), op(0xae)), nil
+	}
+
+	return nil, ErrType
+}
@@ -0,0 +1,245 @@
+package miniscript
+
+import "strings"
+
+// Type is the set of BIP379 properties of an expression, one basic type
+// B, V, K or W and the properties of its satisfactions:
+//
+//	z, o, n   consumes zero, one, or a nonzero number of stack elements
+//	d, u      can be dissatisfied, leaves exactly 1 on success
+//	e, f, s   non-malleable dissatisfaction, no dissatisfaction, needs a signature
+//	m         has a non-malleable satisfaction
+//	x         ends with an opcode that has no VERIFY form
+//	g, h      has a relative time, height timelock
+//	i, j      has an absolute time, height timelock
+//	k         no branch mixes timelock kinds
+type Type uint32
+
+const typeLetters = "BVKWzonduefsmxghijk"
+
+// mst returns the type with the properties of the letters.
+func mst(letters string) Type {
+	var t Type
+	for _, l := range letters {
+		i := strings.IndexRune(typeLetters, l)
+		if i < 0 {
+			panic("unknown type property " + string(l))
+		}
+		t |= 1 << uint(i)
+	}
+
+	return t
+}
+
+// Has reports whether the type has every property of the letters.
+func (t Type) Has(letters string) bool {
+	want := mst(letters)
+
+	return t&want == want
+}
+
+func (t Type) String() string {
+	var result []byte
+	for i := range typeLetters {
+		if t&(1<<uint(i)) != 0 {
+			result = append(result, typeLetters[i])
+		}
+	}
+
+	return string(result)
+}
+
+// iff returns t when cond holds and no properties otherwise.
+func iff(t Type, cond bool) Type {
+	if cond {
+		return t
+	}
+
+	return 0
+}
+
+// isValid reports whether the type has exactly one basic type.
+func (t Type) isValid() bool {
+	n := 0
+	for _, b := range "BVKW" {
+		if t.Has(string(b)) {
+			n++
+		}
+	}
+
+	return n == 1
+}
+
+const (
+	sequenceTypeFlag  = 1 << 22
+	locktimeThreshold = 500000000
+)
+
+// mixesTimelocks reports whether satisfying both x and y takes a time and a
+// height timelock of the same kind.
+func mixesTimelocks(x, y Type) bool {
+	return (x.Has("g") && y.Has("h")) || (x.Has("h") && y.Has("g")) ||
+		(x.Has("i") && y.Has("j")) || (x.Has("j") && y.Has("i"))
+}
+
+// computeType is Bitcoin Core's ComputeType for P2WSH, the type of a
+// fragment given the types of its subexpressions.
+func computeType(frag Fragment, k uint32, subs []Type) Type {
+	var x, y, z Type
+	if len(subs) > 0 {
+		x = subs[0]
+	}
+	if len(subs) > 1 {
+		y = subs[1]
+	}
+	if len(subs) > 2 {
+		z = subs[2]
+	}
+
+	switch frag {
+	case PK_K:
+		return mst("Konudemsxk")
+	case PK_H:
+		return mst("Knudemsxk")
+	case OLDER:
+		return iff(mst("g"), k&sequenceTypeFlag != 0) | iff(mst("h"), k&sequenceTypeFlag == 0) | mst("Bzfmxk")
+	case AFTER:
+		return iff(mst("i"), k >= locktimeThreshold) | iff(mst("j"), k < locktimeThreshold) | mst("Bzfmxk")
+	case SHA256, RIPEMD160, HASH256, HASH160:
+		return mst("Bonudmk")
+	case JUST_1:
+		return mst("Bzufmxk")
+	case JUST_0:
+		return mst("Bzudemsxk")
+	case WRAP_A:
+		return iff(mst("W"), x.Has("B")) | x&mst("ghijk") | x&mst("udfems") | mst("x")
+	case WRAP_S:
+		return iff(mst("W"), x.Has("Bo")) | x&mst("ghijk") | x&mst("udfemsx")
+	case WRAP_C:
+		return iff(mst("B"), x.Has("K")) | x&mst("ghijk") | x&mst("ondfem") | mst("us")
+	case WRAP_D:
+		return iff(mst("B"), x.Has("Vz")) | iff(mst("o"), x.Has("z")) | iff(mst("e"), x.Has("f")) |
+			x&mst("ghijk") | x&mst("ms") | mst("ndx")
+	case WRAP_V:
+		return iff(mst("V"), x.Has("B")) | x&mst("ghijk") | x&mst("zonms") | mst("fx")
+	case WRAP_J:
+		return iff(mst("B"), x.Has("Bn")) | iff(mst("e"), x.Has("f")) | x&mst("ghijk") | x&mst("oums") | mst("ndx")
+	case WRAP_N:
+		return x&mst("ghijk") | x&mst("Bzondfems") | mst("ux")
+	case AND_V:
+		return iff(y&mst("KVB"), x.Has("V")) |
+			x&mst("n") | iff(y&mst("n"), x.Has("z")) |
+			iff((x|y)&mst("o"), (x|y).Has("z")) |
+			x&y&mst("dmz") |
+			(x|y)&mst("s") |
+			iff(mst("f"), y.Has("f") || x.Has("s")) |
+			y&mst("ux") |
+			(x|y)&mst("ghij") |
+			iff(mst("k"), (x&y).Has("k") && !mixesTimelocks(x, y))
+	case AND_B:
+		return iff(x&mst("B"), y.Has("W")) |
+			iff((x|y)&mst("o"), (x|y).Has("z")) |
+			x&mst("n") | iff(y&mst("n"), x.Has("z")) |
+			iff(x&y&mst("e"), (x&y).Has("s")) |
+			x&y&mst("dzm") |
+			iff(mst("f"), (x&y).Has("f") || x.Has("sf") || y.Has("sf")) |
+			(x|y)&mst("s") |
+			mst("ux") |
+			(x|y)&mst("ghij") |
+			iff(mst("k"), (x&y).Has("k") && !mixesTimelocks(x, y))
+	case OR_B:
+		return iff(mst("B"), x.Has("Bd") && y.Has("Wd")) |
+			iff((x|y)&mst("o"), (x|y).Has("z")) |
+			iff(x&y&mst("m"), (x|y).Has("s") && (x&y).Has("e")) |
+			x&y&mst("zse") |
+			mst("dux") |
+			(x|y)&mst("ghij") |
+			x&y&mst("k")
+	case OR_D:
+		return iff(y&mst("B"), x.Has("Bdu")) |
+			iff(x&mst("o"), y.Has("z")) |
+			iff(x&y&mst("m"), x.Has("e") && (x|y).Has("s")) |
+			x&y&mst("zs") |
+			y&mst("ufde") |
+			mst("x") |
+			(x|y)&mst("ghij") |
+			x&y&mst("k")
+	case OR_C:
+		return iff(y&mst("V"), x.Has("Bdu")) |
+			iff(x&mst("o"), y.Has("z")) |
+			iff(x&y&mst("m"), x.Has("e") && (x|y).Has("s")) |
+			x&y&mst("zs") |
+			mst("fx") |
+			(x|y)&mst("ghij") |
+			x&y&mst("k")
+	case OR_I:
+		return x&y&mst("VBKufs") |
+			iff(mst("o"), (x&y).Has("z")) |
+			iff((x|y)&mst("e"), (x|y).Has("f")) |
+			iff(x&y&mst("m"), (x|y).Has("s")) |
+			(x|y)&mst("d") |
+			mst("x") |
+			(x|y)&mst("ghij") |
+			x&y&mst("k")
+	case ANDOR:
+		return iff(y&z&mst("BKV"), x.Has("Bdu")) |
+			x&y&z&mst("z") |
+			iff((x|(y&z))&mst("o"), (x|(y&z)).Has("z")) |
+			y&z&mst("u") |
+			iff(z&mst("f"), x.Has("s") || y.Has("f")) |
+			z&mst("d") |
+			iff(z&mst("e"), x.Has("s") || y.Has("f")) |
+			iff(x&y&z&mst("m"), x.Has("e") && (x|y|z).Has("s")) |
+			z&(x|y)&mst("s") |
+			mst("x") |
+			(x|y|z)&mst("ghij") |
+			iff(mst("k"), (x&y&z).Has("k") && !mixesTimelocks(x, y))
+	case MULTI:
+		return mst("Bnudemsk")
+	case THRESH:
+		return threshType(k, subs)
+	}
+
+	return 0
+}
+
+func threshType(k uint32, subs []Type) Type {
+	allE, allM := true, true
+	args, numS := 0, 0
+	acc := mst("k")
+	for i, t := range subs {
+		want := "Wdu"
+		if i == 0 {
+			want = "Bdu"
+		}
+		if !t.Has(want) {
+			return 0
+		}
+
+		allE = allE && t.Has("e")
+		allM = allM && t.Has("m")
+		if t.Has("s") {
+			numS++
+		}
+		switch {
+		case t.Has("z"):
+		case t.Has("o"):
+			args++
+		default:
+			args += 2
+		}
+
+		acc = (acc|t)&mst("ghij") |
+			iff(mst("k"), (acc&t).Has("k") && (k <= 1 || !mixesTimelocks(acc, t)))
+	}
+
+	n := len(subs)
+
+	return mst("Bdu") |
+		iff(mst("z"), args == 0) |
+		iff(mst("o"), args == 1) |
+		iff(mst("e"), allE && numS == n) |
+		iff(mst("m"), allE && allM && numS >= n-int(k)) |
+		iff(mst("s"), numS >= n-int(k)+1) |
+		acc
+}
@@ -0,0 +1,223 @@
+// Package mnemonic implements BIP39 mnemonic phrases: generating them from
+// entropy, checking their checksum, deriving the seed of an HD wallet and
+// recovering a phrase with a missing word.
+package mnemonic
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/sha512"
+	"errors"
+	"strings"
+
+	"github.com/lobiCode/prog_btc_go/chaincfg"
+	c "github.com/lobiCode/prog_btc_go/cryptography"
+	"golang.org/x/crypto/pbkdf2"
+	"golang.org/x/text/unicode/norm"
+)
+
+var ErrEntropyLength = errors.New("entropy must be 128 to 256 bits, a multiple of 32")
+var ErrWordCount = errors.New("mnemonic must have 12, 15, 18, 21 or 24 words")
+var ErrUnknownWord = errors.New("word not in the wordlist")
+var ErrChecksum = errors.New("mnemonic checksum mismatch")
+var ErrRecover = errors.New("mnemonic has no single missing word")
+
+// Missing marks the word Recover looks for.
+const Missing = "?"
+
+const seedIterations = 2048
+
+// Wordlist is the 2048 words of a language, in order. New joins the words of
+// a phrase with ASCII spaces, so it only suits the languages BIP39 writes
+// that way; a Japanese phrase needs its ideographic spaces put back by the
+// caller. Phrases read may separate the words with any Unicode space.
+type Wordlist []string
+
+func (w Wordlist) index(word string) int {
+	for i, v := range w {
+		if v == word {
+			return i
+		}
+	}
+
+	return -1
+}
+
+// NewEntropy returns bits of random entropy.
+func NewEntropy(bits int) ([]byte, error) {
+	if !validEntropyBits(bits) {
+		return nil, ErrEntropyLength
+	}
+
+	entropy := make([]byte, bits/8)
+	if _, err := rand.Read(entropy); err != nil {
+		return nil, err
+	}
+
+	return entropy, nil
+}
+
+// New returns the mnemonic of entropy, its words joined by ASCII spaces.
+func New(entropy []byte, wordlist Wordlist) (string, error) {
+	if !validEntropyBits(len(entropy) * 8) {
+		return "", ErrEntropyLength
+	}
+
+	indexes := wordIndexes(entropy)
+	words := make([]string, len(indexes))
+	for i, index := range indexes {
+		words[i] = wordlist[index]
+	}
+
+	return strings.Join(words, " "), nil
+}
+
+// Entropy returns the entropy a mnemonic encodes, checking its checksum.
+func Entropy(phrase string, wordlist Wordlist) ([]byte, error) {
+	words := strings.Fields(phrase)
+	if !validWordCount(len(words)) {
+		return nil, ErrWordCount
+	}
+
+	indexes := make([]int, len(words))
+	for i, word := range words {
+		if indexes[i] = wordlist.index(word); indexes[i] < 0 {
+			return nil, ErrUnknownWord
+		}
+	}
+
+	return entropyOf(indexes)
+}
+
+// Validate checks that the words of the mnemonic are in the wordlist and
+// its checksum.
+func Validate(phrase string, wordlist Wordlist) error {
+	_, err := Entropy(phrase, wordlist)
+	return err
+}
+
+// Seed returns the 64 byte seed of a mnemonic and a passphrase, both taken
+// in the NFKD form. The phrase isn't validated.
+func Seed(phrase, passphrase string) []byte {
+	phrase = norm.NFKD.String(strings.Join(strings.Fields(phrase), " "))
+	passphrase = norm.NFKD.String(passphrase)
+	return pbkdf2.Key([]byte(phrase), []byte("mnemonic"+passphrase), seedIterations, 64, sha512.New)
+}
+
+// NewMasterKey validates the mnemonic and returns the BIP32 master key of its
+// seed.
+func NewMasterKey(phrase, passphrase string, wordlist Wordlist, params *chaincfg.Params) (*c.ExtendedKey, error) {
+	if err := Validate(phrase, wordlist); err != nil {
+		return nil, err
+	}
+
+	return c.NewMasterKey(Seed(phrase, passphrase), params)
+}
+
+// Recover returns the mnemonics with a valid checksum the phrase can be. One
+// of its words is either Missing or left out.
+func Recover(phrase string, wordlist Wordlist) ([]string, error) {
+	words := strings.Fields(phrase)
+
+	missing := -1
+	indexes := []int{}
+	for i, word := range words {
+		if word == Missing {
+			if missing >= 0 {
+				return nil, ErrRecover
+			}
+			missing = i
+			continue
+		}
+		index := wordlist.index(word)
+		if index < 0 {
+			return nil, ErrUnknownWord
+		}
+		indexes = append(indexes, index)
+	}
+
+	if !validWordCount(len(indexes) + 1) {
+		return nil, ErrRecover
+	}
+
+	// a left out word could have been at any position
+	positions := []int{missing}
+	if missing < 0 {
+		positions = positions[:0]
+		for i := 0; i <= len(indexes); i++ {
+			positions = append(positions, i)
+		}
+	}
+
+	found := map[string]bool{}
+	phrases := []string{}
+	candidate := make([]int, len(indexes)+1)
+	for _, position := range positions {
+		copy(candidate, indexes[:position])
+		copy(candidate[position+1:], indexes[position:])
+		for index := range wordlist {
+			candidate[position] = index
+			if _, err := entropyOf(candidate); err != nil {
+				continue
+			}
+
+			words := make([]string, len(candidate))
+			for i, index := range candidate {
+				words[i] = wordlist[index]
+			}
+			phrase := strings.Join(words, " ")
+			if !found[phrase] {
+				found[phrase] = true
+				phrases = append(phrases, phrase)
+			}
+		}
+	}
+
+	return phrases, nil
+}
+
+func validEntropyBits(bits int) bool {
+	return bits >= 128 && bits <= 256 && bits%32 == 0
+}
+
+func validWordCount(n int) bool {
+	return n >= 12 && n <= 24 && n%3 == 0
+}
+
+// wordIndexes splits the entropy followed by its checksum, the first bit of
+// its sha256 for every 32 bits, into 11 bit word indexes.
+func wordIndexes(entropy []byte) []int {
+	sum := sha256.Sum256(entropy)
+	b := append(append([]byte{}, entropy...), sum[0])
+
+	n := len(entropy) * 8 * 33 / 32 / 11
+	indexes := make([]int, n)
+	for i := range indexes {
+		for j := 0; j < 11; j++ {
+			bit := i*11 + j
+			indexes[i] = indexes[i]<<1 | int(b[bit/8]>>(7-uint(bit%8))&1)
+		}
+	}
+
+	return indexes
+}
+
+// entropyOf is the inverse of wordIndexes.
+func entropyOf(indexes []int) ([]byte, error) {
+	entropy := make([]byte, len(indexes)*11*32/33/8)
+	for i := range entropy {
+		for j := 0; j < 8; j++ {
+			bit := i*8 + j
+			index := indexes[bit/11]
+			entropy[i] = entropy[i]<<1 | byte(index>>(10-uint(bit%11))&1)
+		}
+	}
+
+	// the checksum is all in the last word
+	expected := wordIndexes(entropy)
+	if expected[len(expected)-1] != indexes[len(indexes)-1] {
+		return nil, ErrChecksum
+	}
+
+	return entropy, nil
+}
@@ -21,12 +21,6 @@ func ParseNetMagic(r io.Reader) (NetMagic, error) {
 	return m, err
 }
 
-var (
-	MainNet  NetMagic = 0xd9b4bef9
-	TestNet  NetMagic = 0xdab5bffa
-	TestNet3 NetMagic = 0x0709110b
-)
-
 type Envelope struct {
 	Magic   NetMagic
 	Command CommandMsg
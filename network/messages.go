@@ -11,6 +11,7 @@ import (
 	"github.com/lobiCode/prog_btc_go/block"
 	"github.com/lobiCode/prog_btc_go/bloom"
 	u "github.com/lobiCode/prog_btc_go/btcutils"
+	"github.com/lobiCode/prog_btc_go/chaincfg"
 	"github.com/lobiCode/prog_btc_go/merkletree"
 	"github.com/lobiCode/prog_btc_go/tx"
 )
@@ -55,7 +56,7 @@ func (c CommandMsg) Encode() []byte {
 	return command
 }
 
-func (c CommandMsg) GetMessage(r io.Reader, testnet bool) (Message, error) {
+func (c CommandMsg) GetMessage(r io.Reader, params *chaincfg.Params) (Message, error) {
 	var m Message
 
 	switch {
@@ -65,7 +66,7 @@ func (c CommandMsg) GetMessage(r io.Reader, testnet bool) (Message, error) {
 		m = &TxMessage{}
 	}
 
-	err := m.Parse(r, testnet)
+	err := m.Parse(r, params)
 	return m, err
 }
 
@@ -105,7 +106,7 @@ func (addr *NetAddr) Encode() []byte {
 
 type Message interface {
 	Serialize() []byte
-	Parse(io.Reader, bool) error
+	Parse(io.Reader, *chaincfg.Params) error
 	GetCommand() CommandMsg
 }
 
@@ -121,7 +122,7 @@ func (m *MerkleMessage) Serialize() []byte {
 	return nil
 }
 
-func (m *MerkleMessage) Parse(r io.Reader, testnet bool) error {
+func (m *MerkleMessage) Parse(r io.Reader, params *chaincfg.Params) error {
 	var err error
 	m.MerkleBlock, err = merkletree.Parse(r)
 
@@ -140,9 +141,9 @@ func (m *TxMessage) Serialize() []byte {
 	return nil
 }
 
-func (m *TxMessage) Parse(r io.Reader, testnet bool) error {
+func (m *TxMessage) Parse(r io.Reader, params *chaincfg.Params) error {
 	var err error
-	m.Tx, err = tx.ParseTx(r, testnet)
+	m.Tx, err = tx.ParseTx(r)
 
 	return err
 }
@@ -200,7 +201,7 @@ func (m *VesrionMessage) Serialize() []byte {
 	return result
 }
 
-func (m *VesrionMessage) Parse(r io.Reader, testnet bool) error {
+func (m *VesrionMessage) Parse(r io.Reader, params *chaincfg.Params) error {
 	return nil
 }
 
@@ -238,7 +239,7 @@ func (m *VerackMessage) GetCommand() CommandMsg {
 func (m *VerackMessage) Serialize() []byte {
 	return []byte{}
 }
-func (m *VerackMessage) Parse(r io.Reader, testnet bool) error {
+func (m *VerackMessage) Parse(r io.Reader, params *chaincfg.Params) error {
 	return nil
 }
 
@@ -252,7 +253,7 @@ func (m *GetHeadersMessage) GetCommand() CommandMsg {
 	return GetHeadersCommand
 }
 
-func (m *GetHeadersMessage) Parse(r io.Reader, testnet bool) error {
+func (m *GetHeadersMessage) Parse(r io.Reader, params *chaincfg.Params) error {
 	return nil
 }
 
@@ -287,7 +288,7 @@ func (m *HeadersMessage) GetCommand() CommandMsg {
 	return HeadersCommand
 }
 
-func (m *HeadersMessage) Parse(r io.Reader, testnet bool) error {
+func (m *HeadersMessage) Parse(r io.Reader, params *chaincfg.Params) error {
 	blockCount, err := u.ReadVariant(r)
 	if err != nil {
 		return err
@@ -329,7 +330,7 @@ func (m *PongMessage) Serialize() []byte {
 	return m.Nonce
 }
 
-func (m *PongMessage) Parse(r io.Reader, testnet bool) error {
+func (m *PongMessage) Parse(r io.Reader, params *chaincfg.Params) error {
 	b, err := u.Read(r, 8)
 	if err != nil {
 		return err
@@ -356,7 +357,7 @@ func (m *FilterLoadMessage) Serialize() []byte {
 	return m.bloom.FilterLoad(1)
 }
 
-func (m *FilterLoadMessage) Parse(r io.Reader, testnet bool) error {
+func (m *FilterLoadMessage) Parse(r io.Reader, params *chaincfg.Params) error {
 	return nil
 }
 
@@ -385,7 +386,7 @@ func (m *GetDataMessage) Serialize() []byte {
 	return result
 }
 
-func (m *GetDataMessage) Parse(r io.Reader, testnet bool) error {
+func (m *GetDataMessage) Parse(r io.Reader, params *chaincfg.Params) error {
 	return nil
 }
 
@@ -7,13 +7,15 @@ import (
 	"net"
 	"strings"
 	"time"
+
+	"github.com/lobiCode/prog_btc_go/chaincfg"
 )
 
 type Node struct {
 	conn     net.Conn
 	address  string
 	port     string
-	testnet  bool
+	params   *chaincfg.Params
 	netMagic NetMagic
 }
 
@@ -58,7 +60,13 @@ func (n *Node) WaitForCommand(commands ...CommandMsg) (*Envelope, error) {
 	}
 }
 
-func NewNode(address, port string, testnet bool) (*Node, error) {
+// NewNode connects to a node of the network, on its default port when port
+// is empty.
+func NewNode(address, port string, params *chaincfg.Params) (*Node, error) {
+	if port == "" {
+		port = params.DefaultPort
+	}
+
 	//conn, err := net.Dial("tcp", fmt.Sprintf("%s:%s", address, port))
 	tcpAddr, err := net.ResolveTCPAddr("tcp", fmt.Sprintf("%s:%s", address, port))
 	if err != nil {
@@ -69,17 +77,12 @@ func NewNode(address, port string, testnet bool) (*Node, error) {
 		return nil, err
 	}
 
-	netMagic := MainNet
-	if testnet {
-		netMagic = TestNet3
-	}
-
 	return &Node{
 		conn:     conn,
 		address:  address,
 		port:     port,
-		testnet:  testnet,
-		netMagic: netMagic,
+		params:   params,
+		netMagic: NetMagic(params.Net),
 	}, nil
 }
 
@@ -156,7 +159,7 @@ func GetHeaders(firstBlock string, node *Node) (*HeadersMessage, error) {
 	}
 
 	headersMessage := &HeadersMessage{}
-	err = headersMessage.Parse(envelope.GetStream(), node.testnet)
+	err = headersMessage.Parse(envelope.GetStream(), node.params)
 	if err != nil {
 		return nil, err
 	}
@@ -0,0 +1,883 @@
+// Package psbt implements partially signed bitcoin transactions, version 0 of
+// BIP174 and version 2 of BIP370. A Psbt keeps the transaction in the fields
+// of version 2, the unsigned transaction of version 0 is built from them, so
+// changing Version converts between the two.
+package psbt
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"io"
+
+	u "github.com/lobiCode/prog_btc_go/btcutils"
+	"github.com/lobiCode/prog_btc_go/script"
+	"github.com/lobiCode/prog_btc_go/tx"
+)
+
+var ErrMagic = errors.New("missing psbt magic bytes")
+var ErrDuplicateKey = errors.New("duplicate psbt key")
+var ErrInvalid = errors.New("invalid psbt")
+var ErrVersion = errors.New("unsupported psbt version")
+var ErrLocktime = errors.New("inputs require different kinds of locktime")
+
+var magic = []byte("psbt\xff")
+
+// maxFieldSize bounds the keys and values read, no field is larger than a
+// block
+const maxFieldSize = 4000000
+
+// the key types of the global map
+const (
+	globalUnsignedTx       = 0x00
+	globalXPub             = 0x01
+	globalTxVersion        = 0x02
+	globalFallbackLocktime = 0x03
+	globalInputCount       = 0x04
+	globalOutputCount      = 0x05
+	globalTxModifiable     = 0x06
+	globalVersion          = 0xfb
+)
+
+// the key types of an input map
+const (
+	inNonWitnessUtxo         = 0x00
+	inWitnessUtxo            = 0x01
+	inPartialSig             = 0x02
+	inSighashType            = 0x03
+	inRedeemScript           = 0x04
+	inWitnessScript          = 0x05
+	inBip32Derivation        = 0x06
+	inFinalScriptSig         = 0x07
+	inFinalScriptWitness     = 0x08
+	inPreviousTxId           = 0x0e
+	inOutputIndex            = 0x0f
+	inSequence               = 0x10
+	inRequiredTimeLocktime   = 0x11
+	inRequiredHeightLocktime = 0x12
+	inTapKeySig              = 0x13
+	inTapInternalKey         = 0x17
+	inTapMerkleRoot          = 0x18
+)
+
+// the key types of an output map
+const (
+	outRedeemScript    = 0x00
+	outWitnessScript   = 0x01
+	outBip32Derivation = 0x02
+	outAmount          = 0x03
+	outScript          = 0x04
+	outTapInternalKey  = 0x05
+)
+
+// Psbt is a transaction with what its signers need to sign it.
+type Psbt struct {
+	// Version is 0 or 2, the version it serializes as
+	Version   uint32
+	TxVersion uint32
+	// FallbackLocktime is the locktime of the transaction when no input
+	// requires one
+	FallbackLocktime uint32
+	// TxModifiable are the BIP370 flags of what can still be changed,
+	// version 2 only
+	TxModifiable byte
+	XPubs        []*XPub
+	Inputs       []*Input
+	Outputs      []*Output
+	// Unknown are the fields this package doesn't know, kept as they are
+	Unknown []*KeyValue
+}
+
+// Input is an input of the transaction and what is known about the output it
+// spends.
+type Input struct {
+	PreviousTxId string
+	OutputIndex  uint32
+	Sequence     uint32
+	// RequiredTimeLocktime and RequiredHeightLocktime are the locktimes the
+	// input needs, 0 when it needs none. They are version 2 only.
+	RequiredTimeLocktime   uint32
+	RequiredHeightLocktime uint32
+
+	NonWitnessUtxo *tx.Tx
+	WitnessUtxo    *tx.TxOut
+	PartialSigs    []*PartialSig
+	// SighashType is the sighash type the signatures must use, nil for
+	// SIGHASH_ALL, or SIGHASH_DEFAULT for P2TR inputs
+	SighashType     *uint32
+	RedeemScript    *script.Script
+	WitnessScript   *script.Script
+	Bip32Derivation []*Bip32Derivation
+	// TapKeySig is the signature of a P2TR key path spend, TapInternalKey
+	// the x-only internal key and TapMerkleRoot the root of its script tree
+	TapKeySig      []byte
+	TapInternalKey []byte
+	TapMerkleRoot  []byte
+
+	FinalScriptSig     *script.Script
+	FinalScriptWitness [][]byte
+
+	Unknown []*KeyValue
+}
+
+// Output is an output of the transaction and what is known about its
+// script.
+type Output struct {
+	Amount          uint64
+	Script          *script.Script
+	RedeemScript    *script.Script
+	WitnessScript   *script.Script
+	Bip32Derivation []*Bip32Derivation
+	TapInternalKey  []byte
+
+	Unknown []*KeyValue
+}
+
+// PartialSig is the signature of PubKey, with its sighash type byte.
+type PartialSig struct {
+	PubKey    []byte
+	Signature []byte
+}
+
+// Bip32Derivation is where PubKey is derived from the master key with
+// Fingerprint.
+type Bip32Derivation struct {
+	PubKey      []byte
+	Fingerprint []byte
+	Path        []uint32
+}
+
+// XPub is an extended public key of the transaction's signers, Key is its 78
+// byte serialization.
+type XPub struct {
+	Key         []byte
+	Fingerprint []byte
+	Path        []uint32
+}
+
+// KeyValue is a field of a map, the key starts with its type.
+type KeyValue struct {
+	Key   []byte
+	Value []byte
+}
+
+// Locktime returns the locktime of the transaction, BIP370 picks it from the
+// locktimes the inputs require.
+func (p *Psbt) Locktime() (uint32, error) {
+	var time, height uint32
+	required, timeOk, heightOk := false, true, true
+
+	for _, in := range p.Inputs {
+		if in.RequiredTimeLocktime == 0 && in.RequiredHeightLocktime == 0 {
+			continue
+		}
+		required = true
+
+		if in.RequiredTimeLocktime == 0 {
+			timeOk = false
+		} else if in.RequiredTimeLocktime > time {
+			time = in.RequiredTimeLocktime
+		}
+		if in.RequiredHeightLocktime == 0 {
+			heightOk = false
+		} else if in.RequiredHeightLocktime > height {
+			height = in.RequiredHeightLocktime
+		}
+	}
+
+	switch {
+	case !required:
+		return p.FallbackLocktime, nil
+	case heightOk:
+		return height, nil
+	case timeOk:
+		return time, nil
+	}
+
+	return 0, ErrLocktime
+}
+
+// UnsignedTx returns the transaction without signatures.
+func (p *Psbt) UnsignedTx() (*tx.Tx, error) {
+	locktime, err := p.Locktime()
+	if err != nil {
+		return nil, err
+	}
+
+	transaction := &tx.Tx{Version: p.TxVersion, Locktime: locktime}
+	for _, in := range p.Inputs {
+		transaction.TxIns = append(transaction.TxIns, &tx.TxIn{
+			PreTxId:   in.PreviousTxId,
+			PreTxIdx:  in.OutputIndex,
+			ScriptSig: &script.Script{},
+			Sequence:  in.Sequence,
+		})
+	}
+	for _, out := range p.Outputs {
+		transaction.TxOuts = append(transaction.TxOuts, &tx.TxOut{Amount: out.Amount, ScriptPubKey: out.Script})
+	}
+
+	return transaction, nil
+}
+
+// pair is a field read from a map.
+type pair struct {
+	key      []byte
+	keyType  uint64
+	keyData  []byte
+	value    []byte
+	consumed bool
+}
+
+// readMap reads the fields of a map up to its separator.
+func readMap(r io.Reader) ([]*pair, error) {
+	pairs := []*pair{}
+	seen := map[string]bool{}
+
+	for {
+		key, err := readField(r)
+		if err != nil {
+			return nil, err
+		}
+		if len(key) == 0 {
+			return pairs, nil
+		}
+		if seen[string(key)] {
+			return nil, ErrDuplicateKey
+		}
+		seen[string(key)] = true
+
+		kr := bytes.NewReader(key)
+		keyType, err := u.ReadVariant(kr)
+		if err != nil {
+			return nil, ErrInvalid
+		}
+
+		value, err := readField(r)
+		if err != nil {
+			return nil, err
+		}
+
+		pairs = append(pairs, &pair{
+			key:     key,
+			keyType: keyType,
+			keyData: key[len(key)-kr.Len():],
+			value:   value,
+		})
+	}
+}
+
+func readField(r io.Reader) ([]byte, error) {
+	l, err := u.ReadVariant(r)
+	if err != nil {
+		return nil, err
+	}
+	if l > maxFieldSize {
+		return nil, ErrInvalid
+	}
+
+	return u.Read(r, int64(l))
+}
+
+// Parse reads a serialized PSBT.
+func Parse(r io.Reader) (*Psbt, error) {
+	b, err := u.Read(r, int64(len(magic)))
+	if err != nil {
+		return nil, err
+	}
+	if !bytes.Equal(b, magic) {
+		return nil, ErrMagic
+	}
+
+	global, err := readMap(r)
+	if err != nil {
+		return nil, err
+	}
+
+	p, inputCount, outputCount, err := parseGlobal(global)
+	if err != nil {
+		return nil, err
+	}
+
+	for i := 0; i < inputCount; i++ {
+		pairs, err := readMap(r)
+		if err != nil {
+			return nil, err
+		}
+		in := &Input{Sequence: 0xffffffff}
+		if p.Version == 0 {
+			in = p.Inputs[i]
+		}
+		if err := in.parse(pairs, p.Version); err != nil {
+			return nil, err
+		}
+		if p.Version == 2 {
+			p.Inputs = append(p.Inputs, in)
+		}
+	}
+
+	for i := 0; i < outputCount; i++ {
+		pairs, err := readMap(r)
+		if err != nil {
+			return nil, err
+		}
+		out := &Output{}
+		if p.Version == 0 {
+			out = p.Outputs[i]
+		}
+		if err := out.parse(pairs, p.Version); err != nil {
+			return nil, err
+		}
+		if p.Version == 2 {
+			p.Outputs = append(p.Outputs, out)
+		}
+	}
+
+	if p.Version == 2 {
+		if p.TxVersion < 2 {
+			return nil, ErrInvalid
+		}
+		if _, err := p.Locktime(); err != nil {
+			return nil, err
+		}
+	}
+
+	return p, nil
+}
+
+// ParseBase64 reads a PSBT in base64, the way it is usually passed around.
+func ParseBase64(s string) (*Psbt, error) {
+	b, err := base64.StdEncoding.DecodeString(s)
+	if err != nil {
+		return nil, err
+	}
+
+	return Parse(bytes.NewReader(b))
+}
+
+// parseGlobal reads the global map and returns the number of input and
+// output maps that follow it.
+func parseGlobal(pairs []*pair) (*Psbt, int, int, error) {
+	p := &Psbt{}
+
+	for _, kv := range pairs {
+		if kv.keyType == globalVersion {
+			if len(kv.keyData) != 0 || len(kv.value) != 4 {
+				return nil, 0, 0, ErrInvalid
+			}
+			p.Version = binary.LittleEndian.Uint32(kv.value)
+			kv.consumed = true
+		}
+	}
+	if p.Version != 0 && p.Version != 2 {
+		return nil, 0, 0, ErrVersion
+	}
+
+	var unsignedTx *tx.Tx
+	var inputCount, outputCount uint64
+	hasTxVersion, hasInputCount, hasOutputCount := false, false, false
+
+	for _, kv := range pairs {
+		if kv.consumed {
+			continue
+		}
+
+		if kv.keyType == globalXPub {
+			if len(kv.keyData) != 78 {
+				return nil, 0, 0, ErrInvalid
+			}
+			fingerprint, path, err := parseDerivation(kv.value)
+			if err != nil {
+				return nil, 0, 0, err
+			}
+			p.XPubs = append(p.XPubs, &XPub{Key: kv.keyData, Fingerprint: fingerprint, Path: path})
+			continue
+		}
+
+		v0 := kv.keyType == globalUnsignedTx
+		v2 := kv.keyType >= globalTxVersion && kv.keyType <= globalTxModifiable
+		if !v0 && !v2 {
+			p.Unknown = append(p.Unknown, &KeyValue{kv.key, kv.value})
+			continue
+		}
+		if len(kv.keyData) != 0 || (v0 && p.Version != 0) || (v2 && p.Version != 2) {
+			return nil, 0, 0, ErrInvalid
+		}
+
+		var err error
+		switch kv.keyType {
+		case globalUnsignedTx:
+			unsignedTx, err = parseUnsignedTx(kv.value)
+		case globalTxVersion:
+			p.TxVersion, err = parseUint32(kv.value)
+			hasTxVersion = true
+		case globalFallbackLocktime:
+			p.FallbackLocktime, err = parseUint32(kv.value)
+		case globalInputCount:
+			inputCount, err = parseCount(kv.value)
+			hasInputCount = true
+		case globalOutputCount:
+			outputCount, err = parseCount(kv.value)
+			hasOutputCount = true
+		case globalTxModifiable:
+			if len(kv.value) != 1 {
+				err = ErrInvalid
+			} else {
+				p.TxModifiable = kv.value[0]
+			}
+		}
+		if err != nil {
+			return nil, 0, 0, err
+		}
+	}
+
+	if p.Version == 2 {
+		if !hasTxVersion || !hasInputCount || !hasOutputCount {
+			return nil, 0, 0, ErrInvalid
+		}
+		return p, int(inputCount), int(outputCount), nil
+	}
+
+	if unsignedTx == nil {
+		return nil, 0, 0, ErrInvalid
+	}
+	p.TxVersion = unsignedTx.Version
+	p.FallbackLocktime = unsignedTx.Locktime
+	for _, txIn := range unsignedTx.TxIns {
+		p.Inputs = append(p.Inputs, &Input{
+			PreviousTxId: txIn.PreTxId,
+			OutputIndex:  txIn.PreTxIdx,
+			Sequence:     txIn.Sequence,
+		})
+	}
+	for _, txOut := range unsignedTx.TxOuts {
+		p.Outputs = append(p.Outputs, &Output{Amount: txOut.Amount, Script: txOut.ScriptPubKey})
+	}
+
+	return p, len(p.Inputs), len(p.Outputs), nil
+}
+
+func parseUnsignedTx(b []byte) (*tx.Tx, error) {
+	r := bytes.NewReader(b)
+	unsignedTx, err := tx.ParseTxLegacy(r)
+	if err != nil {
+		return nil, err
+	}
+	if r.Len() != 0 || !isUnsigned(unsignedTx) {
+		return nil, ErrInvalid
+	}
+
+	return unsignedTx, nil
+}
+
+func isUnsigned(transaction *tx.Tx) bool {
+	for _, txIn := range transaction.TxIns {
+		if len(txIn.ScriptSig.Cmds) > 0 || len(txIn.Witness) > 0 {
+			return false
+		}
+	}
+
+	return true
+}
+
+func (in *Input) parse(pairs []*pair, version uint32) error {
+	hasTxId, hasIndex := false, false
+
+	for _, kv := range pairs {
+		v2 := kv.keyType >= inPreviousTxId && kv.keyType <= inRequiredHeightLocktime
+		if v2 && version != 2 {
+			return ErrInvalid
+		}
+
+		var err error
+		switch kv.keyType {
+		case inPartialSig:
+			if !isPubKey(kv.keyData) {
+				return ErrInvalid
+			}
+			in.PartialSigs = append(in.PartialSigs, &PartialSig{PubKey: kv.keyData, Signature: kv.value})
+			continue
+		case inBip32Derivation:
+			var derivation *Bip32Derivation
+			derivation, err = parseBip32Derivation(kv)
+			if err != nil {
+				return err
+			}
+			in.Bip32Derivation = append(in.Bip32Derivation, derivation)
+			continue
+		case inNonWitnessUtxo, inWitnessUtxo, inSighashType, inRedeemScript,
+			inWitnessScript, inFinalScriptSig, inFinalScriptWitness, inPreviousTxId,
+			inOutputIndex, inSequence, inRequiredTimeLocktime, inRequiredHeightLocktime,
+			inTapKeySig, inTapInternalKey, inTapMerkleRoot:
+			if len(kv.keyData) != 0 {
+				return ErrInvalid
+			}
+		default:
+			in.Unknown = append(in.Unknown, &KeyValue{kv.key, kv.value})
+			continue
+		}
+
+		switch kv.keyType {
+		case inNonWitnessUtxo:
+			in.NonWitnessUtxo, err = tx.ParseTx(bytes.NewReader(kv.value))
+		case inWitnessUtxo:
+			in.WitnessUtxo, err = tx.ParseTxOut(bytes.NewReader(kv.value))
+		case inSighashType:
+			var hashType uint32
+			hashType, err = parseUint32(kv.value)
+			in.SighashType = &hashType
+		case inRedeemScript:
+			in.RedeemScript, err = script.ParseRaw(kv.value)
+		case inWitnessScript:
+			in.WitnessScript, err = script.ParseRaw(kv.value)
+		case inFinalScriptSig:
+			in.FinalScriptSig, err = script.ParseRaw(kv.value)
+		case inFinalScriptWitness:
+			in.FinalScriptWitness, err = tx.ParseWitness(bytes.NewReader(kv.value))
+		case inPreviousTxId:
+			if len(kv.value) != 32 {
+				return ErrInvalid
+			}
+			in.PreviousTxId = hex.EncodeToString(u.CopybAndReverse(kv.value))
+			hasTxId = true
+		case inOutputIndex:
+			in.OutputIndex, err = parseUint32(kv.value)
+			hasIndex = true
+		case inSequence:
+			in.Sequence, err = parseUint32(kv.value)
+		case inRequiredTimeLocktime:
+			in.RequiredTimeLocktime, err = parseUint32(kv.value)
+			if err == nil && in.RequiredTimeLocktime < 500000000 {
+				err = ErrInvalid
+			}
+		case inRequiredHeightLocktime:
+			in.RequiredHeightLocktime, err = parseUint32(kv.value)
+			if err == nil && (in.RequiredHeightLocktime == 0 || in.RequiredHeightLocktime >= 500000000) {
+				err = ErrInvalid
+			}
+		case inTapKeySig:
+			if len(kv.value) != 64 && len(kv.value) != 65 {
+				return ErrInvalid
+			}
+			in.TapKeySig = kv.value
+		case inTapInternalKey:
+			if len(kv.value) != 32 {
+				return ErrInvalid
+			}
+			in.TapInternalKey = kv.value
+		case inTapMerkleRoot:
+			if len(kv.value) != 32 {
+				return ErrInvalid
+			}
+			in.TapMerkleRoot = kv.value
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	if version == 2 && (!hasTxId || !hasIndex) {
+		return ErrInvalid
+	}
+
+	return nil
+}
+
+func (out *Output) parse(pairs []*pair, version uint32) error {
+	hasAmount, hasScript := false, false
+
+	for _, kv := range pairs {
+		v2 := kv.keyType == outAmount || kv.keyType == outScript
+		if v2 && version != 2 {
+			return ErrInvalid
+		}
+
+		var err error
+		switch kv.keyType {
+		case outBip32Derivation:
+			var derivation *Bip32Derivation
+			derivation, err = parseBip32Derivation(kv)
+			if err != nil {
+				return err
+			}
+			out.Bip32Derivation = append(out.Bip32Derivation, derivation)
+			continue
+		case outRedeemScript, outWitnessScript, outAmount, outScript, outTapInternalKey:
+			if len(kv.keyData) != 0 {
+				return ErrInvalid
+			}
+		default:
+			out.Unknown = append(out.Unknown, &KeyValue{kv.key, kv.value})
+			continue
+		}
+
+		switch kv.keyType {
+		case outRedeemScript:
+			out.RedeemScript, err = script.ParseRaw(kv.value)
+		case outWitnessScript:
+			out.WitnessScript, err = script.ParseRaw(kv.value)
+		case outAmount:
+			if len(kv.value) != 8 {
+				return ErrInvalid
+			}
+			out.Amount = binary.LittleEndian.Uint64(kv.value)
+			hasAmount = true
+		case outScript:
+			out.Script, err = script.ParseRaw(kv.value)
+			hasScript = true
+		case outTapInternalKey:
+			if len(kv.value) != 32 {
+				return ErrInvalid
+			}
+			out.TapInternalKey = kv.value
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	if version == 2 && (!hasAmount || !hasScript) {
+		return ErrInvalid
+	}
+
+	return nil
+}
+
+func isPubKey(b []byte) bool {
+	return (len(b) == 33 && (b[0] == 0x02 || b[0] == 0x03)) || (len(b) == 65 && b[0] == 0x04)
+}
+
+func parseBip32Derivation(kv *pair) (*Bip32Derivation, error) {
+	if !isPubKey(kv.keyData) {
+		return nil, ErrInvalid
+	}
+	fingerprint, path, err := parseDerivation(kv.value)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Bip32Derivation{PubKey: kv.keyData, Fingerprint: fingerprint, Path: path}, nil
+}
+
+// parseDerivation reads a master key fingerprint followed by a path.
+func parseDerivation(b []byte) ([]byte, []uint32, error) {
+	if len(b) < 4 || len(b)%4 != 0 {
+		return nil, nil, ErrInvalid
+	}
+
+	path := []uint32{}
+	for i := 4; i < len(b); i += 4 {
+		path = append(path, binary.LittleEndian.Uint32(b[i:]))
+	}
+
+	return b[:4], path, nil
+}
+
+func parseUint32(b []byte) (uint32, error) {
+	if len(b) != 4 {
+		return 0, ErrInvalid
+	}
+
+	return binary.LittleEndian.Uint32(b), nil
+}
+
+func parseCount(b []byte) (uint64, error) {
+	r := bytes.NewReader(b)
+	n, err := u.ReadVariant(r)
+	if err != nil || r.Len() != 0 || n > maxFieldSize {
+		return 0, ErrInvalid
+	}
+
+	return n, nil
+}
+
+// writer writes the fields of maps.
+type writer struct {
+	bytes.Buffer
+}
+
+func (w *writer) field(keyType byte, keyData, value []byte) {
+	key := append([]byte{keyType}, keyData...)
+	w.Write(u.EncodeVariant(len(key)))
+	w.Write(key)
+	w.Write(u.EncodeVariant(len(value)))
+	w.Write(value)
+}
+
+// script writes s when it is set.
+func (w *writer) script(keyType byte, s *script.Script) {
+	if s != nil {
+		w.field(keyType, nil, s.RawSerialize())
+	}
+}
+
+func (w *writer) bip32Derivation(keyType byte, derivations []*Bip32Derivation) {
+	for _, d := range derivations {
+		w.field(keyType, d.PubKey, serializeDerivation(d.Fingerprint, d.Path))
+	}
+}
+
+// end writes the unknown fields and the separator of the map.
+func (w *writer) end(unknown []*KeyValue) {
+	for _, kv := range unknown {
+		w.Write(u.EncodeVariant(len(kv.Key)))
+		w.Write(kv.Key)
+		w.Write(u.EncodeVariant(len(kv.Value)))
+		w.Write(kv.Value)
+	}
+	w.WriteByte(0x00)
+}
+
+func serializeDerivation(fingerprint []byte, path []uint32) []byte {
+	result := u.Copyb(fingerprint)
+	for _, i := range path {
+		result = append(result, u.MustEncodeNumLittleEndian(i)...)
+	}
+
+	return result
+}
+
+func serializeTx(transaction *tx.Tx) []byte {
+	b, _ := hex.DecodeString(transaction.Serialize())
+	return b
+}
+
+func serializeWitness(witness [][]byte) []byte {
+	result := u.EncodeVariant(len(witness))
+	for _, item := range witness {
+		result = append(result, u.EncodeVariant(len(item))...)
+		result = append(result, item...)
+	}
+
+	return result
+}
+
+// Serialize returns the PSBT in the format of its Version.
+func (p *Psbt) Serialize() ([]byte, error) {
+	if p.Version != 0 && p.Version != 2 {
+		return nil, ErrVersion
+	}
+
+	w := &writer{}
+	w.Write(magic)
+
+	if p.Version == 0 {
+		unsignedTx, err := p.UnsignedTx()
+		if err != nil {
+			return nil, err
+		}
+		w.field(globalUnsignedTx, nil, serializeTx(unsignedTx))
+	}
+	for _, xpub := range p.XPubs {
+		w.field(globalXPub, xpub.Key, serializeDerivation(xpub.Fingerprint, xpub.Path))
+	}
+	if p.Version == 2 {
+		if p.TxVersion < 2 {
+			return nil, ErrInvalid
+		}
+		if _, err := p.Locktime(); err != nil {
+			return nil, err
+		}
+		w.field(globalTxVersion, nil, u.MustEncodeNumLittleEndian(p.TxVersion))
+		if p.FallbackLocktime != 0 {
+			w.field(globalFallbackLocktime, nil, u.MustEncodeNumLittleEndian(p.FallbackLocktime))
+		}
+		w.field(globalInputCount, nil, u.EncodeVariant(len(p.Inputs)))
+		w.field(globalOutputCount, nil, u.EncodeVariant(len(p.Outputs)))
+		if p.TxModifiable != 0 {
+			w.field(globalTxModifiable, nil, []byte{p.TxModifiable})
+		}
+		w.field(globalVersion, nil, u.MustEncodeNumLittleEndian(p.Version))
+	}
+	w.end(p.Unknown)
+
+	for _, in := range p.Inputs {
+		if err := in.serialize(w, p.Version); err != nil {
+			return nil, err
+		}
+	}
+	for _, out := range p.Outputs {
+		out.serialize(w, p.Version)
+	}
+
+	return w.Bytes(), nil
+}
+
+// Base64 returns the serialized PSBT in base64.
+func (p *Psbt) Base64() (string, error) {
+	b, err := p.Serialize()
+	if err != nil {
+		return "", err
+	}
+
+	return base64.StdEncoding.EncodeToString(b), nil
+}
+
+func (in *Input) serialize(w *writer, version uint32) error {
+	if in.NonWitnessUtxo != nil {
+		w.field(inNonWitnessUtxo, nil, serializeTx(in.NonWitnessUtxo))
+	}
+	if in.WitnessUtxo != nil {
+		w.field(inWitnessUtxo, nil, in.WitnessUtxo.Serialize())
+	}
+	for _, sig := range in.PartialSigs {
+		w.field(inPartialSig, sig.PubKey, sig.Signature)
+	}
+	if in.SighashType != nil {
+		w.field(inSighashType, nil, u.MustEncodeNumLittleEndian(*in.SighashType))
+	}
+	w.script(inRedeemScript, in.RedeemScript)
+	w.script(inWitnessScript, in.WitnessScript)
+	w.bip32Derivation(inBip32Derivation, in.Bip32Derivation)
+	w.script(inFinalScriptSig, in.FinalScriptSig)
+	if in.FinalScriptWitness != nil {
+		w.field(inFinalScriptWitness, nil, serializeWitness(in.FinalScriptWitness))
+	}
+
+	if version == 2 {
+		preTxId, err := hex.DecodeString(in.PreviousTxId)
+		if err != nil || len(preTxId) != 32 {
+			return ErrInvalid
+		}
+		w.field(inPreviousTxId, nil, u.CopybAndReverse(preTxId))
+		w.field(inOutputIndex, nil, u.MustEncodeNumLittleEndian(in.OutputIndex))
+		if in.Sequence != 0xffffffff {
+			w.field(inSequence, nil, u.MustEncodeNumLittleEndian(in.Sequence))
+		}
+		if in.RequiredTimeLocktime != 0 {
+			w.field(inRequiredTimeLocktime, nil, u.MustEncodeNumLittleEndian(in.RequiredTimeLocktime))
+		}
+		if in.RequiredHeightLocktime != 0 {
+			w.field(inRequiredHeightLocktime, nil, u.MustEncodeNumLittleEndian(in.RequiredHeightLocktime))
+		}
+	}
+
+	if in.TapKeySig != nil {
+		w.field(inTapKeySig, nil, in.TapKeySig)
+	}
+	if in.TapInternalKey != nil {
+		w.field(inTapInternalKey, nil, in.TapInternalKey)
+	}
+	if in.TapMerkleRoot != nil {
+		w.field(inTapMerkleRoot, nil, in.TapMerkleRoot)
+	}
+	w.end(in.Unknown)
+
+	return nil
+}
+
+func (out *Output) serialize(w *writer, version uint32) {
+	w.script(outRedeemScript, out.RedeemScript)
+	w.script(outWitnessScript, out.WitnessScript)
+	w.bip32Derivation(outBip32Derivation, out.Bip32Derivation)
+	if version == 2 {
+		w.field(outAmount, nil, u.MustEncodeNumLittleEndian(out.Amount))
+		w.field(outScript, nil, out.Script.RawSerialize())
+	}
+	if out.TapInternalKey != nil {
+		w.field(outTapInternalKey, nil, out.TapInternalKey)
+	}
+	w.end(out.Unknown)
+}
@@ -0,0 +1,411 @@
+package psbt
+
+import (
+	"bytes"
+	"encoding/hex"
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+
+	u "github.com/lobiCode/prog_btc_go/btcutils"
+	c "github.com/lobiCode/prog_btc_go/cryptography"
+	"github.com/lobiCode/prog_btc_go/script"
+	"github.com/lobiCode/prog_btc_go/tx"
+)
+
+// the BIP174 PSBT with one P2PKH input and empty outputs
+const bip174Vector = "cHNidP8BAHUCAAAAASaBcTce3/KF6Tet7qSze3gADAVmy7OtZGQXE8pCFxv2AAAAAAD+////AtPf9QUAAAAAGXapFNDFmQPFusKGh2DpD9UhpGZap2UgiKwA4fUFAAAAABepFDVF5uM7gyxHBQ8k0+65PJwDlIvHh7MuEwAAAQD9pQEBAAAAAAECiaPHHqtNIOA3G7ukzGmPopXJRjr6Ljl/hTPMti+VZ+UBAAAAFxYAFL4Y0VKpsBIDna89p95PUzSe7LmF/////4b4qkOnHf8USIk6UwpyN+9rRgi7st0tAXHmOuxqSJC0AQAAABcWABT+Pp7xp0XpdNkCxDVZQ6vLNL1TU/////8CAMLrCwAAAAAZdqkUhc/xCX/Z4Ai7NK9wnGIZeziXikiIrHL++E4sAAAAF6kUM5cluiHv1irHU6m80GfWx6ajnQWHAkcwRAIgJxK+IuAnDzlPVoMR3HyppolwuAJf3TskAinwf4pfOiQCIAGLONfc0xTnNMkna9b7QPZzMlvEuqFEyADS8vAtsnZcASED0uFWdJQbrUqZY3LLh+GFbTZSYG2YVi/jnF6efkE/IQUCSDBFAiEA0SuFLYXc2WHS9fSrZgZU327tzHlMDDPOXMMJ/7X85Y0CIGczio4OFyXBl/saiK9Z9R5E5CVbIBZ8hoQDHAXR8lkqASECI7cr7vCWXRC+B3jv7NYfysb3mk6haTkzgHNEZPhPKrMAAAAAAAAA"
+
+// a transaction with one input and one output, as a version 0 and a version
+// 2 PSBT
+const (
+	minimalTx = "02000000" + "01" + "1111111111111111111111111111111111111111111111111111111111111111" + "00000000" + "00" + "ffffffff" +
+		"01" + "e803000000000000" + "16" + "00140000000000000000000000000000000000000000" + "00000000"
+	minimalV0 = "70736274ff" + "010052" + minimalTx + "00" + "00" + "00"
+	minimalV2 = "70736274ff" + "01020402000000" + "01040101" + "01050101" + "01fb0402000000" + "00" +
+		"010e20" + "1111111111111111111111111111111111111111111111111111111111111111" + "010f0400000000" + "00" +
+		"010308e803000000000000" + "010416" + "00140000000000000000000000000000000000000000" + "00"
+)
+
+func mustDecode(s string) []byte {
+	b, err := hex.DecodeString(s)
+	if err != nil {
+		panic(err)
+	}
+
+	return b
+}
+
+func mustSerialize(p *Psbt, t *testing.T) []byte {
+	t.Helper()
+	b, err := p.Serialize()
+	check(nil, err, t)
+
+	return b
+}
+
+func TestBip174Vector(t *testing.T) {
+	p, err := ParseBase64(bip174Vector)
+	check(nil, err, t)
+
+	s, err := p.Base64()
+	check(nil, err, t)
+	check(bip174Vector, s, t)
+
+	check(1, len(p.Inputs), t)
+	check(2, len(p.Outputs), t)
+	check("f61b1742ca13176464adb3cb66050c00787bb3a4eead37e985f2df1e37718126", p.Inputs[0].PreviousTxId, t)
+	check(uint32(0xfffffffe), p.Inputs[0].Sequence, t)
+	check(uint32(1257139), p.FallbackLocktime, t)
+
+	utxo, err := p.Inputs[0].Utxo()
+	check(nil, err, t)
+	check(uint64(200000000), utxo.Amount, t)
+	check(true, utxo.ScriptPubKey.IsP2pkhScriptPubkey(), t)
+}
+
+func TestSerialize(t *testing.T) {
+	unsignedTx, err := tx.ParseTx(bytes.NewReader(mustDecode(minimalTx)))
+	check(nil, err, t)
+	p, err := New(unsignedTx)
+	check(nil, err, t)
+	check(mustDecode(minimalV0), mustSerialize(p, t), t)
+
+	p.Version = 2
+	check(mustDecode(minimalV2), mustSerialize(p, t), t)
+
+	for _, s := range []string{minimalV0, minimalV2} {
+		parsed, err := Parse(bytes.NewReader(mustDecode(s)))
+		check(nil, err, t)
+		check(mustDecode(s), mustSerialize(parsed, t), t)
+
+		parsedTx, err := parsed.UnsignedTx()
+		check(nil, err, t)
+		check(unsignedTx.TxId(), parsedTx.TxId(), t)
+	}
+
+	// a version 2 PSBT needs a version 2 transaction
+	p.TxVersion = 1
+	_, err = p.Serialize()
+	check(ErrInvalid, err, t)
+}
+
+func TestParseNoInputs(t *testing.T) {
+	// the input count of the unsigned transaction isn't the BIP144 marker
+	noInputsTx := "02000000" + "00" + "01" + "e803000000000000" + "16" + "00140000000000000000000000000000000000000000" + "00000000"
+	psbt := "70736274ff" + "010029" + noInputsTx + "00" + "00"
+
+	p, err := Parse(bytes.NewReader(mustDecode(psbt)))
+	check(nil, err, t)
+	check(0, len(p.Inputs), t)
+	check(1, len(p.Outputs), t)
+	check(uint64(1000), p.Outputs[0].Amount, t)
+	check(mustDecode(psbt), mustSerialize(p, t), t)
+}
+
+func TestRoundTrip(t *testing.T) {
+	unsignedTx, _ := tx.ParseTx(bytes.NewReader(mustDecode(minimalTx)))
+	p, _ := New(unsignedTx)
+	key := c.NewPrivateKey(u.NewInt(1000))
+	hashType := tx.SIGHASH_SINGLE | tx.SIGHASH_ANYONECANPAY
+	derivation := &Bip32Derivation{PubKey: key.Sec(true), Fingerprint: mustDecode("d90c6a4f"), Path: []uint32{84 | c.HardenedKeyStart, 0, 7}}
+
+	p.XPubs = []*XPub{{Key: make([]byte, 78), Fingerprint: mustDecode("d90c6a4f"), Path: []uint32{}}}
+	p.Unknown = []*KeyValue{{Key: []byte{0xfc, 0x01}, Value: []byte{0x02}}}
+	in := p.Inputs[0]
+	in.WitnessUtxo = &tx.TxOut{Amount: 5000, ScriptPubKey: script.P2wsh(make([]byte, 32))}
+	in.PartialSigs = []*PartialSig{{PubKey: key.Sec(true), Signature: []byte{0x30, 0x01}}}
+	in.SighashType = &hashType
+	in.WitnessScript = script.P2pkh(u.Hash160(key.Sec(true)))
+	in.Bip32Derivation = []*Bip32Derivation{derivation}
+	in.Unknown = []*KeyValue{{Key: []byte{0x20, 0xaa}, Value: []byte{}}}
+	out := p.Outputs[0]
+	out.RedeemScript = script.P2wpkh(make([]byte, 20))
+	out.Bip32Derivation = []*Bip32Derivation{derivation}
+	out.TapInternalKey = key.XOnly()
+
+	for _, version := range []uint32{0, 2} {
+		p.Version = version
+		b := mustSerialize(p, t)
+		parsed, err := Parse(bytes.NewReader(b))
+		check(nil, err, t)
+		check(b, mustSerialize(parsed, t), t)
+
+		check(p.XPubs, parsed.XPubs, t)
+		check(p.Unknown, parsed.Unknown, t)
+		check(hashType, *parsed.Inputs[0].SighashType, t)
+		check(in.PartialSigs, parsed.Inputs[0].PartialSigs, t)
+		check(in.Bip32Derivation, parsed.Inputs[0].Bip32Derivation, t)
+		check(in.Unknown, parsed.Inputs[0].Unknown, t)
+		check(in.WitnessScript.RawSerialize(), parsed.Inputs[0].WitnessScript.RawSerialize(), t)
+		check(out.Bip32Derivation, parsed.Outputs[0].Bip32Derivation, t)
+		check(out.TapInternalKey, parsed.Outputs[0].TapInternalKey, t)
+	}
+}
+
+func TestParseInvalid(t *testing.T) {
+	v2Field := "010e20" + strings.Repeat("11", 32)
+
+	for _, test := range []struct {
+		psbt string
+		err  error
+	}{
+		{minimalTx, ErrMagic},
+		{"70736274ff" + "00", ErrInvalid},
+		// a duplicate unsigned transaction
+		{"70736274ff" + "010052" + minimalTx + "010052" + minimalTx + "00", ErrDuplicateKey},
+		{"70736274ff" + "010052" + minimalTx + "01fb0401000000" + "00", ErrVersion},
+		// a version 2 field in a version 0 PSBT
+		{"70736274ff" + "010052" + minimalTx + "00" + v2Field + "00" + "00", ErrInvalid},
+		// a version 2 PSBT without its input count
+		{"70736274ff" + "01020402000000" + "01050100" + "01fb0402000000" + "00", ErrInvalid},
+		// a version 2 input without its output index
+		{"70736274ff" + "01020402000000" + "01040101" + "01050100" + "01fb0402000000" + "00" + v2Field + "00", ErrInvalid},
+		// a partial signature with a key that isn't one
+		{"70736274ff" + "010052" + minimalTx + "00" + "03020102" + "0130" + "00" + "00", ErrInvalid},
+		// a non-witness UTXO that claims more outputs than it has
+		{"70736274ff" + "010052" + minimalTx + "00" + "010037" + "02000000" + "01" + strings.Repeat("22", 32) + "00000000" + "00" + "ffffffff" + "ffffffffffffffffff" + "00" + "00", io.EOF},
+	} {
+		_, err := Parse(bytes.NewReader(mustDecode(test.psbt)))
+		check(test.err, err, t)
+	}
+
+	signedTx, _ := tx.ParseTx(bytes.NewReader(mustDecode(minimalTx)))
+	signedTx.TxIns[0].Witness = [][]byte{{0x01}}
+	_, err := New(signedTx)
+	check(ErrNotUnsigned, err, t)
+}
+
+func TestLocktime(t *testing.T) {
+	for _, test := range []struct {
+		required [][2]uint32
+		locktime uint32
+		err      error
+	}{
+		{[][2]uint32{{0, 0}, {0, 0}}, 100, nil},
+		{[][2]uint32{{0, 0}, {0, 700000}, {0, 700010}}, 700010, nil},
+		{[][2]uint32{{1600000000, 0}, {1700000000, 0}}, 1700000000, nil},
+		// height is chosen when both are possible
+		{[][2]uint32{{1600000000, 700000}, {0, 700001}}, 700001, nil},
+		{[][2]uint32{{1600000000, 700000}, {1700000000, 0}}, 1700000000, nil},
+		{[][2]uint32{{1600000000, 0}, {0, 700000}}, 0, ErrLocktime},
+	} {
+		p := &Psbt{Version: 2, TxVersion: 2, FallbackLocktime: 100}
+		for _, required := range test.required {
+			p.Inputs = append(p.Inputs, &Input{RequiredTimeLocktime: required[0], RequiredHeightLocktime: required[1]})
+		}
+		locktime, err := p.Locktime()
+		check(test.err, err, t)
+		check(test.locktime, locktime, t)
+	}
+}
+
+// testKeys are the keys of the signers of the tests.
+var testKeys = []*c.PrivateKey{
+	c.NewPrivateKey(u.NewInt(11111)),
+	c.NewPrivateKey(u.NewInt(22222)),
+	c.NewPrivateKey(u.NewInt(33333)),
+}
+
+// creditingTx pays amount to each of the scripts.
+func creditingTx(amount uint64, scripts ...*script.Script) *tx.Tx {
+	txIn := &tx.TxIn{PreTxId: strings.Repeat("22", 32), ScriptSig: &script.Script{}, Sequence: 0xffffffff}
+	credit := &tx.Tx{Version: 2, TxIns: []*tx.TxIn{txIn}}
+	for _, s := range scripts {
+		credit.TxOuts = append(credit.TxOuts, &tx.TxOut{Amount: amount, ScriptPubKey: s})
+	}
+
+	return credit
+}
+
+// spendingPsbt returns a PSBT spending every output of credit.
+func spendingPsbt(credit *tx.Tx, t *testing.T) *Psbt {
+	t.Helper()
+	spend := &tx.Tx{Version: 2}
+	for i := range credit.TxOuts {
+		spend.TxIns = append(spend.TxIns, &tx.TxIn{PreTxId: credit.TxId(), PreTxIdx: uint32(i), ScriptSig: &script.Script{}, Sequence: 0xfffffffd})
+	}
+	spend.TxOuts = []*tx.TxOut{{Amount: 10000, ScriptPubKey: script.P2wpkh(make([]byte, 20))}}
+
+	p, err := New(spend)
+	check(nil, err, t)
+
+	return p
+}
+
+// copyPsbt passes the PSBT through its base64 form, as it is sent to
+// another signer.
+func copyPsbt(p *Psbt, t *testing.T) *Psbt {
+	t.Helper()
+	s, err := p.Base64()
+	check(nil, err, t)
+	copied, err := ParseBase64(s)
+	check(nil, err, t)
+
+	return copied
+}
+
+// checkExtract extracts the transaction and verifies its inputs against
+// the outputs of credit.
+func checkExtract(p *Psbt, credit *tx.Tx, t *testing.T) {
+	t.Helper()
+	signedTx, err := p.Extract()
+	check(nil, err, t)
+
+	fetcher := tx.MapFetcher{}
+	fetcher.AddTx(credit)
+	check(nil, signedTx.Verify(fetcher), t)
+}
+
+func TestMultisig(t *testing.T) {
+	multisig := &script.Script{Cmds: [][]byte{
+		{0x52}, testKeys[0].Sec(true), testKeys[1].Sec(true), testKeys[2].Sec(true), {0x53}, {0xae},
+	}}
+	p2wsh := script.P2wsh(sha256Sum(multisig.RawSerialize()))
+	p2sh := script.P2sh(u.Hash160(multisig.RawSerialize()))
+	p2shP2wsh := script.P2sh(u.Hash160(p2wsh.RawSerialize()))
+	credit := creditingTx(40000, p2wsh, p2sh, p2shP2wsh)
+
+	// the updater
+	p := spendingPsbt(credit, t)
+	p.Version = 2
+	check(nil, p.SetUtxo(0, credit), t)
+	check(nil, p.SetUtxo(1, credit), t)
+	p.Inputs[0].WitnessScript = multisig
+	p.Inputs[1].RedeemScript = multisig
+	p.Inputs[2].RedeemScript = p2wsh
+	p.Inputs[2].WitnessScript = multisig
+	check(nil, p.SetUtxo(2, credit), t)
+	check(true, p.Inputs[0].WitnessUtxo != nil, t)
+	check((*tx.TxOut)(nil), p.Inputs[1].WitnessUtxo, t)
+	check(true, p.Inputs[2].WitnessUtxo != nil, t)
+
+	// two signers sign their copies
+	first, second := copyPsbt(p, t), copyPsbt(p, t)
+	signed, err := first.SignAll(testKeys[2])
+	check(nil, err, t)
+	check(3, signed, t)
+	signed, err = second.SignAll(testKeys[0])
+	check(nil, err, t)
+	check(3, signed, t)
+
+	// one signature isn't enough
+	check(ErrFinalize, copyPsbt(first, t).Finalize(), t)
+
+	check(nil, p.Combine(first, second), t)
+	for _, in := range p.Inputs {
+		check(2, len(in.PartialSigs), t)
+	}
+	check(nil, p.Finalize(), t)
+	for _, in := range p.Inputs {
+		check((*script.Script)(nil), in.WitnessScript, t)
+		check(0, len(in.PartialSigs), t)
+	}
+
+	checkExtract(copyPsbt(p, t), credit, t)
+}
+
+func TestSingleKey(t *testing.T) {
+	key := testKeys[1]
+	h160 := u.Hash160(key.Sec(true))
+	outputKey, err := key.TaprootTweak(nil)
+	check(nil, err, t)
+	p2tr := script.P2tr(outputKey.XOnly())
+	credit := creditingTx(30000, script.P2pkh(h160), script.P2wpkh(h160), script.P2sh(u.Hash160(script.P2wpkh(h160).RawSerialize())), p2tr)
+
+	p := spendingPsbt(credit, t)
+	check(nil, p.SetUtxo(0, credit), t)
+	p.Inputs[2].RedeemScript = script.P2wpkh(h160)
+	fetcher := tx.MapFetcher{}
+	fetcher.AddTx(credit)
+	check(nil, p.Update(fetcher), t)
+	check((*tx.TxOut)(nil), p.Inputs[0].WitnessUtxo, t)
+	check(true, p.Inputs[1].WitnessUtxo != nil, t)
+	check(true, p.Inputs[2].WitnessUtxo != nil, t)
+
+	// a P2PKH input needs its previous transaction
+	legacy := spendingPsbt(credit, t)
+	check(nil, legacy.Update(fetcher), t)
+	check((*tx.TxOut)(nil), legacy.Inputs[0].WitnessUtxo, t)
+	legacy.Inputs[0].WitnessUtxo = credit.TxOuts[0]
+	check(ErrNoUtxo, legacy.Sign(0, key), t)
+
+	// a P2TR signature commits to the UTXOs of every input
+	noUtxo := copyPsbt(p, t)
+	noUtxo.Inputs[0].NonWitnessUtxo = nil
+	check(tx.ErrTxPrevOutNotFound, noUtxo.Sign(3, key), t)
+	check(ErrNoUtxo, noUtxo.Sign(0, key), t)
+
+	signed, err := p.SignAll(testKeys[0])
+	check(nil, err, t)
+	check(0, signed, t)
+
+	signed, err = p.SignAll(key)
+	check(nil, err, t)
+	check(4, signed, t)
+	check(64, len(p.Inputs[3].TapKeySig), t)
+	check(ErrNotFinalized, extractErr(p), t)
+
+	p = copyPsbt(p, t)
+	check(nil, p.Finalize(), t)
+	check((*script.Script)(nil), p.Inputs[1].FinalScriptSig, t)
+	check(1, len(p.Inputs[2].FinalScriptSig.Cmds), t)
+	checkExtract(p, credit, t)
+}
+
+func TestSighashType(t *testing.T) {
+	key := testKeys[0]
+	credit := creditingTx(50000, script.P2wpkh(u.Hash160(key.Sec(true))))
+	p := spendingPsbt(credit, t)
+	p.Inputs[0].WitnessUtxo = credit.TxOuts[0]
+	hashType := tx.SIGHASH_NONE | tx.SIGHASH_ANYONECANPAY
+	p.Inputs[0].SighashType = &hashType
+
+	check(nil, p.Sign(0, key), t)
+	sig := p.Inputs[0].PartialSigs[0].Signature
+	check(byte(hashType), sig[len(sig)-1], t)
+
+	check(nil, p.Finalize(), t)
+	checkExtract(p, credit, t)
+}
+
+func TestRoleErrors(t *testing.T) {
+	key := testKeys[0]
+	credit := creditingTx(50000, script.P2wpkh(u.Hash160(key.Sec(true))), script.P2sh(make([]byte, 20)))
+	p := spendingPsbt(credit, t)
+
+	check(ErrNoUtxo, p.Sign(0, key), t)
+	check(ErrInputIndex, p.Sign(2, key), t)
+	check(ErrUtxoMismatch, p.SetUtxo(0, creditingTx(50000)), t)
+
+	check(nil, p.SetUtxo(0, credit), t)
+	check(nil, p.SetUtxo(1, credit), t)
+	// the witness UTXO must be the output of the previous transaction
+	p.Inputs[1].WitnessUtxo = credit.TxOuts[0]
+	check(ErrUtxoMismatch, p.Sign(1, key), t)
+	p.Inputs[1].WitnessUtxo = nil
+	check(ErrKeyMismatch, p.Sign(0, testKeys[1]), t)
+	check(ErrScriptMismatch, p.Sign(1, key), t)
+	p.Inputs[1].RedeemScript = script.P2pkh(u.Hash160(key.Sec(true)))
+	check(ErrScriptMismatch, p.Sign(1, key), t)
+
+	check(ErrFinalize, p.FinalizeInput(0), t)
+	_, err := p.Extract()
+	check(ErrNotFinalized, err, t)
+
+	other := spendingPsbt(creditingTx(50000, script.P2wpkh(make([]byte, 20))), t)
+	check(ErrCombine, p.Combine(other), t)
+}
+
+func extractErr(p *Psbt) error {
+	_, err := p.Extract()
+	return err
+}
+
+func check(expected, recived interface{}, t *testing.T) {
+	t.Helper()
+	if !reflect.DeepEqual(recived, expected) {
+		t.Errorf("Received\n%+v\ndoesn't match expected\n%+v\n", recived, expected)
+	}
+}
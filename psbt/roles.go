@@ -0,0 +1,658 @@
+package psbt
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"errors"
+
+	u "github.com/lobiCode/prog_btc_go/btcutils"
+	c "github.com/lobiCode/prog_btc_go/cryptography"
+	"github.com/lobiCode/prog_btc_go/script"
+	"github.com/lobiCode/prog_btc_go/tx"
+)
+
+var ErrNotUnsigned = errors.New("transaction has signatures")
+var ErrInputIndex = errors.New("input index out of range")
+var ErrNoUtxo = errors.New("input has no utxo")
+var ErrUtxoMismatch = errors.New("utxo isn't the output the input spends")
+var ErrScriptMismatch = errors.New("redeem or witness script doesn't match the utxo")
+var ErrKeyMismatch = errors.New("key doesn't sign the input")
+var ErrCombine = errors.New("psbts are of different transactions")
+var ErrFinalize = errors.New("input can't be finalized")
+var ErrNotFinalized = errors.New("input isn't finalized")
+
+// New is the creator, it returns a version 0 PSBT of a transaction whose
+// inputs have empty script sigs and no witnesses.
+func New(unsignedTx *tx.Tx) (*Psbt, error) {
+	if !isUnsigned(unsignedTx) {
+		return nil, ErrNotUnsigned
+	}
+
+	p := &Psbt{TxVersion: unsignedTx.Version, FallbackLocktime: unsignedTx.Locktime}
+	for _, txIn := range unsignedTx.TxIns {
+		p.Inputs = append(p.Inputs, &Input{
+			PreviousTxId: txIn.PreTxId,
+			OutputIndex:  txIn.PreTxIdx,
+			Sequence:     txIn.Sequence,
+		})
+	}
+	for _, txOut := range unsignedTx.TxOuts {
+		p.Outputs = append(p.Outputs, &Output{Amount: txOut.Amount, Script: txOut.ScriptPubKey})
+	}
+
+	return p, nil
+}
+
+func (p *Psbt) input(i int) (*Input, error) {
+	if i < 0 || i >= len(p.Inputs) {
+		return nil, ErrInputIndex
+	}
+
+	return p.Inputs[i], nil
+}
+
+// SetUtxo sets prevTx as the transaction input i spends from. The output it
+// spends is also set as the witness UTXO when it is a witness program, or
+// pays to a redeem script that is one.
+func (p *Psbt) SetUtxo(i int, prevTx *tx.Tx) error {
+	in, err := p.input(i)
+	if err != nil {
+		return err
+	}
+	if prevTx.TxId() != in.PreviousTxId || int(in.OutputIndex) >= len(prevTx.TxOuts) {
+		return ErrUtxoMismatch
+	}
+
+	in.NonWitnessUtxo = prevTx
+	txOut := prevTx.TxOuts[in.OutputIndex]
+	if in.spendsWitness(txOut) {
+		in.WitnessUtxo = txOut
+	}
+
+	return nil
+}
+
+// Update sets the witness UTXO of the inputs without a UTXO to the outputs
+// the fetcher returns. Only witness programs are set, the other inputs
+// need their previous transaction from SetUtxo.
+func (p *Psbt) Update(fetcher tx.PrevOutFetcher) error {
+	for _, in := range p.Inputs {
+		if in.NonWitnessUtxo != nil || in.WitnessUtxo != nil {
+			continue
+		}
+
+		txOut, err := fetcher.FetchPrevOut(in.PreviousTxId, in.OutputIndex)
+		if err != nil {
+			return err
+		}
+		if in.spendsWitness(txOut) {
+			in.WitnessUtxo = txOut
+		}
+	}
+
+	return nil
+}
+
+// spendsWitness reports whether txOut is a witness program, or pays to the
+// redeem script of the input that is one. A finalized input has dropped its
+// redeem script, its final witness tells instead.
+func (in *Input) spendsWitness(txOut *tx.TxOut) bool {
+	return isWitnessProgram(txOut.ScriptPubKey) || (in.RedeemScript != nil && isWitnessProgram(in.RedeemScript)) ||
+		in.FinalScriptWitness != nil
+}
+
+func isWitnessProgram(s *script.Script) bool {
+	class, _ := script.Classify(s)
+	switch class {
+	case script.TX_WITNESS_V0_KEYHASH, script.TX_WITNESS_V0_SCRIPTHASH, script.TX_WITNESS_V1_TAPROOT, script.TX_WITNESS_UNKNOWN:
+		return true
+	}
+
+	return false
+}
+
+// Utxo returns the output the input spends. The previous transaction is
+// checked against the input and the witness UTXO, a witness UTXO alone is
+// only taken for witness programs, the amount of the other outputs isn't
+// signed.
+func (in *Input) Utxo() (*tx.TxOut, error) {
+	if in.NonWitnessUtxo != nil {
+		if in.NonWitnessUtxo.TxId() != in.PreviousTxId || int(in.OutputIndex) >= len(in.NonWitnessUtxo.TxOuts) {
+			return nil, ErrUtxoMismatch
+		}
+		txOut := in.NonWitnessUtxo.TxOuts[in.OutputIndex]
+		if in.WitnessUtxo != nil && !bytes.Equal(in.WitnessUtxo.Serialize(), txOut.Serialize()) {
+			return nil, ErrUtxoMismatch
+		}
+
+		return txOut, nil
+	}
+	if in.WitnessUtxo == nil || !in.spendsWitness(in.WitnessUtxo) {
+		return nil, ErrNoUtxo
+	}
+
+	return in.WitnessUtxo, nil
+}
+
+// IsFinalized reports whether the input has its final script sig or
+// witness.
+func (in *Input) IsFinalized() bool {
+	return in.FinalScriptSig != nil || in.FinalScriptWitness != nil
+}
+
+// fetcher returns the UTXOs of the inputs, the ones not known are left out.
+func (p *Psbt) fetcher() tx.MapFetcher {
+	fetcher := tx.MapFetcher{}
+	for _, in := range p.Inputs {
+		if txOut, err := in.Utxo(); err == nil {
+			fetcher.Add(in.PreviousTxId, in.OutputIndex, txOut)
+		}
+	}
+
+	return fetcher
+}
+
+// Sign is the signer, it adds the signature of key to input i. The input
+// needs its UTXO, and the redeem and witness scripts of P2SH and P2WSH
+// outputs, which must contain the public key. P2TR inputs are signed with
+// the key path, key is then the internal key and TapMerkleRoot the root of
+// the output's script tree, every input needs its UTXO.
+func (p *Psbt) Sign(i int, key *c.PrivateKey) error {
+	in, err := p.input(i)
+	if err != nil {
+		return err
+	}
+	utxo, err := in.Utxo()
+	if err != nil {
+		return err
+	}
+	unsignedTx, err := p.UnsignedTx()
+	if err != nil {
+		return err
+	}
+	fetcher := p.fetcher()
+
+	class, data := script.Classify(utxo.ScriptPubKey)
+	if class == script.TX_WITNESS_V1_TAPROOT {
+		return p.signTaproot(unsignedTx, fetcher, i, key, data.Program)
+	}
+
+	hashType := tx.SIGHASH_ALL
+	if in.SighashType != nil {
+		hashType = *in.SighashType
+	}
+
+	sec := key.Sec(true)
+	var z []byte
+
+	switch class {
+	case script.TX_PUBKEYHASH, script.TX_WITNESS_V0_KEYHASH:
+		hash := data.Hash
+		if class == script.TX_WITNESS_V0_KEYHASH {
+			hash = data.Program
+		}
+		if !bytes.Equal(u.Hash160(sec), hash) {
+			return ErrKeyMismatch
+		}
+		if class == script.TX_PUBKEYHASH {
+			z, err = unsignedTx.SigHash(fetcher, i, nil, hashType)
+		} else {
+			z, err = unsignedTx.SigHashBip143(fetcher, i, nil, nil, hashType)
+		}
+	case script.TX_SCRIPTHASH:
+		if in.RedeemScript == nil || !bytes.Equal(u.Hash160(in.RedeemScript.RawSerialize()), data.Hash) {
+			return ErrScriptMismatch
+		}
+
+		redeemClass, redeemData := script.Classify(in.RedeemScript)
+		switch redeemClass {
+		case script.TX_WITNESS_V0_KEYHASH:
+			if !bytes.Equal(u.Hash160(sec), redeemData.Program) {
+				return ErrKeyMismatch
+			}
+			z, err = unsignedTx.SigHashBip143(fetcher, i, in.RedeemScript, nil, hashType)
+		case script.TX_WITNESS_V0_SCRIPTHASH:
+			if err := in.checkWitnessScript(redeemData.Program, sec); err != nil {
+				return err
+			}
+			z, err = unsignedTx.SigHashBip143(fetcher, i, nil, in.WitnessScript, hashType)
+		default:
+			if !hasKey(in.RedeemScript, sec) {
+				return ErrKeyMismatch
+			}
+			z, err = unsignedTx.SigHash(fetcher, i, in.RedeemScript, hashType)
+		}
+	case script.TX_WITNESS_V0_SCRIPTHASH:
+		if err := in.checkWitnessScript(data.Program, sec); err != nil {
+			return err
+		}
+		z, err = unsignedTx.SigHashBip143(fetcher, i, nil, in.WitnessScript, hashType)
+	default:
+		if !hasKey(utxo.ScriptPubKey, sec) {
+			return ErrKeyMismatch
+		}
+		z, err = unsignedTx.SigHash(fetcher, i, nil, hashType)
+	}
+	if err != nil {
+		return err
+	}
+
+	sig := append(key.Sign(u.ParseBytes(z)).Der(), byte(hashType))
+	in.addPartialSig(&PartialSig{PubKey: sec, Signature: sig})
+
+	return nil
+}
+
+func (p *Psbt) signTaproot(unsignedTx *tx.Tx, fetcher tx.PrevOutFetcher, i int, key *c.PrivateKey, outputKey []byte) error {
+	in := p.Inputs[i]
+	if in.TapInternalKey != nil && !bytes.Equal(in.TapInternalKey, key.XOnly()) {
+		return ErrKeyMismatch
+	}
+
+	tweaked, err := key.TaprootTweak(in.TapMerkleRoot)
+	if err != nil {
+		return err
+	}
+	if !bytes.Equal(tweaked.XOnly(), outputKey) {
+		return ErrKeyMismatch
+	}
+
+	hashType := tx.SIGHASH_DEFAULT
+	if in.SighashType != nil {
+		hashType = *in.SighashType
+	}
+
+	z, err := unsignedTx.SigHashTaproot(fetcher, i, hashType, nil)
+	if err != nil {
+		return err
+	}
+
+	sig := tweaked.SignSchnorr(z).Serialize()
+	if hashType != tx.SIGHASH_DEFAULT {
+		sig = append(sig, byte(hashType))
+	}
+	in.TapKeySig = sig
+	in.TapInternalKey = key.XOnly()
+
+	return nil
+}
+
+// SignAll signs every input key can sign and returns how many it signed.
+func (p *Psbt) SignAll(key *c.PrivateKey) (int, error) {
+	signed := 0
+	for i, in := range p.Inputs {
+		if in.IsFinalized() {
+			continue
+		}
+
+		err := p.Sign(i, key)
+		if err == ErrKeyMismatch {
+			continue
+		}
+		if err != nil {
+			return signed, err
+		}
+		signed++
+	}
+
+	return signed, nil
+}
+
+func (in *Input) checkWitnessScript(hash, sec []byte) error {
+	if in.WitnessScript == nil || !bytes.Equal(sha256Sum(in.WitnessScript.RawSerialize()), hash) {
+		return ErrScriptMismatch
+	}
+	if !hasKey(in.WitnessScript, sec) {
+		return ErrKeyMismatch
+	}
+
+	return nil
+}
+
+func sha256Sum(b []byte) []byte {
+	sum := sha256.Sum256(b)
+	return sum[:]
+}
+
+// hasKey reports whether the script pushes the public key or its hash.
+func hasKey(s *script.Script, sec []byte) bool {
+	h160 := u.Hash160(sec)
+	for _, cmd := range s.Cmds {
+		if bytes.Equal(cmd, sec) || bytes.Equal(cmd, h160) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// addPartialSig adds sig, replacing a signature of the same key.
+func (in *Input) addPartialSig(sig *PartialSig) {
+	for i, s := range in.PartialSigs {
+		if bytes.Equal(s.PubKey, sig.PubKey) {
+			in.PartialSigs[i] = sig
+			return
+		}
+	}
+	in.PartialSigs = append(in.PartialSigs, sig)
+}
+
+func (in *Input) partialSig(pubKey []byte) []byte {
+	for _, s := range in.PartialSigs {
+		if bytes.Equal(s.PubKey, pubKey) {
+			return s.Signature
+		}
+	}
+
+	return nil
+}
+
+// Combine is the combiner, it merges into p the fields of PSBTs of the same
+// transaction.
+func (p *Psbt) Combine(others ...*Psbt) error {
+	unsignedTx, err := p.UnsignedTx()
+	if err != nil {
+		return err
+	}
+
+	for _, other := range others {
+		otherTx, err := other.UnsignedTx()
+		if err != nil {
+			return err
+		}
+		if otherTx.TxId() != unsignedTx.TxId() {
+			return ErrCombine
+		}
+	}
+
+	for _, other := range others {
+		for _, xpub := range other.XPubs {
+			if !p.hasXPub(xpub.Key) {
+				p.XPubs = append(p.XPubs, xpub)
+			}
+		}
+		p.Unknown = combineUnknown(p.Unknown, other.Unknown)
+
+		for i, in := range p.Inputs {
+			in.combine(other.Inputs[i])
+		}
+		for i, out := range p.Outputs {
+			out.combine(other.Outputs[i])
+		}
+	}
+
+	return nil
+}
+
+func (p *Psbt) hasXPub(key []byte) bool {
+	for _, xpub := range p.XPubs {
+		if bytes.Equal(xpub.Key, key) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (in *Input) combine(other *Input) {
+	if in.NonWitnessUtxo == nil {
+		in.NonWitnessUtxo = other.NonWitnessUtxo
+	}
+	if in.WitnessUtxo == nil {
+		in.WitnessUtxo = other.WitnessUtxo
+	}
+	if in.SighashType == nil {
+		in.SighashType = other.SighashType
+	}
+	if in.RedeemScript == nil {
+		in.RedeemScript = other.RedeemScript
+	}
+	if in.WitnessScript == nil {
+		in.WitnessScript = other.WitnessScript
+	}
+	if in.TapKeySig == nil {
+		in.TapKeySig = other.TapKeySig
+	}
+	if in.TapInternalKey == nil {
+		in.TapInternalKey = other.TapInternalKey
+	}
+	if in.TapMerkleRoot == nil {
+		in.TapMerkleRoot = other.TapMerkleRoot
+	}
+	if !in.IsFinalized() {
+		in.FinalScriptSig = other.FinalScriptSig
+		in.FinalScriptWitness = other.FinalScriptWitness
+	}
+
+	for _, sig := range other.PartialSigs {
+		if in.partialSig(sig.PubKey) == nil {
+			in.PartialSigs = append(in.PartialSigs, sig)
+		}
+	}
+	in.Bip32Derivation = combineDerivations(in.Bip32Derivation, other.Bip32Derivation)
+	in.Unknown = combineUnknown(in.Unknown, other.Unknown)
+}
+
+func (out *Output) combine(other *Output) {
+	if out.RedeemScript == nil {
+		out.RedeemScript = other.RedeemScript
+	}
+	if out.WitnessScript == nil {
+		out.WitnessScript = other.WitnessScript
+	}
+	if out.TapInternalKey == nil {
+		out.TapInternalKey = other.TapInternalKey
+	}
+	out.Bip32Derivation = combineDerivations(out.Bip32Derivation, other.Bip32Derivation)
+	out.Unknown = combineUnknown(out.Unknown, other.Unknown)
+}
+
+func combineDerivations(derivations, others []*Bip32Derivation) []*Bip32Derivation {
+	for _, other := range others {
+		found := false
+		for _, d := range derivations {
+			if bytes.Equal(d.PubKey, other.PubKey) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			derivations = append(derivations, other)
+		}
+	}
+
+	return derivations
+}
+
+func combineUnknown(unknown, others []*KeyValue) []*KeyValue {
+	for _, other := range others {
+		found := false
+		for _, kv := range unknown {
+			if bytes.Equal(kv.Key, other.Key) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			unknown = append(unknown, other)
+		}
+	}
+
+	return unknown
+}
+
+// Finalize is the finalizer, it finalizes every input that isn't yet.
+func (p *Psbt) Finalize() error {
+	for i := range p.Inputs {
+		if err := p.FinalizeInput(i); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// FinalizeInput builds the script sig and witness of input i from its
+// partial signatures, or its key path signature, and checks that they spend
+// the UTXO. P2PKH, P2WPKH and P2TR key path outputs, and P2SH, P2WSH and
+// P2SH-P2WSH ones to single key or multisig scripts, can be finalized. The
+// fields only signers need are then removed.
+func (p *Psbt) FinalizeInput(i int) error {
+	in, err := p.input(i)
+	if err != nil {
+		return err
+	}
+	if in.IsFinalized() {
+		return nil
+	}
+	utxo, err := in.Utxo()
+	if err != nil {
+		return err
+	}
+
+	var scriptSig [][]byte
+	var witness [][]byte
+
+	class, data := script.Classify(utxo.ScriptPubKey)
+	switch class {
+	case script.TX_WITNESS_V1_TAPROOT:
+		if in.TapKeySig == nil {
+			return ErrFinalize
+		}
+		witness = [][]byte{in.TapKeySig}
+	case script.TX_PUBKEYHASH:
+		scriptSig, err = in.keyHashStack(data.Hash)
+	case script.TX_WITNESS_V0_KEYHASH:
+		witness, err = in.keyHashStack(data.Program)
+	case script.TX_WITNESS_V0_SCRIPTHASH:
+		witness, err = in.witnessScriptStack()
+	case script.TX_SCRIPTHASH:
+		if in.RedeemScript == nil {
+			return ErrFinalize
+		}
+		redeemScript := in.RedeemScript.RawSerialize()
+
+		redeemClass, redeemData := script.Classify(in.RedeemScript)
+		switch redeemClass {
+		case script.TX_WITNESS_V0_KEYHASH:
+			witness, err = in.keyHashStack(redeemData.Program)
+		case script.TX_WITNESS_V0_SCRIPTHASH:
+			witness, err = in.witnessScriptStack()
+		default:
+			scriptSig, err = in.scriptStack(in.RedeemScript)
+		}
+		scriptSig = append(scriptSig, redeemScript)
+	default:
+		scriptSig, err = in.scriptStack(utxo.ScriptPubKey)
+	}
+	if err != nil {
+		return err
+	}
+
+	final, err := p.UnsignedTx()
+	if err != nil {
+		return err
+	}
+	final.TxIns[i].ScriptSig = &script.Script{Cmds: scriptSig}
+	final.TxIns[i].Witness = witness
+
+	engine, err := final.NewEngine(p.fetcher(), i, script.STANDARD_SCRIPT_VERIFY_FLAGS)
+	if err != nil {
+		return err
+	}
+	if err := engine.Execute(); err != nil {
+		return err
+	}
+
+	if len(scriptSig) > 0 {
+		in.FinalScriptSig = final.TxIns[i].ScriptSig
+	}
+	in.FinalScriptWitness = witness
+
+	in.PartialSigs = nil
+	in.SighashType = nil
+	in.RedeemScript = nil
+	in.WitnessScript = nil
+	in.Bip32Derivation = nil
+	in.TapKeySig = nil
+	in.TapInternalKey = nil
+	in.TapMerkleRoot = nil
+
+	return nil
+}
+
+// keyHashStack returns the signature and public key of the key with hash.
+func (in *Input) keyHashStack(hash []byte) ([][]byte, error) {
+	for _, s := range in.PartialSigs {
+		if bytes.Equal(u.Hash160(s.PubKey), hash) {
+			return [][]byte{s.Signature, s.PubKey}, nil
+		}
+	}
+
+	return nil, ErrFinalize
+}
+
+func (in *Input) witnessScriptStack() ([][]byte, error) {
+	if in.WitnessScript == nil {
+		return nil, ErrFinalize
+	}
+
+	stack, err := in.scriptStack(in.WitnessScript)
+	if err != nil {
+		return nil, err
+	}
+
+	return append(stack, in.WitnessScript.RawSerialize()), nil
+}
+
+// scriptStack returns the signatures satisfying a single key or multisig
+// script, the multisig ones in the order of their keys.
+func (in *Input) scriptStack(s *script.Script) ([][]byte, error) {
+	class, data := script.Classify(s)
+
+	switch class {
+	case script.TX_PUBKEY:
+		if sig := in.partialSig(data.PubKeys[0]); sig != nil {
+			return [][]byte{sig}, nil
+		}
+	case script.TX_PUBKEYHASH:
+		return in.keyHashStack(data.Hash)
+	case script.TX_MULTISIG:
+		// the extra item OP_CHECKMULTISIG pops
+		stack := [][]byte{{}}
+		for _, pubKey := range data.PubKeys {
+			if len(stack) > data.Required {
+				break
+			}
+			if sig := in.partialSig(pubKey); sig != nil {
+				stack = append(stack, sig)
+			}
+		}
+		if len(stack) > data.Required {
+			return stack, nil
+		}
+	}
+
+	return nil, ErrFinalize
+}
+
+// Extract is the extractor, it returns the signed transaction of a PSBT
+// whose inputs are all finalized.
+func (p *Psbt) Extract() (*tx.Tx, error) {
+	signedTx, err := p.UnsignedTx()
+	if err != nil {
+		return nil, err
+	}
+
+	for i, in := range p.Inputs {
+		if !in.IsFinalized() {
+			return nil, ErrNotFinalized
+		}
+		if in.FinalScriptSig != nil {
+			signedTx.TxIns[i].ScriptSig = in.FinalScriptSig
+		}
+		signedTx.TxIns[i].Witness = in.FinalScriptWitness
+	}
+
+	return signedTx, nil
+}
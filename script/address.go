@@ -0,0 +1,29 @@
+package script
+
+import (
+	u "github.com/lobiCode/prog_btc_go/btcutils"
+	"github.com/lobiCode/prog_btc_go/chaincfg"
+)
+
+// DecodeAddress returns the script pubkey an address of the network pays
+// to, a base58 P2PKH or P2SH address or a segwit address of any witness
+// version.
+func DecodeAddress(address string, params *chaincfg.Params) (*Script, error) {
+	if version, program, err := u.DecodeSegwitAddress(params.Bech32HRP, address); err == nil {
+		return P2witness(version, program), nil
+	}
+
+	b, err := u.DecodeBase58Checksum(address)
+	if err != nil || len(b) != 21 {
+		return nil, u.ErrBadAddress
+	}
+
+	switch b[0] {
+	case params.PubKeyHashAddrID:
+		return P2pkh(b[1:]), nil
+	case params.ScriptHashAddrID:
+		return P2sh(b[1:]), nil
+	}
+
+	return nil, u.ErrBadAddress
+}
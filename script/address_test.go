@@ -0,0 +1,47 @@
+package script
+
+import (
+	"encoding/hex"
+	"testing"
+
+	u "github.com/lobiCode/prog_btc_go/btcutils"
+	"github.com/lobiCode/prog_btc_go/chaincfg"
+)
+
+func TestDecodeAddress(t *testing.T) {
+	main, testnet := &chaincfg.MainNetParams, &chaincfg.TestNet3Params
+	tests := []struct {
+		address string
+		params  *chaincfg.Params
+		script  string
+	}{
+		{"1BgGZ9tcN4rm9KBzDn7KprQz87SZ26SAMH", main, "76a914751e76e8199196d454941c45d1b3a323f1433bd688ac"},
+		{"miKegze5FQNCnGw6PKyqUbYUeBa4x2hFeM", testnet, "76a9141ec51b3654c1f1d0f4929d11a1f702937eaf50c888ac"},
+		{"3NfDBB7zG3gMHD8Um212FeMKdpoKGX6Vzc", main, "a914e60333d42b4a653dbc3dc811852836a43eb983ad87"},
+		{"2MtwTo5PCjTiGdKHfVVWFp4HGEdRk1TmZ9K", testnet, "a91412944a20d0b548b3d0507faf492509132db629a287"},
+		{"bc1qw508d6qejxtdg4y5r3zarvary0c5xw7kv8f3t4", main, "0014751e76e8199196d454941c45d1b3a323f1433bd6"},
+		{"tb1qrp33g0q5c5txsp9arysrx4k6zdkfs4nce4xj0gdcccefvpysxf3q0sl5k7", testnet, "00201863143c14c5166804bd19203356da136c985678cd4d27a1b8c6329604903262"},
+		{"bcrt1qw508d6qejxtdg4y5r3zarvary0c5xw7kygt080", &chaincfg.RegressionNetParams, "0014751e76e8199196d454941c45d1b3a323f1433bd6"},
+		{"bc1p0xlxvlhemja6c4dqv22uapctqupfhlxm9h8z3k2e72q4k9hcz7vqzk5jj0", main, "512079be667ef9dcbbac55a06295ce870b07029bfcdb2dce28d959f2815b16f81798"},
+	}
+
+	for _, test := range tests {
+		s, err := DecodeAddress(test.address, test.params)
+		check(nil, err, t)
+		check(test.script, hex.EncodeToString(s.RawSerialize()), t)
+
+		address, err := s.GetAddress(test.params)
+		check(nil, err, t)
+		check(test.address, address, t)
+	}
+
+	// an address of another network
+	for _, test := range tests {
+		other := main
+		if test.params == main {
+			other = testnet
+		}
+		_, err := DecodeAddress(test.address, other)
+		check(u.ErrBadAddress, err, t)
+	}
+}
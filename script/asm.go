@@ -0,0 +1,205 @@
+package script
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"strconv"
+	"strings"
+)
+
+var ErrASMParse = errors.New("parsing script asm failed")
+
+// op_codes_aliases are the other names Bitcoin Core's tests use for opcodes.
+var op_codes_aliases = map[string]byte{
+	"OP_FALSE": 0,
+	"OP_TRUE":  81,
+	"OP_NOP2":  177,
+	"OP_NOP3":  178,
+}
+
+func getOpCode(name string) (byte, bool) {
+	if !strings.HasPrefix(name, "OP_") {
+		name = "OP_" + name
+	}
+
+	if op, ok := op_codes_aliases[name]; ok {
+		return op, true
+	}
+
+	for op, v := range op_codes_names {
+		if v == name {
+			return op, true
+		}
+	}
+
+	return 0, false
+}
+
+// ParseASM parses a script written in the notation of Bitcoin Core and btcd,
+// see AssembleASM.
+func ParseASM(asm string) (*Script, error) {
+	raw, err := AssembleASM(asm)
+	if err != nil {
+		return nil, err
+	}
+
+	return ParseRaw(raw)
+}
+
+// AssembleASM returns the bytes of a script written as whitespace separated
+// words. A word is one of
+//
+//	a decimal number, pushed as OP_0, OP_1NEGATE, OP_1-OP_16 or a script number
+//	0x followed by hex, the bytes themselves
+//	'text', a push of text
+//	an opcode name, with or without OP_
+//	hex, a push of the data
+//
+// Pushes use the smallest push opcode that fits the data.
+func AssembleASM(asm string) ([]byte, error) {
+	result := []byte{}
+	for _, w := range strings.Fields(asm) {
+		if n, err := strconv.ParseInt(w, 10, 64); err == nil {
+			result = append(result, PushNum(n)...)
+			continue
+		}
+
+		if strings.HasPrefix(w, "0x") {
+			b, err := hex.DecodeString(w[2:])
+			if err != nil || len(b) == 0 {
+				return nil, ErrASMParse
+			}
+			result = append(result, b...)
+			continue
+		}
+
+		if len(w) >= 2 && w[0] == '\'' && w[len(w)-1] == '\'' {
+			result = append(result, encodePush([]byte(w[1:len(w)-1]))...)
+			continue
+		}
+
+		if op, ok := getOpCode(w); ok {
+			result = append(result, op)
+			continue
+		}
+
+		b, err := hex.DecodeString(w)
+		if err != nil {
+			return nil, ErrASMParse
+		}
+		result = append(result, encodePush(b)...)
+	}
+
+	return result, nil
+}
+
+// PushData returns the smallest instruction pushing data.
+func PushData(data []byte) []byte {
+	return encodePush(data)
+}
+
+// PushNum returns the smallest instruction pushing the script number n,
+// OP_0, OP_1NEGATE and OP_1-OP_16 for the numbers they push.
+func PushNum(n int64) []byte {
+	switch {
+	case n == 0:
+		return []byte{0}
+	case n == -1 || (n >= 1 && n <= 16):
+		return []byte{byte(n + 80)}
+	}
+
+	return encodePush(encodeNum(n))
+}
+
+// encodePush returns the smallest push of data, an empty one is OP_0.
+func encodePush(data []byte) []byte {
+	l := len(data)
+
+	var result []byte
+	switch {
+	case l == 0:
+		return []byte{0}
+	case l < 76:
+		result = []byte{byte(l)}
+	case l <= 0xff:
+		result = []byte{76, byte(l)}
+	case l <= 0xffff:
+		result = []byte{77, 0, 0}
+		binary.LittleEndian.PutUint16(result[1:], uint16(l))
+	default:
+		result = []byte{78, 0, 0, 0, 0}
+		binary.LittleEndian.PutUint32(result[1:], uint32(l))
+	}
+
+	return append(result, data...)
+}
+
+// ASM returns the script in the notation AssembleASM reads, which gives back
+// the same bytes. Pushes print as hex, or as a number when that's how the
+// number is pushed, other pushes and unknown opcodes keep their bytes.
+func (s *Script) ASM() string {
+	return disassemble(s.RawSerialize())
+}
+
+func disassemble(raw []byte) string {
+	words := []string{}
+	for pc := 0; pc < len(raw); {
+		ins, next, ok := readInstruction(raw, pc)
+		if !ok {
+			// a push running past the end keeps its bytes
+			words = append(words, "0x"+hex.EncodeToString(raw[pc:]))
+			break
+		}
+
+		if ins.op == 0 || ins.op > 78 {
+			words = append(words, opCodeWord(ins.op))
+		} else {
+			words = append(words, pushWord(raw[pc:next-len(ins.data)], ins.data))
+		}
+		pc = next
+	}
+
+	return strings.Join(words, " ")
+}
+
+func opCodeWord(op byte) string {
+	switch {
+	case op == 0:
+		return "0"
+	case op == 79:
+		return "-1"
+	case op >= 81 && op <= 96:
+		return strconv.Itoa(int(op) - 80)
+	}
+
+	if name := GetOpCodeName(op); name != "" {
+		return name
+	}
+
+	return "0x" + hex.EncodeToString([]byte{op})
+}
+
+// pushWord returns the word of data pushed with prefix, the push opcode and
+// its length bytes.
+func pushWord(prefix, data []byte) string {
+	if len(prefix) != len(encodePush(data))-len(data) {
+		name := GetOpCodeName(prefix[0])
+		if len(data) == 0 {
+			return name + " 0x" + hex.EncodeToString(prefix[1:])
+		}
+		return name + " 0x" + hex.EncodeToString(prefix[1:]) + " 0x" + hex.EncodeToString(data)
+	}
+
+	if n, err := decodeNum(data, maxNumSize, true); err == nil && (n < -1 || n > 16) {
+		return strconv.FormatInt(n, 10)
+	}
+
+	// hex of decimal digits only would read as a number
+	word := hex.EncodeToString(data)
+	if _, err := strconv.ParseInt(word, 10, 64); err == nil {
+		return "0x" + hex.EncodeToString(prefix) + " 0x" + word
+	}
+
+	return word
+}
@@ -0,0 +1,72 @@
+package script
+
+import (
+	"encoding/hex"
+	"testing"
+)
+
+func TestAssembleASM(t *testing.T) {
+	tests := []struct {
+		asm      string
+		expected string
+	}{
+		{"0 -1 1 16", "004f5160"},
+		{"17 -2 1000", "0111018202e803"},
+		{"OP_DUP HASH160 EQUALVERIFY OP_CHECKSIG", "76a988ac"},
+		{"TRUE FALSE NOP2 OP_NOP3", "5100b1b2"},
+		{"0x4c 0x00", "4c00"},
+		{"'' 'abc'", "0003616263"},
+		{"deadbeef 1ADD", "04deadbeef8b"},
+		{"0xbb", "bb"},
+	}
+
+	for _, test := range tests {
+		raw, err := AssembleASM(test.asm)
+		check(nil, err, t)
+		check(test.expected, hex.EncodeToString(raw), t)
+	}
+
+	for _, asm := range []string{"OP_NOTANOPCODE", "0x", "0xabc", "abc"} {
+		_, err := AssembleASM(asm)
+		check(ErrASMParse, err, t)
+	}
+}
+
+func TestDisassemble(t *testing.T) {
+	tests := []struct {
+		raw      string
+		expected string
+	}{
+		{"76a914d52ad7ca9b3d096a38e752c2018e6fbc40cdf26f88ac", "OP_DUP OP_HASH160 d52ad7ca9b3d096a38e752c2018e6fbc40cdf26f OP_EQUALVERIFY OP_CHECKSIG"},
+		{"004f51600111", "0 -1 1 16 17"},
+		{"0110", "0x01 0x10"},
+		{"0180", "0x01 0x80"},
+		{"4c00", "OP_PUSHDATA1 0x00"},
+		{"4c02abcd", "OP_PUSHDATA1 0x02 0xabcd"},
+		{"4d0200abcd", "OP_PUSHDATA2 0x0200 0xabcd"},
+		{"4e02000000abcd", "OP_PUSHDATA4 0x02000000 0xabcd"},
+		{"bbff", "0xbb 0xff"},
+		{"6a04abcd", "OP_RETURN 0x04abcd"},
+		{"4d01", "0x4d01"},
+	}
+
+	for _, test := range tests {
+		raw, err := hex.DecodeString(test.raw)
+		check(nil, err, t)
+
+		asm := disassemble(raw)
+		check(test.expected, asm, t)
+
+		result, err := AssembleASM(asm)
+		check(nil, err, t)
+		check(test.raw, hex.EncodeToString(result), t)
+	}
+}
+
+func TestScriptASM(t *testing.T) {
+	asm := "0 d52ad7ca9b3d096a38e752c2018e6fbc40cdf26f"
+	s, err := ParseASM(asm)
+	check(nil, err, t)
+	check(P2wpkh(s.Cmds[1]).Cmds, s.Cmds, t)
+	check(asm, s.ASM(), t)
+}
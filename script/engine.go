@@ -0,0 +1,311 @@
+package script
+
+import "bytes"
+
+// phase is the script of an input an Engine runs.
+type phase int
+
+const (
+	phaseScriptSig phase = iota
+	phaseScriptPubKey
+	phaseRedeemScript
+	phaseWitnessScript
+	phaseDone
+)
+
+var phaseNames = map[phase]string{
+	phaseScriptSig:     "scriptSig",
+	phaseScriptPubKey:  "scriptPubKey",
+	phaseRedeemScript:  "redeemScript",
+	phaseWitnessScript: "witnessScript",
+	phaseDone:          "done",
+}
+
+// TraceHook is called before an Engine executes an instruction.
+type TraceHook func(e *Engine)
+
+// Engine runs the scripts of an input one instruction at a time, in the
+// order Evaluate runs them.
+type Engine struct {
+	ctx          *context
+	scriptSig    *Script
+	scriptPubKey *Script
+	redeemScript *Script
+	witness      [][]byte
+
+	phase     phase
+	realStack *stack
+	altStack  *stack
+	// stackCopy is the stack the script sig left for the redeem script,
+	// mainStack the one the witness script result goes back to
+	stackCopy  *stack
+	mainStack  *stack
+	hadWitness bool
+
+	err  error
+	hook TraceHook
+}
+
+// NewEngine returns an Engine at the first instruction of the input's
+// scripts, the error is why the spend fails before any instruction runs.
+func NewEngine(tx *TxContext, scriptSig, scriptPubKey *Script, witness [][]byte, flags ScriptFlags) (*Engine, error) {
+	e := &Engine{
+		ctx:          &context{tx: tx, flags: flags},
+		scriptSig:    scriptSig,
+		scriptPubKey: scriptPubKey,
+		witness:      witness,
+		realStack:    newStack(0),
+	}
+
+	if flags.has(SCRIPT_VERIFY_SIGPUSHONLY) && !scriptSig.IsPushOnly() {
+		return nil, ErrSigPushOnly
+	}
+
+	if err := e.start(phaseScriptSig, scriptSig); err != nil {
+		return nil, err
+	}
+
+	return e, nil
+}
+
+// SetTraceHook sets the function called before each instruction.
+func (e *Engine) SetTraceHook(hook TraceHook) {
+	e.hook = hook
+}
+
+// Step executes the next instruction, done is true once the scripts ended
+// or failed with err.
+func (e *Engine) Step() (done bool, err error) {
+	if e.phase == phaseDone {
+		return true, e.err
+	}
+
+	if e.hook != nil {
+		e.hook(e)
+	}
+
+	err = step(e.ctx, e.realStack, e.altStack)
+	if err == nil {
+		err = e.advance()
+	}
+	if err != nil {
+		e.err = err
+		e.phase = phaseDone
+	}
+
+	return e.phase == phaseDone, err
+}
+
+// Execute runs the rest of the scripts, it returns nil when the spend is
+// valid.
+func (e *Engine) Execute() error {
+	for {
+		if done, err := e.Step(); done {
+			return err
+		}
+	}
+}
+
+// Phase returns the name of the running script, scriptSig, scriptPubKey,
+// redeemScript, witnessScript or tapscript, and done at the end.
+func (e *Engine) Phase() string {
+	if e.phase == phaseWitnessScript && e.ctx.sigVersion == sigVersionTapscript {
+		return "tapscript"
+	}
+
+	return phaseNames[e.phase]
+}
+
+// Script returns the running script.
+func (e *Engine) Script() *Script {
+	return newScript(e.ctx.script)
+}
+
+// PC returns the offset of the next instruction in the running script.
+func (e *Engine) PC() int {
+	return e.ctx.pc
+}
+
+// Opcode returns the next instruction, ok is false at the end and at a push
+// running past the end of the script.
+func (e *Engine) Opcode() (op byte, data []byte, ok bool) {
+	if e.phase == phaseDone || e.ctx.pc >= len(e.ctx.script) {
+		return 0, nil, false
+	}
+
+	ins, _, ok := readInstruction(e.ctx.script, e.ctx.pc)
+
+	return ins.op, ins.data, ok
+}
+
+// Stack returns the main stack, the top is the last element.
+func (e *Engine) Stack() [][]byte {
+	return copyStack(e.realStack)
+}
+
+// AltStack returns the alt stack, the top is the last element.
+func (e *Engine) AltStack() [][]byte {
+	return copyStack(e.altStack)
+}
+
+// Branches returns whether each enclosing conditional branch is taken, the
+// innermost last.
+func (e *Engine) Branches() []bool {
+	return append([]bool{}, e.ctx.execStack...)
+}
+
+// Executing reports whether the next instruction runs, all the enclosing
+// branches are taken.
+func (e *Engine) Executing() bool {
+	return e.ctx.executing()
+}
+
+func copyStack(s *stack) [][]byte {
+	result := make([][]byte, s.length())
+	for i, v := range s.s {
+		result[i] = append([]byte{}, v...)
+	}
+
+	return result
+}
+
+// start begins running script, each script starts with its own altstack,
+// conditionals and operation count.
+func (e *Engine) start(p phase, script *Script) error {
+	raw := script.RawSerialize()
+	if e.ctx.sigVersion != sigVersionTapscript && len(raw) > maxScriptSize {
+		return ErrScriptSize
+	}
+
+	e.phase = p
+	e.ctx.startScript(raw)
+	e.altStack = newStack(0)
+
+	return e.advance()
+}
+
+// advance ends the running script once it has no instructions left and
+// starts the one after it.
+func (e *Engine) advance() error {
+	if e.phase == phaseDone || e.ctx.pc < len(e.ctx.script) {
+		return nil
+	}
+
+	if len(e.ctx.execStack) > 0 {
+		return ErrUnbalancedConditional
+	}
+
+	switch e.phase {
+	case phaseScriptSig:
+		// the redeem script runs on the stack the script sig left
+		if e.ctx.flags.has(SCRIPT_VERIFY_P2SH) {
+			e.stackCopy = newStack(e.realStack.length())
+			e.stackCopy.push(e.realStack.s...)
+		}
+
+		return e.start(phaseScriptPubKey, e.scriptPubKey)
+	case phaseScriptPubKey:
+		return e.endScriptPubKey()
+	case phaseRedeemScript:
+		return e.endRedeemScript()
+	}
+
+	// the witness script has to leave exactly one true element
+	if e.realStack.length() != 1 {
+		return ErrCleanStack
+	}
+	if !castToBool(e.realStack.get()) {
+		return ErrEvalFalse
+	}
+	e.realStack = e.mainStack
+
+	return e.finish()
+}
+
+func (e *Engine) endScriptPubKey() error {
+	if e.realStack.length() == 0 || !castToBool(e.realStack.get()) {
+		return ErrEvalFalse
+	}
+
+	scriptPubKeyB := e.scriptPubKey.RawSerialize()
+	if version, program, ok := witnessProgram(scriptPubKeyB); ok && e.ctx.flags.has(SCRIPT_VERIFY_WITNESS) {
+		if len(e.scriptSig.RawSerialize()) != 0 {
+			return ErrWitnessMalleated
+		}
+
+		return e.startWitness(version, program, false)
+	}
+
+	if e.ctx.flags.has(SCRIPT_VERIFY_P2SH) && isP2sh(scriptPubKeyB) {
+		if !e.scriptSig.IsPushOnly() {
+			return ErrSigPushOnly
+		}
+
+		e.realStack = e.stackCopy
+		e.redeemScript = newScript(e.realStack.pop())
+
+		return e.start(phaseRedeemScript, e.redeemScript)
+	}
+
+	return e.finish()
+}
+
+func (e *Engine) endRedeemScript() error {
+	if e.realStack.length() == 0 || !castToBool(e.realStack.get()) {
+		return ErrEvalFalse
+	}
+
+	redeemScriptB := e.redeemScript.RawSerialize()
+	if version, program, ok := witnessProgram(redeemScriptB); ok && e.ctx.flags.has(SCRIPT_VERIFY_WITNESS) {
+		if !bytes.Equal(e.scriptSig.RawSerialize(), encodePush(redeemScriptB)) {
+			return ErrWitnessMalleatedP2SH
+		}
+
+		return e.startWitness(version, program, true)
+	}
+
+	return e.finish()
+}
+
+// startWitness verifies the witness against the program and starts the
+// script it commits to, when it has one.
+func (e *Engine) startWitness(version byte, program []byte, isP2sh bool) error {
+	e.hadWitness = true
+
+	script, items, err := witnessScript(e.ctx, version, program, e.witness, isP2sh)
+	if err != nil {
+		return err
+	}
+
+	// the witness leaves exactly one true element
+	e.realStack.s = e.realStack.s[:1]
+	if script == nil {
+		return e.finish()
+	}
+
+	for _, item := range items {
+		if len(item) > maxScriptElementSize {
+			return ErrPushSize
+		}
+	}
+
+	e.mainStack = e.realStack
+	e.realStack = newStack(len(items))
+	e.realStack.push(items...)
+
+	return e.start(phaseWitnessScript, script)
+}
+
+func (e *Engine) finish() error {
+	if e.ctx.flags.has(SCRIPT_VERIFY_CLEANSTACK) && e.realStack.length() != 1 {
+		return ErrCleanStack
+	}
+
+	if e.ctx.flags.has(SCRIPT_VERIFY_WITNESS) && !e.hadWitness && len(e.witness) > 0 {
+		return ErrWitnessUnexpected
+	}
+
+	e.phase = phaseDone
+
+	return nil
+}
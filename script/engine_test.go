@@ -0,0 +1,95 @@
+package script
+
+import (
+	"crypto/sha256"
+	"testing"
+
+	u "github.com/lobiCode/prog_btc_go/btcutils"
+)
+
+func TestEngineStep(t *testing.T) {
+	redeemScript := mustParseASM("TOALTSTACK 1 IF FROMALTSTACK ENDIF", t)
+	scriptSig := &Script{Cmds: [][]byte{{0x02}, redeemScript.RawSerialize()}}
+	scriptPubKey := P2sh(u.Hash160(redeemScript.RawSerialize()))
+
+	e, err := NewEngine(fixedTxContext(nil), scriptSig, scriptPubKey, nil, testFlags)
+	check(nil, err, t)
+
+	phases := []string{}
+	e.SetTraceHook(func(e *Engine) {
+		phases = append(phases, e.Phase())
+	})
+
+	// the two pushes of the script sig
+	for i := 0; i < 2; i++ {
+		done, err := e.Step()
+		check(false, done, t)
+		check(nil, err, t)
+	}
+	check("scriptPubKey", e.Phase(), t)
+	op, _, ok := e.Opcode()
+	check(byte(0xa9), op, t)
+	check(true, ok, t)
+	check([][]byte{{0x02}, redeemScript.RawSerialize()}, e.Stack(), t)
+
+	check(nil, runUntil(e, 0x63), t)
+	check("redeemScript", e.Phase(), t)
+	check([][]byte{{0x01}}, e.Stack(), t)
+	check([][]byte{{0x02}}, e.AltStack(), t)
+
+	_, err = e.Step()
+	check(nil, err, t)
+	check([]bool{true}, e.Branches(), t)
+	check(true, e.Executing(), t)
+
+	check(nil, e.Execute(), t)
+	check("done", e.Phase(), t)
+	check([][]byte{{0x02}}, e.Stack(), t)
+	check([]string{"scriptSig", "scriptSig", "scriptPubKey", "scriptPubKey", "scriptPubKey",
+		"redeemScript", "redeemScript", "redeemScript", "redeemScript", "redeemScript"}, phases, t)
+
+	done, err := e.Step()
+	check(true, done, t)
+	check(nil, err, t)
+}
+
+// runUntil steps until op is the next instruction.
+func runUntil(e *Engine, op byte) error {
+	for {
+		if next, _, _ := e.Opcode(); next == op {
+			return nil
+		}
+		if done, err := e.Step(); done {
+			return err
+		}
+	}
+}
+
+func TestEngineWitnessScript(t *testing.T) {
+	witnessScript := mustParseASM("2 EQUAL", t)
+	sum := sha256.Sum256(witnessScript.RawSerialize())
+	witness := [][]byte{{0x02}, witnessScript.RawSerialize()}
+
+	e, err := NewEngine(fixedTxContext(nil), &Script{}, P2wsh(sum[:]), witness, testFlags)
+	check(nil, err, t)
+	check("scriptPubKey", e.Phase(), t)
+
+	check(nil, runUntil(e, 0x52), t)
+	check("witnessScript", e.Phase(), t)
+	check([][]byte{{0x02}}, e.Stack(), t)
+	check(nil, e.Execute(), t)
+
+	e, err = NewEngine(fixedTxContext(nil), &Script{}, P2wsh(sum[:]), [][]byte{{0x03}, witness[1]}, testFlags)
+	check(nil, err, t)
+	check(ErrEvalFalse, e.Execute(), t)
+	check("done", e.Phase(), t)
+}
+
+func TestNewEngineError(t *testing.T) {
+	_, err := NewEngine(fixedTxContext(nil), &Script{}, &Script{}, nil, testFlags)
+	check(ErrEvalFalse, err, t)
+
+	scriptSig := mustParseASM("1 DUP", t)
+	_, err = NewEngine(fixedTxContext(nil), scriptSig, &Script{}, nil, testFlags|SCRIPT_VERIFY_SIGPUSHONLY)
+	check(ErrSigPushOnly, err, t)
+}
@@ -2,26 +2,17 @@ package script
 
 import (
 	"bytes"
-	"math/big"
+	"crypto/sha256"
 
 	u "github.com/lobiCode/prog_btc_go/btcutils"
 )
 
+const maxScriptSize = 10000
+
 type stack struct {
 	s [][]byte
 }
 
-func (s *stack) popFirst() []byte {
-	if s.length() == 0 {
-		return nil
-	}
-
-	sf := s.s[0]
-	s.s = s.s[1:]
-
-	return sf
-}
-
 func (s *stack) pop() []byte {
 	l := s.length()
 	if l == 0 {
@@ -68,6 +59,24 @@ func (s *stack) getN(i int) []byte {
 	return e
 }
 
+// remove takes the element at index i out of the stack, negative indexes
+// count from the top.
+func (s *stack) remove(i int) []byte {
+	p := i
+	if i < 0 {
+		p = s.length() + i
+	}
+
+	if p < 0 || p > s.length()-1 {
+		return nil
+	}
+
+	e := s.s[p]
+	s.s = append(s.s[:p], s.s[p+1:]...)
+
+	return e
+}
+
 func (s *stack) length() int {
 	return len(s.s)
 }
@@ -82,119 +91,192 @@ func newStack(capacity int) *stack {
 	return &stack{s}
 }
 
-func Evaluate(z []byte, scriptSig, scriptPubKey *Script) bool {
-	cmds := newStack(len(scriptSig.Cmds) + len(scriptPubKey.Cmds))
-	cmds.push(scriptSig.Cmds...)
-	cmds.push(scriptPubKey.Cmds...)
-
-	realStack := newStack(0)
-	altStack := newStack(0)
+// Evaluate runs the scripts of an input under the rules flags select, it
+// returns nil when the spend is valid and the reason it isn't otherwise.
+func Evaluate(tx *TxContext, scriptSig, scriptPubKey *Script, witness [][]byte, flags ScriptFlags) error {
+	e, err := NewEngine(tx, scriptSig, scriptPubKey, witness, flags)
+	if err != nil {
+		return err
+	}
 
-	return evaluate(u.ParseBytes(z), cmds, realStack, altStack)
+	return e.Execute()
 }
 
-func evaluate(z *big.Int, cmds, realStack, altStack *stack) bool {
-	for cmds.length() > 0 {
-		cmd := cmds.popFirst()
+// step executes the instruction at ctx.pc.
+func step(ctx *context, realStack, altStack *stack) error {
+	ins, next, ok := readInstruction(ctx.script, ctx.pc)
+	if !ok {
+		return ErrBadOpcode
+	}
+	ctx.pc = next
 
-		var operationFunc OperationFunc
-		if len(cmd) == 1 {
-			if s := GetOpCodeName(cmd[0]); s != "" {
-				if operationFunc = GetOperationFunction(s); operationFunc == nil {
-					return false
-				}
-			}
+	op := ins.op
+	executing := ctx.executing()
+
+	if len(ins.data) > maxScriptElementSize {
+		return ErrPushSize
+	}
+
+	// pushes of small numbers don't count
+	if op > 96 && ctx.sigVersion != sigVersionTapscript {
+		ctx.opCount++
+		if ctx.opCount > maxOpsPerScript {
+			return ErrOpCount
 		}
+	}
 
-		if operationFunc != nil {
-			if !operationFunc(z, cmds, realStack, altStack) {
-				return false
-			}
-		} else {
-			realStack.push(cmd)
-			if isP2sh(cmds.s) {
-				if !evaluateP2sk(z, cmds, realStack, altStack) {
-					return false
-				}
-				redeemScript := append(u.EncodeVariant(len(cmd)), cmd...)
-				script, err := Parse(bytes.NewReader(redeemScript))
-				if err != nil {
-					return false
-				}
-				cmds.push(script.Cmds...)
+	// disabled opcodes fail the script even in a branch that isn't executed
+	if isDisabledOpcode(op) {
+		return ErrDisabledOpcode
+	}
+
+	if op == 171 && ctx.sigVersion == sigVersionBase && ctx.flags.has(SCRIPT_VERIFY_CONST_SCRIPTCODE) {
+		return ErrOpCodeSeparator
+	}
+
+	if op <= 78 {
+		if executing {
+			if ctx.requireMinimal() && !isMinimalPush(ins) {
+				return ErrMinimalData
 			}
+			realStack.push(u.Copyb(ins.data))
+		}
+	} else if executing || isConditionalOpcode(op) {
+		operationFunc := GetOperationFunction(GetOpCodeName(op))
+		if operationFunc == nil {
+			return ErrBadOpcode
+		}
+		if err := operationFunc(ctx, realStack, altStack); err != nil {
+			return err
 		}
 	}
 
-	if realStack.length() == 0 {
-		return false
+	if realStack.length()+altStack.length() > maxStackSize {
+		return ErrStackSize
 	}
 
-	i, err := u.DecodeNum(realStack.pop())
-	// TODO
-	if err != nil || i != 1 {
+	ctx.opcodePos++
+
+	return nil
+}
+
+// isMinimalPush reports whether the data couldn't have been pushed with a
+// shorter instruction, the pushes of 1 to 16 and -1 have their own opcodes.
+func isMinimalPush(ins instruction) bool {
+	l := len(ins.data)
+	switch {
+	case l == 0:
+		return ins.op == 0
+	case l == 1 && ins.data[0] >= 1 && ins.data[0] <= 16:
+		return false
+	case l == 1 && ins.data[0] == 0x81:
 		return false
+	case l <= 75:
+		return int(ins.op) == l
+	case l <= 0xff:
+		return ins.op == 76
+	case l <= 0xffff:
+		return ins.op == 77
 	}
 
 	return true
 }
 
-func evaluateP2sk(z *big.Int, cmds, realStack, altStack *stack) bool {
-	cmds.pop()
-	h160 := cmds.pop()
-	if !opHash160(z, cmds, realStack, altStack) {
-		return false
-	}
+// witnessScript verifies the witness against the program, as defined in
+// BIP141 and BIP341, and returns the script it commits to with the stack the
+// script starts with. The script is nil when there is nothing left to run.
+// The version is the opcode that pushes it.
+func witnessScript(ctx *context, version byte, program []byte, witness [][]byte, isP2sh bool) (*Script, [][]byte, error) {
+	switch {
+	case version == 0x00 && len(program) == 32:
+		if len(witness) == 0 {
+			return nil, nil, ErrWitnessProgramWitnessEmpty
+		}
 
-	realStack.push(h160)
+		witnessScriptB := witness[len(witness)-1]
+		sum := sha256.Sum256(witnessScriptB)
+		if !bytes.Equal(program, sum[:]) {
+			return nil, nil, ErrWitnessProgramMismatch
+		}
 
-	if !opEqual(z, cmds, realStack, altStack) {
-		return false
+		ctx.sigVersion = sigVersionWitnessV0
+
+		return newScript(witnessScriptB), witness[:len(witness)-1], nil
+	case version == 0x00 && len(program) == 20:
+		if len(witness) != 2 {
+			return nil, nil, ErrWitnessProgramMismatch
+		}
+
+		ctx.sigVersion = sigVersionWitnessV0
+
+		return P2pkh(program), witness, nil
+	case version == 0x00:
+		return nil, nil, ErrWitnessProgramWrongLength
+	case version == 0x51 && len(program) == 32 && !isP2sh && ctx.flags.has(SCRIPT_VERIFY_TAPROOT):
+		return taprootScript(ctx, program, witness)
 	}
 
-	return opVerify(z, cmds, realStack, altStack)
+	// unknown witness versions, and taproot nested in P2SH, are left for
+	// future soft forks
+	if ctx.flags.has(SCRIPT_VERIFY_DISCOURAGE_UPGRADABLE_WITNESS_PROGRAM) {
+		return nil, nil, ErrDiscourageUpgradableWitnessProgram
+	}
+
+	return nil, nil, nil
 }
 
-func isP2sh(cmds [][]byte) bool {
-	if len(cmds) != 3 {
-		return false
+// witnessProgram returns the version opcode and the program of a BIP141
+// witness program, a version push followed by a 2 to 40 byte push.
+func witnessProgram(raw []byte) (byte, []byte, bool) {
+	if len(raw) < 4 || len(raw) > 42 {
+		return 0, nil, false
 	}
 
-	if !bytes.Equal(cmds[0], []byte{0xa9}) {
-		return false
+	if raw[0] != 0x00 && (raw[0] < 0x51 || raw[0] > 0x60) {
+		return 0, nil, false
 	}
 
-	if len(cmds[1]) != 20 {
-		return false
+	if int(raw[1])+2 != len(raw) {
+		return 0, nil, false
 	}
 
-	if !bytes.Equal(cmds[2], []byte{0x87}) {
-		return false
-	}
+	return raw[0], raw[2:], true
+}
 
-	return true
+func isWitnessProgram(raw []byte) bool {
+	_, _, ok := witnessProgram(raw)
+
+	return ok
 }
 
-func isP2pkh(cmds [][]byte) bool {
-	if len(cmds) != 5 {
-		return false
-	}
+func isP2tr(raw []byte) bool {
+	version, program, ok := witnessProgram(raw)
 
-	if !bytes.Equal(cmds[0], []byte{0x76}) {
-		return false
-	}
+	return ok && version == 0x51 && len(program) == 32
+}
 
-	if !bytes.Equal(cmds[1], []byte{0xa9}) {
-		return false
-	}
+func isP2wpkh(raw []byte) bool {
+	return isWitnessV0(raw, 20)
+}
 
-	if !bytes.Equal(cmds[3], []byte{0x88}) {
-		return false
-	}
+func isP2wsh(raw []byte) bool {
+	return isWitnessV0(raw, 32)
+}
 
-	if !bytes.Equal(cmds[4], []byte{0xac}) {
-		return false
-	}
+func isWitnessV0(raw []byte, programLen int) bool {
+	version, program, ok := witnessProgram(raw)
 
-	return true
+	return ok && version == 0x00 && len(program) == programLen
+}
+
+// isP2sh matches OP_HASH160 <20 bytes> OP_EQUAL byte for byte.
+func isP2sh(raw []byte) bool {
+	return len(raw) == 23 && raw[0] == 0xa9 && raw[1] == 0x14 && raw[22] == 0x87
+}
+
+// isP2pkh matches OP_DUP OP_HASH160 <20 bytes> OP_EQUALVERIFY OP_CHECKSIG
+// byte for byte.
+func isP2pkh(raw []byte) bool {
+	return len(raw) == 25 && raw[0] == 0x76 && raw[1] == 0xa9 && raw[2] == 0x14 &&
+		raw[23] == 0x88 && raw[24] == 0xac
 }
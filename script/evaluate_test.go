@@ -1,8 +1,11 @@
 package script
 
 import (
+	"crypto/sha256"
 	"encoding/hex"
 	"testing"
+
+	u "github.com/lobiCode/prog_btc_go/btcutils"
 )
 
 func TestEvaluate(t *testing.T) {
@@ -11,17 +14,40 @@ func TestEvaluate(t *testing.T) {
 
 	sig, _ := hex.DecodeString("3045022000eff69ef2b1bd93a66ed5219add4fb51e11a840f404876325a1e8ffe0529a2c022100c7207fee197d27c618aea621406f6bf5ef6fca38681d82b2f06fddbdce6feab601")
 
-	scriptPubKey := &Script{[][]byte{sec, []byte{0xac}}}
-	scriptSig := &Script{[][]byte{sig}}
+	scriptPubKey := &Script{Cmds: [][]byte{sec, []byte{0xac}}}
+	scriptSig := &Script{Cmds: [][]byte{sig}}
 
-	ok := Evaluate(z, scriptSig, scriptPubKey)
+	err := Evaluate(fixedTxContext(z), scriptSig, scriptPubKey, nil, testFlags)
 
-	check(true, ok, t)
+	check(nil, err, t)
+}
+
+func TestEvaluateSigVersion(t *testing.T) {
+	z, _ := hex.DecodeString("7c076ff316692a3d7eb3c3bb0f8b1488cf72e1afcd929e29307032997a838a3d")
+	sec, _ := hex.DecodeString("04887387e452b8eacc4acfde10d9aaf7f6d9a0f975aabb10d006e4da568744d06c61de6d95231cd89026e286df3b6ae4a894a3378e393e93a0f45b666329a0ae34")
+	sig, _ := hex.DecodeString("3045022000eff69ef2b1bd93a66ed5219add4fb51e11a840f404876325a1e8ffe0529a2c022100c7207fee197d27c618aea621406f6bf5ef6fca38681d82b2f06fddbdce6feab601")
+
+	// only the BIP143 hash matches the signature
+	txContext := &TxContext{SigHash: func(hashType uint32, ext *SigHashExt) ([]byte, error) {
+		if ext.WitnessV0 {
+			return z, nil
+		}
+		return []byte{0x01}, nil
+	}}
+
+	witnessScript := &Script{Cmds: [][]byte{sec, {0xac}}}
+	h := sha256.Sum256(witnessScript.RawSerialize())
+
+	err := Evaluate(txContext, &Script{}, P2wsh(h[:]), [][]byte{sig, witnessScript.RawSerialize()}, testFlags)
+	check(nil, err, t)
+
+	err = Evaluate(txContext, &Script{Cmds: [][]byte{sig}}, witnessScript, nil, testFlags)
+	check(ErrEvalFalse, err, t)
 }
 
 func TestEvaluate4(t *testing.T) {
 
-	scriptPubKey := &Script{[][]byte{
+	scriptPubKey := &Script{Cmds: [][]byte{
 		{0x6e},
 		{0x87},
 		{0x91},
@@ -36,8 +62,41 @@ func TestEvaluate4(t *testing.T) {
 
 	col2, _ := hex.DecodeString("255044462d312e330a25e2e3cfd30a0a0a312030206f626a0a3c3c2f57696474682032203020522f4865696768742033203020522f547970652034203020522f537562747970652035203020522f46696c7465722036203020522f436f6c6f7253706163652037203020522f4c656e6774682038203020522f42697473506572436f6d706f6e656e7420383e3e0a73747265616d0affd8fffe00245348412d3120697320646561642121212121852fec092339759c39b1a1c63c4c97e1fffe017346dc9166b67e118f029ab621b2560ff9ca67cca8c7f85ba84c79030c2b3de218f86db3a90901d5df45c14f26fedfb3dc38e96ac22fe7bd728f0e45bce046d23c570feb141398bb552ef5a0a82be331fea48037b8b5d71f0e332edf93ac3500eb4ddc0decc1a864790c782c76215660dd309791d06bd0af3f98cda4bc4629b1")
 
-	scriptSig := &Script{[][]byte{col1, col2}}
-	ok := Evaluate([]byte{0x01}, scriptSig, scriptPubKey)
+	scriptSig := &Script{Cmds: [][]byte{col1, col2}}
+	err := Evaluate(fixedTxContext([]byte{0x01}), scriptSig, scriptPubKey, nil, testFlags)
+
+	check(nil, err, t)
+}
+
+func TestEvaluateFlags(t *testing.T) {
+	redeemScript := &Script{Cmds: [][]byte{{0x00}, {0x00}}}
+
+	tests := []struct {
+		name         string
+		scriptSig    [][]byte
+		scriptPubKey [][]byte
+		witness      [][]byte
+		flags        ScriptFlags
+		expected     error
+	}{
+		{"nop", nil, [][]byte{{0x51}, {0xb0}}, nil, testFlags, nil},
+		{"discouraged nop", nil, [][]byte{{0x51}, {0xb0}}, nil, testFlags | SCRIPT_VERIFY_DISCOURAGE_UPGRADABLE_NOPS, ErrDiscourageUpgradableNops},
+		{"stack left", [][]byte{{0x51}}, [][]byte{{0x51}}, nil, testFlags, nil},
+		{"cleanstack", [][]byte{{0x51}}, [][]byte{{0x51}}, nil, testFlags | SCRIPT_VERIFY_CLEANSTACK, ErrCleanStack},
+		{"push", [][]byte{{0x05}}, [][]byte{{0x55}, {0x87}}, nil, testFlags, nil},
+		{"minimaldata", [][]byte{{0x05}}, [][]byte{{0x55}, {0x87}}, nil, testFlags | SCRIPT_VERIFY_MINIMALDATA, ErrMinimalData},
+		{"opcode in script sig", [][]byte{{0x51}, {0x76}}, [][]byte{{0x87}}, nil, testFlags, nil},
+		{"sigpushonly", [][]byte{{0x51}, {0x76}}, [][]byte{{0x87}}, nil, testFlags | SCRIPT_VERIFY_SIGPUSHONLY, ErrSigPushOnly},
+		{"redeem script", [][]byte{redeemScript.RawSerialize()}, P2sh(u.Hash160(redeemScript.RawSerialize())).Cmds, nil, testFlags, ErrEvalFalse},
+		{"before p2sh", [][]byte{redeemScript.RawSerialize()}, P2sh(u.Hash160(redeemScript.RawSerialize())).Cmds, nil, SCRIPT_VERIFY_NONE, nil},
+		{"witness unexpected", nil, [][]byte{{0x51}}, [][]byte{{0x01, 0x02}}, testFlags, ErrWitnessUnexpected},
+		{"before segwit", nil, [][]byte{{0x51}}, [][]byte{{0x01, 0x02}}, SCRIPT_VERIFY_P2SH, nil},
+	}
 
-	check(true, ok, t)
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := Evaluate(fixedTxContext(nil), &Script{Cmds: test.scriptSig}, &Script{Cmds: test.scriptPubKey}, test.witness, test.flags)
+			check(test.expected, err, t)
+		})
+	}
 }
@@ -0,0 +1,113 @@
+package script
+
+import (
+	"errors"
+	"strings"
+)
+
+var ErrUnknownScriptFlag = errors.New("unknown script verify flag")
+
+// ScriptFlags selects the rules Evaluate enforces on top of the ones that
+// have always been part of the consensus, the names follow Bitcoin Core.
+type ScriptFlags uint32
+
+const (
+	SCRIPT_VERIFY_NONE ScriptFlags = 0
+
+	SCRIPT_VERIFY_P2SH ScriptFlags = 1 << (iota - 1)
+	SCRIPT_VERIFY_STRICTENC
+	SCRIPT_VERIFY_DERSIG
+	SCRIPT_VERIFY_LOW_S
+	SCRIPT_VERIFY_NULLDUMMY
+	SCRIPT_VERIFY_SIGPUSHONLY
+	SCRIPT_VERIFY_MINIMALDATA
+	SCRIPT_VERIFY_DISCOURAGE_UPGRADABLE_NOPS
+	SCRIPT_VERIFY_CLEANSTACK
+	SCRIPT_VERIFY_CHECKLOCKTIMEVERIFY
+	SCRIPT_VERIFY_CHECKSEQUENCEVERIFY
+	SCRIPT_VERIFY_WITNESS
+	SCRIPT_VERIFY_DISCOURAGE_UPGRADABLE_WITNESS_PROGRAM
+	SCRIPT_VERIFY_MINIMALIF
+	SCRIPT_VERIFY_NULLFAIL
+	SCRIPT_VERIFY_WITNESS_PUBKEYTYPE
+	SCRIPT_VERIFY_CONST_SCRIPTCODE
+	SCRIPT_VERIFY_TAPROOT
+	SCRIPT_VERIFY_DISCOURAGE_UPGRADABLE_TAPROOT_VERSION
+	SCRIPT_VERIFY_DISCOURAGE_OP_SUCCESS
+	SCRIPT_VERIFY_DISCOURAGE_UPGRADABLE_PUBKEYTYPE
+)
+
+// MANDATORY_SCRIPT_VERIFY_FLAGS are the soft forks in force, a block with a
+// script that fails them is invalid.
+const MANDATORY_SCRIPT_VERIFY_FLAGS = SCRIPT_VERIFY_P2SH |
+	SCRIPT_VERIFY_DERSIG |
+	SCRIPT_VERIFY_NULLDUMMY |
+	SCRIPT_VERIFY_CHECKLOCKTIMEVERIFY |
+	SCRIPT_VERIFY_CHECKSEQUENCEVERIFY |
+	SCRIPT_VERIFY_WITNESS |
+	SCRIPT_VERIFY_TAPROOT
+
+// STANDARD_SCRIPT_VERIFY_FLAGS add the policy rules nodes relay transactions
+// under.
+const STANDARD_SCRIPT_VERIFY_FLAGS = MANDATORY_SCRIPT_VERIFY_FLAGS |
+	SCRIPT_VERIFY_STRICTENC |
+	SCRIPT_VERIFY_LOW_S |
+	SCRIPT_VERIFY_MINIMALDATA |
+	SCRIPT_VERIFY_DISCOURAGE_UPGRADABLE_NOPS |
+	SCRIPT_VERIFY_CLEANSTACK |
+	SCRIPT_VERIFY_DISCOURAGE_UPGRADABLE_WITNESS_PROGRAM |
+	SCRIPT_VERIFY_MINIMALIF |
+	SCRIPT_VERIFY_NULLFAIL |
+	SCRIPT_VERIFY_WITNESS_PUBKEYTYPE |
+	SCRIPT_VERIFY_CONST_SCRIPTCODE |
+	SCRIPT_VERIFY_DISCOURAGE_UPGRADABLE_TAPROOT_VERSION |
+	SCRIPT_VERIFY_DISCOURAGE_OP_SUCCESS |
+	SCRIPT_VERIFY_DISCOURAGE_UPGRADABLE_PUBKEYTYPE
+
+var scriptFlagNames = map[string]ScriptFlags{
+	"NONE":                                  SCRIPT_VERIFY_NONE,
+	"P2SH":                                  SCRIPT_VERIFY_P2SH,
+	"STRICTENC":                             SCRIPT_VERIFY_STRICTENC,
+	"DERSIG":                                SCRIPT_VERIFY_DERSIG,
+	"LOW_S":                                 SCRIPT_VERIFY_LOW_S,
+	"NULLDUMMY":                             SCRIPT_VERIFY_NULLDUMMY,
+	"SIGPUSHONLY":                           SCRIPT_VERIFY_SIGPUSHONLY,
+	"MINIMALDATA":                           SCRIPT_VERIFY_MINIMALDATA,
+	"DISCOURAGE_UPGRADABLE_NOPS":            SCRIPT_VERIFY_DISCOURAGE_UPGRADABLE_NOPS,
+	"CLEANSTACK":                            SCRIPT_VERIFY_CLEANSTACK,
+	"CHECKLOCKTIMEVERIFY":                   SCRIPT_VERIFY_CHECKLOCKTIMEVERIFY,
+	"CHECKSEQUENCEVERIFY":                   SCRIPT_VERIFY_CHECKSEQUENCEVERIFY,
+	"WITNESS":                               SCRIPT_VERIFY_WITNESS,
+	"DISCOURAGE_UPGRADABLE_WITNESS_PROGRAM": SCRIPT_VERIFY_DISCOURAGE_UPGRADABLE_WITNESS_PROGRAM,
+	"MINIMALIF":                             SCRIPT_VERIFY_MINIMALIF,
+	"NULLFAIL":                              SCRIPT_VERIFY_NULLFAIL,
+	"WITNESS_PUBKEYTYPE":                    SCRIPT_VERIFY_WITNESS_PUBKEYTYPE,
+	"CONST_SCRIPTCODE":                      SCRIPT_VERIFY_CONST_SCRIPTCODE,
+	"TAPROOT":                               SCRIPT_VERIFY_TAPROOT,
+	"DISCOURAGE_UPGRADABLE_TAPROOT_VERSION": SCRIPT_VERIFY_DISCOURAGE_UPGRADABLE_TAPROOT_VERSION,
+	"DISCOURAGE_OP_SUCCESS":                 SCRIPT_VERIFY_DISCOURAGE_OP_SUCCESS,
+	"DISCOURAGE_UPGRADABLE_PUBKEYTYPE":      SCRIPT_VERIFY_DISCOURAGE_UPGRADABLE_PUBKEYTYPE,
+}
+
+// ParseScriptFlags parses comma separated flag names without their
+// SCRIPT_VERIFY_ prefix, as Bitcoin Core's test vectors write them.
+func ParseScriptFlags(s string) (ScriptFlags, error) {
+	flags := SCRIPT_VERIFY_NONE
+	for _, name := range strings.Split(s, ",") {
+		if name == "" {
+			continue
+		}
+
+		flag, ok := scriptFlagNames[name]
+		if !ok {
+			return 0, ErrUnknownScriptFlag
+		}
+		flags |= flag
+	}
+
+	return flags, nil
+}
+
+func (f ScriptFlags) has(flag ScriptFlags) bool {
+	return f&flag != 0
+}
@@ -0,0 +1,99 @@
+package script
+
+import "errors"
+
+var ErrNumOverflow = errors.New("script number too long")
+var ErrNumNotMinimal = errors.New("script number not minimally encoded")
+
+// maxNumSize is the most bytes a number operand may have, results of the
+// arithmetic operations can be longer.
+const maxNumSize = 4
+
+// encodeNum returns the minimal little endian sign and magnitude encoding of
+// i, zero is the empty array.
+func encodeNum(i int64) []byte {
+	if i == 0 {
+		return []byte{}
+	}
+
+	negative := i < 0
+	abs := uint64(i)
+	if negative {
+		abs = uint64(-i)
+	}
+
+	result := make([]byte, 0, 9)
+	for abs > 0 {
+		result = append(result, byte(abs&0xff))
+		abs >>= 8
+	}
+
+	// the most significant bit holds the sign, add a byte when it's taken
+	if result[len(result)-1]&0x80 != 0 {
+		if negative {
+			result = append(result, 0x80)
+		} else {
+			result = append(result, 0x00)
+		}
+	} else if negative {
+		result[len(result)-1] |= 0x80
+	}
+
+	return result
+}
+
+// decodeNum parses a number of at most maxSize bytes. Negative zero decodes to
+// zero, with requireMinimal it and any other padded encoding are rejected.
+func decodeNum(b []byte, maxSize int, requireMinimal bool) (int64, error) {
+	if len(b) > maxSize {
+		return 0, ErrNumOverflow
+	}
+
+	if requireMinimal && !isMinimalNum(b) {
+		return 0, ErrNumNotMinimal
+	}
+
+	if len(b) == 0 {
+		return 0, nil
+	}
+
+	var result int64
+	for i, v := range b {
+		result |= int64(v) << uint(8*i)
+	}
+
+	last := b[len(b)-1]
+	if last&0x80 != 0 {
+		result &= ^(int64(0x80) << uint(8*(len(b)-1)))
+		return -result, nil
+	}
+
+	return result, nil
+}
+
+func isMinimalNum(b []byte) bool {
+	if len(b) == 0 {
+		return true
+	}
+
+	// the last byte may only be zero, or the sign alone, when the byte before
+	// needs its most significant bit for the magnitude
+	if b[len(b)-1]&0x7f == 0 {
+		if len(b) == 1 || b[len(b)-2]&0x80 == 0 {
+			return false
+		}
+	}
+
+	return true
+}
+
+// castToBool is false for any encoding of zero, including negative zero.
+func castToBool(b []byte) bool {
+	for i, v := range b {
+		if v != 0 {
+			return !(i == len(b)-1 && v == 0x80)
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,68 @@
+package script
+
+import (
+	"encoding/hex"
+	"testing"
+)
+
+func TestEncodeNum(t *testing.T) {
+	tests := []struct {
+		i        int64
+		expected string
+	}{
+		{0, ""},
+		{1, "01"},
+		{-1, "81"},
+		{127, "7f"},
+		{128, "8000"},
+		{-128, "8080"},
+		{255, "ff00"},
+		{256, "0001"},
+		{-32768, "008080"},
+		{2147483647, "ffffff7f"},
+		{-2147483648, "0000008080"},
+	}
+
+	for _, test := range tests {
+		b := encodeNum(test.i)
+		check(test.expected, hex.EncodeToString(b), t)
+
+		i, err := decodeNum(b, 5, true)
+		check(nil, err, t)
+		check(test.i, i, t)
+	}
+}
+
+func TestDecodeNum(t *testing.T) {
+	tests := []struct {
+		in             string
+		requireMinimal bool
+		expected       int64
+		err            error
+	}{
+		{"80", false, 0, nil},
+		{"80", true, 0, ErrNumNotMinimal},
+		{"00", true, 0, ErrNumNotMinimal},
+		{"0100", false, 1, nil},
+		{"0100", true, 0, ErrNumNotMinimal},
+		{"0180", false, -1, nil},
+		{"ff00", true, 255, nil},
+		{"ffffffff", true, -2147483647, nil},
+		{"0000000001", false, 0, ErrNumOverflow},
+	}
+
+	for _, test := range tests {
+		b, _ := hex.DecodeString(test.in)
+		i, err := decodeNum(b, maxNumSize, test.requireMinimal)
+		check(test.err, err, t)
+		check(test.expected, i, t)
+	}
+}
+
+func TestCastToBool(t *testing.T) {
+	check(false, castToBool([]byte{}), t)
+	check(false, castToBool([]byte{0x00, 0x00}), t)
+	check(false, castToBool([]byte{0x00, 0x80}), t)
+	check(true, castToBool([]byte{0x80, 0x00}), t)
+	check(true, castToBool([]byte{0x00, 0x01}), t)
+}
@@ -3,336 +3,1252 @@ package script
 import (
 	"bytes"
 	"crypto/sha1"
-	"math/big"
+	"crypto/sha256"
+
+	"golang.org/x/crypto/ripemd160"
 
 	u "github.com/lobiCode/prog_btc_go/btcutils"
 	c "github.com/lobiCode/prog_btc_go/cryptography"
 )
 
-type OperationFunc = func(z *big.Int, cmds, realStack, altStack *stack) bool
+// SigHashFunc returns the signature hash for the given hash type, ext is nil
+// for the taproot key path. A taproot hash type it doesn't take is
+// ErrSchnorrSigHashType.
+type SigHashFunc = func(hashType uint32, ext *SigHashExt) ([]byte, error)
+
+// SigHashExt is the BIP342 extension of the taproot signature hash for
+// tapscript signatures. For the other signatures ScriptCode is the script the
+// hash commits to, the executed script from its last OP_CODESEPARATOR on, and
+// WitnessV0 selects the BIP143 hash.
+type SigHashExt struct {
+	LeafHash   []byte
+	CodeSepPos uint32
+	ScriptCode *Script
+	WitnessV0  bool
+}
 
-func _add_number(i int64, realStack *stack) bool {
-	b, err := u.EncodeNum(i)
-	if err != nil {
-		return false
-	}
+// TxContext is what the evaluation of an input's scripts knows about the
+// spending transaction.
+type TxContext struct {
+	SigHash    SigHashFunc
+	Version    uint32
+	LockTime   uint32
+	InputIndex int
+	// Sequence and Amount belong to the input being spent
+	Sequence uint32
+	Amount   uint64
+}
+
+type sigVersion int
 
-	realStack.push(b)
+const (
+	sigVersionBase sigVersion = iota
+	sigVersionWitnessV0
+	sigVersionTapscript
+)
+
+// context is the state of the execution the operations need besides the
+// stacks.
+type context struct {
+	tx               *TxContext
+	flags            ScriptFlags
+	sigVersion       sigVersion
+	leafHash         []byte
+	opcodePos        uint32
+	codeSepPos       uint32
+	validationWeight int
+	// script is the one running, pc the position of its next instruction
+	// and codeBegin where the script code signatures commit to starts
+	script    []byte
+	pc        int
+	codeBegin int
+	opCount   int
+	execStack []bool
+}
+
+// executing reports whether all the enclosing conditional branches are taken.
+func (ctx *context) executing() bool {
+	for _, e := range ctx.execStack {
+		if !e {
+			return false
+		}
+	}
 
 	return true
 }
 
-func op0(z *big.Int, cmds, realStack, altStack *stack) bool {
+// startScript resets the state that is kept per script.
+func (ctx *context) startScript(script []byte) {
+	ctx.script = script
+	ctx.pc = 0
+	ctx.codeBegin = 0
+	ctx.opCount = 0
+	ctx.opcodePos = 0
+	ctx.execStack = nil
+}
+
+// requireMinimal reports whether numbers and pushes must be minimally
+// encoded.
+func (ctx *context) requireMinimal() bool {
+	return ctx.flags.has(SCRIPT_VERIFY_MINIMALDATA)
+}
+
+type OperationFunc = func(ctx *context, realStack, altStack *stack) error
+
+const (
+	maxOpsPerScript       = 201
+	maxPubKeysPerMultisig = 20
+	maxStackSize          = 1000
+
+	// lock times below are block heights, the others unix times
+	lockTimeThreshold = 500000000
+
+	sequenceLockTimeDisableFlag = 1 << 31
+	sequenceLockTimeTypeFlag    = 1 << 22
+	sequenceLockTimeMask        = 0x0000ffff
+)
+
+func _add_number(i int64, realStack *stack) error {
+	realStack.push(encodeNum(i))
+
+	return nil
+}
+
+func _add_bool(b bool, realStack *stack) error {
+	if b {
+		return _add_number(1, realStack)
+	}
+
 	return _add_number(0, realStack)
 }
 
-func op1(z *big.Int, cmds, realStack, altStack *stack) bool {
+// popNum pops a number operand off the stack.
+func popNum(ctx *context, realStack *stack) (int64, error) {
+	if realStack.length() < 1 {
+		return 0, ErrStackUnderflow
+	}
+
+	return decodeNum(realStack.pop(), maxNumSize, ctx.requireMinimal())
+}
+
+func op1negate(ctx *context, realStack, altStack *stack) error {
+	return _add_number(-1, realStack)
+}
+
+func op0(ctx *context, realStack, altStack *stack) error {
+	return _add_number(0, realStack)
+}
+
+func op1(ctx *context, realStack, altStack *stack) error {
 	return _add_number(1, realStack)
 }
 
-func op2(z *big.Int, cmds, realStack, altStack *stack) bool {
+func op2(ctx *context, realStack, altStack *stack) error {
 	return _add_number(2, realStack)
 }
 
-func op3(z *big.Int, cmds, realStack, altStack *stack) bool {
+func op3(ctx *context, realStack, altStack *stack) error {
 	return _add_number(3, realStack)
 }
 
-func op4(z *big.Int, cmds, realStack, altStack *stack) bool {
+func op4(ctx *context, realStack, altStack *stack) error {
 	return _add_number(4, realStack)
 }
 
-func op5(z *big.Int, cmds, realStack, altStack *stack) bool {
+func op5(ctx *context, realStack, altStack *stack) error {
 	return _add_number(5, realStack)
 }
 
-func op6(z *big.Int, cmds, realStack, altStack *stack) bool {
+func op6(ctx *context, realStack, altStack *stack) error {
 	return _add_number(6, realStack)
 }
 
-func op7(z *big.Int, cmds, realStack, altStack *stack) bool {
+func op7(ctx *context, realStack, altStack *stack) error {
 	return _add_number(7, realStack)
 }
 
-func op8(z *big.Int, cmds, realStack, altStack *stack) bool {
+func op8(ctx *context, realStack, altStack *stack) error {
 	return _add_number(8, realStack)
 }
 
-func op9(z *big.Int, cmds, realStack, altStack *stack) bool {
+func op9(ctx *context, realStack, altStack *stack) error {
 	return _add_number(9, realStack)
 }
 
-func op10(z *big.Int, cmds, realStack, altStack *stack) bool {
+func op10(ctx *context, realStack, altStack *stack) error {
 	return _add_number(10, realStack)
 }
 
-func op11(z *big.Int, cmds, realStack, altStack *stack) bool {
+func op11(ctx *context, realStack, altStack *stack) error {
 	return _add_number(11, realStack)
 }
 
-func op12(z *big.Int, cmds, realStack, altStack *stack) bool {
+func op12(ctx *context, realStack, altStack *stack) error {
 	return _add_number(12, realStack)
 }
 
-func op13(z *big.Int, cmds, realStack, altStack *stack) bool {
+func op13(ctx *context, realStack, altStack *stack) error {
 	return _add_number(13, realStack)
 }
 
-func op14(z *big.Int, cmds, realStack, altStack *stack) bool {
+func op14(ctx *context, realStack, altStack *stack) error {
 	return _add_number(14, realStack)
 }
 
-func op15(z *big.Int, cmds, realStack, altStack *stack) bool {
+func op15(ctx *context, realStack, altStack *stack) error {
 	return _add_number(15, realStack)
 }
 
-func op16(z *big.Int, cmds, realStack, altStack *stack) bool {
+func op16(ctx *context, realStack, altStack *stack) error {
 	return _add_number(16, realStack)
 }
 
-func opDup(z *big.Int, cmds, realStack, altStack *stack) bool {
+func opDup(ctx *context, realStack, altStack *stack) error {
 	if realStack.length() < 1 {
-		return false
+		return ErrStackUnderflow
 	}
 
 	realStack.push(realStack.get())
-	return true
+	return nil
 }
 
-func opHash256(z *big.Int, cmds, realStack, altStack *stack) bool {
+func opHash256(ctx *context, realStack, altStack *stack) error {
 	if realStack.length() < 1 {
-		return false
+		return ErrStackUnderflow
 	}
 
 	e := realStack.pop()
 	realStack.push(u.Hash256(e))
 
-	return true
+	return nil
 }
 
-func opHash160(z *big.Int, cmds, realStack, altStack *stack) bool {
+func opHash160(ctx *context, realStack, altStack *stack) error {
 	if realStack.length() < 1 {
-		return false
+		return ErrStackUnderflow
 	}
 
 	e := realStack.pop()
 	realStack.push(u.Hash160(e))
 
-	return true
+	return nil
 }
 
-func opChecksig(z *big.Int, cmds, realStack, altStack *stack) bool {
+func opChecksig(ctx *context, realStack, altStack *stack) error {
 	if realStack.length() < 2 {
-		return false
+		return ErrStackUnderflow
 	}
 
 	publicKeyB := realStack.pop()
 	signatureB := realStack.pop()
 
-	publicKey, err := c.ParsePublicKey(publicKeyB)
+	if ctx.sigVersion == sigVersionTapscript {
+		success, err := checkTapscriptSignature(ctx, signatureB, publicKeyB)
+		if err != nil {
+			return err
+		}
+		return _add_bool(success, realStack)
+	}
+
+	scriptCode, err := ctx.findAndDelete(signatureB)
 	if err != nil {
-		return false
+		return err
 	}
 
-	signature, err := c.ParseSignature(signatureB[:len(signatureB)-1])
+	success, err := checkSignature(ctx, signatureB, publicKeyB, scriptCode)
 	if err != nil {
-		return false
+		return err
+	}
+
+	if !success && len(signatureB) > 0 && ctx.flags.has(SCRIPT_VERIFY_NULLFAIL) {
+		return ErrSigNullFail
 	}
 
-	var i int64 = 0
+	return _add_bool(success, realStack)
+}
 
-	if c.Verify(z, signature, publicKey) {
-		i = 1
+func opChecksigverify(ctx *context, realStack, altStack *stack) error {
+	if err := opChecksig(ctx, realStack, altStack); err != nil {
+		return err
 	}
 
-	return _add_number(i, realStack)
+	return verify(realStack, ErrCheckSigVerify)
 }
 
-func opEqual(z *big.Int, cmds, realStack, altStack *stack) bool {
-	if realStack.length() < 2 {
-		return false
+func opChecksigadd(ctx *context, realStack, altStack *stack) error {
+	if ctx.sigVersion != sigVersionTapscript {
+		return ErrBadOpcode
 	}
 
-	e1 := realStack.pop()
-	e2 := realStack.pop()
+	if realStack.length() < 3 {
+		return ErrStackUnderflow
+	}
 
-	ok := bytes.Equal(e1, e2)
-	var i int64 = 0
-	if ok {
-		i = 1
+	publicKeyB := realStack.pop()
+	n, err := popNum(ctx, realStack)
+	if err != nil {
+		return err
 	}
+	signatureB := realStack.pop()
 
-	return _add_number(i, realStack)
+	success, err := checkTapscriptSignature(ctx, signatureB, publicKeyB)
+	if err != nil {
+		return err
+	}
+	if success {
+		n++
+	}
+
+	return _add_number(n, realStack)
 }
 
-func opVerify(z *big.Int, cmds, realStack, altStack *stack) bool {
-	if realStack.length() < 1 {
-		return false
+func opCodeseparator(ctx *context, realStack, altStack *stack) error {
+	if ctx.sigVersion == sigVersionTapscript {
+		ctx.codeSepPos = ctx.opcodePos
+		return nil
 	}
 
-	e := realStack.pop()
-	i, err := u.DecodeNum(e)
+	// the signatures that follow commit to the rest of the script only
+	ctx.codeBegin = ctx.pc
+
+	return nil
+}
+
+// scriptCode returns the script the signatures commit to, the running one
+// from its last executed OP_CODESEPARATOR on.
+func (ctx *context) scriptCode() []byte {
+	return ctx.script[ctx.codeBegin:]
+}
+
+// findAndDelete returns the script code without the pushes of signatureB,
+// signatures can't sign themselves in legacy scripts.
+func (ctx *context) findAndDelete(signatureB ...[]byte) ([]byte, error) {
+	scriptCode := ctx.scriptCode()
+	if ctx.sigVersion != sigVersionBase {
+		return scriptCode, nil
+	}
+
+	found := 0
+	for _, sig := range signatureB {
+		var n int
+		scriptCode, n = findAndDelete(scriptCode, encodePush(sig))
+		found += n
+	}
+
+	if found > 0 && ctx.flags.has(SCRIPT_VERIFY_CONST_SCRIPTCODE) {
+		return nil, ErrSigFindAndDelete
+	}
+
+	return scriptCode, nil
+}
+
+// findAndDelete removes pattern from script where it starts at an
+// instruction, as Bitcoin Core's FindAndDelete does, and returns how many
+// times it was found.
+func findAndDelete(script, pattern []byte) ([]byte, int) {
+	found := 0
+	result := make([]byte, 0, len(script))
+
+	pc, begin := 0, 0
+	for {
+		result = append(result, script[begin:pc]...)
+		for len(script)-pc >= len(pattern) && bytes.Equal(script[pc:pc+len(pattern)], pattern) {
+			pc += len(pattern)
+			found++
+		}
+		begin = pc
+
+		if pc >= len(script) {
+			break
+		}
+		_, next, ok := readInstruction(script, pc)
+		if !ok {
+			break
+		}
+		pc = next
+	}
+
+	if found == 0 {
+		return script, 0
+	}
+
+	return append(result, script[begin:]...), found
+}
+
+// checkSignature verifies a DER signature followed by its hash type byte, the
+// hash type selects which signature hash is checked. Only signatures and keys
+// the flags don't allow are errors, the others just fail the check.
+func checkSignature(ctx *context, signatureB, publicKeyB []byte, scriptCode []byte) (bool, error) {
+	if err := checkSignatureEncoding(signatureB, ctx.flags); err != nil {
+		return false, err
+	}
+
+	if err := checkPublicKeyEncoding(publicKeyB, ctx.flags, ctx.sigVersion); err != nil {
+		return false, err
+	}
+
+	if len(signatureB) == 0 {
+		return false, nil
+	}
+
+	publicKey, err := c.ParsePublicKey(publicKeyB)
 	if err != nil {
-		return false
+		return false, nil
 	}
 
-	if i == 0 {
-		return false
+	signature, err := c.ParseSignatureLax(signatureB[:len(signatureB)-1])
+	if err != nil {
+		return false, nil
 	}
 
-	return true
+	ext := &SigHashExt{ScriptCode: newScript(scriptCode), WitnessV0: ctx.sigVersion == sigVersionWitnessV0}
+	z, err := ctx.tx.SigHash(uint32(signatureB[len(signatureB)-1]), ext)
+	if err != nil {
+		return false, err
+	}
+
+	return c.Verify(u.ParseBytes(z), signature, publicKey), nil
 }
 
-func opEqualverify(z *big.Int, cmds, realStack, altStack *stack) bool {
-	return opEqual(z, cmds, realStack, altStack) && opVerify(z, cmds, realStack, altStack)
+// checkTapscriptSignature follows the BIP342 signature rules, an empty
+// signature fails the check and any other one that doesn't verify fails the
+// script.
+func checkTapscriptSignature(ctx *context, signatureB, publicKeyB []byte) (bool, error) {
+	success := len(signatureB) > 0
+	if success {
+		ctx.validationWeight -= validationWeightPerSigOp
+		if ctx.validationWeight < 0 {
+			return false, ErrTapscriptValidationWeight
+		}
+	}
+
+	if len(publicKeyB) == 0 {
+		return false, ErrTapscriptEmptyPubKey
+	}
+
+	// unknown public key types are left for future soft forks
+	if len(publicKeyB) != 32 {
+		if ctx.flags.has(SCRIPT_VERIFY_DISCOURAGE_UPGRADABLE_PUBKEYTYPE) {
+			return false, ErrDiscourageUpgradablePubKeyType
+		}
+		return success, nil
+	}
+
+	if success {
+		if err := checkSchnorrSignature(ctx, signatureB, publicKeyB); err != nil {
+			return false, err
+		}
+	}
+
+	return success, nil
 }
 
-func op2dup(z *big.Int, cmds, realStack, altStack *stack) bool {
+// checkSchnorrSignature verifies a BIP340 signature with an optional hash type
+// byte, a missing one means SIGHASH_DEFAULT.
+func checkSchnorrSignature(ctx *context, signatureB, publicKeyB []byte) error {
+	var hashType uint32
+
+	switch len(signatureB) {
+	case 64:
+	case 65:
+		hashType = uint32(signatureB[64])
+		if hashType == 0 {
+			return ErrSchnorrSigHashType
+		}
+		signatureB = signatureB[:64]
+	default:
+		return ErrSchnorrSigSize
+	}
+
+	signature, err := c.ParseSchnorrSignature(signatureB)
+	if err != nil {
+		return ErrSchnorrSig
+	}
+
+	publicKey, err := c.ParseXOnlyPublicKey(publicKeyB)
+	if err != nil {
+		return ErrSchnorrSig
+	}
+
+	var ext *SigHashExt
+	if ctx.sigVersion == sigVersionTapscript {
+		ext = &SigHashExt{LeafHash: ctx.leafHash, CodeSepPos: ctx.codeSepPos}
+	}
+
+	z, err := ctx.tx.SigHash(hashType, ext)
+	if err != nil {
+		return err
+	}
+
+	if !c.VerifySchnorr(z, signature, publicKey) {
+		return ErrSchnorrSig
+	}
+
+	return nil
+}
+
+func opEqual(ctx *context, realStack, altStack *stack) error {
 	if realStack.length() < 2 {
-		return false
+		return ErrStackUnderflow
 	}
 
-	e1 := realStack.getN(-1)
-	e2 := realStack.getN(-2)
+	e1 := realStack.pop()
+	e2 := realStack.pop()
 
-	realStack.push(e1, e2)
+	return _add_bool(bytes.Equal(e1, e2), realStack)
+}
 
-	return true
+func opVerify(ctx *context, realStack, altStack *stack) error {
+	return verify(realStack, ErrVerify)
+}
+
+// verify pops the top element and fails with err when it's false, it's the
+// second half of the VERIFY opcodes.
+func verify(realStack *stack, err error) error {
+	if realStack.length() < 1 {
+		return ErrStackUnderflow
+	}
+
+	if !castToBool(realStack.pop()) {
+		return err
+	}
+
+	return nil
+}
+
+func opEqualverify(ctx *context, realStack, altStack *stack) error {
+	if err := opEqual(ctx, realStack, altStack); err != nil {
+		return err
+	}
+
+	return verify(realStack, ErrEqualVerify)
+}
+
+func op2dup(ctx *context, realStack, altStack *stack) error {
+	if realStack.length() < 2 {
+		return ErrStackUnderflow
+	}
+
+	realStack.push(realStack.getN(-2), realStack.getN(-1))
+
+	return nil
 }
 
-func opSwap(z *big.Int, cmds, realStack, altStack *stack) bool {
+func opSwap(ctx *context, realStack, altStack *stack) error {
 	if realStack.length() < 2 {
-		return false
+		return ErrStackUnderflow
 	}
 	e1 := realStack.pop()
 	e2 := realStack.pop()
 
 	realStack.push(e1, e2)
 
-	return true
+	return nil
 }
 
-func opNot(z *big.Int, cmds, realStack, altStack *stack) bool {
+func opNot(ctx *context, realStack, altStack *stack) error {
+	i, err := popNum(ctx, realStack)
+	if err != nil {
+		return err
+	}
+
+	return _add_bool(i == 0, realStack)
+}
+
+func opSha1(ctx *context, realStack, altStack *stack) error {
 	if realStack.length() < 1 {
-		return false
+		return ErrStackUnderflow
 	}
+
 	e := realStack.pop()
+	sum := sha1.Sum(e)
+	realStack.push(sum[:])
+
+	return nil
+}
+
+func opCheckmultisig(ctx *context, realStack, altStack *stack) error {
+	if ctx.sigVersion == sigVersionTapscript {
+		return ErrTapscriptCheckMultisig
+	}
 
-	i, err := u.DecodeNum(e)
+	n, err := popNum(ctx, realStack)
 	if err != nil {
-		return false
+		return err
 	}
 
-	if i == 0 {
-		i = 1
-	} else {
-		i = 0
+	if n < 0 || n > maxPubKeysPerMultisig {
+		return ErrPubKeyCount
 	}
 
-	return _add_number(i, realStack)
+	ctx.opCount += int(n)
+	if ctx.opCount > maxOpsPerScript {
+		return ErrOpCount
+	}
+
+	if int64(realStack.length()) < n+1 {
+		return ErrStackUnderflow
+	}
+
+	publicKeys := make([][]byte, n)
+	for i := n - 1; i >= 0; i-- {
+		publicKeys[i] = realStack.pop()
+	}
+
+	m, err := popNum(ctx, realStack)
+	if err != nil {
+		return err
+	}
+
+	if m < 0 || m > n {
+		return ErrSigCount
+	}
+
+	// the original implementation pops one element too many
+	if int64(realStack.length()) < m+1 {
+		return ErrStackUnderflow
+	}
+
+	sigs := make([][]byte, m)
+	for i := m - 1; i >= 0; i-- {
+		sigs[i] = realStack.pop()
+	}
+
+	dummy := realStack.pop()
+
+	scriptCode, err := ctx.findAndDelete(sigs...)
+	if err != nil {
+		return err
+	}
+
+	// signatures must be in the same order as their keys, both are matched
+	// from the last one
+	success := true
+	for s, k := len(sigs)-1, len(publicKeys)-1; s >= 0; k-- {
+		if s > k {
+			success = false
+			break
+		}
+
+		ok, err := checkSignature(ctx, sigs[s], publicKeys[k], scriptCode)
+		if err != nil {
+			return err
+		}
+		if ok {
+			s--
+		}
+	}
+
+	if !success && ctx.flags.has(SCRIPT_VERIFY_NULLFAIL) {
+		for _, sig := range sigs {
+			if len(sig) > 0 {
+				return ErrSigNullFail
+			}
+		}
+	}
+
+	if len(dummy) > 0 && ctx.flags.has(SCRIPT_VERIFY_NULLDUMMY) {
+		return ErrSigNullDummy
+	}
+
+	return _add_bool(success, realStack)
+}
+
+func opCheckmultisigverify(ctx *context, realStack, altStack *stack) error {
+	if err := opCheckmultisig(ctx, realStack, altStack); err != nil {
+		return err
+	}
+
+	return verify(realStack, ErrCheckMultisigVerify)
+}
+
+func opNop(ctx *context, realStack, altStack *stack) error {
+	return nil
+}
+
+// opUpgradableNop is the NOPx reserved for soft forks, using one is allowed
+// but not standard.
+func opUpgradableNop(ctx *context, realStack, altStack *stack) error {
+	if ctx.flags.has(SCRIPT_VERIFY_DISCOURAGE_UPGRADABLE_NOPS) {
+		return ErrDiscourageUpgradableNops
+	}
+
+	return nil
+}
+
+func opReturn(ctx *context, realStack, altStack *stack) error {
+	return ErrOpReturn
 }
 
-func opSha1(z *big.Int, cmds, realStack, altStack *stack) bool {
+// opChecklocktimeverify fails unless the transaction lock time has reached
+// the one on the stack, as described in BIP65.
+func opChecklocktimeverify(ctx *context, realStack, altStack *stack) error {
+	if !ctx.flags.has(SCRIPT_VERIFY_CHECKLOCKTIMEVERIFY) {
+		return opUpgradableNop(ctx, realStack, altStack)
+	}
+
 	if realStack.length() < 1 {
-		return false
+		return ErrStackUnderflow
 	}
 
-	e := realStack.pop()
-	sum := sha1.Sum(e)
-	realStack.push(sum[:])
+	// lock times are 5 bytes, they reach beyond the 31 bits of 4 bytes
+	lockTime, err := decodeNum(realStack.getN(-1), 5, ctx.requireMinimal())
+	if err != nil {
+		return err
+	}
 
-	return true
+	if lockTime < 0 {
+		return ErrNegativeLockTime
+	}
+
+	txLockTime := int64(ctx.tx.LockTime)
+	if (lockTime < lockTimeThreshold) != (txLockTime < lockTimeThreshold) {
+		return ErrUnsatisfiedLockTime
+	}
+
+	if lockTime > txLockTime {
+		return ErrUnsatisfiedLockTime
+	}
+
+	// a final input would make the transaction lock time ineffective
+	if ctx.tx.Sequence == 0xffffffff {
+		return ErrUnsatisfiedLockTime
+	}
+
+	return nil
 }
 
-func opCheckmultisig(z *big.Int, cmds, realStack, altStack *stack) bool {
+// opChecksequenceverify fails unless the input's relative lock time, BIP68
+// encoded in its sequence, has reached the one on the stack, as described in
+// BIP112.
+func opChecksequenceverify(ctx *context, realStack, altStack *stack) error {
+	if !ctx.flags.has(SCRIPT_VERIFY_CHECKSEQUENCEVERIFY) {
+		return opUpgradableNop(ctx, realStack, altStack)
+	}
+
 	if realStack.length() < 1 {
-		return false
+		return ErrStackUnderflow
+	}
+
+	sequence, err := decodeNum(realStack.getN(-1), 5, ctx.requireMinimal())
+	if err != nil {
+		return err
+	}
+
+	if sequence < 0 {
+		return ErrNegativeLockTime
+	}
+
+	if sequence&sequenceLockTimeDisableFlag != 0 {
+		return nil
+	}
+
+	if ctx.tx.Version < 2 {
+		return ErrUnsatisfiedLockTime
+	}
+
+	txSequence := int64(ctx.tx.Sequence)
+	if txSequence&sequenceLockTimeDisableFlag != 0 {
+		return ErrUnsatisfiedLockTime
+	}
+
+	mask := int64(sequenceLockTimeTypeFlag | sequenceLockTimeMask)
+	sequence &= mask
+	txSequence &= mask
+
+	if (sequence < sequenceLockTimeTypeFlag) != (txSequence < sequenceLockTimeTypeFlag) {
+		return ErrUnsatisfiedLockTime
+	}
+
+	if sequence > txSequence {
+		return ErrUnsatisfiedLockTime
+	}
+
+	return nil
+}
+
+// opIf and opNotif push whether their branch is executed, a branch inside
+// one that isn't executed is never executed.
+func opIf(ctx *context, realStack, altStack *stack) error {
+	return execIf(ctx, realStack, false)
+}
+
+func opNotif(ctx *context, realStack, altStack *stack) error {
+	return execIf(ctx, realStack, true)
+}
+
+func execIf(ctx *context, realStack *stack, not bool) error {
+	if !ctx.executing() {
+		ctx.execStack = append(ctx.execStack, false)
+		return nil
+	}
+
+	if realStack.length() < 1 {
+		return ErrUnbalancedConditional
 	}
 
 	e := realStack.pop()
-	i, err := u.DecodeNum(e)
-	if err != nil || int64(realStack.length()) < i+1 || i > 15 {
-		return false
+	if !isMinimalIf(e) {
+		if ctx.sigVersion == sigVersionTapscript {
+			return ErrTapscriptMinimalIf
+		}
+		if ctx.sigVersion == sigVersionWitnessV0 && ctx.flags.has(SCRIPT_VERIFY_MINIMALIF) {
+			return ErrMinimalIf
+		}
 	}
 
-	publicKeys := make([][]byte, 0, i)
-	for ; i > 0; i-- {
-		publicKeys = append(publicKeys, realStack.pop())
+	ctx.execStack = append(ctx.execStack, castToBool(e) != not)
+
+	return nil
+}
+
+// isMinimalIf reports whether e is an empty array or exactly one, the only
+// arguments BIP342 allows, and the MINIMALIF policy for segwit v0.
+func isMinimalIf(e []byte) bool {
+	return len(e) == 0 || (len(e) == 1 && e[0] == 1)
+}
+
+func opElse(ctx *context, realStack, altStack *stack) error {
+	l := len(ctx.execStack)
+	if l == 0 {
+		return ErrUnbalancedConditional
 	}
 
-	e = realStack.pop()
-	i, err = u.DecodeNum(e)
-	if err != nil || int64(realStack.length()) < i+1 || i > 15 {
-		return false
+	ctx.execStack[l-1] = !ctx.execStack[l-1]
+
+	return nil
+}
+
+func opEndif(ctx *context, realStack, altStack *stack) error {
+	l := len(ctx.execStack)
+	if l == 0 {
+		return ErrUnbalancedConditional
 	}
 
-	sigs := make([][]byte, 0, i)
-	for ; i > 0; i-- {
-		sigs = append(sigs, realStack.pop())
+	ctx.execStack = ctx.execStack[:l-1]
+
+	return nil
+}
+
+// isConditionalOpcode reports whether op is looked at in a branch that isn't
+// executed, OP_VERIF and OP_VERNOTIF are among them and fail the script.
+func isConditionalOpcode(op byte) bool {
+	return op >= 99 && op <= 104
+}
+
+// isDisabledOpcode reports whether op is one of the opcodes disabled in 2010.
+func isDisabledOpcode(op byte) bool {
+	return (op >= 126 && op <= 129) || (op >= 131 && op <= 134) ||
+		(op >= 141 && op <= 142) || (op >= 149 && op <= 153)
+}
+
+func opToaltstack(ctx *context, realStack, altStack *stack) error {
+	if realStack.length() < 1 {
+		return ErrStackUnderflow
+	}
+
+	altStack.push(realStack.pop())
+
+	return nil
+}
+
+func opFromaltstack(ctx *context, realStack, altStack *stack) error {
+	if altStack.length() < 1 {
+		return ErrAltStackUnderflow
+	}
+
+	realStack.push(altStack.pop())
+
+	return nil
+}
+
+func opDrop(ctx *context, realStack, altStack *stack) error {
+	if realStack.length() < 1 {
+		return ErrStackUnderflow
 	}
 
 	realStack.pop()
 
-	if len(sigs) > len(publicKeys) {
-		return false
+	return nil
+}
+
+func op2drop(ctx *context, realStack, altStack *stack) error {
+	if realStack.length() < 2 {
+		return ErrStackUnderflow
 	}
 
-SIG:
-	for i, sig := range sigs {
-		for j := i; j < len(publicKeys); j++ {
-			publicKey, err := c.ParsePublicKey(publicKeys[j])
-			if err != nil {
-				return false
-			}
-			signature, err := c.ParseSignature(sig[:len(sig)-1])
-			if err != nil {
-				return false
-			}
+	realStack.pop()
+	realStack.pop()
 
-			if c.Verify(z, signature, publicKey) {
-				break SIG
-			}
+	return nil
+}
 
-			return false
+func op3dup(ctx *context, realStack, altStack *stack) error {
+	if realStack.length() < 3 {
+		return ErrStackUnderflow
+	}
+
+	realStack.push(realStack.getN(-3), realStack.getN(-2), realStack.getN(-1))
+
+	return nil
+}
+
+func op2over(ctx *context, realStack, altStack *stack) error {
+	if realStack.length() < 4 {
+		return ErrStackUnderflow
+	}
+
+	realStack.push(realStack.getN(-4), realStack.getN(-3))
+
+	return nil
+}
+
+func op2rot(ctx *context, realStack, altStack *stack) error {
+	if realStack.length() < 6 {
+		return ErrStackUnderflow
+	}
+
+	e1 := realStack.remove(-6)
+	e2 := realStack.remove(-5)
+	realStack.push(e1, e2)
+
+	return nil
+}
+
+func op2swap(ctx *context, realStack, altStack *stack) error {
+	if realStack.length() < 4 {
+		return ErrStackUnderflow
+	}
+
+	e1 := realStack.remove(-4)
+	e2 := realStack.remove(-3)
+	realStack.push(e1, e2)
+
+	return nil
+}
+
+func opIfdup(ctx *context, realStack, altStack *stack) error {
+	if realStack.length() < 1 {
+		return ErrStackUnderflow
+	}
+
+	if castToBool(realStack.getN(-1)) {
+		realStack.push(realStack.get())
+	}
+
+	return nil
+}
+
+func opDepth(ctx *context, realStack, altStack *stack) error {
+	return _add_number(int64(realStack.length()), realStack)
+}
+
+func opNip(ctx *context, realStack, altStack *stack) error {
+	if realStack.length() < 2 {
+		return ErrStackUnderflow
+	}
+
+	realStack.remove(-2)
+
+	return nil
+}
+
+func opOver(ctx *context, realStack, altStack *stack) error {
+	if realStack.length() < 2 {
+		return ErrStackUnderflow
+	}
+
+	realStack.push(realStack.getN(-2))
+
+	return nil
+}
+
+func opPick(ctx *context, realStack, altStack *stack) error {
+	n, err := popNum(ctx, realStack)
+	if err != nil {
+		return err
+	}
+
+	if n < 0 || n >= int64(realStack.length()) {
+		return ErrStackUnderflow
+	}
+
+	realStack.push(realStack.getN(int(-n - 1)))
+
+	return nil
+}
+
+func opRoll(ctx *context, realStack, altStack *stack) error {
+	n, err := popNum(ctx, realStack)
+	if err != nil {
+		return err
+	}
+
+	if n < 0 || n >= int64(realStack.length()) {
+		return ErrStackUnderflow
+	}
+
+	realStack.push(realStack.remove(int(-n - 1)))
+
+	return nil
+}
+
+func opRot(ctx *context, realStack, altStack *stack) error {
+	if realStack.length() < 3 {
+		return ErrStackUnderflow
+	}
+
+	realStack.push(realStack.remove(-3))
+
+	return nil
+}
+
+func opTuck(ctx *context, realStack, altStack *stack) error {
+	if realStack.length() < 2 {
+		return ErrStackUnderflow
+	}
+
+	e1 := realStack.pop()
+	e2 := realStack.pop()
+	realStack.push(e1, e2, e1)
+
+	return nil
+}
+
+func opSize(ctx *context, realStack, altStack *stack) error {
+	if realStack.length() < 1 {
+		return ErrStackUnderflow
+	}
+
+	return _add_number(int64(len(realStack.getN(-1))), realStack)
+}
+
+func opRipemd160(ctx *context, realStack, altStack *stack) error {
+	if realStack.length() < 1 {
+		return ErrStackUnderflow
+	}
+
+	h := ripemd160.New()
+	h.Write(realStack.pop())
+	realStack.push(h.Sum(nil))
+
+	return nil
+}
+
+func opSha256(ctx *context, realStack, altStack *stack) error {
+	if realStack.length() < 1 {
+		return ErrStackUnderflow
+	}
+
+	sum := sha256.Sum256(realStack.pop())
+	realStack.push(sum[:])
+
+	return nil
+}
+
+// unaryNumOp and binaryNumOp build the arithmetic operations, the operands
+// are limited to 4 bytes but the result isn't.
+func unaryNumOp(f func(a int64) int64) OperationFunc {
+	return func(ctx *context, realStack, altStack *stack) error {
+		a, err := popNum(ctx, realStack)
+		if err != nil {
+			return err
 		}
 
+		return _add_number(f(a), realStack)
 	}
+}
 
-	_add_number(1, realStack)
+func binaryNumOp(f func(a, b int64) int64) OperationFunc {
+	return func(ctx *context, realStack, altStack *stack) error {
+		if realStack.length() < 2 {
+			return ErrStackUnderflow
+		}
 
-	return true
+		b, err := popNum(ctx, realStack)
+		if err != nil {
+			return err
+		}
+
+		a, err := popNum(ctx, realStack)
+		if err != nil {
+			return err
+		}
+
+		return _add_number(f(a, b), realStack)
+	}
+}
+
+func boolToNum(b bool) int64 {
+	if b {
+		return 1
+	}
+
+	return 0
+}
+
+var (
+	op1add               = unaryNumOp(func(a int64) int64 { return a + 1 })
+	op1sub               = unaryNumOp(func(a int64) int64 { return a - 1 })
+	opNegate             = unaryNumOp(func(a int64) int64 { return -a })
+	op0notequal          = unaryNumOp(func(a int64) int64 { return boolToNum(a != 0) })
+	opAdd                = binaryNumOp(func(a, b int64) int64 { return a + b })
+	opSub                = binaryNumOp(func(a, b int64) int64 { return a - b })
+	opBooland            = binaryNumOp(func(a, b int64) int64 { return boolToNum(a != 0 && b != 0) })
+	opBoolor             = binaryNumOp(func(a, b int64) int64 { return boolToNum(a != 0 || b != 0) })
+	opNumequal           = binaryNumOp(func(a, b int64) int64 { return boolToNum(a == b) })
+	opNumnotequal        = binaryNumOp(func(a, b int64) int64 { return boolToNum(a != b) })
+	opLessthan           = binaryNumOp(func(a, b int64) int64 { return boolToNum(a < b) })
+	opGreaterthan        = binaryNumOp(func(a, b int64) int64 { return boolToNum(a > b) })
+	opLessthanorequal    = binaryNumOp(func(a, b int64) int64 { return boolToNum(a <= b) })
+	opGreaterthanorequal = binaryNumOp(func(a, b int64) int64 { return boolToNum(a >= b) })
+	opMin                = binaryNumOp(func(a, b int64) int64 {
+		if a < b {
+			return a
+		}
+		return b
+	})
+	opMax = binaryNumOp(func(a, b int64) int64 {
+		if a > b {
+			return a
+		}
+		return b
+	})
+)
+
+func opAbs(ctx *context, realStack, altStack *stack) error {
+	a, err := popNum(ctx, realStack)
+	if err != nil {
+		return err
+	}
+
+	if a < 0 {
+		a = -a
+	}
+
+	return _add_number(a, realStack)
+}
+
+func opNumequalverify(ctx *context, realStack, altStack *stack) error {
+	if err := opNumequal(ctx, realStack, altStack); err != nil {
+		return err
+	}
+
+	return verify(realStack, ErrNumEqualVerify)
+}
+
+func opWithin(ctx *context, realStack, altStack *stack) error {
+	if realStack.length() < 3 {
+		return ErrStackUnderflow
+	}
+
+	max, err := popNum(ctx, realStack)
+	if err != nil {
+		return err
+	}
+
+	min, err := popNum(ctx, realStack)
+	if err != nil {
+		return err
+	}
+
+	x, err := popNum(ctx, realStack)
+	if err != nil {
+		return err
+	}
+
+	return _add_bool(min <= x && x < max, realStack)
 }
 
 var operation_functions = map[string]OperationFunc{
-	"OP_DUP":           opDup,
-	"OP_HASH256":       opHash256,
-	"OP_HASH160":       opHash160,
-	"OP_CHECKSIG":      opChecksig,
-	"OP_EQUAL":         opEqual,
-	"OP_EQUALVERIFY":   opEqualverify,
-	"OP_VERIFY":        opVerify,
-	"OP_2DUP":          op2dup,
-	"OP_SWAP":          opSwap,
-	"OP_NOT":           opNot,
-	"OP_SHA1":          opSha1,
-	"OP_0":             op0,
-	"OP_1":             op1,
-	"OP_2":             op2,
-	"OP_3":             op3,
-	"OP_4":             op4,
-	"OP_5":             op5,
-	"OP_6":             op6,
-	"OP_7":             op7,
-	"OP_8":             op8,
-	"OP_9":             op9,
-	"OP_10":            op10,
-	"OP_11":            op11,
-	"OP_12":            op12,
-	"OP_13":            op13,
-	"OP_14":            op14,
-	"OP_15":            op15,
-	"OP_16":            op16,
-	"OP_CHECKMULTISIG": opCheckmultisig,
+	"OP_DUP":                 opDup,
+	"OP_HASH256":             opHash256,
+	"OP_HASH160":             opHash160,
+	"OP_CHECKSIG":            opChecksig,
+	"OP_EQUAL":               opEqual,
+	"OP_EQUALVERIFY":         opEqualverify,
+	"OP_VERIFY":              opVerify,
+	"OP_2DUP":                op2dup,
+	"OP_SWAP":                opSwap,
+	"OP_NOT":                 opNot,
+	"OP_SHA1":                opSha1,
+	"OP_0":                   op0,
+	"OP_1NEGATE":             op1negate,
+	"OP_1":                   op1,
+	"OP_2":                   op2,
+	"OP_3":                   op3,
+	"OP_4":                   op4,
+	"OP_5":                   op5,
+	"OP_6":                   op6,
+	"OP_7":                   op7,
+	"OP_8":                   op8,
+	"OP_9":                   op9,
+	"OP_10":                  op10,
+	"OP_11":                  op11,
+	"OP_12":                  op12,
+	"OP_13":                  op13,
+	"OP_14":                  op14,
+	"OP_15":                  op15,
+	"OP_16":                  op16,
+	"OP_NOP":                 opNop,
+	"OP_IF":                  opIf,
+	"OP_NOTIF":               opNotif,
+	"OP_ELSE":                opElse,
+	"OP_ENDIF":               opEndif,
+	"OP_RETURN":              opReturn,
+	"OP_TOALTSTACK":          opToaltstack,
+	"OP_FROMALTSTACK":        opFromaltstack,
+	"OP_2DROP":               op2drop,
+	"OP_3DUP":                op3dup,
+	"OP_2OVER":               op2over,
+	"OP_2ROT":                op2rot,
+	"OP_2SWAP":               op2swap,
+	"OP_IFDUP":               opIfdup,
+	"OP_DEPTH":               opDepth,
+	"OP_DROP":                opDrop,
+	"OP_NIP":                 opNip,
+	"OP_OVER":                opOver,
+	"OP_PICK":                opPick,
+	"OP_ROLL":                opRoll,
+	"OP_ROT":                 opRot,
+	"OP_TUCK":                opTuck,
+	"OP_SIZE":                opSize,
+	"OP_1ADD":                op1add,
+	"OP_1SUB":                op1sub,
+	"OP_NEGATE":              opNegate,
+	"OP_ABS":                 opAbs,
+	"OP_0NOTEQUAL":           op0notequal,
+	"OP_ADD":                 opAdd,
+	"OP_SUB":                 opSub,
+	"OP_BOOLAND":             opBooland,
+	"OP_BOOLOR":              opBoolor,
+	"OP_NUMEQUAL":            opNumequal,
+	"OP_NUMEQUALVERIFY":      opNumequalverify,
+	"OP_NUMNOTEQUAL":         opNumnotequal,
+	"OP_LESSTHAN":            opLessthan,
+	"OP_GREATERTHAN":         opGreaterthan,
+	"OP_LESSTHANOREQUAL":     opLessthanorequal,
+	"OP_GREATERTHANOREQUAL":  opGreaterthanorequal,
+	"OP_MIN":                 opMin,
+	"OP_MAX":                 opMax,
+	"OP_WITHIN":              opWithin,
+	"OP_RIPEMD160":           opRipemd160,
+	"OP_SHA256":              opSha256,
+	"OP_CHECKSIGVERIFY":      opChecksigverify,
+	"OP_CHECKMULTISIG":       opCheckmultisig,
+	"OP_CHECKMULTISIGVERIFY": opCheckmultisigverify,
+	"OP_CHECKSIGADD":         opChecksigadd,
+	"OP_CODESEPARATOR":       opCodeseparator,
+	"OP_NOP1":                opUpgradableNop,
+	"OP_CHECKLOCKTIMEVERIFY": opChecklocktimeverify,
+	"OP_CHECKSEQUENCEVERIFY": opChecksequenceverify,
+	"OP_NOP4":                opUpgradableNop,
+	"OP_NOP5":                opUpgradableNop,
+	"OP_NOP6":                opUpgradableNop,
+	"OP_NOP7":                opUpgradableNop,
+	"OP_NOP8":                opUpgradableNop,
+	"OP_NOP9":                opUpgradableNop,
+	"OP_NOP10":               opUpgradableNop,
 }
 
 var op_codes_names = map[byte]string{
@@ -341,6 +1257,7 @@ var op_codes_names = map[byte]string{
 	77:  "OP_PUSHDATA2",
 	78:  "OP_PUSHDATA4",
 	79:  "OP_1NEGATE",
+	80:  "OP_RESERVED",
 	81:  "OP_1",
 	82:  "OP_2",
 	83:  "OP_3",
@@ -358,8 +1275,11 @@ var op_codes_names = map[byte]string{
 	95:  "OP_15",
 	96:  "OP_16",
 	97:  "OP_NOP",
+	98:  "OP_VER",
 	99:  "OP_IF",
 	100: "OP_NOTIF",
+	101: "OP_VERIF",
+	102: "OP_VERNOTIF",
 	103: "OP_ELSE",
 	104: "OP_ENDIF",
 	105: "OP_VERIFY",
@@ -383,11 +1303,23 @@ var op_codes_names = map[byte]string{
 	123: "OP_ROT",
 	124: "OP_SWAP",
 	125: "OP_TUCK",
+	126: "OP_CAT",
+	127: "OP_SUBSTR",
+	128: "OP_LEFT",
+	129: "OP_RIGHT",
 	130: "OP_SIZE",
+	131: "OP_INVERT",
+	132: "OP_AND",
+	133: "OP_OR",
+	134: "OP_XOR",
 	135: "OP_EQUAL",
 	136: "OP_EQUALVERIFY",
+	137: "OP_RESERVED1",
+	138: "OP_RESERVED2",
 	139: "OP_1ADD",
 	140: "OP_1SUB",
+	141: "OP_2MUL",
+	142: "OP_2DIV",
 	143: "OP_NEGATE",
 	144: "OP_ABS",
 	145: "OP_NOT",
@@ -395,6 +1327,10 @@ var op_codes_names = map[byte]string{
 	147: "OP_ADD",
 	148: "OP_SUB",
 	149: "OP_MUL",
+	150: "OP_DIV",
+	151: "OP_MOD",
+	152: "OP_LSHIFT",
+	153: "OP_RSHIFT",
 	154: "OP_BOOLAND",
 	155: "OP_BOOLOR",
 	156: "OP_NUMEQUAL",
@@ -427,6 +1363,7 @@ var op_codes_names = map[byte]string{
 	183: "OP_NOP8",
 	184: "OP_NOP9",
 	185: "OP_NOP10",
+	186: "OP_CHECKSIGADD",
 }
 
 func GetOpCodeName(b byte) string {
@@ -1,6 +1,7 @@
 package script
 
 import (
+	"crypto/sha256"
 	"encoding/hex"
 	"testing"
 )
@@ -14,10 +15,228 @@ func TestOpCheckmultisig(t *testing.T) {
 	sec2, _ := hex.DecodeString("03b287eaf122eea69030a0e9feed096bed8045c8b98bec453e1ffac7fbdbd4bb71")
 	sig2, _ := hex.DecodeString("3045022100da6bee3c93766232079a01639d07fa869598749729ae323eab8eef53577d611b02207bef15429dcadce2121ea07f233115c6f09034c0be68db99980b9a6c5e75402201")
 
-	scriptPubKey := &Script{[][]byte{{82}, sec1, sec2, {82}, {174}}}
-	scriptSig := &Script{[][]byte{{0x00}, sig1, sig2}}
+	scriptPubKey := &Script{Cmds: [][]byte{{82}, sec1, sec2, {82}, {174}}}
+	scriptSig := &Script{Cmds: [][]byte{{0x00}, sig1, sig2}}
 
-	ok := Evaluate(z, scriptSig, scriptPubKey)
+	err := Evaluate(fixedTxContext(z), scriptSig, scriptPubKey, nil, testFlags)
 
-	check(true, ok, t)
+	check(nil, err, t)
+}
+
+func TestOperations(t *testing.T) {
+	// scripts that end with their expected result and OP_EQUAL
+	tests := []struct {
+		name     string
+		cmds     [][]byte
+		expected error
+	}{
+		{"add", [][]byte{{0x52}, {0x53}, {0x93}, {0x55}, {0x87}}, nil},
+		{"sub", [][]byte{{0x52}, {0x53}, {0x94}, {0x4f}, {0x87}}, nil},
+		{"1add overflow operand", [][]byte{{0xff, 0xff, 0xff, 0x7f}, {0x8b}, {0x00, 0x00, 0x00, 0x80, 0x00}, {0x87}}, nil},
+		{"5 byte operand", [][]byte{{0x00, 0x00, 0x00, 0x80, 0x00}, {0x8b}, {0x75}, {0x51}}, ErrNumOverflow},
+		{"negate", [][]byte{{0x55}, {0x8f}, {0x55}, {0x93}, {0x91}}, nil},
+		{"abs", [][]byte{{0x55}, {0x8f}, {0x90}, {0x55}, {0x87}}, nil},
+		{"negative zero is false", [][]byte{{0x00, 0x80}, {0x91}}, nil},
+		{"0notequal", [][]byte{{0x58}, {0x92}, {0x51}, {0x87}}, nil},
+		{"booland", [][]byte{{0x51}, {0x00}, {0x9a}, {0x00}, {0x87}}, nil},
+		{"boolor", [][]byte{{0x51}, {0x00}, {0x9b}}, nil},
+		{"numequalverify", [][]byte{{0x53}, {0x03, 0x00}, {0x9d}, {0x51}}, nil},
+		{"numnotequal", [][]byte{{0x53}, {0x54}, {0x9e}}, nil},
+		{"lessthan", [][]byte{{0x53}, {0x54}, {0x9f}}, nil},
+		{"greaterthan", [][]byte{{0x53}, {0x54}, {0xa0}}, ErrEvalFalse},
+		{"lessthanorequal", [][]byte{{0x54}, {0x54}, {0xa1}}, nil},
+		{"greaterthanorequal", [][]byte{{0x53}, {0x54}, {0xa2}}, ErrEvalFalse},
+		{"min", [][]byte{{0x53}, {0x54}, {0xa3}, {0x53}, {0x87}}, nil},
+		{"max", [][]byte{{0x53}, {0x54}, {0xa4}, {0x54}, {0x87}}, nil},
+		{"within", [][]byte{{0x53}, {0x53}, {0x54}, {0xa5}}, nil},
+		{"within upper bound", [][]byte{{0x54}, {0x53}, {0x54}, {0xa5}}, ErrEvalFalse},
+		{"size", [][]byte{{0xaa, 0xbb, 0xcc}, {0x82}, {0x53}, {0x87}, {0x69}, {0x75}, {0x51}}, nil},
+		{"depth", [][]byte{{0x51}, {0x51}, {0x74}, {0x52}, {0x87}}, nil},
+		{"altstack", [][]byte{{0x52}, {0x6b}, {0x51}, {0x6c}, {0x52}, {0x87}, {0x69}}, nil},
+		{"fromaltstack empty", [][]byte{{0x6c}}, ErrAltStackUnderflow},
+		{"drop", [][]byte{{0x51}, {0x00}, {0x75}}, nil},
+		{"2drop", [][]byte{{0x51}, {0x00}, {0x00}, {0x6d}}, nil},
+		{"nip", [][]byte{{0x00}, {0x51}, {0x77}, {0x74}, {0x51}, {0x87}}, nil},
+		{"over", [][]byte{{0x52}, {0x51}, {0x78}, {0x52}, {0x87}}, nil},
+		{"pick", [][]byte{{0x53}, {0x52}, {0x51}, {0x52}, {0x79}, {0x53}, {0x87}}, nil},
+		{"pick out of range", [][]byte{{0x51}, {0x51}, {0x79}}, ErrStackUnderflow},
+		{"roll", [][]byte{{0x53}, {0x52}, {0x51}, {0x52}, {0x7a}, {0x53}, {0x87}, {0x69}, {0x74}, {0x52}, {0x87}}, nil},
+		{"rot", [][]byte{{0x51}, {0x52}, {0x53}, {0x7b}, {0x51}, {0x87}}, nil},
+		{"tuck", [][]byte{{0x51}, {0x52}, {0x7d}, {0x74}, {0x53}, {0x87}}, nil},
+		{"2dup", [][]byte{{0x51}, {0x52}, {0x6e}, {0x52}, {0x88}, {0x51}, {0x88}, {0x52}, {0x87}}, nil},
+		{"3dup", [][]byte{{0x51}, {0x52}, {0x53}, {0x6f}, {0x74}, {0x56}, {0x87}}, nil},
+		{"2over", [][]byte{{0x51}, {0x52}, {0x53}, {0x54}, {0x70}, {0x52}, {0x87}}, nil},
+		{"2rot", [][]byte{{0x51}, {0x52}, {0x53}, {0x54}, {0x55}, {0x56}, {0x71}, {0x52}, {0x87}}, nil},
+		{"2swap", [][]byte{{0x51}, {0x52}, {0x53}, {0x54}, {0x72}, {0x52}, {0x87}}, nil},
+		{"ifdup", [][]byte{{0x00}, {0x73}, {0x74}, {0x51}, {0x87}}, nil},
+		{"return", [][]byte{{0x51}, {0x6a}}, ErrOpReturn},
+		{"nop", [][]byte{{0x51}, {0x61}, {0xb0}, {0xb9}}, nil},
+		{"cat is disabled", [][]byte{{0x51}, {0x51}, {0x7e}}, ErrDisabledOpcode},
+		{"mul is disabled", [][]byte{{0x51}, {0x51}, {0x95}}, ErrDisabledOpcode},
+		{"reserved", [][]byte{{0x51}, {0x50}}, ErrBadOpcode},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := Evaluate(fixedTxContext(nil), &Script{}, &Script{Cmds: test.cmds}, nil, testFlags)
+			check(test.expected, err, t)
+		})
+	}
+}
+
+func TestOpHashes(t *testing.T) {
+	preimage := []byte("hello")
+	ripemd, _ := hex.DecodeString("108f07b8382412612c048d07d13f814118445acd")
+	sha, _ := hex.DecodeString("2cf24dba5fb0a30e26e83b2ac5b9e29e1b161e5c1fa7425e73043362938b9824")
+
+	scriptPubKey := &Script{Cmds: [][]byte{{0x76}, {0xa6}, ripemd, {0x88}, {0xa8}, sha, {0x87}}}
+	scriptSig := &Script{Cmds: [][]byte{preimage}}
+
+	check(nil, Evaluate(fixedTxContext(nil), scriptSig, scriptPubKey, nil, testFlags), t)
+}
+
+func TestOpCheckmultisigOrder(t *testing.T) {
+	z, _ := hex.DecodeString("e71bfa115715d6fd33796948126f40a8cdd39f187e4afb03896795189fe1423c")
+
+	sec1, _ := hex.DecodeString("022626e955ea6ea6d98850c994f9107b036b1334f18ca8830bfff1295d21cfdb70")
+	sig1, _ := hex.DecodeString("3045022100dc92655fe37036f47756db8102e0d7d5e28b3beb83a8fef4f5dc0559bddfb94e02205a36d4e4e6c7fcd16658c50783e00c341609977aed3ad00937bf4ee942a8993701")
+
+	sec2, _ := hex.DecodeString("03b287eaf122eea69030a0e9feed096bed8045c8b98bec453e1ffac7fbdbd4bb71")
+	sig2, _ := hex.DecodeString("3045022100da6bee3c93766232079a01639d07fa869598749729ae323eab8eef53577d611b02207bef15429dcadce2121ea07f233115c6f09034c0be68db99980b9a6c5e75402201")
+
+	// 1 of 2 with either key
+	scriptPubKey := &Script{Cmds: [][]byte{{0x51}, sec1, sec2, {0x52}, {0xae}}}
+	check(nil, Evaluate(fixedTxContext(z), &Script{Cmds: [][]byte{{0x00}, sig1}}, scriptPubKey, nil, testFlags), t)
+	check(nil, Evaluate(fixedTxContext(z), &Script{Cmds: [][]byte{{0x00}, sig2}}, scriptPubKey, nil, testFlags), t)
+
+	// signatures in the wrong order
+	scriptPubKey = &Script{Cmds: [][]byte{{0x52}, sec1, sec2, {0x52}, {0xae}}}
+	check(ErrEvalFalse, Evaluate(fixedTxContext(z), &Script{Cmds: [][]byte{{0x00}, sig2, sig1}}, scriptPubKey, nil, testFlags), t)
+
+	// a failed check leaves false on the stack, the verify variant fails
+	scriptPubKey = &Script{Cmds: [][]byte{{0x52}, sec1, sec2, {0x52}, {0xae}, {0x91}}}
+	check(nil, Evaluate(fixedTxContext(z), &Script{Cmds: [][]byte{{0x00}, sig2, sig1}}, scriptPubKey, nil, testFlags), t)
+	scriptPubKey = &Script{Cmds: [][]byte{{0x52}, sec1, sec2, {0x52}, {0xaf}, {0x51}}}
+	check(ErrCheckMultisigVerify, Evaluate(fixedTxContext(z), &Script{Cmds: [][]byte{{0x00}, sig2, sig1}}, scriptPubKey, nil, testFlags), t)
+}
+
+func TestOpCodeseparator(t *testing.T) {
+	z, _ := hex.DecodeString("7c076ff316692a3d7eb3c3bb0f8b1488cf72e1afcd929e29307032997a838a3d")
+	sec, _ := hex.DecodeString("04887387e452b8eacc4acfde10d9aaf7f6d9a0f975aabb10d006e4da568744d06c61de6d95231cd89026e286df3b6ae4a894a3378e393e93a0f45b666329a0ae34")
+	sig, _ := hex.DecodeString("3045022000eff69ef2b1bd93a66ed5219add4fb51e11a840f404876325a1e8ffe0529a2c022100c7207fee197d27c618aea621406f6bf5ef6fca38681d82b2f06fddbdce6feab601")
+
+	var scriptCode *Script
+	sigHash := func(hashType uint32, ext *SigHashExt) ([]byte, error) {
+		if ext != nil {
+			scriptCode = ext.ScriptCode
+		}
+		return z, nil
+	}
+
+	scriptPubKey := &Script{Cmds: [][]byte{{0x61}, {0xab}, sec, {0xac}}}
+	check(nil, Evaluate(&TxContext{SigHash: sigHash}, &Script{Cmds: [][]byte{sig}}, scriptPubKey, nil, testFlags), t)
+	check((&Script{Cmds: [][]byte{sec, {0xac}}}).RawSerialize(), scriptCode.RawSerialize(), t)
+}
+
+func TestOpIf(t *testing.T) {
+	tests := []struct {
+		name     string
+		cmds     [][]byte
+		expected error
+	}{
+		{"if", [][]byte{{0x51}, {0x63}, {0x51}, {0x67}, {0x00}, {0x68}}, nil},
+		{"else", [][]byte{{0x00}, {0x63}, {0x00}, {0x67}, {0x51}, {0x68}}, nil},
+		{"notif", [][]byte{{0x00}, {0x64}, {0x51}, {0x67}, {0x00}, {0x68}}, nil},
+		{"nested", [][]byte{{0x51}, {0x00}, {0x63}, {0x63}, {0x00}, {0x68}, {0x51}, {0x67}, {0x63}, {0x51}, {0x67}, {0x00}, {0x68}, {0x68}}, nil},
+		{"multiple else", [][]byte{{0x51}, {0x63}, {0x00}, {0x67}, {0x00}, {0x67}, {0x51}, {0x68}}, nil},
+		{"unexecuted return", [][]byte{{0x00}, {0x63}, {0x6a}, {0x68}, {0x51}}, nil},
+		{"unexecuted reserved", [][]byte{{0x00}, {0x63}, {0x50}, {0x68}, {0x51}}, nil},
+		{"unexecuted disabled", [][]byte{{0x00}, {0x63}, {0x7e}, {0x68}, {0x51}}, ErrDisabledOpcode},
+		{"unexecuted verif", [][]byte{{0x00}, {0x63}, {0x65}, {0x68}, {0x51}}, ErrBadOpcode},
+		{"missing endif", [][]byte{{0x51}, {0x63}, {0x51}}, ErrUnbalancedConditional},
+		{"endif without if", [][]byte{{0x51}, {0x68}}, ErrUnbalancedConditional},
+		{"else without if", [][]byte{{0x51}, {0x67}}, ErrUnbalancedConditional},
+		{"if on empty stack", [][]byte{{0x63}, {0x68}, {0x51}}, ErrUnbalancedConditional},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := Evaluate(fixedTxContext(nil), &Script{}, &Script{Cmds: test.cmds}, nil, testFlags)
+			check(test.expected, err, t)
+		})
+	}
+}
+
+func TestOpIfScriptSig(t *testing.T) {
+	// a conditional opened in the script sig can't be closed by the script
+	// pubkey
+	scriptSig := &Script{Cmds: [][]byte{{0x51}, {0x63}}}
+	scriptPubKey := &Script{Cmds: [][]byte{{0x68}, {0x51}}}
+	check(ErrUnbalancedConditional, Evaluate(fixedTxContext(nil), scriptSig, scriptPubKey, nil, testFlags), t)
+}
+
+// MINIMALIF is only policy for segwit v0
+func TestOpIfMinimal(t *testing.T) {
+	witnessScript := &Script{Cmds: [][]byte{{0x63}, {0x51}, {0x67}, {0x00}, {0x68}}}
+	sum := sha256.Sum256(witnessScript.RawSerialize())
+	scriptPubKey := P2wsh(sum[:])
+
+	check(nil, Evaluate(fixedTxContext(nil), &Script{}, scriptPubKey, [][]byte{{0x01}, witnessScript.RawSerialize()}, testFlags), t)
+	check(nil, Evaluate(fixedTxContext(nil), &Script{}, scriptPubKey, [][]byte{{0x02}, witnessScript.RawSerialize()}, testFlags), t)
+	check(ErrMinimalIf, Evaluate(fixedTxContext(nil), &Script{}, scriptPubKey, [][]byte{{0x02}, witnessScript.RawSerialize()}, testFlags|SCRIPT_VERIFY_MINIMALIF), t)
+
+	// legacy scripts take any true value
+	check(nil, Evaluate(fixedTxContext(nil), &Script{Cmds: [][]byte{{0x02, 0x00}}}, witnessScript, nil, testFlags|SCRIPT_VERIFY_MINIMALIF), t)
+}
+
+func TestOpChecklocktimeverify(t *testing.T) {
+	tests := []struct {
+		name     string
+		lockTime int64
+		tx       TxContext
+		expected error
+	}{
+		{"height reached", 500, TxContext{LockTime: 500, Sequence: 0xfffffffe}, nil},
+		{"height not reached", 501, TxContext{LockTime: 500, Sequence: 0xfffffffe}, ErrUnsatisfiedLockTime},
+		{"time reached", 600000000, TxContext{LockTime: 600000001, Sequence: 0}, nil},
+		{"time against height", 600000000, TxContext{LockTime: 499999999, Sequence: 0}, ErrUnsatisfiedLockTime},
+		{"height against time", 500, TxContext{LockTime: 600000000, Sequence: 0}, ErrUnsatisfiedLockTime},
+		{"final input", 500, TxContext{LockTime: 500, Sequence: 0xffffffff}, ErrUnsatisfiedLockTime},
+		{"negative", -500, TxContext{LockTime: 500, Sequence: 0}, ErrNegativeLockTime},
+		{"5 bytes", 0xffffffff, TxContext{LockTime: 0xffffffff, Sequence: 0}, nil},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			scriptPubKey := &Script{Cmds: [][]byte{encodeNum(test.lockTime), {0xb1}, {0x75}, {0x51}}}
+			check(test.expected, Evaluate(&test.tx, &Script{}, scriptPubKey, nil, testFlags), t)
+		})
+	}
+}
+
+func TestOpChecksequenceverify(t *testing.T) {
+	tests := []struct {
+		name     string
+		sequence int64
+		tx       TxContext
+		expected error
+	}{
+		{"blocks reached", 144, TxContext{Version: 2, Sequence: 144}, nil},
+		{"blocks not reached", 145, TxContext{Version: 2, Sequence: 144}, ErrUnsatisfiedLockTime},
+		{"time reached", 1<<22 | 300, TxContext{Version: 2, Sequence: 1<<22 | 301}, nil},
+		{"time against blocks", 1<<22 | 300, TxContext{Version: 2, Sequence: 301}, ErrUnsatisfiedLockTime},
+		{"blocks against time", 300, TxContext{Version: 2, Sequence: 1<<22 | 301}, ErrUnsatisfiedLockTime},
+		{"upper bits ignored", 1<<16 | 144, TxContext{Version: 2, Sequence: 1<<20 | 144}, nil},
+		{"version 1", 144, TxContext{Version: 1, Sequence: 144}, ErrUnsatisfiedLockTime},
+		{"disabled input", 144, TxContext{Version: 2, Sequence: 1<<31 | 144}, ErrUnsatisfiedLockTime},
+		{"disabled operand", 1<<31 | 145, TxContext{Version: 1, Sequence: 0}, nil},
+		{"negative", -144, TxContext{Version: 2, Sequence: 144}, ErrNegativeLockTime},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			scriptPubKey := &Script{Cmds: [][]byte{encodeNum(test.sequence), {0xb2}, {0x75}, {0x51}}}
+			check(test.expected, Evaluate(&test.tx, &Script{}, scriptPubKey, nil, testFlags), t)
+		})
+	}
 }
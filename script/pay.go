@@ -9,7 +9,7 @@ func P2pkh(h160 []byte) *Script {
 		{0xac},
 	}
 
-	return &Script{cmds}
+	return &Script{Cmds: cmds}
 }
 
 func P2sh(h160 []byte) *Script {
@@ -19,7 +19,7 @@ func P2sh(h160 []byte) *Script {
 		{0x87},
 	}
 
-	return &Script{cmds}
+	return &Script{Cmds: cmds}
 }
 
 func P2wpkh(h160 []byte) *Script {
@@ -28,7 +28,7 @@ func P2wpkh(h160 []byte) *Script {
 		h160,
 	}
 
-	return &Script{cmds}
+	return &Script{Cmds: cmds}
 }
 
 func P2wsh(h256 []byte) *Script {
@@ -37,5 +37,29 @@ func P2wsh(h256 []byte) *Script {
 		h256,
 	}
 
-	return &Script{cmds}
+	return &Script{Cmds: cmds}
+}
+
+func P2tr(outputKey []byte) *Script {
+	cmds := [][]byte{
+		{0x51},
+		outputKey,
+	}
+
+	return &Script{Cmds: cmds}
+}
+
+// P2witness returns the witness program of any version from 0 to 16.
+func P2witness(version byte, program []byte) *Script {
+	op := byte(0x00)
+	if version > 0 {
+		op = 0x50 + version
+	}
+
+	cmds := [][]byte{
+		{op},
+		program,
+	}
+
+	return &Script{Cmds: cmds}
 }
@@ -9,80 +9,233 @@ import (
 	"strings"
 
 	u "github.com/lobiCode/prog_btc_go/btcutils"
+	"github.com/lobiCode/prog_btc_go/chaincfg"
 )
 
 var ErrTxVersionLen = errors.New("wrong version len")
 var ErrScripParse = errors.New("parsing script failed")
 var ErrUnknownScriptPubKey = errors.New("unknown script pubkey")
 
+// Script is a list of commands, pushed data and one byte opcodes. A parsed
+// script keeps its bytes, it serializes to them as long as Cmds aren't
+// changed.
 type Script struct {
 	Cmds [][]byte
+
+	raw     []byte
+	rawCmds [][]byte
+}
+
+// instruction is an opcode with the data it pushes.
+type instruction struct {
+	op   byte
+	data []byte
 }
 
-func (s *Script) GetAddress(testnet bool) (string, error) {
+// readInstruction decodes the instruction of raw at pc and returns where the
+// next one starts. ok is false when a push runs past the end, next is then
+// as far as Bitcoin Core's GetOp gets.
+func readInstruction(raw []byte, pc int) (ins instruction, next int, ok bool) {
+	op := raw[pc]
+	pc++
+
+	var dataLen uint64
+	switch {
+	case op < 76:
+		dataLen = uint64(op)
+	case op == 76:
+		if len(raw)-pc < 1 {
+			return instruction{}, pc, false
+		}
+		dataLen = uint64(raw[pc])
+		pc++
+	case op == 77:
+		if len(raw)-pc < 2 {
+			return instruction{}, pc, false
+		}
+		dataLen = uint64(binary.LittleEndian.Uint16(raw[pc:]))
+		pc += 2
+	case op == 78:
+		if len(raw)-pc < 4 {
+			return instruction{}, pc, false
+		}
+		dataLen = uint64(binary.LittleEndian.Uint32(raw[pc:]))
+		pc += 4
+	default:
+		return instruction{op: op}, pc, true
+	}
+
+	if uint64(len(raw)-pc) < dataLen {
+		return instruction{}, pc, false
+	}
+	end := pc + int(dataLen)
+
+	return instruction{op, raw[pc:end]}, end, true
+}
+
+// newScript returns the script of raw, its Cmds stop at a push that runs
+// past the end.
+func newScript(raw []byte) *Script {
+	raw = u.Copyb(raw)
+	cmds := [][]byte{}
+	rawCmds := [][]byte{}
+
+	for pc := 0; pc < len(raw); {
+		ins, next, ok := readInstruction(raw, pc)
+		if !ok {
+			break
+		}
+
+		if ins.op > 0 && ins.op <= 78 {
+			cmds = append(cmds, u.Copyb(ins.data))
+			rawCmds = append(rawCmds, ins.data)
+		} else {
+			cmds = append(cmds, []byte{ins.op})
+			rawCmds = append(rawCmds, raw[pc:pc+1])
+		}
+		pc = next
+	}
+
+	return &Script{Cmds: cmds, raw: raw, rawCmds: rawCmds}
+}
+
+// isParsed reports whether the script still is the one parsed from raw.
+func (s *Script) isParsed() bool {
+	if s.raw == nil || len(s.Cmds) != len(s.rawCmds) {
+		return false
+	}
+
+	for i, cmd := range s.Cmds {
+		if !bytes.Equal(cmd, s.rawCmds[i]) {
+			return false
+		}
+	}
+
+	return true
+}
+
+func (s *Script) GetAddress(params *chaincfg.Params) (string, error) {
 	if s.IsP2pkhScriptPubkey() {
-		return u.AddressP2pkh(s.Cmds[2], testnet), nil
+		return u.AddressP2pkh(s.Cmds[2], params), nil
 	}
 
 	if s.IsP2shScriptPubkeys() {
-		return u.AddressP2sh(s.Cmds[1], testnet), nil
+		return u.AddressP2sh(s.Cmds[1], params), nil
+	}
+
+	if version, program, ok := witnessProgram(s.RawSerialize()); ok {
+		if version != 0 {
+			version -= 0x50
+		}
+		return u.AddressSegwit(version, program, params)
 	}
 
 	return "", ErrUnknownScriptPubKey
 }
 
 func (s *Script) Serialize() []byte {
-	result := make([]byte, 8)
+	raw := s.RawSerialize()
 
-	var i byte
-	var dataLen []byte
+	return append(u.EncodeVariant(len(raw)), raw...)
+}
 
+func (s *Script) RawSerialize() []byte {
+	if s.isParsed() {
+		return u.Copyb(s.raw)
+	}
+
+	result := make([]byte, 0, 8)
 	for _, v := range s.Cmds {
-		l := len(v)
-		if l == 1 && (v[0] == 0 || v[0] > 77) {
+		if len(v) == 1 && (v[0] == 0 || v[0] > 77) {
 			result = append(result, v...)
 		} else {
-			if l >= 1 && l < 76 {
-				dataLen = []byte{}
-				i = byte(l)
-			} else if l > 75 && l < 0x100 {
-				i = 76
-				dataLen = []byte{byte(l)}
-			} else if l >= 0x100 && l <= 520 {
-				i = 77
-				dataLen = []byte{0, 0}
-				binary.LittleEndian.PutUint16(dataLen, uint16(l))
-			} else {
-				panic("too long cmd")
-			}
-
-			result = append(result, i)
-			if len(dataLen) > 0 {
-				result = append(result, dataLen...)
-			}
-			result = append(result, v...)
+			result = append(result, encodePush(v)...)
 		}
 	}
 
-	variant := u.EncodeVariant(len(result) - 8)
-	vl := 8 - len(variant)
-	result = result[vl:]
-	for i, v := range variant {
-		result[i] = v
-	}
 	return result
 }
 
 func (s *Script) IsP2shScriptPubkeys() bool {
-	return isP2sh(s.Cmds)
+	return isP2sh(s.RawSerialize())
 }
 
 func (s *Script) IsP2pkhScriptPubkey() bool {
-	return isP2sh(s.Cmds)
+	return isP2pkh(s.RawSerialize())
+}
+
+func (s *Script) IsP2wpkhScriptPubkey() bool {
+	return isP2wpkh(s.RawSerialize())
+}
+
+func (s *Script) IsP2wshScriptPubkey() bool {
+	return isP2wsh(s.RawSerialize())
+}
+
+func (s *Script) IsP2trScriptPubkey() bool {
+	return isP2tr(s.RawSerialize())
+}
+
+// IsPushOnly reports whether the script only pushes data, the opcodes up to
+// OP_16 count as pushes.
+func (s *Script) IsPushOnly() bool {
+	raw := s.RawSerialize()
+	for pc := 0; pc < len(raw); {
+		ins, next, ok := readInstruction(raw, pc)
+		if !ok || ins.op > 96 {
+			return false
+		}
+		pc = next
+	}
+
+	return true
+}
+
+// SerializeScriptCode returns the script the way the legacy signature hash
+// commits to it, without its OP_CODESEPARATORs.
+func (s *Script) SerializeScriptCode() []byte {
+	raw := s.RawSerialize()
+
+	// like Bitcoin Core the length counts the bytes after a push that runs
+	// past the end, which aren't written
+	n := len(raw)
+	for pc := 0; pc < len(raw); {
+		ins, next, ok := readInstruction(raw, pc)
+		if !ok {
+			break
+		}
+		if ins.op == 171 {
+			n--
+		}
+		pc = next
+	}
+
+	result := u.EncodeVariant(n)
+	begin, pc := 0, 0
+	for pc < len(raw) {
+		ins, next, ok := readInstruction(raw, pc)
+		pc = next
+		if !ok {
+			break
+		}
+		if ins.op == 171 {
+			result = append(result, raw[begin:pc-1]...)
+			begin = pc
+		}
+	}
+	if begin < len(raw) {
+		result = append(result, raw[begin:pc]...)
+	}
+
+	return result
 }
 
 func (s *Script) GetRedeemScript() (*Script, error) {
-	return Parse(bytes.NewReader(s.Cmds[2]))
+	if len(s.Cmds) == 0 {
+		return nil, ErrScripParse
+	}
+
+	return ParseRaw(s.Cmds[len(s.Cmds)-1])
 }
 
 func (s *Script) String() string {
@@ -99,67 +252,25 @@ func (s *Script) String() string {
 	return strings.Join(outs, " ")
 }
 
+// ParseRaw parses a script without its length, any bytes are a script.
+func ParseRaw(b []byte) (*Script, error) {
+	return newScript(b), nil
+}
+
 func Parse(r io.Reader) (*Script, error) {
 	n, err := u.ReadVariant(r)
 	if err != nil {
 		return nil, err
 	}
 
-	cmds := make([][]byte, 0)
-	// TODO
-	b := make([]byte, 520)
-
-	count := uint64(0)
-	for count < n {
-		_, err = io.ReadFull(r, b[:1])
-		if err != nil {
-			return nil, err
-		}
-		count += 1
-
-		// TODO
-		i := uint64(b[0])
-
-		switch {
-		case (i >= 1 && i <= 75):
-			_, err = io.ReadFull(r, b[:i])
-			if err != nil {
-				return nil, err
-			}
-			cmds = append(cmds, u.Copyb(b[:i]))
-			count += i
-		case i == 76:
-			_, err = io.ReadFull(r, b[:1])
-			if err != nil {
-				return nil, err
-			}
-			dataLen := uint64(b[0])
-			_, err = io.ReadFull(r, b[:dataLen])
-			if err != nil {
-				return nil, err
-			}
-			cmds = append(cmds, u.Copyb(b[:dataLen]))
-			count += (dataLen + 1)
-		case i == 77:
-			_, err = io.ReadFull(r, b[:2])
-			if err != nil {
-				return nil, err
-			}
-			dataLen := uint64(binary.LittleEndian.Uint16(b[:2]))
-			_, err = io.ReadFull(r, b[:dataLen])
-			if err != nil {
-				return nil, err
-			}
-			cmds = append(cmds, u.Copyb(b[:dataLen]))
-			count += (dataLen + 2)
-		default:
-			cmds = append(cmds, u.Copyb(b[:1]))
-		}
+	// the length isn't trusted with an allocation
+	var raw bytes.Buffer
+	if _, err := io.CopyN(&raw, r, int64(n)); err != nil {
+		return nil, err
 	}
-
-	if count != n {
+	if uint64(raw.Len()) != n {
 		return nil, ErrScripParse
 	}
 
-	return &Script{cmds}, nil
+	return newScript(raw.Bytes()), nil
 }
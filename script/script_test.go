@@ -24,9 +24,58 @@ func TestParse(t *testing.T) {
 	check(in, s, t)
 }
 
+func TestRawSerializeEmptyPush(t *testing.T) {
+	s := &Script{Cmds: [][]byte{{}, {0x51}}}
+	check([]byte{0x00, 0x51}, s.RawSerialize(), t)
+}
+
+func TestParseRawRoundTrip(t *testing.T) {
+	tests := []string{
+		"",
+		"4c0101",
+		"4d0100ab",
+		"4e01000000ab",
+		"4c00",
+		"0101",
+		"76a94c14d52ad7ca9b3d096a38e752c2018e6fbc40cdf26f88ac",
+		"4d01",
+		"4e0200000000",
+		"05abcd",
+		"bbfffe",
+	}
+
+	for _, test := range tests {
+		raw, err := hex.DecodeString(test)
+		check(nil, err, t)
+
+		s, err := ParseRaw(raw)
+		check(nil, err, t)
+		check(test, hex.EncodeToString(s.RawSerialize()), t)
+	}
+
+	// a push over 520 bytes serializes, it only fails when evaluated
+	raw := append([]byte{77, 0x09, 0x02}, make([]byte, 521)...)
+	s, err := ParseRaw(raw)
+	check(nil, err, t)
+	check(raw, s.RawSerialize(), t)
+	check(521, len(s.Cmds[0]), t)
+}
+
 func check(expected, recived interface{}, t *testing.T) {
 	t.Helper()
 	if !reflect.DeepEqual(recived, expected) {
 		t.Errorf("Received\n%+v\ndoesn't match expected\n%+v\n", recived, expected)
 	}
 }
+
+const testFlags = MANDATORY_SCRIPT_VERIFY_FLAGS
+
+func fixedSigHash(z []byte) SigHashFunc {
+	return func(hashType uint32, ext *SigHashExt) ([]byte, error) {
+		return z, nil
+	}
+}
+
+func fixedTxContext(z []byte) *TxContext {
+	return &TxContext{SigHash: fixedSigHash(z)}
+}
@@ -0,0 +1,113 @@
+package script
+
+import (
+	"math/big"
+
+	ec "github.com/lobiCode/prog_btc_go/ellipticcurve"
+)
+
+// checkSignatureEncoding enforces the encoding rules the flags select on a
+// signature with its hash type byte, an empty signature is always allowed.
+func checkSignatureEncoding(sig []byte, flags ScriptFlags) error {
+	if len(sig) == 0 {
+		return nil
+	}
+
+	if flags.has(SCRIPT_VERIFY_DERSIG|SCRIPT_VERIFY_LOW_S|SCRIPT_VERIFY_STRICTENC) && !isValidSignatureEncoding(sig) {
+		return ErrSigDER
+	}
+
+	if flags.has(SCRIPT_VERIFY_LOW_S) && !isLowDERSignature(sig) {
+		return ErrSigHighS
+	}
+
+	if flags.has(SCRIPT_VERIFY_STRICTENC) && !isDefinedHashType(sig) {
+		return ErrSigHashType
+	}
+
+	return nil
+}
+
+func checkPublicKeyEncoding(pub []byte, flags ScriptFlags, sigVersion sigVersion) error {
+	if flags.has(SCRIPT_VERIFY_STRICTENC) && !isCompressedOrUncompressedPublicKey(pub) {
+		return ErrPubKeyType
+	}
+
+	if flags.has(SCRIPT_VERIFY_WITNESS_PUBKEYTYPE) && sigVersion == sigVersionWitnessV0 &&
+		!isCompressedPublicKey(pub) {
+		return ErrWitnessPubKeyType
+	}
+
+	return nil
+}
+
+// isValidSignatureEncoding is the strict DER check of BIP66, sig ends with
+// the hash type byte.
+func isValidSignatureEncoding(sig []byte) bool {
+	// 0x30 len 0x02 rLen r 0x02 sLen s hashType
+	if len(sig) < 9 || len(sig) > 73 {
+		return false
+	}
+
+	if sig[0] != 0x30 || int(sig[1]) != len(sig)-3 {
+		return false
+	}
+
+	rLen := int(sig[3])
+	if 5+rLen >= len(sig) {
+		return false
+	}
+
+	sLen := int(sig[5+rLen])
+	if rLen+sLen+7 != len(sig) {
+		return false
+	}
+
+	if !isValidDERInteger(sig[2], sig[4:4+rLen]) {
+		return false
+	}
+
+	return isValidDERInteger(sig[4+rLen], sig[6+rLen:6+rLen+sLen])
+}
+
+// isValidDERInteger reports whether i is a positive integer without padding.
+func isValidDERInteger(tag byte, i []byte) bool {
+	if tag != 0x02 || len(i) == 0 || i[0]&0x80 != 0 {
+		return false
+	}
+
+	return len(i) == 1 || i[0] != 0x00 || i[1]&0x80 != 0
+}
+
+// isLowDERSignature reports whether S is at most half the curve order, the
+// other S of the same signature isn't.
+func isLowDERSignature(sig []byte) bool {
+	if !isValidSignatureEncoding(sig) {
+		return false
+	}
+
+	rLen := int(sig[3])
+	sLen := int(sig[5+rLen])
+	s := new(big.Int).SetBytes(sig[6+rLen : 6+rLen+sLen])
+	halfOrder := new(big.Int).Rsh(ec.BTCCurve.N, 1)
+
+	return s.Cmp(halfOrder) <= 0
+}
+
+func isDefinedHashType(sig []byte) bool {
+	hashType := sig[len(sig)-1] &^ 0x80
+
+	return hashType >= 1 && hashType <= 3
+}
+
+func isCompressedOrUncompressedPublicKey(pub []byte) bool {
+	if len(pub) == 65 {
+		return pub[0] == 0x04
+	}
+
+	return isCompressedPublicKey(pub)
+}
+
+func isCompressedPublicKey(pub []byte) bool {
+	return len(pub) == 33 && (pub[0] == 0x02 || pub[0] == 0x03)
+}
@@ -0,0 +1,257 @@
+package script
+
+// ScriptClass is the template a script pubkey follows, the names follow
+// Bitcoin Core.
+type ScriptClass int
+
+const (
+	TX_NONSTANDARD ScriptClass = iota
+	TX_PUBKEY
+	TX_PUBKEYHASH
+	TX_SCRIPTHASH
+	TX_MULTISIG
+	TX_NULL_DATA
+	TX_WITNESS_V0_KEYHASH
+	TX_WITNESS_V0_SCRIPTHASH
+	TX_WITNESS_V1_TAPROOT
+	TX_WITNESS_UNKNOWN
+)
+
+var scriptClassNames = map[ScriptClass]string{
+	TX_NONSTANDARD:           "nonstandard",
+	TX_PUBKEY:                "pubkey",
+	TX_PUBKEYHASH:            "pubkeyhash",
+	TX_SCRIPTHASH:            "scripthash",
+	TX_MULTISIG:              "multisig",
+	TX_NULL_DATA:             "nulldata",
+	TX_WITNESS_V0_KEYHASH:    "witness_v0_keyhash",
+	TX_WITNESS_V0_SCRIPTHASH: "witness_v0_scripthash",
+	TX_WITNESS_V1_TAPROOT:    "witness_v1_taproot",
+	TX_WITNESS_UNKNOWN:       "witness_unknown",
+}
+
+func (c ScriptClass) String() string {
+	return scriptClassNames[c]
+}
+
+const (
+	maxStandardScriptSigSize = 1650
+	maxStandardMultisigKeys  = 3
+	maxDataCarrierSize       = 83
+	dustRelayFeePerKvB       = 3000
+)
+
+// ScriptData is what Classify extracts from a script pubkey, only the fields
+// of its class are set.
+type ScriptData struct {
+	// PubKeys of pubkey and multisig, Required is m of a multisig
+	PubKeys  [][]byte
+	Required int
+	// Hash of pubkeyhash and scripthash
+	Hash []byte
+	// Version and Program of a witness program, the key hash, script hash
+	// or output key for the known versions
+	Version int
+	Program []byte
+	// Data pushed after the OP_RETURN of nulldata
+	Data [][]byte
+}
+
+// Classify returns the class of a script pubkey and the data it pays to.
+func Classify(s *Script) (ScriptClass, *ScriptData) {
+	raw := s.RawSerialize()
+
+	if isP2sh(raw) {
+		return TX_SCRIPTHASH, &ScriptData{Hash: raw[2:22]}
+	}
+
+	if op, program, ok := witnessProgram(raw); ok {
+		version := 0
+		if op != 0 {
+			version = int(op) - 80
+		}
+		data := &ScriptData{Version: version, Program: program}
+
+		switch {
+		case version == 0 && len(program) == 20:
+			return TX_WITNESS_V0_KEYHASH, data
+		case version == 0 && len(program) == 32:
+			return TX_WITNESS_V0_SCRIPTHASH, data
+		case version == 0:
+			return TX_NONSTANDARD, &ScriptData{}
+		case version == 1 && len(program) == 32:
+			return TX_WITNESS_V1_TAPROOT, data
+		}
+
+		return TX_WITNESS_UNKNOWN, data
+	}
+
+	if len(raw) > 0 && raw[0] == 0x6a {
+		if data, ok := pushes(raw[1:]); ok {
+			return TX_NULL_DATA, &ScriptData{Data: data}
+		}
+	}
+
+	if pubKey, ok := matchP2pk(raw); ok {
+		return TX_PUBKEY, &ScriptData{PubKeys: [][]byte{pubKey}}
+	}
+
+	if isP2pkh(raw) {
+		return TX_PUBKEYHASH, &ScriptData{Hash: raw[3:23]}
+	}
+
+	if data, ok := matchMultisig(raw); ok {
+		return TX_MULTISIG, data
+	}
+
+	return TX_NONSTANDARD, &ScriptData{}
+}
+
+// pushes returns the data of a push only script.
+func pushes(raw []byte) ([][]byte, bool) {
+	result := [][]byte{}
+	for pc := 0; pc < len(raw); {
+		ins, next, ok := readInstruction(raw, pc)
+		if !ok || ins.op > 96 {
+			return nil, false
+		}
+		result = append(result, ins.data)
+		pc = next
+	}
+
+	return result, true
+}
+
+// isValidPubKeySize is Bitcoin Core's CPubKey::ValidSize, the length a
+// public key with its prefix byte has.
+func isValidPubKeySize(pubKey []byte) bool {
+	if len(pubKey) == 0 {
+		return false
+	}
+
+	switch pubKey[0] {
+	case 2, 3:
+		return len(pubKey) == 33
+	case 4, 6, 7:
+		return len(pubKey) == 65
+	}
+
+	return false
+}
+
+// matchP2pk matches <pubkey> OP_CHECKSIG.
+func matchP2pk(raw []byte) ([]byte, bool) {
+	if len(raw) != 35 && len(raw) != 67 {
+		return nil, false
+	}
+
+	pubKey := raw[1 : len(raw)-1]
+	if int(raw[0]) != len(pubKey) || raw[len(raw)-1] != 0xac || !isValidPubKeySize(pubKey) {
+		return nil, false
+	}
+
+	return pubKey, true
+}
+
+// matchMultisig matches m <pubkey>... n OP_CHECKMULTISIG.
+func matchMultisig(raw []byte) (*ScriptData, bool) {
+	if len(raw) < 1 || raw[len(raw)-1] != 0xae {
+		return nil, false
+	}
+
+	ins, pc, ok := readInstruction(raw, 0)
+	if !ok {
+		return nil, false
+	}
+	required, ok := multisigNumber(ins, 1)
+	if !ok {
+		return nil, false
+	}
+
+	pubKeys := [][]byte{}
+	for {
+		ins, pc, ok = readInstruction(raw, pc)
+		if !ok || !isValidPubKeySize(ins.data) {
+			break
+		}
+		pubKeys = append(pubKeys, ins.data)
+		if pc >= len(raw) {
+			return nil, false
+		}
+	}
+	if !ok {
+		return nil, false
+	}
+
+	n, ok := multisigNumber(ins, required)
+	if !ok || n != len(pubKeys) || pc+1 != len(raw) {
+		return nil, false
+	}
+
+	return &ScriptData{PubKeys: pubKeys, Required: required}, true
+}
+
+// multisigNumber returns the number an OP_1-OP_16 or a minimal push gives
+// when it's from min up to the most keys a multisig takes.
+func multisigNumber(ins instruction, min int) (int, bool) {
+	var n int64
+	switch {
+	case ins.op >= 81 && ins.op <= 96:
+		n = int64(ins.op) - 80
+	case ins.op <= 78 && isMinimalPush(ins):
+		var err error
+		if n, err = decodeNum(ins.data, maxNumSize, true); err != nil {
+			return 0, false
+		}
+	default:
+		return 0, false
+	}
+
+	if n < int64(min) || n > maxPubKeysPerMultisig {
+		return 0, false
+	}
+
+	return int(n), true
+}
+
+// IsStandard reports whether nodes relay outputs paying to the script pubkey,
+// bare multisig takes at most three keys and nulldata at most 83 bytes.
+func IsStandard(scriptPubKey *Script) bool {
+	class, data := Classify(scriptPubKey)
+	switch class {
+	case TX_NONSTANDARD:
+		return false
+	case TX_MULTISIG:
+		return len(data.PubKeys) <= maxStandardMultisigKeys
+	case TX_NULL_DATA:
+		return len(scriptPubKey.RawSerialize()) <= maxDataCarrierSize
+	}
+
+	return true
+}
+
+// IsStandardScriptSig reports whether nodes relay a script sig, it has to
+// only push data and be at most 1650 bytes.
+func IsStandardScriptSig(scriptSig *Script) bool {
+	return len(scriptSig.RawSerialize()) <= maxStandardScriptSigSize && scriptSig.IsPushOnly()
+}
+
+// DustThreshold is the smallest amount an output paying to the script pubkey
+// isn't dust at, where spending it costs more than a third of it at the
+// default dust relay fee. Unspendable outputs have none.
+func DustThreshold(scriptPubKey *Script) uint64 {
+	raw := scriptPubKey.RawSerialize()
+	if (len(raw) > 0 && raw[0] == 0x6a) || len(raw) > maxScriptSize {
+		return 0
+	}
+
+	// the output and the input spending it, a witness counts a quarter
+	size := 8 + len(scriptPubKey.Serialize())
+	if isWitnessProgram(raw) {
+		size += 32 + 4 + 1 + 107/4 + 4
+	} else {
+		size += 32 + 4 + 1 + 107 + 4
+	}
+
+	return uint64(size) * dustRelayFeePerKvB / 1000
+}
@@ -0,0 +1,109 @@
+package script
+
+import (
+	"encoding/hex"
+	"strings"
+	"testing"
+)
+
+const (
+	testPubKey  = "0279be667ef9dcbbac55a06295ce870b07029bfcdb2dce28d959f2815b16f81798"
+	testPubKey2 = "02c6047f9441ed7d6d3045406e95c07cd85c778e4b8cef3ca7abac09b95c709ee5"
+	testHash160 = "751e76e8199196d454941c45d1b3a323f1433bd6"
+	testHash256 = "1863143c14c5166804bd19203356da136c985678cd4d27a1b8c6329604903262"
+)
+
+func mustParseASM(asm string, t *testing.T) *Script {
+	t.Helper()
+	s, err := ParseASM(asm)
+	check(nil, err, t)
+
+	return s
+}
+
+func decodeHex(s string, t *testing.T) []byte {
+	t.Helper()
+	b, err := hex.DecodeString(s)
+	check(nil, err, t)
+
+	return b
+}
+
+func TestClassify(t *testing.T) {
+	tests := []struct {
+		asm      string
+		class    ScriptClass
+		expected *ScriptData
+	}{
+		{"DUP HASH160 " + testHash160 + " EQUALVERIFY CHECKSIG", TX_PUBKEYHASH, &ScriptData{Hash: decodeHex(testHash160, t)}},
+		{"HASH160 " + testHash160 + " EQUAL", TX_SCRIPTHASH, &ScriptData{Hash: decodeHex(testHash160, t)}},
+		{"0 " + testHash160, TX_WITNESS_V0_KEYHASH, &ScriptData{Program: decodeHex(testHash160, t)}},
+		{"0 " + testHash256, TX_WITNESS_V0_SCRIPTHASH, &ScriptData{Program: decodeHex(testHash256, t)}},
+		{"1 " + testHash256, TX_WITNESS_V1_TAPROOT, &ScriptData{Version: 1, Program: decodeHex(testHash256, t)}},
+		{"2 abcd", TX_WITNESS_UNKNOWN, &ScriptData{Version: 2, Program: decodeHex("abcd", t)}},
+		{"1 " + testHash160, TX_WITNESS_UNKNOWN, &ScriptData{Version: 1, Program: decodeHex(testHash160, t)}},
+		{"0 " + testHash160 + "00", TX_NONSTANDARD, &ScriptData{}},
+		{testPubKey + " CHECKSIG", TX_PUBKEY, &ScriptData{PubKeys: [][]byte{decodeHex(testPubKey, t)}}},
+		{"1 " + testPubKey + " " + testPubKey2 + " 2 CHECKMULTISIG", TX_MULTISIG,
+			&ScriptData{PubKeys: [][]byte{decodeHex(testPubKey, t), decodeHex(testPubKey2, t)}, Required: 1}},
+		{"2 " + testPubKey + " 1 CHECKMULTISIG", TX_NONSTANDARD, &ScriptData{}},
+		{"1 " + testPubKey + " 1 CHECKMULTISIG CHECKMULTISIG", TX_NONSTANDARD, &ScriptData{}},
+		{"RETURN deadbeef", TX_NULL_DATA, &ScriptData{Data: [][]byte{decodeHex("deadbeef", t)}}},
+		{"RETURN", TX_NULL_DATA, &ScriptData{Data: [][]byte{}}},
+		{"RETURN DUP", TX_NONSTANDARD, &ScriptData{}},
+		{"0x4c14" + testHash160 + " CHECKSIG", TX_NONSTANDARD, &ScriptData{}},
+	}
+
+	for _, test := range tests {
+		class, data := Classify(mustParseASM(test.asm, t))
+		check(test.class, class, t)
+		check(test.expected, data, t)
+	}
+
+	check("witness_v0_keyhash", TX_WITNESS_V0_KEYHASH.String(), t)
+}
+
+func TestIsStandard(t *testing.T) {
+	keys := func(n int) string {
+		return strings.Repeat(testPubKey+" ", n)
+	}
+
+	tests := []struct {
+		asm      string
+		expected bool
+	}{
+		{"DUP HASH160 " + testHash160 + " EQUALVERIFY CHECKSIG", true},
+		{"2 abcd", true},
+		{"3 " + keys(3) + "3 CHECKMULTISIG", true},
+		{"1 " + keys(4) + "4 CHECKMULTISIG", false},
+		{"RETURN " + strings.Repeat("ab", 80), true},
+		{"RETURN " + strings.Repeat("ab", 81), false},
+		{"DUP DROP", false},
+	}
+
+	for _, test := range tests {
+		check(test.expected, IsStandard(mustParseASM(test.asm, t)), t)
+	}
+
+	check(true, IsStandardScriptSig(mustParseASM("0 "+testPubKey, t)), t)
+	check(false, IsStandardScriptSig(mustParseASM(testPubKey+" DUP", t)), t)
+	check(false, IsStandardScriptSig(mustParseASM(strings.Repeat(strings.Repeat("ab", 75)+" ", 22), t)), t)
+}
+
+func TestDustThreshold(t *testing.T) {
+	tests := []struct {
+		asm      string
+		expected uint64
+	}{
+		{"DUP HASH160 " + testHash160 + " EQUALVERIFY CHECKSIG", 546},
+		{"HASH160 " + testHash160 + " EQUAL", 540},
+		{"0 " + testHash160, 294},
+		{"0 " + testHash256, 330},
+		{"1 " + testHash256, 330},
+		{"RETURN deadbeef", 0},
+	}
+
+	for _, test := range tests {
+		check(test.expected, DustThreshold(mustParseASM(test.asm, t)), t)
+	}
+}
@@ -0,0 +1,259 @@
+package script
+
+import (
+	"bytes"
+	"errors"
+
+	u "github.com/lobiCode/prog_btc_go/btcutils"
+	c "github.com/lobiCode/prog_btc_go/cryptography"
+	ec "github.com/lobiCode/prog_btc_go/ellipticcurve"
+)
+
+var ErrTapLeafNotFound = errors.New("leaf not in tap tree")
+
+const (
+	TapscriptLeafVersion byte = 0xc0
+
+	annexTag                 = 0x50
+	maxScriptElementSize     = 520
+	validationWeightOffset   = 50
+	validationWeightPerSigOp = 50
+	controlBlockBaseSize     = 33
+	controlBlockNodeSize     = 32
+	taprootControlMaxNodes   = 128
+)
+
+// TapTree is a node of a taproot script tree, either a leaf with a script or
+// a branch with two children.
+type TapTree struct {
+	Script      *Script
+	LeafVersion byte
+	Left, Right *TapTree
+}
+
+func NewTapLeaf(s *Script) *TapTree {
+	return &TapTree{Script: s, LeafVersion: TapscriptLeafVersion}
+}
+
+func NewTapBranch(left, right *TapTree) *TapTree {
+	return &TapTree{Left: left, Right: right}
+}
+
+func (t *TapTree) IsLeaf() bool {
+	return t.Script != nil
+}
+
+func (t *TapTree) Hash() []byte {
+	if t.IsLeaf() {
+		return TapLeafHash(t.LeafVersion, t.Script.RawSerialize())
+	}
+
+	return tapBranchHash(t.Left.Hash(), t.Right.Hash())
+}
+
+// ControlBlock returns the control block that spends the output of
+// internalKey and the tree through leaf.
+func (t *TapTree) ControlBlock(internalKey *ec.Point, leaf *Script) ([]byte, error) {
+	leafVersion, path, ok := t.path(leaf.RawSerialize())
+	if !ok {
+		return nil, ErrTapLeafNotFound
+	}
+
+	outputKey, err := c.TaprootTweakPublicKey(internalKey, t.Hash())
+	if err != nil {
+		return nil, err
+	}
+
+	if !outputKey.IsYeven() {
+		leafVersion |= 0x01
+	}
+
+	result := []byte{leafVersion}
+	result = append(result, c.SerializeXOnly(internalKey)...)
+	for _, node := range path {
+		result = append(result, node...)
+	}
+
+	return result, nil
+}
+
+// path returns the leaf version of the leaf with the raw script and the hashes
+// of the siblings on the way from it to the root.
+func (t *TapTree) path(raw []byte) (byte, [][]byte, bool) {
+	if t.IsLeaf() {
+		return t.LeafVersion, nil, bytes.Equal(t.Script.RawSerialize(), raw)
+	}
+
+	if leafVersion, path, ok := t.Left.path(raw); ok {
+		return leafVersion, append(path, t.Right.Hash()), true
+	}
+
+	if leafVersion, path, ok := t.Right.path(raw); ok {
+		return leafVersion, append(path, t.Left.Hash()), true
+	}
+
+	return 0, nil, false
+}
+
+func TapLeafHash(leafVersion byte, script []byte) []byte {
+	return c.TaggedHash("TapLeaf", []byte{leafVersion}, u.EncodeVariant(len(script)), script)
+}
+
+func tapBranchHash(a, b []byte) []byte {
+	if bytes.Compare(a, b) > 0 {
+		a, b = b, a
+	}
+
+	return c.TaggedHash("TapBranch", a, b)
+}
+
+// P2trFromTree returns the P2TR script pubkey of internalKey committing to
+// tree, a nil tree leaves only the key path.
+func P2trFromTree(internalKey *ec.Point, tree *TapTree) (*Script, error) {
+	var merkleRoot []byte
+	if tree != nil {
+		merkleRoot = tree.Hash()
+	}
+
+	outputKey, err := c.TaprootTweakPublicKey(internalKey, merkleRoot)
+	if err != nil {
+		return nil, err
+	}
+
+	return P2tr(c.SerializeXOnly(outputKey)), nil
+}
+
+// taprootScript verifies a taproot spend, the key path one completely, and
+// returns the tapscript of a script path spend with its stack.
+func taprootScript(ctx *context, program []byte, witness [][]byte) (*Script, [][]byte, error) {
+	if len(witness) == 0 {
+		return nil, nil, ErrWitnessProgramWitnessEmpty
+	}
+
+	stack := witness
+	if last := stack[len(stack)-1]; len(stack) >= 2 && len(last) > 0 && last[0] == annexTag {
+		stack = stack[:len(stack)-1]
+	}
+
+	if len(stack) == 1 {
+		return nil, nil, checkSchnorrSignature(ctx, stack[0], program)
+	}
+
+	control := stack[len(stack)-1]
+	tapscript := stack[len(stack)-2]
+	stack = stack[:len(stack)-2]
+
+	if !isValidControlBlockSize(control) {
+		return nil, nil, ErrTaprootWrongControlSize
+	}
+
+	leafHash, ok := verifyTaprootCommitment(control, program, tapscript)
+	if !ok {
+		return nil, nil, ErrWitnessProgramMismatch
+	}
+
+	// unknown leaf versions are left for future soft forks
+	if control[0]&0xfe != TapscriptLeafVersion {
+		if ctx.flags.has(SCRIPT_VERIFY_DISCOURAGE_UPGRADABLE_TAPROOT_VERSION) {
+			return nil, nil, ErrDiscourageUpgradableTaprootVersion
+		}
+		return nil, nil, nil
+	}
+
+	success, ok := hasOpSuccess(tapscript)
+	if !ok {
+		return nil, nil, ErrBadOpcode
+	}
+	if success {
+		if ctx.flags.has(SCRIPT_VERIFY_DISCOURAGE_OP_SUCCESS) {
+			return nil, nil, ErrDiscourageOpSuccess
+		}
+		return nil, nil, nil
+	}
+
+	if len(stack) > maxStackSize {
+		return nil, nil, ErrStackSize
+	}
+
+	ctx.sigVersion = sigVersionTapscript
+	ctx.leafHash = leafHash
+	ctx.codeSepPos = 0xffffffff
+	ctx.validationWeight = witnessSize(witness) + validationWeightOffset
+
+	return newScript(tapscript), stack, nil
+}
+
+func isValidControlBlockSize(control []byte) bool {
+	l := len(control)
+
+	return l >= controlBlockBaseSize && (l-controlBlockBaseSize)%controlBlockNodeSize == 0 &&
+		(l-controlBlockBaseSize)/controlBlockNodeSize <= taprootControlMaxNodes
+}
+
+// verifyTaprootCommitment checks that the control block proves tapscript is
+// committed to by the output key program and returns the leaf hash.
+func verifyTaprootCommitment(control, program, tapscript []byte) ([]byte, bool) {
+	l := len(control)
+	if !isValidControlBlockSize(control) {
+		return nil, false
+	}
+
+	internalKey, err := c.ParseXOnlyPublicKey(control[1:controlBlockBaseSize])
+	if err != nil {
+		return nil, false
+	}
+
+	leafHash := TapLeafHash(control[0]&0xfe, tapscript)
+	k := leafHash
+	for i := controlBlockBaseSize; i < l; i += controlBlockNodeSize {
+		k = tapBranchHash(k, control[i:i+controlBlockNodeSize])
+	}
+
+	outputKey, err := c.TaprootTweakPublicKey(internalKey, k)
+	if err != nil {
+		return nil, false
+	}
+
+	if !bytes.Equal(c.SerializeXOnly(outputKey), program) {
+		return nil, false
+	}
+
+	if outputKey.IsYeven() != (control[0]&0x01 == 0) {
+		return nil, false
+	}
+
+	return leafHash, true
+}
+
+// hasOpSuccess reports whether the script contains an OP_SUCCESSx opcode, ok
+// is false when a push runs past the end of the script before one is found.
+func hasOpSuccess(script []byte) (success, ok bool) {
+	for pc := 0; pc < len(script); {
+		ins, next, ok := readInstruction(script, pc)
+		if !ok {
+			return false, false
+		}
+		if isOpSuccess(ins.op) {
+			return true, true
+		}
+		pc = next
+	}
+
+	return false, true
+}
+
+func isOpSuccess(op byte) bool {
+	return op == 80 || op == 98 || (op >= 126 && op <= 129) ||
+		(op >= 131 && op <= 134) || (op >= 137 && op <= 138) ||
+		(op >= 141 && op <= 142) || (op >= 149 && op <= 153) ||
+		(op >= 187 && op <= 254)
+}
+
+func witnessSize(witness [][]byte) int {
+	size := len(u.EncodeVariant(len(witness)))
+	for _, item := range witness {
+		size += len(u.EncodeVariant(len(item))) + len(item)
+	}
+
+	return size
+}
@@ -0,0 +1,483 @@
+package tx
+
+import (
+	"errors"
+	"math/rand"
+	"sort"
+
+	u "github.com/lobiCode/prog_btc_go/btcutils"
+	"github.com/lobiCode/prog_btc_go/script"
+)
+
+var ErrTxInsufficientFunds = errors.New("not enough funds for the outputs and the fee")
+var ErrTxInputWeight = errors.New("can't estimate the weight of the input")
+var ErrTxNoOutputs = errors.New("no outputs to pay")
+var ErrTxNoChangeScript = errors.New("no change script")
+
+// DefaultLongTermFeeRate is the fee rate in sat/vB the coins are expected to
+// be spent at later, when none is given.
+const DefaultLongTermFeeRate = 10
+
+const bnbMaxTries = 100000
+const knapsackIterations = 1000
+
+// the signed sizes of the inputs the builder knows, for the worst case 73
+// byte signature with its sighash type
+const (
+	p2pkWeight          = (32 + 4 + 1 + 74 + 4) * 4
+	p2pkhWeight         = (32 + 4 + 1 + 108 + 4) * 4
+	p2wpkhWeight        = (32+4+1+4)*4 + 1 + 74 + 34
+	p2trKeyPathWeight   = (32+4+1+4)*4 + 1 + 65
+	witnessHeaderWeight = 2
+)
+
+// Utxo is an output the builder can spend.
+type Utxo struct {
+	OutPoint
+	TxOut *TxOut
+	// InputWeight is the weight of the signed input spending the output, it
+	// is estimated for P2PK, P2PKH, P2WPKH and P2TR key path spends when 0.
+	// The other outputs aren't spent without it.
+	InputWeight int
+	// Witness tells whether the input has a witness, with InputWeight
+	Witness bool
+}
+
+// TxBuilder builds an unsigned transaction paying Outputs with some of Utxos
+// at FeeRate sat/vB. The coins are selected with Branch and Bound looking for
+// a spend without change, and with knapsack and single random draw ones that
+// send the rest to ChangeScript, keeping the selection that wastes the least.
+type TxBuilder struct {
+	Utxos        []*Utxo
+	Outputs      []*TxOut
+	FeeRate      uint64
+	ChangeScript *script.Script
+	// LongTermFeeRate is used to tell whether spending more inputs now is
+	// cheaper than later, DefaultLongTermFeeRate when 0
+	LongTermFeeRate uint64
+	Version         uint32
+	Locktime        uint32
+	// Rand shuffles the coins of the random selections, the global source
+	// when nil
+	Rand *rand.Rand
+}
+
+type coin struct {
+	utxo    *Utxo
+	weight  int
+	witness bool
+	// value is the amount less the fee of the input
+	value       int64
+	fee         int64
+	longTermFee int64
+}
+
+type selection struct {
+	coins     []*coin
+	value     int64
+	hasChange bool
+	waste     int64
+}
+
+// inputWeight returns the weight of the signed input spending utxo and
+// whether it has a witness.
+func inputWeight(utxo *Utxo) (int, bool, error) {
+	if utxo.InputWeight > 0 {
+		return utxo.InputWeight, utxo.Witness, nil
+	}
+
+	class, _ := script.Classify(utxo.TxOut.ScriptPubKey)
+	switch class {
+	case script.TX_PUBKEY:
+		return p2pkWeight, false, nil
+	case script.TX_PUBKEYHASH:
+		return p2pkhWeight, false, nil
+	case script.TX_WITNESS_V0_KEYHASH:
+		return p2wpkhWeight, true, nil
+	case script.TX_WITNESS_V1_TAPROOT:
+		return p2trKeyPathWeight, true, nil
+	}
+
+	return 0, false, ErrTxInputWeight
+}
+
+// feeOf returns the fee of weight at rate sat/vB, the virtual size rounded
+// up like Bitcoin Core does.
+func feeOf(weight int, rate uint64) int64 {
+	return int64(uint64(weight+3) / 4 * rate)
+}
+
+func outputWeight(txOut *TxOut) int {
+	return len(txOut.Serialize()) * 4
+}
+
+// baseWeight is the weight of a transaction without its inputs.
+func (b *TxBuilder) baseWeight(inputs int, outputs []*TxOut, witness bool) int {
+	weight := (4 + len(u.EncodeVariant(inputs)) + len(u.EncodeVariant(len(outputs))) + 4) * 4
+	for _, txOut := range outputs {
+		weight += outputWeight(txOut)
+	}
+	if witness {
+		weight += witnessHeaderWeight
+	}
+
+	return weight
+}
+
+// FetchPrevOut makes the builder a PrevOutFetcher of its Utxos, to sign and
+// verify the built transaction with.
+func (b *TxBuilder) FetchPrevOut(txId string, index uint32) (*TxOut, error) {
+	for _, utxo := range b.Utxos {
+		if utxo.TxId == txId && utxo.Index == index {
+			return utxo.TxOut, nil
+		}
+	}
+
+	return nil, ErrTxPrevOutNotFound
+}
+
+// Build returns the unsigned transaction and its fee.
+func (b *TxBuilder) Build() (*Tx, uint64, error) {
+	if len(b.Outputs) == 0 {
+		return nil, 0, ErrTxNoOutputs
+	}
+	if b.ChangeScript == nil {
+		return nil, 0, ErrTxNoChangeScript
+	}
+	for _, txOut := range b.Outputs {
+		if txOut.IsDust() {
+			return nil, 0, ErrTxDust
+		}
+	}
+
+	longTermFeeRate := b.LongTermFeeRate
+	if longTermFeeRate == 0 {
+		longTermFeeRate = DefaultLongTermFeeRate
+	}
+
+	coins, witness, skipped := b.coins(longTermFeeRate)
+
+	var payment int64
+	for _, txOut := range b.Outputs {
+		payment += int64(txOut.Amount)
+	}
+	// estimated with a one byte input count, the inputs pay for the rest
+	target := payment + feeOf(b.baseWeight(1, b.Outputs, witness), b.FeeRate)
+
+	changeOut := &TxOut{ScriptPubKey: b.ChangeScript}
+	changeFee := feeOf(outputWeight(changeOut), b.FeeRate)
+	costOfChange := changeFee
+	if weight, _, err := inputWeight(&Utxo{TxOut: changeOut}); err == nil {
+		costOfChange += feeOf(weight, longTermFeeRate)
+	}
+	// the change left after paying for its output isn't dust
+	changeTarget := changeFee + int64(script.DustThreshold(b.ChangeScript))
+
+	selections := []*selection{}
+	if s := selectBnB(coins, target, costOfChange); s != nil {
+		selections = append(selections, s)
+	}
+	if s := b.selectKnapsack(coins, target+changeTarget); s != nil {
+		s.hasChange = true
+		selections = append(selections, s)
+	}
+	if s := b.selectSRD(coins, target+changeTarget); s != nil {
+		s.hasChange = true
+		selections = append(selections, s)
+	}
+	if len(selections) == 0 {
+		if skipped {
+			return nil, 0, ErrTxInputWeight
+		}
+		return nil, 0, ErrTxInsufficientFunds
+	}
+
+	var best *selection
+	for _, s := range selections {
+		s.waste = waste(s, target, costOfChange)
+		if best == nil || s.waste < best.waste {
+			best = s
+		}
+	}
+
+	return b.assemble(best.coins, payment)
+}
+
+// coins returns the UTXOs worth more than the fee of spending them, and
+// whether some were skipped for their unknown weight.
+func (b *TxBuilder) coins(longTermFeeRate uint64) ([]*coin, bool, bool) {
+	coins := []*coin{}
+	witness, skipped := false, false
+	for _, utxo := range b.Utxos {
+		weight, w, err := inputWeight(utxo)
+		if err != nil {
+			skipped = true
+			continue
+		}
+		witness = witness || w
+		coins = append(coins, &coin{utxo: utxo, weight: weight, witness: w})
+	}
+
+	positive := coins[:0]
+	for _, c := range coins {
+		// a legacy input of a segwit transaction has an empty witness
+		weight := c.weight
+		if witness && !c.witness {
+			weight++
+		}
+		c.fee = feeOf(weight, b.FeeRate)
+		c.longTermFee = feeOf(weight, longTermFeeRate)
+		c.value = int64(c.utxo.TxOut.Amount) - c.fee
+		if c.value > 0 {
+			positive = append(positive, c)
+		}
+	}
+
+	return positive, witness, skipped
+}
+
+// waste is what a selection costs more than spending its coins at the long
+// term fee rate: the change, or the excess given to the fee without it.
+func waste(s *selection, target, costOfChange int64) int64 {
+	var w int64
+	for _, c := range s.coins {
+		w += c.fee - c.longTermFee
+	}
+	if s.hasChange {
+		return w + costOfChange
+	}
+
+	return w + s.value - target
+}
+
+// selectBnB searches for the coins adding up to between target and target
+// plus the cost of a change, so that the excess can go to the fee.
+func selectBnB(coins []*coin, target, costOfChange int64) *selection {
+	sorted := append([]*coin{}, coins...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].value > sorted[j].value
+	})
+
+	// remaining[i] is the value of the coins from i on
+	remaining := make([]int64, len(sorted)+1)
+	for i := len(sorted) - 1; i >= 0; i-- {
+		remaining[i] = remaining[i+1] + sorted[i].value
+	}
+
+	var best []*coin
+	var bestWaste int64
+	tries := 0
+	current := []*coin{}
+
+	var search func(i int, value, currentWaste int64)
+	search = func(i int, value, currentWaste int64) {
+		tries++
+		if tries > bnbMaxTries || value+remaining[i] < target || value > target+costOfChange {
+			return
+		}
+		if value >= target {
+			w := currentWaste + value - target
+			if best == nil || w < bestWaste {
+				best, bestWaste = append([]*coin{}, current...), w
+			}
+			return
+		}
+		if i == len(sorted) {
+			return
+		}
+
+		c := sorted[i]
+		current = append(current, c)
+		search(i+1, value+c.value, currentWaste+c.fee-c.longTermFee)
+		current = current[:len(current)-1]
+		search(i+1, value, currentWaste)
+	}
+	search(0, 0, 0)
+
+	if best == nil {
+		return nil
+	}
+
+	return newSelection(best)
+}
+
+func (b *TxBuilder) shuffled(coins []*coin) []*coin {
+	shuffled := append([]*coin{}, coins...)
+	shuffle := rand.Shuffle
+	if b.Rand != nil {
+		shuffle = b.Rand.Shuffle
+	}
+	shuffle(len(shuffled), func(i, j int) {
+		shuffled[i], shuffled[j] = shuffled[j], shuffled[i]
+	})
+
+	return shuffled
+}
+
+func (b *TxBuilder) intn(n int) int {
+	if b.Rand != nil {
+		return b.Rand.Intn(n)
+	}
+
+	return rand.Intn(n)
+}
+
+// selectSRD draws coins at random until they reach target.
+func (b *TxBuilder) selectSRD(coins []*coin, target int64) *selection {
+	shuffled := b.shuffled(coins)
+
+	var value int64
+	for i, c := range shuffled {
+		value += c.value
+		if value >= target {
+			return newSelection(shuffled[:i+1])
+		}
+	}
+
+	return nil
+}
+
+// selectKnapsack picks a coin matching target alone, or the subset of the
+// smaller coins closest above it when it is smaller than the smallest larger
+// coin, like the knapsack solver of Bitcoin Core.
+func (b *TxBuilder) selectKnapsack(coins []*coin, target int64) *selection {
+	var lowestLarger *coin
+	smaller := []*coin{}
+	var smallerValue int64
+	for _, c := range b.shuffled(coins) {
+		switch {
+		case c.value == target:
+			return newSelection([]*coin{c})
+		case c.value < target:
+			smaller = append(smaller, c)
+			smallerValue += c.value
+		case lowestLarger == nil || c.value < lowestLarger.value:
+			lowestLarger = c
+		}
+	}
+
+	if smallerValue == target {
+		return newSelection(smaller)
+	}
+	if smallerValue < target {
+		if lowestLarger == nil {
+			return nil
+		}
+		return newSelection([]*coin{lowestLarger})
+	}
+
+	sort.SliceStable(smaller, func(i, j int) bool {
+		return smaller[i].value > smaller[j].value
+	})
+	subset, value := b.approximateBestSubset(smaller, smallerValue, target)
+	if lowestLarger != nil && value != target && lowestLarger.value <= value {
+		return newSelection([]*coin{lowestLarger})
+	}
+
+	return newSelection(subset)
+}
+
+// approximateBestSubset tries random subsets of the coins, worth total
+// together, for the one with the smallest value reaching target.
+func (b *TxBuilder) approximateBestSubset(coins []*coin, total, target int64) ([]*coin, int64) {
+	best := make([]bool, len(coins))
+	for i := range best {
+		best[i] = true
+	}
+	bestValue := total
+
+	for rep := 0; rep < knapsackIterations && bestValue != target; rep++ {
+		included := make([]bool, len(coins))
+		var value int64
+		reached := false
+		// the second pass adds the coins the first one left out
+		for pass := 0; pass < 2 && !reached; pass++ {
+			for i, c := range coins {
+				if included[i] || (pass == 0 && b.intn(2) == 0) {
+					continue
+				}
+				value += c.value
+				included[i] = true
+				if value >= target {
+					reached = true
+					if value < bestValue {
+						bestValue = value
+						copy(best, included)
+					}
+					value -= c.value
+					included[i] = false
+				}
+			}
+		}
+	}
+
+	subset := []*coin{}
+	for i, c := range coins {
+		if best[i] {
+			subset = append(subset, c)
+		}
+	}
+
+	return subset, bestValue
+}
+
+func newSelection(coins []*coin) *selection {
+	s := &selection{coins: coins}
+	for _, c := range coins {
+		s.value += c.value
+	}
+
+	return s
+}
+
+// assemble returns the transaction spending the coins, with a change output
+// when what is left after the fee isn't dust.
+func (b *TxBuilder) assemble(coins []*coin, payment int64) (*Tx, uint64, error) {
+	tx := &Tx{Version: b.Version, Locktime: b.Locktime}
+	if tx.Version == 0 {
+		tx.Version = 2
+	}
+
+	witness := false
+	for _, c := range coins {
+		witness = witness || c.witness
+	}
+
+	var total int64
+	weight := 0
+	for _, c := range coins {
+		tx.TxIns = append(tx.TxIns, &TxIn{
+			PreTxId:   c.utxo.TxId,
+			PreTxIdx:  c.utxo.Index,
+			ScriptSig: &script.Script{},
+			Sequence:  0xffffffff,
+		})
+		total += int64(c.utxo.TxOut.Amount)
+		weight += c.weight
+		if witness && !c.witness {
+			weight++
+		}
+	}
+	tx.TxOuts = append(tx.TxOuts, b.Outputs...)
+
+	fee := feeOf(weight+b.baseWeight(len(coins), tx.TxOuts, witness), b.FeeRate)
+	if total < payment+fee {
+		return nil, 0, ErrTxInsufficientFunds
+	}
+
+	change := &TxOut{ScriptPubKey: b.ChangeScript}
+	outputs := append(append([]*TxOut{}, b.Outputs...), change)
+	feeWithChange := feeOf(weight+b.baseWeight(len(coins), outputs, witness), b.FeeRate)
+	if amount := total - payment - feeWithChange; amount > 0 {
+		change.Amount = uint64(amount)
+		if !change.IsDust() {
+			tx.TxOuts = outputs
+			fee = feeWithChange
+		}
+	}
+	if len(tx.TxOuts) == len(b.Outputs) {
+		fee = total - payment
+	}
+
+	return tx, uint64(fee), nil
+}
@@ -0,0 +1,174 @@
+package tx
+
+import (
+	"fmt"
+	"math/rand"
+	"strings"
+	"testing"
+
+	u "github.com/lobiCode/prog_btc_go/btcutils"
+	c "github.com/lobiCode/prog_btc_go/cryptography"
+	"github.com/lobiCode/prog_btc_go/script"
+)
+
+var builderKey = c.NewPrivateKey(u.NewInt(8675309))
+
+func builderUtxos(scriptPubKey *script.Script, amounts ...uint64) []*Utxo {
+	utxos := []*Utxo{}
+	for i, amount := range amounts {
+		utxos = append(utxos, &Utxo{
+			OutPoint: OutPoint{TxId: strings.Repeat(fmt.Sprintf("%02x", i+1), 32), Index: uint32(i)},
+			TxOut:    &TxOut{Amount: amount, ScriptPubKey: scriptPubKey},
+		})
+	}
+
+	return utxos
+}
+
+// checkSigned signs the transaction and checks that it is no heavier than
+// its fee pays for.
+func checkSigned(transaction *Tx, fee uint64, b *TxBuilder, t *testing.T) {
+	t.Helper()
+	check(nil, transaction.SingInputs(b, builderKey), t)
+	check(nil, transaction.Verify(b), t)
+
+	paid, err := transaction.Fee(b)
+	check(nil, err, t)
+	check(fee, paid, t)
+	check(true, fee >= uint64(transaction.VSize())*b.FeeRate, t)
+}
+
+func TestBuildWithoutChange(t *testing.T) {
+	p2wpkh := script.P2wpkh(u.Hash160(builderKey.Sec(true)))
+	payment := &TxOut{Amount: 50000, ScriptPubKey: script.P2wpkh(make([]byte, 20))}
+
+	// at 1 sat/vB a P2WPKH input costs 69 and the rest of the transaction
+	// 42, the two small coins pay the output exactly
+	b := &TxBuilder{
+		Utxos:        builderUtxos(p2wpkh, 1000000, 30000+69, 20000+42+69),
+		Outputs:      []*TxOut{payment},
+		FeeRate:      1,
+		ChangeScript: p2wpkh,
+		Rand:         rand.New(rand.NewSource(1)),
+	}
+	transaction, fee, err := b.Build()
+	check(nil, err, t)
+	check(2, len(transaction.TxIns), t)
+	check([]*TxOut{payment}, transaction.TxOuts, t)
+	check(uint64(180), fee, t)
+	checkSigned(transaction, fee, b, t)
+}
+
+func TestBuildChange(t *testing.T) {
+	p2wpkh := script.P2wpkh(u.Hash160(builderKey.Sec(true)))
+	p2pkh := script.P2pkh(u.Hash160(builderKey.Sec(true)))
+	change := script.P2tr(make([]byte, 32))
+
+	for _, test := range []struct {
+		utxos   []*Utxo
+		feeRate uint64
+	}{
+		{builderUtxos(p2wpkh, 300000), 5},
+		{builderUtxos(p2wpkh, 40000, 80000, 70000, 25000), 12},
+		{builderUtxos(p2pkh, 90000, 150000), 3},
+		{append(builderUtxos(p2pkh, 60000), builderUtxos(p2wpkh, 0, 50000)[1:]...), 20},
+	} {
+		b := &TxBuilder{
+			Utxos:        test.utxos,
+			Outputs:      []*TxOut{{Amount: 100000, ScriptPubKey: script.P2wpkh(make([]byte, 20))}},
+			FeeRate:      test.feeRate,
+			ChangeScript: change,
+			Rand:         rand.New(rand.NewSource(1)),
+		}
+		transaction, fee, err := b.Build()
+		check(nil, err, t)
+		check(2, len(transaction.TxOuts), t)
+		check(change, transaction.TxOuts[1].ScriptPubKey, t)
+		check(false, transaction.TxOuts[1].IsDust(), t)
+		checkSigned(transaction, fee, b, t)
+	}
+}
+
+func TestBuildDustChange(t *testing.T) {
+	p2wpkh := script.P2wpkh(u.Hash160(builderKey.Sec(true)))
+
+	// 200 sats left over, less than a P2WPKH change output is worth
+	b := &TxBuilder{
+		Utxos:        builderUtxos(p2wpkh, 50000+42+69+200),
+		Outputs:      []*TxOut{{Amount: 50000, ScriptPubKey: script.P2wpkh(make([]byte, 20))}},
+		FeeRate:      1,
+		ChangeScript: p2wpkh,
+	}
+	transaction, fee, err := b.Build()
+	check(nil, err, t)
+	check(1, len(transaction.TxOuts), t)
+	check(uint64(42+69+200), fee, t)
+	checkSigned(transaction, fee, b, t)
+}
+
+func TestBuildErrors(t *testing.T) {
+	p2wpkh := script.P2wpkh(u.Hash160(builderKey.Sec(true)))
+	payment := []*TxOut{{Amount: 50000, ScriptPubKey: p2wpkh}}
+
+	_, _, err := (&TxBuilder{Utxos: builderUtxos(p2wpkh, 50000), Outputs: payment, FeeRate: 1, ChangeScript: p2wpkh}).Build()
+	check(ErrTxInsufficientFunds, err, t)
+
+	_, _, err = (&TxBuilder{Utxos: builderUtxos(p2wpkh, 100000), FeeRate: 1, ChangeScript: p2wpkh}).Build()
+	check(ErrTxNoOutputs, err, t)
+
+	_, _, err = (&TxBuilder{Utxos: builderUtxos(p2wpkh, 100000), Outputs: payment, FeeRate: 1}).Build()
+	check(ErrTxNoChangeScript, err, t)
+
+	dust := []*TxOut{{Amount: 100, ScriptPubKey: p2wpkh}}
+	_, _, err = (&TxBuilder{Utxos: builderUtxos(p2wpkh, 100000), Outputs: dust, FeeRate: 1, ChangeScript: p2wpkh}).Build()
+	check(ErrTxDust, err, t)
+
+	// a P2WSH input needs its weight
+	utxos := builderUtxos(script.P2wsh(make([]byte, 32)), 100000)
+	_, _, err = (&TxBuilder{Utxos: utxos, Outputs: payment, FeeRate: 1, ChangeScript: p2wpkh}).Build()
+	check(ErrTxInputWeight, err, t)
+
+	// coins of unknown weight are left out when the others are enough
+	mixed := builderUtxos(p2wpkh, 100000, 80000)
+	mixed[0].TxOut.ScriptPubKey = script.P2wsh(make([]byte, 32))
+	b := &TxBuilder{
+		Utxos:        mixed,
+		Outputs:      payment,
+		FeeRate:      1,
+		ChangeScript: p2wpkh,
+	}
+	transaction, fee, err := b.Build()
+	check(nil, err, t)
+	check(1, len(transaction.TxIns), t)
+	check(mixed[1].OutPoint, OutPoint{transaction.TxIns[0].PreTxId, transaction.TxIns[0].PreTxIdx}, t)
+	checkSigned(transaction, fee, b, t)
+
+	utxos[0].InputWeight, utxos[0].Witness = 500, true
+	transaction, fee, err = (&TxBuilder{Utxos: utxos, Outputs: payment, FeeRate: 2, ChangeScript: p2wpkh}).Build()
+	check(nil, err, t)
+	// 500 for the input and 290 for the rest with the change, 198 vB
+	check(uint64(2*198), fee, t)
+	check(uint64(100000-50000)-fee, transaction.TxOuts[1].Amount, t)
+}
+
+func TestSelectCoins(t *testing.T) {
+	coins := []*coin{}
+	for _, value := range []int64{5, 10, 20, 40} {
+		coins = append(coins, &coin{value: value})
+	}
+	b := &TxBuilder{Rand: rand.New(rand.NewSource(1))}
+
+	check(int64(25), selectBnB(coins, 25, 0).value, t)
+	check(int64(35), selectBnB(coins, 33, 2).value, t)
+	check((*selection)(nil), selectBnB(coins, 33, 1), t)
+
+	check(int64(25), b.selectKnapsack(coins, 25).value, t)
+	check(int64(40), b.selectKnapsack(coins, 40).value, t)
+	check(int64(40), b.selectKnapsack(coins, 36).value, t)
+	check((*selection)(nil), b.selectKnapsack(coins, 76), t)
+
+	for target := int64(1); target <= 75; target++ {
+		check(true, b.selectSRD(coins, target).value >= target, t)
+	}
+	check((*selection)(nil), b.selectSRD(coins, 76), t)
+}
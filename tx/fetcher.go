@@ -0,0 +1,100 @@
+package tx
+
+import (
+	"errors"
+	"sync"
+
+	"github.com/lobiCode/prog_btc_go/chaincfg"
+)
+
+var ErrTxPrevOutNotFound = errors.New("previous output not found")
+var ErrTxIdMismatch = errors.New("fetched transaction has another id")
+
+// PrevOutFetcher returns the output at index of transaction txId, the
+// output an input spends. It can be backed by anything that knows the
+// outputs: a map, a UTXO database, a block file index or an explorer.
+type PrevOutFetcher interface {
+	FetchPrevOut(txId string, index uint32) (*TxOut, error)
+}
+
+// OutPoint is an output of a transaction.
+type OutPoint struct {
+	TxId  string
+	Index uint32
+}
+
+// MapFetcher is a PrevOutFetcher of outputs kept in memory.
+type MapFetcher map[OutPoint]*TxOut
+
+// Add stores the output at index of transaction txId.
+func (m MapFetcher) Add(txId string, index uint32, txOut *TxOut) {
+	m[OutPoint{txId, index}] = txOut
+}
+
+// AddTx stores every output of tx.
+func (m MapFetcher) AddTx(tx *Tx) {
+	txId := tx.TxId()
+	for i, txOut := range tx.TxOuts {
+		m.Add(txId, uint32(i), txOut)
+	}
+}
+
+func (m MapFetcher) FetchPrevOut(txId string, index uint32) (*TxOut, error) {
+	txOut, ok := m[OutPoint{txId, index}]
+	if !ok {
+		return nil, ErrTxPrevOutNotFound
+	}
+
+	return txOut, nil
+}
+
+// TxFetcherFunc is a PrevOutFetcher that looks up whole transactions by id.
+// The transaction it returns is checked against the id.
+type TxFetcherFunc func(txId string) (*Tx, error)
+
+func (f TxFetcherFunc) FetchPrevOut(txId string, index uint32) (*TxOut, error) {
+	tx, err := f(txId)
+	if err != nil {
+		return nil, err
+	}
+
+	if tx.TxId() != txId {
+		return nil, ErrTxIdMismatch
+	}
+	if int(index) >= len(tx.TxOuts) {
+		return nil, ErrTxPrevOutNotFound
+	}
+
+	return tx.TxOuts[index], nil
+}
+
+// CachedTxFetcher returns a TxFetcherFunc that looks up each transaction
+// with f once, failed lookups are tried again.
+func CachedTxFetcher(f TxFetcherFunc) TxFetcherFunc {
+	var mu sync.Mutex
+	cache := map[string]*Tx{}
+
+	return func(txId string) (*Tx, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		if tx, ok := cache[txId]; ok {
+			return tx, nil
+		}
+
+		tx, err := f(txId)
+		if err != nil {
+			return nil, err
+		}
+		cache[txId] = tx
+
+		return tx, nil
+	}
+}
+
+// NewExplorerFetcher returns a PrevOutFetcher that downloads the previous
+// transactions of a network with FetchTx, each of them once.
+func NewExplorerFetcher(params *chaincfg.Params) PrevOutFetcher {
+	return CachedTxFetcher(func(txId string) (*Tx, error) {
+		return FetchTx(txId, params)
+	})
+}
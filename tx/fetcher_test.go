@@ -0,0 +1,120 @@
+package tx
+
+import (
+	"testing"
+
+	u "github.com/lobiCode/prog_btc_go/btcutils"
+	c "github.com/lobiCode/prog_btc_go/cryptography"
+	"github.com/lobiCode/prog_btc_go/script"
+)
+
+func TestMapFetcher(t *testing.T) {
+	key := c.NewPrivateKey(u.NewInt(8675309))
+	credit := creditingTx(script.P2wpkh(u.Hash160(key.Sec(true))), 100000)
+
+	spend := &Tx{
+		Version: 2,
+		TxIns:   []*TxIn{{PreTxId: credit.TxId(), PreTxIdx: 0, Sequence: 0xffffffff}},
+		TxOuts:  []*TxOut{{Amount: 90000, ScriptPubKey: script.P2pkh(u.Hash160(key.Sec(true)))}},
+	}
+
+	_, err := spend.Fee(MapFetcher{})
+	check(ErrTxPrevOutNotFound, err, t)
+
+	prevOuts := MapFetcher{}
+	prevOuts.AddTx(credit)
+	check(nil, spend.SingInputs(prevOuts, key), t)
+	check(nil, spend.Verify(prevOuts), t)
+
+	fee, err := spend.Fee(prevOuts)
+	check(nil, err, t)
+	check(uint64(10000), fee, t)
+}
+
+func TestTxFetcherFunc(t *testing.T) {
+	credit := creditingTx(script.P2pkh(make([]byte, 20)), 100000)
+	fetcher := TxFetcherFunc(func(txId string) (*Tx, error) {
+		return credit, nil
+	})
+
+	txOut, err := fetcher.FetchPrevOut(credit.TxId(), 0)
+	check(nil, err, t)
+	check(credit.TxOuts[0], txOut, t)
+
+	_, err = fetcher.FetchPrevOut(credit.TxId(), 1)
+	check(ErrTxPrevOutNotFound, err, t)
+
+	// a transaction with another id than asked for
+	other := creditingTx(script.P2pkh(make([]byte, 20)), 100001)
+	_, err = fetcher.FetchPrevOut(other.TxId(), 0)
+	check(ErrTxIdMismatch, err, t)
+}
+
+func TestCachedTxFetcher(t *testing.T) {
+	key := c.NewPrivateKey(u.NewInt(8675309))
+	p2pkh := script.P2pkh(u.Hash160(key.Sec(true)))
+	p2tr, err := script.P2trFromTree(key.Point(), nil)
+	check(nil, err, t)
+	credits := []*Tx{creditingTx(p2pkh, 100000), creditingTx(p2tr, 100001), creditingTx(p2tr, 100002)}
+
+	fetches := map[string]int{}
+	fetcher := CachedTxFetcher(func(txId string) (*Tx, error) {
+		fetches[txId]++
+		for _, credit := range credits {
+			if credit.TxId() == txId {
+				return credit, nil
+			}
+		}
+		return nil, ErrTxPrevOutNotFound
+	})
+
+	spend := &Tx{Version: 2, TxOuts: []*TxOut{{Amount: 250000, ScriptPubKey: p2pkh}}}
+	for _, credit := range credits {
+		spend.TxIns = append(spend.TxIns, &TxIn{PreTxId: credit.TxId(), Sequence: 0xffffffff})
+	}
+	check(nil, spend.SingInputs(fetcher, key), t)
+	check(nil, spend.Verify(fetcher), t)
+
+	// signing and verifying fetch each previous transaction once
+	check(len(credits), len(fetches), t)
+	for _, credit := range credits {
+		check(1, fetches[credit.TxId()], t)
+	}
+
+	_, err = fetcher.FetchPrevOut(credits[0].TxId(), 1)
+	check(ErrTxPrevOutNotFound, err, t)
+	check(1, fetches[credits[0].TxId()], t)
+}
+
+type countingFetcher struct {
+	MapFetcher
+	fetches int
+}
+
+func (f *countingFetcher) FetchPrevOut(txId string, idx uint32) (*TxOut, error) {
+	f.fetches++
+	return f.MapFetcher.FetchPrevOut(txId, idx)
+}
+
+func TestSigHashCacheFetches(t *testing.T) {
+	key := c.NewPrivateKey(u.NewInt(8675309))
+	p2tr, err := script.P2trFromTree(key.Point(), nil)
+	check(nil, err, t)
+
+	fetcher := &countingFetcher{MapFetcher: MapFetcher{}}
+	spend := &Tx{Version: 2, TxOuts: []*TxOut{{Amount: 100000, ScriptPubKey: p2tr}}}
+	for i := uint64(0); i < 8; i++ {
+		credit := creditingTx(p2tr, 100000+i)
+		fetcher.AddTx(credit)
+		spend.TxIns = append(spend.TxIns, &TxIn{PreTxId: credit.TxId(), Sequence: 0xffffffff})
+	}
+
+	// the amounts and script pubkeys all signature hashes commit to are
+	// fetched once per pass, not once per input
+	check(nil, spend.SingInputs(fetcher, key), t)
+	check(true, fetcher.fetches <= 5*len(spend.TxIns), t)
+
+	fetcher.fetches = 0
+	check(nil, spend.Verify(fetcher), t)
+	check(true, fetcher.fetches <= 5*len(spend.TxIns), t)
+}
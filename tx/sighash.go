@@ -0,0 +1,409 @@
+package tx
+
+import (
+	"crypto/sha256"
+
+	"github.com/lobiCode/prog_btc_go/script"
+
+	u "github.com/lobiCode/prog_btc_go/btcutils"
+	c "github.com/lobiCode/prog_btc_go/cryptography"
+)
+
+// sigHashCache keeps the hashes of tx that the BIP143 and BIP341 signature
+// hashes of all its inputs share, a verification or signing pass computes them
+// and fetches the previous outputs for them once.
+// The inputs and outputs of tx mustn't change while it's in use, their script
+// sigs and witnesses can.
+type sigHashCache struct {
+	tx      *Tx
+	fetcher PrevOutFetcher
+
+	shaPrevouts      []byte
+	shaSequences     []byte
+	shaOutputs       []byte
+	shaAmounts       []byte
+	shaScriptPubKeys []byte
+
+	hashPrevouts []byte
+	hashSequence []byte
+	hashOutputs  []byte
+}
+
+func newSigHashCache(tx *Tx, fetcher PrevOutFetcher) *sigHashCache {
+	return &sigHashCache{tx: tx, fetcher: fetcher}
+}
+
+func (cache *sigHashCache) getShaPrevouts() []byte {
+	if cache.shaPrevouts == nil {
+		cache.shaPrevouts = cache.tx.getShaPrevouts()
+	}
+
+	return cache.shaPrevouts
+}
+
+func (cache *sigHashCache) getShaSequences() []byte {
+	if cache.shaSequences == nil {
+		cache.shaSequences = cache.tx.getShaSequences()
+	}
+
+	return cache.shaSequences
+}
+
+func (cache *sigHashCache) getShaOutputs() []byte {
+	if cache.shaOutputs == nil {
+		cache.shaOutputs = cache.tx.getShaOutputs()
+	}
+
+	return cache.shaOutputs
+}
+
+func (cache *sigHashCache) getShaAmounts() ([]byte, error) {
+	if cache.shaAmounts == nil {
+		shaAmounts, err := cache.tx.getShaAmounts(cache.fetcher)
+		if err != nil {
+			return nil, err
+		}
+		cache.shaAmounts = shaAmounts
+	}
+
+	return cache.shaAmounts, nil
+}
+
+func (cache *sigHashCache) getShaScriptPubKeys() ([]byte, error) {
+	if cache.shaScriptPubKeys == nil {
+		shaScriptPubKeys, err := cache.tx.getShaScriptPubKeys(cache.fetcher)
+		if err != nil {
+			return nil, err
+		}
+		cache.shaScriptPubKeys = shaScriptPubKeys
+	}
+
+	return cache.shaScriptPubKeys, nil
+}
+
+func (cache *sigHashCache) getHashPrevouts() []byte {
+	if cache.hashPrevouts == nil {
+		sum := sha256.Sum256(cache.getShaPrevouts())
+		cache.hashPrevouts = sum[:]
+	}
+
+	return cache.hashPrevouts
+}
+
+func (cache *sigHashCache) getHashSequence() []byte {
+	if cache.hashSequence == nil {
+		sum := sha256.Sum256(cache.getShaSequences())
+		cache.hashSequence = sum[:]
+	}
+
+	return cache.hashSequence
+}
+
+func (cache *sigHashCache) getHashOutputs() []byte {
+	if cache.hashOutputs == nil {
+		sum := sha256.Sum256(cache.getShaOutputs())
+		cache.hashOutputs = sum[:]
+	}
+
+	return cache.hashOutputs
+}
+
+// sigHashFunc returns the signature hashes the evaluation of input i asks
+// for, ext tells which of the algorithms to use.
+func (tx *Tx) sigHashFunc(cache *sigHashCache, i int) script.SigHashFunc {
+	return func(hashType uint32, ext *script.SigHashExt) ([]byte, error) {
+		switch {
+		case ext == nil || ext.LeafHash != nil:
+			return tx.sigHashTaproot(cache, i, hashType, ext)
+		case ext.WitnessV0:
+			return tx.sigHashBip143(cache, i, nil, ext.ScriptCode, hashType)
+		default:
+			return tx.SigHash(cache.fetcher, i, ext.ScriptCode, hashType)
+		}
+	}
+}
+
+func isSigHashType(hashType, baseType uint32) bool {
+	return hashType&0x1f == baseType
+}
+
+func isAnyoneCanPay(hashType uint32) bool {
+	return hashType&SIGHASH_ANYONECANPAY != 0
+}
+
+// SigHash returns the legacy signature hash of input replaceScriptSig. With
+// SIGHASH_SINGLE and no matching output it returns the number one, like
+// Bitcoin Core does.
+func (tx *Tx) SigHash(fetcher PrevOutFetcher, replaceScriptSig int, redeemScript *script.Script, hashType uint32) ([]byte, error) {
+	if isSigHashType(hashType, SIGHASH_SINGLE) && replaceScriptSig >= len(tx.TxOuts) {
+		one := make([]byte, 32)
+		one[0] = 0x01
+		return one, nil
+	}
+
+	scriptCode := redeemScript
+	if scriptCode == nil {
+		scriptPubKey, err := tx.TxIns[replaceScriptSig].ScriptPubKey(fetcher)
+		if err != nil {
+			return nil, err
+		}
+		scriptCode = scriptPubKey
+	}
+
+	result := []byte{}
+
+	result = append(result, tx.serializeVersion()...)
+
+	if isAnyoneCanPay(hashType) {
+		result = append(result, u.EncodeVariant(1)...)
+		result = append(result, tx.TxIns[replaceScriptSig].SerializeSigHash(scriptCode, false)...)
+	} else {
+		zeroSequence := isSigHashType(hashType, SIGHASH_NONE) || isSigHashType(hashType, SIGHASH_SINGLE)
+		result = append(result, tx.serializeNTxIns()...)
+		for i, txIn := range tx.TxIns {
+			if i == replaceScriptSig {
+				result = append(result, txIn.SerializeSigHash(scriptCode, false)...)
+			} else {
+				result = append(result, txIn.SerializeSigHash(nil, zeroSequence)...)
+			}
+		}
+	}
+
+	switch {
+	case isSigHashType(hashType, SIGHASH_NONE):
+		result = append(result, u.EncodeVariant(0)...)
+	case isSigHashType(hashType, SIGHASH_SINGLE):
+		result = append(result, u.EncodeVariant(replaceScriptSig+1)...)
+		for i := 0; i < replaceScriptSig; i++ {
+			result = append(result, u.MustEncodeNumLittleEndian(int64(-1))...)
+			result = append(result, u.EncodeVariant(0)...)
+		}
+		result = append(result, tx.TxOuts[replaceScriptSig].Serialize()...)
+	default:
+		result = append(result, tx.serializeNTxOuts()...)
+		for _, txOut := range tx.TxOuts {
+			result = append(result, txOut.Serialize()...)
+		}
+	}
+
+	result = append(result, tx.serializeLocktime()...)
+	result = append(result, u.MustEncodeNumLittleEndian(hashType)...)
+
+	return u.Hash256(result), nil
+}
+
+func (tx *Tx) getShaPrevouts() []byte {
+	h := sha256.New()
+	for _, txIn := range tx.TxIns {
+		h.Write(txIn.serializePreTxId())
+		h.Write(txIn.serializePreTxIdx())
+	}
+
+	return h.Sum(nil)
+}
+
+func (tx *Tx) getShaSequences() []byte {
+	h := sha256.New()
+	for _, txIn := range tx.TxIns {
+		h.Write(txIn.serializeSequence())
+	}
+
+	return h.Sum(nil)
+}
+
+func (tx *Tx) getShaOutputs() []byte {
+	h := sha256.New()
+	for _, txOut := range tx.TxOuts {
+		h.Write(txOut.Serialize())
+	}
+
+	return h.Sum(nil)
+}
+
+func (tx *Tx) getShaAmounts(fetcher PrevOutFetcher) ([]byte, error) {
+	h := sha256.New()
+	for _, txIn := range tx.TxIns {
+		value, err := txIn.Value(fetcher)
+		if err != nil {
+			return nil, err
+		}
+		h.Write(u.MustEncodeNumLittleEndian(value))
+	}
+
+	return h.Sum(nil), nil
+}
+
+func (tx *Tx) getShaScriptPubKeys(fetcher PrevOutFetcher) ([]byte, error) {
+	h := sha256.New()
+	for _, txIn := range tx.TxIns {
+		scriptPubKey, err := txIn.ScriptPubKey(fetcher)
+		if err != nil {
+			return nil, err
+		}
+		h.Write(scriptPubKey.Serialize())
+	}
+
+	return h.Sum(nil), nil
+}
+
+// SigHashBip143 returns the segwit v0 signature hash of input i. The script
+// code is the witness script when one is given, otherwise the P2PKH script of
+// the key hash in the redeem script or in the script pubkey.
+func (tx *Tx) SigHashBip143(fetcher PrevOutFetcher, i int, redeemScript, witnessScript *script.Script, hashType uint32) ([]byte, error) {
+	return tx.sigHashBip143(newSigHashCache(tx, fetcher), i, redeemScript, witnessScript, hashType)
+}
+
+func (tx *Tx) sigHashBip143(cache *sigHashCache, i int, redeemScript, witnessScript *script.Script, hashType uint32) ([]byte, error) {
+	fetcher := cache.fetcher
+	txIn := tx.TxIns[i]
+
+	scriptCode := witnessScript
+	if scriptCode == nil {
+		keyHashScript := redeemScript
+		if keyHashScript == nil {
+			scriptPubKey, err := txIn.ScriptPubKey(fetcher)
+			if err != nil {
+				return nil, err
+			}
+			keyHashScript = scriptPubKey
+		}
+
+		class, data := script.Classify(keyHashScript)
+		if class != script.TX_WITNESS_V0_KEYHASH {
+			return nil, ErrTxScriptCode
+		}
+		scriptCode = script.P2pkh(data.Program)
+	}
+
+	value, err := txIn.Value(fetcher)
+	if err != nil {
+		return nil, err
+	}
+
+	zero := make([]byte, 32)
+
+	hashPrevouts := zero
+	if !isAnyoneCanPay(hashType) {
+		hashPrevouts = cache.getHashPrevouts()
+	}
+
+	hashSequence := zero
+	if !isAnyoneCanPay(hashType) && !isSigHashType(hashType, SIGHASH_SINGLE) && !isSigHashType(hashType, SIGHASH_NONE) {
+		hashSequence = cache.getHashSequence()
+	}
+
+	hashOutputs := zero
+	if !isSigHashType(hashType, SIGHASH_SINGLE) && !isSigHashType(hashType, SIGHASH_NONE) {
+		hashOutputs = cache.getHashOutputs()
+	} else if isSigHashType(hashType, SIGHASH_SINGLE) && i < len(tx.TxOuts) {
+		hashOutputs = u.Hash256(tx.TxOuts[i].Serialize())
+	}
+
+	result := []byte{}
+	result = append(result, tx.serializeVersion()...)
+	result = append(result, hashPrevouts...)
+	result = append(result, hashSequence...)
+	result = append(result, txIn.serializePreTxId()...)
+	result = append(result, txIn.serializePreTxIdx()...)
+	result = append(result, scriptCode.Serialize()...)
+	result = append(result, u.MustEncodeNumLittleEndian(value)...)
+	result = append(result, txIn.serializeSequence()...)
+	result = append(result, hashOutputs...)
+	result = append(result, tx.serializeLocktime()...)
+	result = append(result, u.MustEncodeNumLittleEndian(hashType)...)
+
+	return u.Hash256(result), nil
+}
+
+// SigHashTaproot returns the BIP341 signature hash of input i, ext is nil for
+// key path spends.
+func (tx *Tx) SigHashTaproot(fetcher PrevOutFetcher, i int, hashType uint32, ext *script.SigHashExt) ([]byte, error) {
+	return tx.sigHashTaproot(newSigHashCache(tx, fetcher), i, hashType, ext)
+}
+
+func (tx *Tx) sigHashTaproot(cache *sigHashCache, i int, hashType uint32, ext *script.SigHashExt) ([]byte, error) {
+	if hashType > 0x03 && (hashType < 0x81 || hashType > 0x83) {
+		return nil, ErrTxSigHashType
+	}
+
+	outputType := hashType & 0x03
+	if outputType == SIGHASH_DEFAULT {
+		outputType = SIGHASH_ALL
+	}
+
+	if outputType == SIGHASH_SINGLE && i >= len(tx.TxOuts) {
+		return nil, ErrTxSigHashType
+	}
+
+	txIn := tx.TxIns[i]
+
+	result := []byte{0x00, byte(hashType)}
+	result = append(result, tx.serializeVersion()...)
+	result = append(result, tx.serializeLocktime()...)
+
+	if !isAnyoneCanPay(hashType) {
+		shaAmounts, err := cache.getShaAmounts()
+		if err != nil {
+			return nil, err
+		}
+		shaScriptPubKeys, err := cache.getShaScriptPubKeys()
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, cache.getShaPrevouts()...)
+		result = append(result, shaAmounts...)
+		result = append(result, shaScriptPubKeys...)
+		result = append(result, cache.getShaSequences()...)
+	}
+
+	if outputType == SIGHASH_ALL {
+		result = append(result, cache.getShaOutputs()...)
+	}
+
+	annex := txIn.getAnnex()
+
+	var spendType byte
+	if ext != nil {
+		spendType |= 0x02
+	}
+	if annex != nil {
+		spendType |= 0x01
+	}
+	result = append(result, spendType)
+
+	if isAnyoneCanPay(hashType) {
+		value, err := txIn.Value(cache.fetcher)
+		if err != nil {
+			return nil, err
+		}
+		scriptPubKey, err := txIn.ScriptPubKey(cache.fetcher)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, txIn.serializePreTxId()...)
+		result = append(result, txIn.serializePreTxIdx()...)
+		result = append(result, u.MustEncodeNumLittleEndian(value)...)
+		result = append(result, scriptPubKey.Serialize()...)
+		result = append(result, txIn.serializeSequence()...)
+	} else {
+		result = append(result, u.MustEncodeNumLittleEndian(uint32(i))...)
+	}
+
+	if annex != nil {
+		sum := sha256.Sum256(append(u.EncodeVariant(len(annex)), annex...))
+		result = append(result, sum[:]...)
+	}
+
+	if outputType == SIGHASH_SINGLE {
+		sum := sha256.Sum256(tx.TxOuts[i].Serialize())
+		result = append(result, sum[:]...)
+	}
+
+	if ext != nil {
+		result = append(result, ext.LeafHash...)
+		result = append(result, 0x00)
+		result = append(result, u.MustEncodeNumLittleEndian(ext.CodeSepPos)...)
+	}
+
+	return c.TaggedHash("TapSighash", result), nil
+}
@@ -11,18 +11,46 @@ import (
 	"net/http"
 
 	u "github.com/lobiCode/prog_btc_go/btcutils"
+	"github.com/lobiCode/prog_btc_go/chaincfg"
 	c "github.com/lobiCode/prog_btc_go/cryptography"
+	ec "github.com/lobiCode/prog_btc_go/ellipticcurve"
 	"github.com/lobiCode/prog_btc_go/script"
 )
 
 var ErrTxVersionLen = errors.New("wrong version len")
 var ErrTxScripSig = errors.New("parsing script failed")
 var ErrWrongSig = errors.New("wrong signature")
+var ErrTxWitnessFlag = errors.New("wrong witness flag")
+var ErrTxRedeemScript = errors.New("redeem script doesn't match script pubkey")
+var ErrTxWitnessScript = errors.New("witness script required")
+
+// ErrTxSigHashType is the script package's error, so the evaluation of a
+// signature tells a bad hash type from a failed signature hash.
+var ErrTxSigHashType = script.ErrSchnorrSigHashType
+
+var ErrTxNegativeFee = errors.New("outputs exceed inputs")
+var ErrTxNonStandardVersion = errors.New("non-standard version")
+var ErrTxNonStandardSize = errors.New("transaction too large")
+var ErrTxNonStandardScriptSig = errors.New("non-standard script sig")
+var ErrTxNonStandardScriptPubKey = errors.New("non-standard script pubkey")
+var ErrTxDust = errors.New("dust output")
+var ErrTxMultiOpReturn = errors.New("more than one nulldata output")
+var ErrTxNoExplorer = errors.New("no explorer to fetch transactions from")
+var ErrTxTooLarge = errors.New("transaction larger than a block")
+var ErrTxScriptCode = errors.New("script code needs a P2WPKH script")
+
+const (
+	maxStandardVersion = 3
+	maxStandardWeight  = 400000
+	maxBlockWeight     = 4000000
+)
 
 var (
-	SIGHASH_ALL    uint32 = 1
-	SIGHASH_NONE   uint32 = 2
-	SIGHASH_SINGLE uint32 = 3
+	SIGHASH_DEFAULT      uint32 = 0
+	SIGHASH_ALL          uint32 = 1
+	SIGHASH_NONE         uint32 = 2
+	SIGHASH_SINGLE       uint32 = 3
+	SIGHASH_ANYONECANPAY uint32 = 0x80
 )
 
 type Tx struct {
@@ -30,7 +58,6 @@ type Tx struct {
 	TxIns    []*TxIn
 	TxOuts   []*TxOut
 	Locktime uint32
-	Testnet  bool
 }
 
 func (tx *Tx) serializeVersion() []byte {
@@ -54,10 +81,50 @@ func (tx *Tx) serializeLocktime() []byte {
 	return locktime
 }
 
+func (tx *Tx) HasWitness() bool {
+	for _, txIn := range tx.TxIns {
+		if len(txIn.Witness) > 0 {
+			return true
+		}
+	}
+
+	return false
+}
+
 func (tx *Tx) Serialize() string {
+	return hex.EncodeToString(tx.serialize())
+}
+
+func (tx *Tx) serialize() []byte {
+	if !tx.HasWitness() {
+		return tx.serializeLegacy()
+	}
+
 	result := make([]byte, 0, 16)
 
 	result = append(result, tx.serializeVersion()...)
+	result = append(result, 0x00, 0x01)
+	result = append(result, tx.serializeTxInsOuts()...)
+	for _, txIn := range tx.TxIns {
+		result = append(result, txIn.serializeWitness()...)
+	}
+	result = append(result, tx.serializeLocktime()...)
+
+	return result
+}
+
+func (tx *Tx) serializeLegacy() []byte {
+	result := make([]byte, 0, 16)
+
+	result = append(result, tx.serializeVersion()...)
+	result = append(result, tx.serializeTxInsOuts()...)
+	result = append(result, tx.serializeLocktime()...)
+
+	return result
+}
+
+func (tx *Tx) serializeTxInsOuts() []byte {
+	result := make([]byte, 0, 16)
 
 	result = append(result, tx.serializeNTxIns()...)
 	for _, txIn := range tx.TxIns {
@@ -67,9 +134,24 @@ func (tx *Tx) Serialize() string {
 	for _, txOut := range tx.TxOuts {
 		result = append(result, txOut.Serialize()...)
 	}
-	result = append(result, tx.serializeLocktime()...)
 
-	return hex.EncodeToString(result)
+	return result
+}
+
+func (tx *Tx) TxId() string {
+	return hex.EncodeToString(u.CopybAndReverse(u.Hash256(tx.serializeLegacy())))
+}
+
+func (tx *Tx) WTxId() string {
+	return hex.EncodeToString(u.CopybAndReverse(u.Hash256(tx.serialize())))
+}
+
+func (tx *Tx) Weight() int {
+	return len(tx.serializeLegacy())*3 + len(tx.serialize())
+}
+
+func (tx *Tx) VSize() int {
+	return (tx.Weight() + 3) / 4
 }
 
 func (tx *Tx) String() string {
@@ -82,121 +164,341 @@ txouts:
 		tx.Version, tx.TxIns, tx.TxOuts)
 }
 
-func (tx *Tx) SigHash(replaceScriptSig int, redeemScript *script.Script) ([]byte, error) {
-	result := []byte{}
+// InputError is the reason the scripts of an input don't verify.
+type InputError struct {
+	Index int
+	Err   error
+}
 
-	result = append(result, tx.serializeVersion()...)
-	result = append(result, tx.serializeNTxIns()...)
-	for i, txIn := range tx.TxIns {
-		var ok bool
-		if i == replaceScriptSig {
-			ok = true
-		}
-		txInSer, err := txIn.SerializeSigHash(ok, tx.Testnet, redeemScript)
+func (e *InputError) Error() string {
+	return fmt.Sprintf("input %d: %s", e.Index, e.Err)
+}
+
+// Verify checks every input under the consensus rules, when one fails the
+// error is an *InputError. The previous outputs that aren't known come from
+// fetcher.
+func (tx *Tx) Verify(fetcher PrevOutFetcher) error {
+	return tx.VerifyWithFlags(fetcher, script.MANDATORY_SCRIPT_VERIFY_FLAGS)
+}
+
+// VerifyWithFlags is Verify under the rules flags select, the policy ones are
+// script.STANDARD_SCRIPT_VERIFY_FLAGS.
+func (tx *Tx) VerifyWithFlags(fetcher PrevOutFetcher, flags script.ScriptFlags) error {
+	var in, out uint64
+	for _, v := range tx.TxIns {
+		value, err := v.Value(fetcher)
 		if err != nil {
-			return nil, err
+			return err
 		}
-		result = append(result, txInSer...)
+		in += value
+	}
+	for _, v := range tx.TxOuts {
+		out += v.Amount
 	}
 
-	result = append(result, tx.serializeNTxOuts()...)
-	for _, txOut := range tx.TxOuts {
-		result = append(result, txOut.Serialize()...)
+	if out > in {
+		return ErrTxNegativeFee
 	}
-	result = append(result, tx.serializeLocktime()...)
 
-	sigHashAll := make([]byte, 4)
-	binary.LittleEndian.PutUint32(sigHashAll, SIGHASH_ALL)
+	cache := newSigHashCache(tx, fetcher)
+	for i := range tx.TxIns {
+		if err := tx.verifyInputWith(cache, i, flags); err != nil {
+			return &InputError{i, err}
+		}
+	}
 
-	result = append(result, sigHashAll...)
+	return nil
+}
 
-	r := u.Hash256(result)[:]
-	return r, nil
+func (tx *Tx) getReedemScript(replaceScriptSig int) (*script.Script, error) {
+	return tx.TxIns[replaceScriptSig].RedeemScript, nil
 }
 
-func (tx *Tx) Verify() bool {
-	fee, err := tx.Fee()
-	if fee < 0 && err != nil {
-		return false
+func (tx *Tx) verifyInput(fetcher PrevOutFetcher, replaceScriptSig int, flags script.ScriptFlags) error {
+	return tx.verifyInputWith(newSigHashCache(tx, fetcher), replaceScriptSig, flags)
+}
+
+// verifyInputWith verifies input replaceScriptSig with the hashes of cache,
+// shared by the other inputs of the pass.
+func (tx *Tx) verifyInputWith(cache *sigHashCache, replaceScriptSig int, flags script.ScriptFlags) error {
+	engine, err := tx.newEngine(cache, replaceScriptSig, flags)
+	if err != nil {
+		return err
 	}
 
-	for i, _ := range tx.TxIns {
-		if !tx.verifyInput(i) {
-			return false
-		}
+	return engine.Execute()
+}
+
+// NewEngine returns a script.Engine stepping through the scripts of input i,
+// the previous output is fetched with fetcher.
+func (tx *Tx) NewEngine(fetcher PrevOutFetcher, i int, flags script.ScriptFlags) (*script.Engine, error) {
+	return tx.newEngine(newSigHashCache(tx, fetcher), i, flags)
+}
+
+func (tx *Tx) newEngine(cache *sigHashCache, i int, flags script.ScriptFlags) (*script.Engine, error) {
+	txIn := tx.TxIns[i]
+
+	scriptPubKey, err := txIn.ScriptPubKey(cache.fetcher)
+	if err != nil {
+		return nil, err
 	}
 
-	return true
+	txContext, err := tx.txContext(cache.fetcher, i, tx.sigHashFunc(cache, i))
+	if err != nil {
+		return nil, err
+	}
+
+	return script.NewEngine(txContext, txIn.ScriptSig, scriptPubKey, txIn.Witness, flags)
 }
 
-func (tx *Tx) getReedemScript(replaceScriptSig int) (*script.Script, error) {
-	return nil, nil
+func (tx *Tx) txContext(fetcher PrevOutFetcher, i int, sigHash script.SigHashFunc) (*script.TxContext, error) {
+	txIn := tx.TxIns[i]
+
+	value, err := txIn.Value(fetcher)
+	if err != nil {
+		return nil, err
+	}
+
+	return &script.TxContext{
+		SigHash:    sigHash,
+		Version:    tx.Version,
+		LockTime:   tx.Locktime,
+		InputIndex: i,
+		Sequence:   txIn.Sequence,
+		Amount:     value,
+	}, nil
 }
 
-func (tx *Tx) verifyInput(replaceScriptSig int) bool {
+func (tx *Tx) SingInput(fetcher PrevOutFetcher, i int, key *c.PrivateKey) error {
+	return tx.singInput(newSigHashCache(tx, fetcher), i, key)
+}
 
-	scriptPubKey, err := tx.TxIns[replaceScriptSig].ScriptPubKey(tx.Testnet)
+func (tx *Tx) singInput(cache *sigHashCache, i int, key *c.PrivateKey) error {
+	scriptPubKey, err := tx.TxIns[i].ScriptPubKey(cache.fetcher)
 	if err != nil {
-		return false
+		return err
+	}
+
+	if scriptPubKey.IsP2trScriptPubkey() {
+		return tx.singInputTaproot(cache, i, key, nil, SIGHASH_DEFAULT)
+	}
+
+	return tx.singInputWithHashType(cache, i, key, SIGHASH_ALL)
+}
+
+// SingInputWithHashType signs input i with key. P2PKH, P2WPKH and P2SH-P2WPKH
+// inputs need nothing else. P2SH and P2WSH inputs are signed for the
+// RedeemScript and WitnessScript of the input, which must be scripts that a
+// single signature followed by the script itself satisfies. P2TR inputs are
+// signed with the key path of an output without a script tree.
+func (tx *Tx) SingInputWithHashType(fetcher PrevOutFetcher, i int, key *c.PrivateKey, hashType uint32) error {
+	return tx.singInputWithHashType(newSigHashCache(tx, fetcher), i, key, hashType)
+}
+
+func (tx *Tx) singInputWithHashType(cache *sigHashCache, i int, key *c.PrivateKey, hashType uint32) error {
+	fetcher := cache.fetcher
+	v := tx.TxIns[i]
+	sec := key.Sec(true)
+
+	scriptPubKey, err := v.ScriptPubKey(fetcher)
+	if err != nil {
+		return err
+	}
+
+	if scriptPubKey.IsP2trScriptPubkey() {
+		return tx.singInputTaproot(cache, i, key, nil, hashType)
+	}
+
+	redeemScript, err := tx.getReedemScript(i)
+	if err != nil {
+		return err
 	}
 
-	var redeemScript *script.Script
 	if scriptPubKey.IsP2shScriptPubkeys() {
-		r, err := tx.TxIns[replaceScriptSig].ScriptSig.GetRedeemScript()
+		if redeemScript == nil {
+			redeemScript = script.P2wpkh(u.Hash160(sec))
+		}
+		if !bytes.Equal(u.Hash160(redeemScript.RawSerialize()), scriptPubKey.Cmds[1]) {
+			return ErrTxRedeemScript
+		}
+	}
+
+	sign := func(z []byte, err error) ([]byte, error) {
 		if err != nil {
-			return false
+			return nil, err
 		}
-		redeemScript = r
+		sig := key.Sign(u.ParseBytes(z)).Der()
+		return append(sig, byte(hashType)), nil
 	}
 
-	z, err := tx.SigHash(replaceScriptSig, redeemScript)
-	if err != nil {
-		return false
+	var sig []byte
+
+	switch {
+	case scriptPubKey.IsP2wpkhScriptPubkey():
+		if sig, err = sign(tx.sigHashBip143(cache, i, nil, nil, hashType)); err != nil {
+			return err
+		}
+		v.ScriptSig = &script.Script{}
+		v.Witness = [][]byte{sig, sec}
+	case scriptPubKey.IsP2wshScriptPubkey():
+		if v.WitnessScript == nil {
+			return ErrTxWitnessScript
+		}
+		if sig, err = sign(tx.sigHashBip143(cache, i, nil, v.WitnessScript, hashType)); err != nil {
+			return err
+		}
+		v.ScriptSig = &script.Script{}
+		v.Witness = [][]byte{sig, v.WitnessScript.RawSerialize()}
+	case redeemScript != nil && redeemScript.IsP2wpkhScriptPubkey():
+		if sig, err = sign(tx.sigHashBip143(cache, i, redeemScript, nil, hashType)); err != nil {
+			return err
+		}
+		v.ScriptSig = &script.Script{Cmds: [][]byte{redeemScript.RawSerialize()}}
+		v.Witness = [][]byte{sig, sec}
+	case redeemScript != nil && redeemScript.IsP2wshScriptPubkey():
+		if v.WitnessScript == nil {
+			return ErrTxWitnessScript
+		}
+		if sig, err = sign(tx.sigHashBip143(cache, i, nil, v.WitnessScript, hashType)); err != nil {
+			return err
+		}
+		v.ScriptSig = &script.Script{Cmds: [][]byte{redeemScript.RawSerialize()}}
+		v.Witness = [][]byte{sig, v.WitnessScript.RawSerialize()}
+	case redeemScript != nil:
+		if sig, err = sign(tx.SigHash(fetcher, i, redeemScript, hashType)); err != nil {
+			return err
+		}
+		v.ScriptSig = &script.Script{Cmds: [][]byte{sig, redeemScript.RawSerialize()}}
+	default:
+		if sig, err = sign(tx.SigHash(fetcher, i, nil, hashType)); err != nil {
+			return err
+		}
+		v.ScriptSig = &script.Script{Cmds: [][]byte{sig, sec}}
 	}
 
-	ok := script.Evaluate(z, tx.TxIns[replaceScriptSig].ScriptSig, scriptPubKey)
-	return ok
+	return tx.verifyInputWith(cache, i, script.STANDARD_SCRIPT_VERIFY_FLAGS)
 }
 
-func (tx *Tx) SingInput(i int, key *c.PrivateKey) error {
-	redeemScript, err := tx.getReedemScript(i)
+// SingInputTaproot signs a P2TR input with the key path. key is the internal
+// key of the output and merkleRoot the root of its script tree, nil when it has
+// none.
+func (tx *Tx) SingInputTaproot(fetcher PrevOutFetcher, i int, key *c.PrivateKey, merkleRoot []byte, hashType uint32) error {
+	return tx.singInputTaproot(newSigHashCache(tx, fetcher), i, key, merkleRoot, hashType)
+}
+
+func (tx *Tx) singInputTaproot(cache *sigHashCache, i int, key *c.PrivateKey, merkleRoot []byte, hashType uint32) error {
+	tweaked, err := key.TaprootTweak(merkleRoot)
+	if err != nil {
+		return err
+	}
+
+	sig, err := tx.signSchnorr(cache, i, tweaked, hashType, nil)
+	if err != nil {
+		return err
+	}
 
-	sec := key.Sec(true)
 	v := tx.TxIns[i]
-	z, err := tx.SigHash(i, redeemScript)
+	v.ScriptSig = &script.Script{}
+	v.Witness = [][]byte{sig}
+
+	return tx.verifyInputWith(cache, i, script.STANDARD_SCRIPT_VERIFY_FLAGS)
+}
+
+// SingInputTapscript signs a P2TR input with the script path of leaf, a leaf
+// of tree that a single signature satisfies.
+func (tx *Tx) SingInputTapscript(fetcher PrevOutFetcher, i int, key *c.PrivateKey, internalKey *ec.Point, tree *script.TapTree, leaf *script.Script, hashType uint32) error {
+	controlBlock, err := tree.ControlBlock(internalKey, leaf)
 	if err != nil {
 		return err
 	}
-	zi := u.ParseBytes(z)
-	sigd := key.Sign(zi)
-	sig := sigd.Der()
-	sig = append(sig, byte(SIGHASH_ALL))
-	scriptSig := &script.Script{Cmds: [][]byte{sig, sec}}
-	v.ScriptSig = scriptSig
 
-	ok := tx.verifyInput(i)
-	if !ok {
-		return ErrWrongSig
+	leafB := leaf.RawSerialize()
+	ext := &script.SigHashExt{
+		LeafHash:   script.TapLeafHash(controlBlock[0]&0xfe, leafB),
+		CodeSepPos: 0xffffffff,
+	}
 
+	cache := newSigHashCache(tx, fetcher)
+	sig, err := tx.signSchnorr(cache, i, key, hashType, ext)
+	if err != nil {
+		return err
 	}
-	return nil
+
+	v := tx.TxIns[i]
+	v.ScriptSig = &script.Script{}
+	v.Witness = [][]byte{sig, leafB, controlBlock}
+
+	return tx.verifyInputWith(cache, i, script.STANDARD_SCRIPT_VERIFY_FLAGS)
 }
 
-func (tx *Tx) SingInputs(key *c.PrivateKey) error {
+func (tx *Tx) signSchnorr(cache *sigHashCache, i int, key *c.PrivateKey, hashType uint32, ext *script.SigHashExt) ([]byte, error) {
+	z, err := tx.sigHashTaproot(cache, i, hashType, ext)
+	if err != nil {
+		return nil, err
+	}
+
+	sig := key.SignSchnorr(z).Serialize()
+	if hashType != SIGHASH_DEFAULT {
+		sig = append(sig, byte(hashType))
+	}
+
+	return sig, nil
+}
+
+func (tx *Tx) SingInputs(fetcher PrevOutFetcher, key *c.PrivateKey) error {
 	var err error
+	cache := newSigHashCache(tx, fetcher)
 	for i, _ := range tx.TxIns {
-		if err = tx.SingInput(i, key); err != nil {
+		if err = tx.singInput(cache, i, key); err != nil {
 			return err
 		}
 	}
 	return nil
 }
 
-func (tx *Tx) Fee() (uint64, error) {
+// IsStandard checks the transaction against the policy nodes relay under,
+// its scripts are checked with VerifyWithFlags and
+// script.STANDARD_SCRIPT_VERIFY_FLAGS.
+func (tx *Tx) IsStandard() error {
+	if tx.Version < 1 || tx.Version > maxStandardVersion {
+		return ErrTxNonStandardVersion
+	}
+
+	if tx.Weight() > maxStandardWeight {
+		return ErrTxNonStandardSize
+	}
+
+	for _, v := range tx.TxIns {
+		if !script.IsStandardScriptSig(v.ScriptSig) {
+			return ErrTxNonStandardScriptSig
+		}
+	}
+
+	nullData := 0
+	for _, v := range tx.TxOuts {
+		if !script.IsStandard(v.ScriptPubKey) {
+			return ErrTxNonStandardScriptPubKey
+		}
+
+		if class, _ := script.Classify(v.ScriptPubKey); class == script.TX_NULL_DATA {
+			nullData++
+		} else if v.IsDust() {
+			return ErrTxDust
+		}
+	}
+
+	if nullData > 1 {
+		return ErrTxMultiOpReturn
+	}
+
+	return nil
+}
+
+func (tx *Tx) Fee(fetcher PrevOutFetcher) (uint64, error) {
 	var fee uint64 = 0
 
 	for _, v := range tx.TxIns {
-		f, err := v.Value(tx.Testnet)
+		f, err := v.Value(fetcher)
 		if err != nil {
 			return 0, err
 		}
@@ -209,7 +511,17 @@ func (tx *Tx) Fee() (uint64, error) {
 	return fee, nil
 }
 
-func ParseTx(r io.Reader, testnet bool) (*Tx, error) {
+func ParseTx(r io.Reader) (*Tx, error) {
+	return parseTx(r, true)
+}
+
+// ParseTxLegacy parses a transaction serialized without witnesses, as a PSBT
+// holds it. A zero input count is read as such, not as the BIP144 marker.
+func ParseTxLegacy(r io.Reader) (*Tx, error) {
+	return parseTx(r, false)
+}
+
+func parseTx(r io.Reader, witness bool) (*Tx, error) {
 	b := make([]byte, 4)
 
 	// read version
@@ -225,6 +537,24 @@ func ParseTx(r io.Reader, testnet bool) (*Tx, error) {
 		return nil, err
 	}
 
+	// BIP144 marker and flag
+	segwit := false
+	if witness && n == 0 {
+		_, err = io.ReadFull(r, b[:1])
+		if err != nil {
+			return nil, err
+		}
+		if b[0] != 0x01 {
+			return nil, ErrTxWitnessFlag
+		}
+		segwit = true
+
+		n, err = u.ReadVariant(r)
+		if err != nil {
+			return nil, err
+		}
+	}
+
 	txIns := []*TxIn{}
 	for i := uint64(0); i < n; i++ {
 		txIn, err := ParseTxIn(r)
@@ -239,7 +569,7 @@ func ParseTx(r io.Reader, testnet bool) (*Tx, error) {
 		return nil, err
 	}
 
-	txOuts := make([]*TxOut, 0, n)
+	txOuts := []*TxOut{}
 
 	for i := uint64(0); i < n; i++ {
 		txOut, err := ParseTxOut(r)
@@ -249,6 +579,15 @@ func ParseTx(r io.Reader, testnet bool) (*Tx, error) {
 		txOuts = append(txOuts, txOut)
 	}
 
+	if segwit {
+		for _, txIn := range txIns {
+			txIn.Witness, err = ParseWitness(r)
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+
 	// read locktime
 	_, err = io.ReadFull(r, b)
 	if err != nil {
@@ -256,7 +595,12 @@ func ParseTx(r io.Reader, testnet bool) (*Tx, error) {
 	}
 	locktime := binary.LittleEndian.Uint32(b)
 
-	tx := &Tx{version, txIns, txOuts, locktime, testnet}
+	tx := &Tx{
+		Version:  version,
+		TxIns:    txIns,
+		TxOuts:   txOuts,
+		Locktime: locktime,
+	}
 
 	return tx, nil
 }
@@ -282,13 +626,15 @@ func (tx *Tx) CoinbaseHeight() (int64, error) {
 	return u.DecodeNumLittleEndian(b)
 }
 
-func FetchTx(txId string, testnet bool) (*Tx, error) {
+func FetchTx(txId string, params *chaincfg.Params) (*Tx, error) {
 	var url string
-	// TODO
-	if testnet {
-		url = fmt.Sprintf("http://testnet.programmingbitcoin.com/tx/%s.hex", txId)
-	} else {
+	switch params {
+	case &chaincfg.MainNetParams:
 		url = fmt.Sprintf("https://blockchain.info/rawtx/%s?format=hex", txId)
+	case &chaincfg.TestNet3Params:
+		url = fmt.Sprintf("http://testnet.programmingbitcoin.com/tx/%s.hex", txId)
+	default:
+		return nil, ErrTxNoExplorer
 	}
 
 	resp, err := http.Get(url)
@@ -310,24 +656,15 @@ func FetchTx(txId string, testnet bool) (*Tx, error) {
 
 	b = b[:i]
 
-	var z bool
-	if b[4] == 0 {
-		b = append(b[:4], b[6:]...)
-		z = true
-	}
-
 	r := bytes.NewReader(b)
-	tx, err := ParseTx(r, testnet)
+	tx, err := ParseTx(r)
 	if err != nil {
 		return nil, err
 	}
 
-	if z {
-		locktime := binary.LittleEndian.Uint32(b[len(b)-4:])
-		tx.Locktime = locktime
+	if tx.TxId() != txId {
+		return nil, ErrTxIdMismatch
 	}
 
-	// TODO check tr id
-
-	return tx, err
+	return tx, nil
 }
@@ -2,12 +2,19 @@ package tx
 
 import (
 	"bytes"
+	"crypto/sha256"
 	"encoding/hex"
+	"encoding/json"
+	"io"
+	"io/ioutil"
 	"reflect"
+	"strings"
 	"testing"
 
 	u "github.com/lobiCode/prog_btc_go/btcutils"
+	"github.com/lobiCode/prog_btc_go/chaincfg"
 	c "github.com/lobiCode/prog_btc_go/cryptography"
+	"github.com/lobiCode/prog_btc_go/script"
 )
 
 func TestParseTx(t *testing.T) {
@@ -19,7 +26,7 @@ func TestParseTx(t *testing.T) {
 	}
 
 	r := bytes.NewReader(inB)
-	result, err := ParseTx(r, true)
+	result, err := ParseTx(r)
 
 	// check error
 	check(nil, err, t)
@@ -52,6 +59,84 @@ func TestParseTx(t *testing.T) {
 
 	s := result.Serialize()
 	check(in, s, t)
+
+	check(result.TxId(), result.WTxId(), t)
+	check(len(inB)*4, result.Weight(), t)
+}
+
+func TestParseSegwitTx(t *testing.T) {
+	in := "01000000000101a53352d5135766f03076597418263da2d9c958315968fea823529467481ff9cd1300000000ffffffff010b070600000000001600149ddac6f39d51e0398e532a22c41ba189406a852302463043021f4d2381dc97f182abd8185f51753018523212f5ddc07cc4e63a8dc03658da190220608b5c4d92b86b6de7d78ef23a2fa735bcb59b914a48b0e187c5e7569a18197001210307ead084807eb76346df6977000c89392f45c76425b26181f521d7f370066a8f00000000"
+
+	inB, err := hex.DecodeString(in)
+	if err != nil {
+		panic(err)
+	}
+
+	r := bytes.NewReader(inB)
+	result, err := ParseTx(r)
+	check(nil, err, t)
+
+	check(true, result.HasWitness(), t)
+	check(1, len(result.TxIns), t)
+	check(2, len(result.TxIns[0].Witness), t)
+	check("0307ead084807eb76346df6977000c89392f45c76425b26181f521d7f370066a8f", hex.EncodeToString(result.TxIns[0].Witness[1]), t)
+	check(uint32(0), result.Locktime, t)
+
+	check(in, result.Serialize(), t)
+	check("0f167d1385a84d1518cfee208b653fc9163b605ccf1b75347e2850b3e2eb19f3", result.TxId(), t)
+	check("0858eab78e77b6b033da30f46699996396cf48fcf625a783c85a51403e175e74", result.WTxId(), t)
+	check(436, result.Weight(), t)
+	check(109, result.VSize(), t)
+}
+
+func TestParseTxWitnessFlag(t *testing.T) {
+	in := "0100000000020000000000"
+	inB, _ := hex.DecodeString(in)
+	_, err := ParseTx(bytes.NewReader(inB))
+	check(ErrTxWitnessFlag, err, t)
+}
+
+func TestParseTxLegacy(t *testing.T) {
+	// no inputs and one output
+	in := "02000000" + "00" + "01" + "e803000000000000" + "16" + "00140000000000000000000000000000000000000000" + "00000000"
+	inB, _ := hex.DecodeString(in)
+	result, err := ParseTxLegacy(bytes.NewReader(inB))
+	check(nil, err, t)
+	check(0, len(result.TxIns), t)
+	check(1, len(result.TxOuts), t)
+	check(uint64(1000), result.TxOuts[0].Amount, t)
+	check(in, result.Serialize(), t)
+
+	// the output count is taken for the BIP144 flag
+	_, err = ParseTx(bytes.NewReader(inB))
+	check(false, err == nil, t)
+}
+
+func TestParseWitnessInvalid(t *testing.T) {
+	tests := []struct {
+		name     string
+		witness  string
+		expected error
+	}{
+		{"huge count", "ffffffffffffffffff", ErrTxTooLarge},
+		{"huge item", "01ffffffffffffffff7f", ErrTxTooLarge},
+		{"truncated item", "0105abcd", io.EOF},
+		{"missing items", "0302abcd", io.EOF},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			inB, _ := hex.DecodeString(test.witness)
+			_, err := ParseWitness(bytes.NewReader(inB))
+			check(test.expected, err, t)
+		})
+	}
+
+	// a witness larger than the transaction doesn't allocate its count
+	in := "01000000000101" + strings.Repeat("00", 32) + "ffffffff00ffffffff" + "00" + "fe00093d00"
+	inB, _ := hex.DecodeString(in)
+	_, err := ParseTx(bytes.NewReader(inB))
+	check(io.EOF, err, t)
 }
 
 func TestParseTxIn(t *testing.T) {
@@ -89,6 +174,24 @@ func TestParseTxOut(t *testing.T) {
 	check(in, s, t)
 }
 
+func TestValueZeroAmount(t *testing.T) {
+	txIn := &TxIn{PreTxId: strings.Repeat("11", 32)}
+	fetcher := MapFetcher{}
+	fetcher.Add(txIn.PreTxId, 0, &TxOut{Amount: 0, ScriptPubKey: parseScriptHex("6a")})
+
+	value, err := txIn.Value(fetcher)
+	check(nil, err, t)
+	check(uint64(0), value, t)
+
+	// the fetcher passed in is asked every time
+	fetcher.Add(txIn.PreTxId, 0, &TxOut{Amount: 1000, ScriptPubKey: parseScriptHex("6a")})
+	value, err = txIn.Value(fetcher)
+	check(nil, err, t)
+	check(uint64(1000), value, t)
+	_, err = txIn.Value(MapFetcher{})
+	check(ErrTxPrevOutNotFound, err, t)
+}
+
 func TestFee(t *testing.T) {
 	in := "0100000001813f79011acb80925dfe69b3def355fe914bd1d96a3f5f71bf8303c6a989c7d1000000006b483045022100ed81ff192e75a3fd2304004dcadb746fa5e24c5031ccfcf21320b0277457c98f02207a986d955c6e0cb35d446a89d3f56100f4d7f67801c31967743a9c8e10615bed01210349fc4e631e3624a545de3f89f5d8684c7b8138bd94bdd531d2e213bf016b278afeffffff02a135ef01000000001976a914bc3b654dca7e56b04dca18f2566cdaf02e8d9ada88ac99c39800000000001976a9141c4bc762dd5423e332166702cb75f40df79fea1288ac19430600"
 	inB, err := hex.DecodeString(in)
@@ -97,12 +200,19 @@ func TestFee(t *testing.T) {
 	}
 
 	r := bytes.NewReader(inB)
-	result, err := ParseTx(r, false)
+	result, err := ParseTx(r)
 	if err != nil {
 		panic(err)
 	}
 
-	fee, err := result.Fee()
+	// the previous output pays to the key in the script sig
+	prevOuts := MapFetcher{}
+	prevOuts.Add(result.TxIns[0].PreTxId, 0, &TxOut{
+		Amount:       42505594,
+		ScriptPubKey: script.P2pkh(u.Hash160(result.TxIns[0].ScriptSig.Cmds[1])),
+	})
+
+	fee, err := result.Fee(prevOuts)
 	check(nil, err, t)
 	check(uint64(40000), fee, t)
 }
@@ -115,7 +225,7 @@ func TestLocktime(t *testing.T) {
 	}
 
 	r := bytes.NewReader(inB)
-	result, err := ParseTx(r, true)
+	result, err := ParseTx(r)
 	if err != nil {
 		panic(err)
 	}
@@ -123,13 +233,21 @@ func TestLocktime(t *testing.T) {
 	check(uint32(410393), result.Locktime, t)
 }
 
+// p2pkhTx is 452c629d67e41baec3ac6f04fe744b4b9617f8f859c63b3002f8684e7a4fee03,
+// spending 42505594 from a P2PKH output of
+// d1c789a9c60383bf715f3f6ad9d14b91fe55f3deb369fe5d9280cb1a01793f81.
+const p2pkhTx = "0100000001813f79011acb80925dfe69b3def355fe914bd1d96a3f5f71bf8303c6a989c7d1000000006b483045022100ed81ff192e75a3fd2304004dcadb746fa5e24c5031ccfcf21320b0277457c98f02207a986d955c6e0cb35d446a89d3f56100f4d7f67801c31967743a9c8e10615bed01210349fc4e631e3624a545de3f89f5d8684c7b8138bd94bdd531d2e213bf016b278afeffffff02a135ef01000000001976a914bc3b654dca7e56b04dca18f2566cdaf02e8d9ada88ac99c39800000000001976a9141c4bc762dd5423e332166702cb75f40df79fea1288ac19430600"
+
+func p2pkhTxFetcher(tx *Tx) MapFetcher {
+	return prevOutFetcher(tx, 0, 42505594, parseScriptHex("76a914a802fc56c704ce87c42d7c92eb75e7896bdc41ae88ac"))
+}
+
 func TestSigHash(t *testing.T) {
-	tx, err := FetchTx("452c629d67e41baec3ac6f04fe744b4b9617f8f859c63b3002f8684e7a4fee03", false)
-	check(nil, err, t)
+	tx := parseTxHex(p2pkhTx)
 	expected := "27e0c5994dec7824e56dec6b2fcb342eb7cdb0d0957c2fce9882f715e85d81a6"
 	ei, _ := u.ParseInt(expected, 16)
 
-	z, err := tx.SigHash(0, nil)
+	z, err := tx.SigHash(p2pkhTxFetcher(tx), 0, nil, SIGHASH_ALL)
 	check(nil, err, t)
 
 	zi := u.ParseBytes(z)
@@ -137,15 +255,18 @@ func TestSigHash(t *testing.T) {
 }
 
 func TestP2pkh(t *testing.T) {
-	tx, _ := FetchTx("452c629d67e41baec3ac6f04fe744b4b9617f8f859c63b3002f8684e7a4fee03", false)
-	check(true, tx.Verify(), t)
-	tx, _ = FetchTx("5418099cc755cb9dd3ebc6cf1a7888ad53a1a3beb5a025bce89eb1bf7f1650a2", true)
-	check(true, tx.Verify(), t)
+	tx := parseTxHex(p2pkhTx)
+	check("452c629d67e41baec3ac6f04fe744b4b9617f8f859c63b3002f8684e7a4fee03", tx.TxId(), t)
+	check(nil, tx.Verify(p2pkhTxFetcher(tx)), t)
+
+	// the signature doesn't match another key
+	fetcher := prevOutFetcher(tx, 0, 42505594, script.P2pkh(make([]byte, 20)))
+	check(true, tx.Verify(fetcher) != nil, t)
 }
 
 func TesP2sh(t *testing.T) {
-	tx, _ := FetchTx("46df1a9484d0a81d03ce0ee543ab6e1a23ed06175c104a178268fad381216c2b", false)
-	check(true, tx.Verify(), t)
+	tx, _ := FetchTx("46df1a9484d0a81d03ce0ee543ab6e1a23ed06175c104a178268fad381216c2b", &chaincfg.MainNetParams)
+	check(nil, tx.Verify(NewExplorerFetcher(&chaincfg.MainNetParams)), t)
 }
 
 func TestSignInput(t *testing.T) {
@@ -156,13 +277,49 @@ func TestSignInput(t *testing.T) {
 		panic(err)
 	}
 	r := bytes.NewReader(inB)
-	result, err := ParseTx(r, true)
+	result, err := ParseTx(r)
 	check(nil, err, t)
-	check(nil, result.SingInput(0, key), t)
-	expected := "010000000199a24308080ab26e6fb65c4eccfadf76749bb5bfa8cb08f291320b3c21e56f0d0d0000006b483045022100ed3bace23c5e17652e174c835fb72bf53ee306b3406a26890221b4cef7500f88022049c75bf1cdd5d10939596a4fc0d18e5328e5e74ca1bcb99a859b40e35fcdfc54012103935581e52c354cd2f484fe8ed83af7a3097005b2f9c60bff71d35bd795f54b67ffffffff02408af701000000001976a914d52ad7ca9b3d096a38e752c2018e6fbc40cdf26f88ac80969800000000001976a914507b27411ccf7f16f10297de6cef3f291623eddf88ac00000000"
+
+	// the amount isn't part of a legacy signature
+	prevOuts := MapFetcher{}
+	prevOuts.Add(result.TxIns[0].PreTxId, result.TxIns[0].PreTxIdx, &TxOut{
+		Amount:       50000000,
+		ScriptPubKey: script.P2pkh(u.Hash160(key.Sec(true))),
+	})
+	check(nil, result.SingInput(prevOuts, 0, key), t)
+	expected := "010000000199a24308080ab26e6fb65c4eccfadf76749bb5bfa8cb08f291320b3c21e56f0d0d0000006b4830450221008ed46aa2cf12d6d81065bfabe903670165b538f65ee9a3385e6327d80c66d3b502203124f804410527497329ec4715e18558082d489b218677bd029e7fa306a72236012103935581e52c354cd2f484fe8ed83af7a3097005b2f9c60bff71d35bd795f54b67ffffffff02408af701000000001976a914d52ad7ca9b3d096a38e752c2018e6fbc40cdf26f88ac80969800000000001976a914507b27411ccf7f16f10297de6cef3f291623eddf88ac00000000"
 	check(expected, result.Serialize(), t)
 }
 
+func TestIsStandard(t *testing.T) {
+	in := "010000000456919960ac691763688d3d3bcea9ad6ecaf875df5339e148a1fc61c6ed7a069e010000006a47304402204585bcdef85e6b1c6af5c2669d4830ff86e42dd205c0e089bc2a821657e951c002201024a10366077f87d6bce1f7100ad8cfa8a064b39d4e8fe4ea13a7b71aa8180f012102f0da57e85eec2934a82a585ea337ce2f4998b50ae699dd79f5880e253dafafb7feffffffeb8f51f4038dc17e6313cf831d4f02281c2a468bde0fafd37f1bf882729e7fd3000000006a47304402207899531a52d59a6de200179928ca900254a36b8dff8bb75f5f5d71b1cdc26125022008b422690b8461cb52c3cc30330b23d574351872b7c361e9aae3649071c1a7160121035d5c93d9ac96881f19ba1f686f15f009ded7c62efe85a872e6a19b43c15a2937feffffff567bf40595119d1bb8a3037c356efd56170b64cbcc160fb028fa10704b45d775000000006a47304402204c7c7818424c7f7911da6cddc59655a70af1cb5eaf17c69dadbfc74ffa0b662f02207599e08bc8023693ad4e9527dc42c34210f7a7d1d1ddfc8492b654a11e7620a0012102158b46fbdff65d0172b7989aec8850aa0dae49abfb84c81ae6e5b251a58ace5cfeffffffd63a5e6c16e620f86f375925b21cabaf736c779f88fd04dcad51d26690f7f345010000006a47304402200633ea0d3314bea0d95b3cd8dadb2ef79ea8331ffe1e61f762c0f6daea0fabde022029f23b3e9c30f080446150b23852028751635dcee2be669c2a1686a4b5edf304012103ffd6f4a67e94aba353a00882e563ff2722eb4cff0ad6006e86ee20dfe7520d55feffffff0251430f00000000001976a914ab0c0b2e98b1ab6dbf67d4750b0a56244948a87988ac005a6202000000001976a9143c82d7df364eb6c75be8c80df2b3eda8db57397088ac46430600"
+	inB, err := hex.DecodeString(in)
+	check(nil, err, t)
+
+	tx, err := ParseTx(bytes.NewReader(inB))
+	check(nil, err, t)
+	check(nil, tx.IsStandard(), t)
+
+	nullData, err := script.ParseASM("RETURN deadbeef")
+	check(nil, err, t)
+	tx.TxOuts = append(tx.TxOuts, &TxOut{0, nullData})
+	check(nil, tx.IsStandard(), t)
+
+	tx.TxOuts = append(tx.TxOuts, &TxOut{0, nullData})
+	check(ErrTxMultiOpReturn, tx.IsStandard(), t)
+
+	tx.TxOuts = tx.TxOuts[:2]
+	tx.TxOuts[0].Amount = 545
+	check(ErrTxDust, tx.IsStandard(), t)
+
+	tx.TxOuts[0].Amount = 546
+	tx.TxIns[0].ScriptSig = tx.TxOuts[0].ScriptPubKey
+	check(ErrTxNonStandardScriptSig, tx.IsStandard(), t)
+
+	tx.Version = 4
+	check(ErrTxNonStandardVersion, tx.IsStandard(), t)
+}
+
 func TestIsCoinbase(t *testing.T) {
 	in := "01000000010000000000000000000000000000000000000000000000000000000000000000ffffffff5e03d71b07254d696e656420627920416e74506f6f6c20626a31312f4542312f4144362f43205914293101fabe6d6d678e2c8c34afc36896e7d9402824ed38e856676ee94bfdb0c6c4bcd8b2e5666a0400000000000000c7270000a5e00e00ffffffff01faf20b58000000001976a914338c84849423992471bffb1a54a8d9b1d69dc28a88ac00000000"
 	inB, err := hex.DecodeString(in)
@@ -170,7 +327,7 @@ func TestIsCoinbase(t *testing.T) {
 		panic(err)
 	}
 	r := bytes.NewReader(inB)
-	result, err := ParseTx(r, false)
+	result, err := ParseTx(r)
 	check(nil, err, t)
 	check(true, result.IsCoinbase(), t)
 }
@@ -182,16 +339,349 @@ func TestCoinbaseHeight(t *testing.T) {
 		panic(err)
 	}
 	r := bytes.NewReader(inB)
-	result, err := ParseTx(r, false)
+	result, err := ParseTx(r)
 	check(nil, err, t)
 	height, err := result.CoinbaseHeight()
 	check(nil, err, t)
 	check(int64(465879), height, t)
 }
 
+const testFlags = script.MANDATORY_SCRIPT_VERIFY_FLAGS
+
+// noFetcher is for the tests that don't need the previous outputs.
+var noFetcher = MapFetcher{}
+
+// prevOutFetcher returns a fetcher of the output input i of tx spends.
+func prevOutFetcher(tx *Tx, i int, amount uint64, scriptPubKey *script.Script) MapFetcher {
+	fetcher := MapFetcher{}
+	fetcher.Add(tx.TxIns[i].PreTxId, tx.TxIns[i].PreTxIdx, &TxOut{Amount: amount, ScriptPubKey: scriptPubKey})
+
+	return fetcher
+}
+
 func check(expected, recived interface{}, t *testing.T) {
 	t.Helper()
 	if !reflect.DeepEqual(recived, expected) {
 		t.Errorf("Received\n%+v\ndoesn't match expected\n%+v\n", recived, expected)
 	}
 }
+
+func parseTxHex(in string) *Tx {
+	inB, err := hex.DecodeString(in)
+	if err != nil {
+		panic(err)
+	}
+	tx, err := ParseTx(bytes.NewReader(inB))
+	if err != nil {
+		panic(err)
+	}
+	return tx
+}
+
+func parseScriptHex(in string) *script.Script {
+	inB, err := hex.DecodeString(in)
+	if err != nil {
+		panic(err)
+	}
+	s, err := script.ParseRaw(inB)
+	if err != nil {
+		panic(err)
+	}
+	return s
+}
+
+func TestSigHashBip143(t *testing.T) {
+	tx := parseTxHex("0100000002fff7f7881a8099afa6940d42d1e7f6362bec38171ea3edf433541db4e4ad969f0000000000eeffffffef51e1b804cc89d182d279655c3aa89e815b1b309fe287d9b2b55d57b90ec68a0100000000ffffffff02202cb206000000001976a9148280b37df378db99f66f85c95a783a76ac7a6d5988ac9093510d000000001976a9143bde42dbee7e4dbe6a21b2d50ce2f0167faa815988ac11000000")
+	fetcher := prevOutFetcher(tx, 1, 600000000, parseScriptHex("00141d0f172a0ecb48aee1be1f2687d2963ae33f71a1"))
+
+	z, err := tx.SigHashBip143(fetcher, 1, nil, nil, SIGHASH_ALL)
+	check(nil, err, t)
+	check("c37af31116d1b27caf68aae9e3ac82f1477929014d5b917657d0eb49478cb670", hex.EncodeToString(z), t)
+	cache := newSigHashCache(tx, fetcher)
+	check("96b827c8483d4e9b96712b6713a7b68d6e8003a781feba36c31143470b4efd37", hex.EncodeToString(cache.getHashPrevouts()), t)
+	check("52b0a642eea2fb7ae638c36f6252b6750293dbe574a806984b8e4d8548339a3b", hex.EncodeToString(cache.getHashSequence()), t)
+	check("863ef3e1a92afbfdb97f31ad0fc7683ee943e9abcf2501590ff8f6551f47e5e5", hex.EncodeToString(cache.getHashOutputs()), t)
+
+	// a cache hashes the outputs once, each call of SigHashBip143 again
+	tx.TxOuts[0].Amount++
+	check("863ef3e1a92afbfdb97f31ad0fc7683ee943e9abcf2501590ff8f6551f47e5e5", hex.EncodeToString(cache.getHashOutputs()), t)
+	z, err = tx.SigHashBip143(fetcher, 1, nil, nil, SIGHASH_ALL)
+	check(nil, err, t)
+	check(false, hex.EncodeToString(z) == "c37af31116d1b27caf68aae9e3ac82f1477929014d5b917657d0eb49478cb670", t)
+
+	tx = parseTxHex("0100000001db6b1b20aa0fd7b23880be2ecbd4a98130974cf4748fb66092ac4d3ceb1a54770100000000feffffff02b8b4eb0b000000001976a914a457b684d7f0d539a46a45bbc043f35b59d0d96388ac0008af2f000000001976a914fd270b1ee6abcaea97fea7ad0402e8bd8ad6d77c88ac92040000")
+	fetcher = prevOutFetcher(tx, 0, 1000000000, parseScriptHex("a9144733f37cf4db86fbc2efed2500b4f4e49f31202387"))
+
+	z, err = tx.SigHashBip143(fetcher, 0, parseScriptHex("001479091972186c449eb1ded22b78e40d009bdf0089"), nil, SIGHASH_ALL)
+	check(nil, err, t)
+	check("64f3b0f4dd2bb3aa1ce8566d220cc74dda9df97d8490cc81d89d735c92e59fb6", hex.EncodeToString(z), t)
+
+	// the script code is only taken from a P2WPKH script
+	_, err = tx.SigHashBip143(fetcher, 0, parseScriptHex("51"), nil, SIGHASH_ALL)
+	check(ErrTxScriptCode, err, t)
+	_, err = tx.SigHashBip143(fetcher, 0, nil, nil, SIGHASH_ALL)
+	check(ErrTxScriptCode, err, t)
+}
+
+func TestSignInputP2wpkh(t *testing.T) {
+	tx := parseTxHex("0100000002fff7f7881a8099afa6940d42d1e7f6362bec38171ea3edf433541db4e4ad969f0000000000eeffffffef51e1b804cc89d182d279655c3aa89e815b1b309fe287d9b2b55d57b90ec68a0100000000ffffffff02202cb206000000001976a9148280b37df378db99f66f85c95a783a76ac7a6d5988ac9093510d000000001976a9143bde42dbee7e4dbe6a21b2d50ce2f0167faa815988ac11000000")
+	fetcher := prevOutFetcher(tx, 1, 600000000, parseScriptHex("00141d0f172a0ecb48aee1be1f2687d2963ae33f71a1"))
+
+	secret, _ := u.ParseInt("619c335025c7f4012e556c2a58b2506e30b8511b53ade95ea316fd8c3286feb9", 16)
+	check(nil, tx.SingInput(fetcher, 1, c.NewPrivateKey(secret)), t)
+
+	check(0, len(tx.TxIns[1].ScriptSig.Cmds), t)
+	check("304402203609e17b84f6a7d30c80bfa610b5b4542f32a8a0d5447a12fb1366d7f01cc44a0220573a954c4518331561406f90300e8f3358f51928d43c212a8caed02de67eebee01", hex.EncodeToString(tx.TxIns[1].Witness[0]), t)
+	check("025476c2e83188368da1ff3e292e7acafcdb3566bb0ad253f62fc70f07aeee6357", hex.EncodeToString(tx.TxIns[1].Witness[1]), t)
+	check(nil, tx.verifyInput(fetcher, 1, testFlags), t)
+}
+
+func TestSignInputP2shP2wpkh(t *testing.T) {
+	tx := parseTxHex("0100000001db6b1b20aa0fd7b23880be2ecbd4a98130974cf4748fb66092ac4d3ceb1a54770100000000feffffff02b8b4eb0b000000001976a914a457b684d7f0d539a46a45bbc043f35b59d0d96388ac0008af2f000000001976a914fd270b1ee6abcaea97fea7ad0402e8bd8ad6d77c88ac92040000")
+	fetcher := prevOutFetcher(tx, 0, 1000000000, parseScriptHex("a9144733f37cf4db86fbc2efed2500b4f4e49f31202387"))
+
+	secret, _ := u.ParseInt("eb696a065ef48a2192da5b28b694f87544b30fae8327c4510137a922f32c6dcf", 16)
+	check(nil, tx.SingInput(fetcher, 0, c.NewPrivateKey(secret)), t)
+
+	expected := "01000000000101db6b1b20aa0fd7b23880be2ecbd4a98130974cf4748fb66092ac4d3ceb1a5477010000001716001479091972186c449eb1ded22b78e40d009bdf0089feffffff02b8b4eb0b000000001976a914a457b684d7f0d539a46a45bbc043f35b59d0d96388ac0008af2f000000001976a914fd270b1ee6abcaea97fea7ad0402e8bd8ad6d77c88ac02473044022047ac8e878352d3ebbde1c94ce3a10d057c24175747116f8288e5d794d12d482f0220217f36a485cae903c713331d877c1f64677e3622ad4010726870540656fe9dcb012103ad1d8e89212f0b92c74d23bb710c00662ad1470198ac48c43f7d6f93a2a2687392040000"
+	check(expected, tx.Serialize(), t)
+}
+
+func TestSignInputP2wsh(t *testing.T) {
+	key := c.NewPrivateKey(u.NewInt(8675309))
+	witnessScript := &script.Script{Cmds: [][]byte{key.Sec(true), {0xac}}}
+	sum := sha256.Sum256(witnessScript.RawSerialize())
+
+	tx := parseTxHex("010000000199a24308080ab26e6fb65c4eccfadf76749bb5bfa8cb08f291320b3c21e56f0d0d00000000ffffffff02408af701000000001976a914d52ad7ca9b3d096a38e752c2018e6fbc40cdf26f88ac80969800000000001976a914507b27411ccf7f16f10297de6cef3f291623eddf88ac00000000")
+	fetcher := prevOutFetcher(tx, 0, 50000000, script.P2wsh(sum[:]))
+
+	check(ErrTxWitnessScript, tx.SingInput(fetcher, 0, key), t)
+
+	tx.TxIns[0].WitnessScript = witnessScript
+	check(nil, tx.SingInput(fetcher, 0, key), t)
+	check(2, len(tx.TxIns[0].Witness), t)
+	check(witnessScript.RawSerialize(), tx.TxIns[0].Witness[1], t)
+
+	tx.TxIns[0].Witness[1] = script.P2pkh(u.Hash160(key.Sec(true))).RawSerialize()
+	check(script.ErrWitnessProgramMismatch, tx.verifyInput(fetcher, 0, testFlags), t)
+	check(&InputError{0, script.ErrWitnessProgramMismatch}, tx.Verify(fetcher), t)
+}
+
+func TestSigHashTypes(t *testing.T) {
+	// vectors from Bitcoin Core sighash.json, the hash is in internal byte order
+	tests := []struct {
+		test     string
+		tx       string
+		script   string
+		i        int
+		hashType uint32
+		expected string
+	}{
+		{"all", "fea256ce01272d125e577c0a09570a71366898280dda279b021000db1325f27edda41a53460100000002ab53c752c21c013c2b3a01000000000000000000", "65", 0, 1145543262, "076b9f844f6ae429de228a2c337c704df1652c292b6c6494882190638dad9efd"},
+		{"all anyonecanpay", "e3cdbfb4014d90ae6a4401e85f7ac717adc2c035858bf6ff48979dd399d155bce1f150daea0300000002ac51a67a0d39017f6c71040000000005535200535200000000", "", 0, 2395016385, "c1c7df8206e661d593f6455db1d61a364a249407f88e99ecad05346e495b38d7"},
+		{"none", "97be4f7702dc20b087a1fdd533c7de762a3f2867a8f439bddf0dcec9a374dfd0276f9c55cc0300000000cdfb1dbe6582499569127bda6ca4aaff02c132dc73e15dcd91d73da77e92a32a13d1a0ba0200000002ab51ffffffff048cfbe202000000000900516351515363ac535128ce0100000000076aac5365ab6aabc84e8302000000000863536a53ab6a6552f051230500000000066aac535153510848d813", "ac51", 0, 229541474, "e5da9a416ea883be1f8b8b2d178463633f19de3fa82ae25d44ffb531e35bdbc8"},
+		{"none anyonecanpay", "b3cad3a7041c2c17d90a2cd994f6c37307753fa3635e9ef05ab8b1ff121ca11239a0902e700300000009ab635300006aac5163ffffffffcec91722c7468156dce4664f3c783afef147f0e6f80739c83b5f09d5a09a57040200000004516a6552ffffffff969d1c6daf8ef53a70b7cdf1b4102fb3240055a8eaeaed2489617cd84cfd56cf020000000352ab53ffffffff46598b6579494a77b593681c33422a99559b9993d77ca2fa97833508b0c169f80200000009655300655365516351ffffffff04d7ddf800000000000853536a65ac6351ab09f3420300000000056aab65abac33589d04000000000952656a65655151acac944d6f0400000000006a8004ba", "005165", 1, 1035865506, "fe1dc9e8554deecf8f50c417c670b839cc9d650722ebaaf36572418756075d58"},
+		{"single", "ff5400dd02fec5beb9a396e1cbedc82bedae09ed44bae60ba9bef2ff375a6858212478844b03000000025253ffffffff01e46c203577a79d1172db715e9cc6316b9cfc59b5e5e4d9199fef201c6f9f0f000000000900ab6552656a5165acffffffff02e8ce62040000000002515312ce3e00000000000251513f119316", "", 0, 1541581667, "1e0da47eedbbb381b0e0debbb76e128d042e02e65b11125e17fd127305fc65cd"},
+		{"codeseparator", "1d9c5df20139904c582285e1ea63dec934251c0f9cf5c47e86abfb2b394ebc57417a81f67c010000000353515222ba722504800d3402000000000353656a3c0b4a0200000000000fb8d20500000000076300ab005200516462f30400000000015200000000", "ab65", 0, 4084113184, "edf73e2396694e58f6b619f68595b0c1cdcb56a9b3147845b6d6afdb5a80b736"},
+		{"single anyonecanpay", "9ff618e60136f8e6bb7eabaaac7d6e2535f5fba95854be6d2726f986eaa9537cb283c701ff02000000026a65ffffffff012d1c0905000000000865ab00ac6a516a652f9ad240", "51515253635351ac", 0, 1571304387, "659cd3203095d4a8672646add7d77831a1926fc5b66128801979939383695a79"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.test, func(t *testing.T) {
+			tx := parseTxHex(test.tx)
+			z, err := tx.SigHash(noFetcher, test.i, parseScriptHex(test.script), test.hashType)
+			check(nil, err, t)
+			u.ReverseBytes(z)
+			check(test.expected, hex.EncodeToString(z), t)
+		})
+	}
+}
+
+func TestSigHashSingleBug(t *testing.T) {
+	tx := parseTxHex("ff5400dd02fec5beb9a396e1cbedc82bedae09ed44bae60ba9bef2ff375a6858212478844b03000000025253ffffffff01e46c203577a79d1172db715e9cc6316b9cfc59b5e5e4d9199fef201c6f9f0f000000000900ab6552656a5165acffffffff01e8ce62040000000002515300000000")
+	z, err := tx.SigHash(noFetcher, 1, parseScriptHex("51"), SIGHASH_SINGLE)
+	check(nil, err, t)
+	check("0100000000000000000000000000000000000000000000000000000000000000", hex.EncodeToString(z), t)
+}
+
+func TestSigHashBip143Types(t *testing.T) {
+	// BIP143 P2SH-P2WSH example, signed with all six sighash types
+	tx := parseTxHex("010000000136641869ca081e70f394c6948e8af409e18b619df2ed74aa106c1ca29787b96e0100000000ffffffff0200e9a435000000001976a914389ffce9cd9ae88dcc0631e88a821ffdbe9bfe2688acc0832f05000000001976a9147480a33f950689af511e6e84c138dbbd3c3ee41588ac00000000")
+	fetcher := prevOutFetcher(tx, 0, 987654321, parseScriptHex("a9149993a429037b5d912407a71c252019287b8d27a587"))
+	witnessScript := parseScriptHex("56210307b8ae49ac90a048e9b53357a2354b3334e9c8bee813ecb98e99a7e07e8c3ba32103b28f0c28bfab54554ae8c658ac5c3e0ce6e79ad336331f78c428dd43eea8449b21034b8113d703413d57761b8b9781957b8c0ac1dfe69f492580ca4195f50376ba4a21033400f6afecb833092a9a21cfdf1ed1376e58c5d1f47de74683123987e967a8f42103a6d48b1131e94ba04d9737d61acdaa1322008af9602b3b14862c07a1789aac162102d8b661b0b3302ee2f162b09e07a55ad5dfbe673a9f01d9f0c19617681024306b56ae")
+
+	tests := []struct {
+		test     string
+		hashType uint32
+		expected string
+	}{
+		{"all", SIGHASH_ALL, "185c0be5263dce5b4bb50a047973c1b6272bfbd0103a89444597dc40b248ee7c"},
+		{"none", SIGHASH_NONE, "e9733bc60ea13c95c6527066bb975a2ff29a925e80aa14c213f686cbae5d2f36"},
+		{"single", SIGHASH_SINGLE, "1e1f1c303dc025bd664acb72e583e933fae4cff9148bf78c157d1e8f78530aea"},
+		{"all anyonecanpay", SIGHASH_ALL | SIGHASH_ANYONECANPAY, "2a67f03e63a6a422125878b40b82da593be8d4efaafe88ee528af6e5a9955c6e"},
+		{"none anyonecanpay", SIGHASH_NONE | SIGHASH_ANYONECANPAY, "781ba15f3779d5542ce8ecb5c18716733a5ee42a6f51488ec96154934e2c890a"},
+		{"single anyonecanpay", SIGHASH_SINGLE | SIGHASH_ANYONECANPAY, "511e8e52ed574121fc1b654970395502128263f62662e076dc6baf05c2e6a99b"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.test, func(t *testing.T) {
+			z, err := tx.SigHashBip143(fetcher, 0, nil, witnessScript, test.hashType)
+			check(nil, err, t)
+			check(test.expected, hex.EncodeToString(z), t)
+		})
+	}
+}
+
+func TestSignInputWithHashType(t *testing.T) {
+	hashTypes := []uint32{
+		SIGHASH_NONE,
+		SIGHASH_SINGLE,
+		SIGHASH_ALL | SIGHASH_ANYONECANPAY,
+		SIGHASH_SINGLE | SIGHASH_ANYONECANPAY,
+	}
+	secret, _ := u.ParseInt("619c335025c7f4012e556c2a58b2506e30b8511b53ade95ea316fd8c3286feb9", 16)
+	key := c.NewPrivateKey(secret)
+
+	for _, hashType := range hashTypes {
+		tx := parseTxHex("0100000002fff7f7881a8099afa6940d42d1e7f6362bec38171ea3edf433541db4e4ad969f0000000000eeffffffef51e1b804cc89d182d279655c3aa89e815b1b309fe287d9b2b55d57b90ec68a0100000000ffffffff02202cb206000000001976a9148280b37df378db99f66f85c95a783a76ac7a6d5988ac9093510d000000001976a9143bde42dbee7e4dbe6a21b2d50ce2f0167faa815988ac11000000")
+		fetcher := prevOutFetcher(tx, 1, 600000000, parseScriptHex("00141d0f172a0ecb48aee1be1f2687d2963ae33f71a1"))
+
+		check(nil, tx.SingInputWithHashType(fetcher, 1, key, hashType), t)
+		sig := tx.TxIns[1].Witness[0]
+		check(byte(hashType), sig[len(sig)-1], t)
+
+		check(nil, tx.verifyInput(fetcher, 1, testFlags), t)
+
+		// dropping the other input moves ours to index 0, which only
+		// ALL|ANYONECANPAY doesn't commit to
+		tx.TxIns = tx.TxIns[1:]
+		expected := script.ErrEvalFalse
+		if hashType == SIGHASH_ALL|SIGHASH_ANYONECANPAY {
+			expected = nil
+		}
+		check(expected, tx.verifyInput(fetcher, 0, testFlags), t)
+	}
+}
+
+type taprootRefCase struct {
+	Tx       string   `json:"tx"`
+	Prevouts []string `json:"prevouts"`
+	Index    int      `json:"index"`
+	Comment  string   `json:"comment"`
+	Success  *struct {
+		ScriptSig string   `json:"scriptSig"`
+		Witness   []string `json:"witness"`
+	} `json:"success"`
+	Failure *struct {
+		ScriptSig string   `json:"scriptSig"`
+		Witness   []string `json:"witness"`
+	} `json:"failure"`
+}
+
+func TestTaprootRef(t *testing.T) {
+	// a selection of Bitcoin Core's script_assets_test cases
+	b, err := ioutil.ReadFile("testdata/taproot_ref.json")
+	check(nil, err, t)
+
+	var cases []taprootRefCase
+	check(nil, json.Unmarshal(b, &cases), t)
+
+	for _, test := range cases {
+		t.Run(test.Comment, func(t *testing.T) {
+			tx := parseTxHex(test.Tx)
+			fetcher := MapFetcher{}
+			for i, prevout := range test.Prevouts {
+				prevoutB, _ := hex.DecodeString(prevout)
+				txOut, err := ParseTxOut(bytes.NewReader(prevoutB))
+				check(nil, err, t)
+				fetcher.Add(tx.TxIns[i].PreTxId, tx.TxIns[i].PreTxIdx, txOut)
+			}
+
+			txIn := tx.TxIns[test.Index]
+
+			txIn.ScriptSig = parseScriptHex(test.Success.ScriptSig)
+			txIn.Witness = parseWitnessHex(test.Success.Witness)
+			check(nil, tx.verifyInput(fetcher, test.Index, testFlags), t)
+
+			if test.Failure != nil {
+				txIn.ScriptSig = parseScriptHex(test.Failure.ScriptSig)
+				txIn.Witness = parseWitnessHex(test.Failure.Witness)
+				check(true, tx.verifyInput(fetcher, test.Index, testFlags) != nil, t)
+			}
+		})
+	}
+}
+
+func parseWitnessHex(in []string) [][]byte {
+	witness := make([][]byte, 0, len(in))
+	for _, item := range in {
+		b, err := hex.DecodeString(item)
+		if err != nil {
+			panic(err)
+		}
+		witness = append(witness, b)
+	}
+	return witness
+}
+
+func TestSignInputTaproot(t *testing.T) {
+	key := c.NewPrivateKey(u.NewInt(8675309))
+	p2tr, err := script.P2trFromTree(key.Point(), nil)
+	check(nil, err, t)
+
+	for _, hashType := range []uint32{SIGHASH_DEFAULT, SIGHASH_ALL, SIGHASH_SINGLE | SIGHASH_ANYONECANPAY} {
+		tx := parseTxHex("010000000199a24308080ab26e6fb65c4eccfadf76749bb5bfa8cb08f291320b3c21e56f0d0d00000000ffffffff02408af701000000001976a914d52ad7ca9b3d096a38e752c2018e6fbc40cdf26f88ac80969800000000001976a914507b27411ccf7f16f10297de6cef3f291623eddf88ac00000000")
+		fetcher := prevOutFetcher(tx, 0, 50000000, p2tr)
+
+		check(nil, tx.SingInputWithHashType(fetcher, 0, key, hashType), t)
+		check(1, len(tx.TxIns[0].Witness), t)
+		if hashType == SIGHASH_DEFAULT {
+			check(64, len(tx.TxIns[0].Witness[0]), t)
+		} else {
+			check(65, len(tx.TxIns[0].Witness[0]), t)
+		}
+		check(nil, tx.verifyInput(fetcher, 0, testFlags), t)
+
+		fetcher = prevOutFetcher(tx, 0, 50000001, p2tr)
+		check(script.ErrSchnorrSig, tx.verifyInput(fetcher, 0, testFlags), t)
+	}
+
+	// the amount of another input the signature hash commits to is missing
+	tx := parseTxHex("010000000199a24308080ab26e6fb65c4eccfadf76749bb5bfa8cb08f291320b3c21e56f0d0d00000000ffffffff02408af701000000001976a914d52ad7ca9b3d096a38e752c2018e6fbc40cdf26f88ac80969800000000001976a914507b27411ccf7f16f10297de6cef3f291623eddf88ac00000000")
+	fetcher := prevOutFetcher(tx, 0, 50000000, p2tr)
+	check(nil, tx.SingInput(fetcher, 0, key), t)
+	tx.TxIns = append(tx.TxIns, &TxIn{PreTxId: strings.Repeat("22", 32), Sequence: 0xffffffff})
+	check(ErrTxPrevOutNotFound, tx.verifyInput(fetcher, 0, testFlags), t)
+
+	// a hash type taproot doesn't take
+	tx.TxIns[0].Witness[0] = append(tx.TxIns[0].Witness[0], 0x04)
+	check(script.ErrSchnorrSigHashType, tx.verifyInput(fetcher, 0, testFlags), t)
+}
+
+func TestSignInputTapscript(t *testing.T) {
+	internal := c.NewPrivateKey(u.NewInt(8675309))
+	alice := c.NewPrivateKey(u.NewInt(1))
+	bob := c.NewPrivateKey(u.NewInt(6))
+	aliceLeaf := &script.Script{Cmds: [][]byte{alice.XOnly(), {0xac}}}
+	bobLeaf := &script.Script{Cmds: [][]byte{bob.XOnly(), {0xac}}}
+	tree := script.NewTapBranch(script.NewTapLeaf(aliceLeaf), script.NewTapLeaf(bobLeaf))
+
+	p2tr, err := script.P2trFromTree(internal.Point(), tree)
+	check(nil, err, t)
+
+	tx := parseTxHex("010000000199a24308080ab26e6fb65c4eccfadf76749bb5bfa8cb08f291320b3c21e56f0d0d00000000ffffffff02408af701000000001976a914d52ad7ca9b3d096a38e752c2018e6fbc40cdf26f88ac80969800000000001976a914507b27411ccf7f16f10297de6cef3f291623eddf88ac00000000")
+	fetcher := prevOutFetcher(tx, 0, 50000000, p2tr)
+
+	check(nil, tx.SingInputTaproot(fetcher, 0, internal, tree.Hash(), SIGHASH_DEFAULT), t)
+	check(nil, tx.verifyInput(fetcher, 0, testFlags), t)
+
+	check(nil, tx.SingInputTapscript(fetcher, 0, bob, internal.Point(), tree, bobLeaf, SIGHASH_DEFAULT), t)
+	check(3, len(tx.TxIns[0].Witness), t)
+	check(nil, tx.verifyInput(fetcher, 0, testFlags), t)
+
+	// alice can't spend through bob's leaf
+	check(script.ErrSchnorrSig, tx.SingInputTapscript(fetcher, 0, alice, internal.Point(), tree, bobLeaf, SIGHASH_DEFAULT), t)
+
+	unknown := &script.Script{Cmds: [][]byte{{0x51}}}
+	check(script.ErrTapLeafNotFound, tx.SingInputTapscript(fetcher, 0, alice, internal.Point(), tree, unknown, SIGHASH_DEFAULT), t)
+}
@@ -1,6 +1,7 @@
 package tx
 
 import (
+	"bytes"
 	"encoding/binary"
 	"encoding/hex"
 	"fmt"
@@ -11,12 +12,15 @@ import (
 )
 
 type TxIn struct {
-	PreTxId      string
-	PreTxIdx     uint32
-	ScriptSig    *script.Script
-	Sequence     uint32
-	value        uint64
-	scriptPubKey *script.Script
+	PreTxId   string
+	PreTxIdx  uint32
+	ScriptSig *script.Script
+	Sequence  uint32
+	Witness   [][]byte
+	// RedeemScript and WitnessScript are used when signing P2SH and P2WSH
+	// inputs, they are not serialized.
+	RedeemScript  *script.Script
+	WitnessScript *script.Script
 }
 
 func (txIn *TxIn) String() string {
@@ -49,6 +53,16 @@ func (txIn *TxIn) Serialize() []byte {
 	return result
 }
 
+func (txIn *TxIn) serializeWitness() []byte {
+	result := u.EncodeVariant(len(txIn.Witness))
+	for _, item := range txIn.Witness {
+		result = append(result, u.EncodeVariant(len(item))...)
+		result = append(result, item...)
+	}
+
+	return result
+}
+
 func (txIn *TxIn) serializePreTxId() []byte {
 	preTxId, err := hex.DecodeString(txIn.PreTxId)
 	u.ReverseBytes(preTxId)
@@ -72,56 +86,54 @@ func (txIn *TxIn) serializeSequence() []byte {
 	return sequence
 }
 
-func (txIn *TxIn) SerializeSigHash(replaceScriptSig, testnet bool, redeemScript *script.Script) ([]byte, error) {
+func (txIn *TxIn) SerializeSigHash(scriptCode *script.Script, zeroSequence bool) []byte {
 	result := []byte{}
 	result = append(result, txIn.serializePreTxId()...)
 	result = append(result, txIn.serializePreTxIdx()...)
 
-	if replaceScriptSig {
-		if redeemScript != nil {
-			result = append(result, redeemScript.Serialize()...)
-		} else {
-			scriptPubKey, err := txIn.ScriptPubKey(testnet)
-			if err != nil {
-				return nil, err
-			}
-			result = append(result, scriptPubKey.Serialize()...)
-		}
+	if scriptCode != nil {
+		result = append(result, scriptCode.SerializeScriptCode()...)
 	} else {
 		result = append(result, 0x00)
 	}
 
-	result = append(result, txIn.serializeSequence()...)
+	if zeroSequence {
+		result = append(result, make([]byte, 4)...)
+	} else {
+		result = append(result, txIn.serializeSequence()...)
+	}
 
-	return result, nil
+	return result
 }
 
-func (txIn *TxIn) Value(testnet bool) (uint64, error) {
-
-	if txIn.value == 0 {
-		prevTx, err := FetchTx(txIn.PreTxId, testnet)
-		if err != nil {
-			return 0, err
-		}
-
-		txIn.value = prevTx.TxOuts[txIn.PreTxIdx].Amount
+// getAnnex returns the BIP341 annex of a taproot witness, or nil.
+func (txIn *TxIn) getAnnex() []byte {
+	l := len(txIn.Witness)
+	if l < 2 || len(txIn.Witness[l-1]) == 0 || txIn.Witness[l-1][0] != 0x50 {
+		return nil
 	}
 
-	return txIn.value, nil
+	return txIn.Witness[l-1]
 }
 
-func (txIn *TxIn) ScriptPubKey(testnet bool) (*script.Script, error) {
+// Value returns the amount of the previous output.
+func (txIn *TxIn) Value(fetcher PrevOutFetcher) (uint64, error) {
+	txOut, err := fetcher.FetchPrevOut(txIn.PreTxId, txIn.PreTxIdx)
+	if err != nil {
+		return 0, err
+	}
 
-	if txIn.scriptPubKey == nil {
-		prevTx, err := FetchTx(txIn.PreTxId, testnet)
-		if err != nil {
-			return nil, err
-		}
+	return txOut.Amount, nil
+}
 
-		txIn.scriptPubKey = prevTx.TxOuts[txIn.PreTxIdx].ScriptPubKey
+// ScriptPubKey returns the script pubkey of the previous output.
+func (txIn *TxIn) ScriptPubKey(fetcher PrevOutFetcher) (*script.Script, error) {
+	txOut, err := fetcher.FetchPrevOut(txIn.PreTxId, txIn.PreTxIdx)
+	if err != nil {
+		return nil, err
 	}
 
-	return txIn.scriptPubKey, nil
+	return txOut.ScriptPubKey, nil
 }
 
 func ParseTxIn(r io.Reader) (*TxIn, error) {
@@ -161,3 +173,33 @@ func ParseTxIn(r io.Reader) (*TxIn, error) {
 
 	return txIn, nil
 }
+
+func ParseWitness(r io.Reader) ([][]byte, error) {
+	n, err := u.ReadVariant(r)
+	if err != nil {
+		return nil, err
+	}
+	// the count and the lengths aren't trusted with an allocation
+	if n > maxBlockWeight {
+		return nil, ErrTxTooLarge
+	}
+
+	witness := [][]byte{}
+	for i := uint64(0); i < n; i++ {
+		l, err := u.ReadVariant(r)
+		if err != nil {
+			return nil, err
+		}
+		if l > maxBlockWeight {
+			return nil, ErrTxTooLarge
+		}
+
+		var item bytes.Buffer
+		if _, err := io.CopyN(&item, r, int64(l)); err != nil {
+			return nil, err
+		}
+		witness = append(witness, item.Bytes())
+	}
+
+	return witness, nil
+}
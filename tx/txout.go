@@ -26,6 +26,12 @@ func (txOut *TxOut) Serialize() []byte {
 	return append(amount, scriptPubKey...)
 }
 
+// IsDust reports whether the output is worth less than spending it costs
+// under the default dust relay fee.
+func (txOut *TxOut) IsDust() bool {
+	return txOut.Amount < script.DustThreshold(txOut.ScriptPubKey)
+}
+
 func ParseTxOut(r io.Reader) (*TxOut, error) {
 	b := make([]byte, 8)
 
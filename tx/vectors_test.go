@@ -0,0 +1,323 @@
+package tx
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"strings"
+	"testing"
+
+	u "github.com/lobiCode/prog_btc_go/btcutils"
+	"github.com/lobiCode/prog_btc_go/script"
+)
+
+// The vectors in testdata are Bitcoin Core's, as vendored by btcd, with one
+// local edit: the 14 script_tests.json vectors of the witness scripts 635168
+// and 645168 that leave an empty stack or more than one element on it expect
+// CLEANSTACK instead of EVAL_FALSE, the error current Bitcoin Core reports
+// for them.
+
+// scriptErrorNames maps the errors Evaluate returns to Bitcoin Core's names.
+var scriptErrorNames = map[error]string{
+	script.ErrEvalFalse:                          "EVAL_FALSE",
+	script.ErrOpReturn:                           "OP_RETURN",
+	script.ErrScriptSize:                         "SCRIPT_SIZE",
+	script.ErrPushSize:                           "PUSH_SIZE",
+	script.ErrOpCount:                            "OP_COUNT",
+	script.ErrStackSize:                          "STACK_SIZE",
+	script.ErrSigCount:                           "SIG_COUNT",
+	script.ErrPubKeyCount:                        "PUBKEY_COUNT",
+	script.ErrVerify:                             "VERIFY",
+	script.ErrEqualVerify:                        "EQUALVERIFY",
+	script.ErrCheckMultisigVerify:                "CHECKMULTISIGVERIFY",
+	script.ErrCheckSigVerify:                     "CHECKSIGVERIFY",
+	script.ErrNumEqualVerify:                     "NUMEQUALVERIFY",
+	script.ErrBadOpcode:                          "BAD_OPCODE",
+	script.ErrDisabledOpcode:                     "DISABLED_OPCODE",
+	script.ErrStackUnderflow:                     "INVALID_STACK_OPERATION",
+	script.ErrAltStackUnderflow:                  "INVALID_ALTSTACK_OPERATION",
+	script.ErrUnbalancedConditional:              "UNBALANCED_CONDITIONAL",
+	script.ErrNegativeLockTime:                   "NEGATIVE_LOCKTIME",
+	script.ErrUnsatisfiedLockTime:                "UNSATISFIED_LOCKTIME",
+	script.ErrSigHashType:                        "SIG_HASHTYPE",
+	script.ErrSigDER:                             "SIG_DER",
+	script.ErrMinimalData:                        "MINIMALDATA",
+	script.ErrSigPushOnly:                        "SIG_PUSHONLY",
+	script.ErrSigHighS:                           "SIG_HIGH_S",
+	script.ErrSigNullDummy:                       "SIG_NULLDUMMY",
+	script.ErrPubKeyType:                         "PUBKEYTYPE",
+	script.ErrCleanStack:                         "CLEANSTACK",
+	script.ErrMinimalIf:                          "MINIMALIF",
+	script.ErrSigNullFail:                        "NULLFAIL",
+	script.ErrDiscourageUpgradableNops:           "DISCOURAGE_UPGRADABLE_NOPS",
+	script.ErrDiscourageUpgradableWitnessProgram: "DISCOURAGE_UPGRADABLE_WITNESS_PROGRAM",
+	script.ErrWitnessProgramWrongLength:          "WITNESS_PROGRAM_WRONG_LENGTH",
+	script.ErrWitnessProgramWitnessEmpty:         "WITNESS_PROGRAM_WITNESS_EMPTY",
+	script.ErrWitnessProgramMismatch:             "WITNESS_PROGRAM_MISMATCH",
+	script.ErrWitnessMalleated:                   "WITNESS_MALLEATED",
+	script.ErrWitnessMalleatedP2SH:               "WITNESS_MALLEATED_P2SH",
+	script.ErrWitnessUnexpected:                  "WITNESS_UNEXPECTED",
+	script.ErrWitnessPubKeyType:                  "WITNESS_PUBKEYTYPE",
+	script.ErrNumOverflow:                        "UNKNOWN_ERROR",
+	script.ErrNumNotMinimal:                      "UNKNOWN_ERROR",
+}
+
+func scriptErrorName(err error) string {
+	if err == nil {
+		return "OK"
+	}
+
+	if name, ok := scriptErrorNames[err]; ok {
+		return name
+	}
+
+	return err.Error()
+}
+
+// creditingTx and spendingTx are the transactions Bitcoin Core's script
+// tests evaluate a script pair with.
+func creditingTx(scriptPubKey *script.Script, amount uint64) *Tx {
+	txIn := &TxIn{
+		PreTxId:   strings.Repeat("00", 32),
+		PreTxIdx:  0xffffffff,
+		ScriptSig: &script.Script{Cmds: [][]byte{{0}, {0}}},
+		Sequence:  0xffffffff,
+	}
+	txOut := &TxOut{Amount: amount, ScriptPubKey: scriptPubKey}
+
+	return &Tx{Version: 1, TxIns: []*TxIn{txIn}, TxOuts: []*TxOut{txOut}}
+}
+
+func spendingTx(scriptSig *script.Script, witness [][]byte, credit *Tx) *Tx {
+	txIn := &TxIn{
+		PreTxId:   credit.TxId(),
+		PreTxIdx:  0,
+		ScriptSig: scriptSig,
+		Sequence:  0xffffffff,
+		Witness:   witness,
+	}
+	txOut := &TxOut{Amount: credit.TxOuts[0].Amount, ScriptPubKey: &script.Script{}}
+
+	return &Tx{Version: 1, TxIns: []*TxIn{txIn}, TxOuts: []*TxOut{txOut}}
+}
+
+func readVectors(name string, t *testing.T) [][]interface{} {
+	t.Helper()
+	b, err := ioutil.ReadFile("testdata/" + name)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var vectors [][]interface{}
+	if err := json.Unmarshal(b, &vectors); err != nil {
+		t.Fatal(err)
+	}
+
+	return vectors
+}
+
+func TestScriptVectors(t *testing.T) {
+	var ran, failed int
+	for i, v := range readVectors("script_tests.json", t) {
+		if len(v) == 1 {
+			continue
+		}
+
+		var witness [][]byte
+		var amount uint64
+		if w, ok := v[0].([]interface{}); ok {
+			for _, item := range w[:len(w)-1] {
+				b, err := hex.DecodeString(item.(string))
+				check(nil, err, t)
+				witness = append(witness, b)
+			}
+			amount = uint64(w[len(w)-1].(float64)*1e8 + 0.5)
+			v = v[1:]
+		}
+
+		name := fmt.Sprintf("%d %v", i, v)
+		expected := v[3].(string)
+
+		flags, err := script.ParseScriptFlags(v[2].(string))
+		check(nil, err, t)
+
+		sigRaw, err := script.AssembleASM(v[0].(string))
+		check(nil, err, t)
+		pubKeyRaw, err := script.AssembleASM(v[1].(string))
+		check(nil, err, t)
+
+		ran++
+		sig, err := script.ParseRaw(sigRaw)
+		check(nil, err, t)
+		pubKey, err := script.ParseRaw(pubKeyRaw)
+		check(nil, err, t)
+
+		credit := creditingTx(pubKey, amount)
+		tx := spendingTx(sig, witness, credit)
+		fetcher := MapFetcher{}
+		fetcher.AddTx(credit)
+		got := scriptErrorName(tx.verifyInput(fetcher, 0, flags))
+		if got == expected {
+			continue
+		}
+
+		t.Errorf("%s: got %s", name, got)
+		failed++
+	}
+
+	t.Logf("%d of %d script vectors passed", ran-failed, ran)
+}
+
+var errMissingPrevOut = errors.New("prevout not in the vector")
+
+// txParseError is a vector transaction that doesn't deserialize, the other
+// vectorTx errors are of the vector itself.
+type txParseError struct {
+	err error
+}
+
+func (e *txParseError) Error() string {
+	return e.err.Error()
+}
+
+// vectorTx parses a tx_valid.json or tx_invalid.json entry, the prevouts it
+// spends are returned in a fetcher.
+func vectorTx(v []interface{}) (tx *Tx, fetcher MapFetcher, flags script.ScriptFlags, err error) {
+	fetcher = MapFetcher{}
+	for _, p := range v[0].([]interface{}) {
+		p := p.([]interface{})
+		raw, err := script.AssembleASM(p[2].(string))
+		if err != nil {
+			return nil, nil, 0, err
+		}
+		scriptPubKey, err := script.ParseRaw(raw)
+		if err != nil {
+			return nil, nil, 0, err
+		}
+
+		var amount uint64
+		if len(p) > 3 {
+			amount = uint64(p[3].(float64))
+		}
+		fetcher.Add(p[0].(string), uint32(int64(p[1].(float64))), &TxOut{Amount: amount, ScriptPubKey: scriptPubKey})
+	}
+
+	raw, err := hex.DecodeString(v[1].(string))
+	if err != nil {
+		return nil, nil, 0, err
+	}
+	tx, err = ParseTx(bytes.NewReader(raw))
+	if err != nil {
+		return nil, nil, 0, &txParseError{err}
+	}
+
+	for _, txIn := range tx.TxIns {
+		if _, err := fetcher.FetchPrevOut(txIn.PreTxId, txIn.PreTxIdx); err != nil {
+			return nil, nil, 0, errMissingPrevOut
+		}
+	}
+
+	flags, err = script.ParseScriptFlags(v[2].(string))
+
+	return tx, fetcher, flags, err
+}
+
+// verifyInputs is VerifyWithFlags without the fee check, Bitcoin Core's
+// transaction vectors don't balance.
+func verifyInputs(tx *Tx, fetcher PrevOutFetcher, flags script.ScriptFlags) error {
+	cache := newSigHashCache(tx, fetcher)
+	for i := range tx.TxIns {
+		if err := tx.verifyInputWith(cache, i, flags); err != nil {
+			return &InputError{i, err}
+		}
+	}
+
+	return nil
+}
+
+func TestTxValidVectors(t *testing.T) {
+	var ran, failed int
+	for i, v := range readVectors("tx_valid.json", t) {
+		if len(v) == 1 {
+			continue
+		}
+
+		ran++
+		tx, fetcher, flags, err := vectorTx(v)
+		check(nil, err, t)
+		if err != nil {
+			failed++
+			continue
+		}
+
+		if err := verifyInputs(tx, fetcher, flags); err != nil {
+			t.Errorf("%d %s: %s", i, v[1], err)
+			failed++
+		}
+	}
+
+	t.Logf("%d of %d valid tx vectors passed", ran-failed, ran)
+}
+
+func TestTxInvalidVectors(t *testing.T) {
+	var ran, failed, unparsed int
+	for i, v := range readVectors("tx_invalid.json", t) {
+		if len(v) == 1 {
+			continue
+		}
+
+		tx, fetcher, flags, err := vectorTx(v)
+		if _, ok := err.(*txParseError); ok {
+			// transactions that don't deserialize are invalid too
+			unparsed++
+			continue
+		}
+		ran++
+		if err != nil {
+			t.Errorf("%d %s: %s", i, v[1], err)
+			failed++
+			continue
+		}
+
+		if err := verifyInputs(tx, fetcher, flags); err == nil {
+			t.Errorf("%d %s: verified", i, v[1])
+			failed++
+		}
+	}
+
+	t.Logf("%d of %d invalid tx vectors passed, %d didn't deserialize", ran-failed, ran, unparsed)
+}
+
+func TestSigHashVectors(t *testing.T) {
+	var ran, failed int
+	for i, v := range readVectors("sighash.json", t) {
+		if len(v) == 1 {
+			continue
+		}
+
+		ran++
+		tx := parseTxHex(v[0].(string))
+		raw, err := hex.DecodeString(v[1].(string))
+		check(nil, err, t)
+		scriptCode, err := script.ParseRaw(raw)
+		if err != nil {
+			t.Errorf("%d: script doesn't parse", i)
+			failed++
+			continue
+		}
+
+		hashType := uint32(int32(v[3].(float64)))
+		z, err := tx.SigHash(noFetcher, int(v[2].(float64)), scriptCode, hashType)
+		check(nil, err, t)
+		u.ReverseBytes(z)
+		if got := hex.EncodeToString(z); got != v[4].(string) {
+			t.Errorf("%d: got %s", i, got)
+			failed++
+		}
+	}
+
+	t.Logf("%d of %d sighash vectors passed", ran-failed, ran)
+}
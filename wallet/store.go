@@ -0,0 +1,158 @@
+package wallet
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+
+	c "github.com/lobiCode/prog_btc_go/cryptography"
+	"github.com/lobiCode/prog_btc_go/script"
+	"github.com/lobiCode/prog_btc_go/tx"
+)
+
+// state is what Save writes. Only the public account key is kept, the
+// private one is given again to Load.
+type state struct {
+	Account  string      `json:"account"`
+	GapLimit uint32      `json:"gap_limit"`
+	Height   int32       `json:"height"`
+	Used     [2]uint32   `json:"used"`
+	Utxos    []utxoState `json:"utxos"`
+	Spent    []outPoint  `json:"spent"`
+}
+
+type outPoint struct {
+	TxId  string `json:"txid"`
+	Index uint32 `json:"vout"`
+}
+
+type utxoState struct {
+	outPoint
+	Amount       uint64 `json:"amount"`
+	ScriptPubKey string `json:"script_pubkey"`
+	Height       int32  `json:"height"`
+}
+
+// Save writes the state of the wallet as JSON.
+func (w *Wallet) Save(out io.Writer) error {
+	st := &state{
+		Account:  w.account.Neuter().String(),
+		GapLimit: w.GapLimit,
+		Height:   w.height,
+		Used:     [2]uint32{w.chains[Receive].used, w.chains[Change].used},
+		Utxos:    []utxoState{},
+		Spent:    []outPoint{},
+	}
+
+	for _, utxo := range w.Utxos(0) {
+		st.Utxos = append(st.Utxos, utxoState{
+			outPoint:     outPoint{utxo.TxId, utxo.Index},
+			Amount:       utxo.TxOut.Amount,
+			ScriptPubKey: hex.EncodeToString(utxo.TxOut.ScriptPubKey.RawSerialize()),
+			Height:       utxo.Height,
+		})
+	}
+	for o := range w.spent {
+		st.Spent = append(st.Spent, outPoint{o.TxId, o.Index})
+	}
+	sort.Slice(st.Spent, func(i, j int) bool {
+		if st.Spent[i].TxId != st.Spent[j].TxId {
+			return st.Spent[i].TxId < st.Spent[j].TxId
+		}
+		return st.Spent[i].Index < st.Spent[j].Index
+	})
+
+	enc := json.NewEncoder(out)
+	enc.SetIndent("", "  ")
+
+	return enc.Encode(st)
+}
+
+// Load reads a wallet written by Save, the account key must be the one of
+// the saved wallet or its private key.
+func Load(in io.Reader, account *c.ExtendedKey) (*Wallet, error) {
+	st := &state{}
+	if err := json.NewDecoder(in).Decode(st); err != nil {
+		return nil, err
+	}
+
+	if st.Account != account.Neuter().String() {
+		return nil, ErrAccountMismatch
+	}
+	if st.GapLimit == 0 || st.GapLimit > MaxGapLimit {
+		return nil, ErrGapLimit
+	}
+
+	w, err := New(account, st.GapLimit)
+	if err != nil {
+		return nil, err
+	}
+	w.height = st.Height
+
+	for i, used := range st.Used {
+		if used > 0 {
+			if err := w.markUsed(KeyPath{uint32(i), used - 1}); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	for _, o := range st.Spent {
+		w.spent[tx.OutPoint{TxId: o.TxId, Index: o.Index}] = true
+	}
+
+	for _, us := range st.Utxos {
+		raw, err := hex.DecodeString(us.ScriptPubKey)
+		if err != nil {
+			return nil, err
+		}
+		scriptPubKey, err := script.ParseRaw(raw)
+		if err != nil {
+			return nil, err
+		}
+		path, ok := w.IsMine(scriptPubKey)
+		if !ok {
+			return nil, ErrNotOwned
+		}
+
+		o := tx.OutPoint{TxId: us.TxId, Index: us.Index}
+		w.utxos[o] = &Utxo{o, &tx.TxOut{Amount: us.Amount, ScriptPubKey: scriptPubKey}, path, us.Height}
+	}
+
+	return w, nil
+}
+
+// SaveFile saves the wallet to path, replacing the file only once the new
+// state is fully written.
+func (w *Wallet) SaveFile(path string) error {
+	f, err := ioutil.TempFile(filepath.Dir(path), filepath.Base(path)+".tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+
+	if err := w.Save(f); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(f.Name(), path)
+}
+
+// LoadFile loads a wallet saved with SaveFile.
+func LoadFile(path string, account *c.ExtendedKey) (*Wallet, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	return Load(f, account)
+}
@@ -0,0 +1,320 @@
+// Package wallet keeps track of the coins of a BIP84 account: it derives the
+// P2WPKH addresses of the receive and change chains within a gap limit, scans
+// transactions and blocks for the outputs paying to them and keeps their UTXO
+// set.
+package wallet
+
+import (
+	"errors"
+	"sort"
+
+	"github.com/lobiCode/prog_btc_go/block"
+	u "github.com/lobiCode/prog_btc_go/btcutils"
+	"github.com/lobiCode/prog_btc_go/chaincfg"
+	c "github.com/lobiCode/prog_btc_go/cryptography"
+	"github.com/lobiCode/prog_btc_go/script"
+	"github.com/lobiCode/prog_btc_go/tx"
+)
+
+var ErrWatchOnly = errors.New("wallet has no private keys")
+var ErrNotOwned = errors.New("key path not derived by the wallet")
+var ErrAccountMismatch = errors.New("wallet state is of another account")
+var ErrGapLimit = errors.New("gap limit out of range")
+
+// DefaultGapLimit is the number of unused addresses kept after the last used
+// one on each chain.
+const DefaultGapLimit = 20
+
+// MaxGapLimit is the highest gap limit a wallet takes.
+const MaxGapLimit = 1000
+
+// the chains below the account key
+const (
+	Receive uint32 = 0
+	Change  uint32 = 1
+)
+
+// KeyPath is where a key of the wallet is below the account key.
+type KeyPath struct {
+	Chain uint32
+	Index uint32
+}
+
+// Utxo is an unspent output paying to the wallet.
+type Utxo struct {
+	tx.OutPoint
+	TxOut *tx.TxOut
+	Path  KeyPath
+	// Height is the height of the block of the transaction, 0 while it is
+	// unconfirmed
+	Height int32
+}
+
+type chain struct {
+	key     *c.ExtendedKey
+	scripts []*script.Script
+	// used is one past the highest used index
+	used uint32
+}
+
+// Wallet is the state of an account. It is watch-only when the account key
+// is a public one.
+type Wallet struct {
+	Params   *chaincfg.Params
+	GapLimit uint32
+
+	account *c.ExtendedKey
+	chains  [2]*chain
+	owned   map[string]KeyPath
+	utxos   map[tx.OutPoint]*Utxo
+	// spent are the outpoints spent by the wallet's keys whose outputs
+	// weren't scanned yet
+	spent  map[tx.OutPoint]bool
+	height int32
+}
+
+// New returns an empty wallet of the account key, m/84'/0'/0' on mainnet. A
+// gap limit of 0 is DefaultGapLimit.
+func New(account *c.ExtendedKey, gapLimit uint32) (*Wallet, error) {
+	if gapLimit == 0 {
+		gapLimit = DefaultGapLimit
+	}
+	if gapLimit > MaxGapLimit {
+		return nil, ErrGapLimit
+	}
+
+	w := &Wallet{
+		Params:   account.Params,
+		GapLimit: gapLimit,
+		account:  account,
+		owned:    map[string]KeyPath{},
+		utxos:    map[tx.OutPoint]*Utxo{},
+		spent:    map[tx.OutPoint]bool{},
+	}
+
+	for i := range w.chains {
+		key, err := account.Child(uint32(i))
+		if err != nil {
+			return nil, err
+		}
+		w.chains[i] = &chain{key: key}
+		if err := w.fill(uint32(i)); err != nil {
+			return nil, err
+		}
+	}
+
+	return w, nil
+}
+
+// fill derives the addresses of chain i up to the gap limit after the last
+// used one.
+func (w *Wallet) fill(i uint32) error {
+	ch := w.chains[i]
+	for uint32(len(ch.scripts)) < ch.used+w.GapLimit {
+		index := uint32(len(ch.scripts))
+		key, err := ch.key.Child(index)
+		if err != nil {
+			return err
+		}
+
+		s := script.P2wpkh(u.Hash160(c.SerializePublicKey(key.PublicKey())))
+		ch.scripts = append(ch.scripts, s)
+		w.owned[string(s.Serialize())] = KeyPath{i, index}
+	}
+
+	return nil
+}
+
+func (w *Wallet) markUsed(path KeyPath) error {
+	ch := w.chains[path.Chain]
+	if path.Index < ch.used {
+		return nil
+	}
+	ch.used = path.Index + 1
+
+	return w.fill(path.Chain)
+}
+
+// Script returns the script pubkey of the key at path.
+func (w *Wallet) Script(path KeyPath) (*script.Script, error) {
+	if path.Chain > Change || path.Index >= uint32(len(w.chains[path.Chain].scripts)) {
+		return nil, ErrNotOwned
+	}
+
+	return w.chains[path.Chain].scripts[path.Index], nil
+}
+
+// IsMine returns the key path of the script when it pays to the wallet.
+func (w *Wallet) IsMine(s *script.Script) (KeyPath, bool) {
+	path, ok := w.owned[string(s.Serialize())]
+	return path, ok
+}
+
+// ReceiveAddress returns the first unused address of the receive chain.
+func (w *Wallet) ReceiveAddress() (string, error) {
+	s, err := w.Script(KeyPath{Receive, w.chains[Receive].used})
+	if err != nil {
+		return "", err
+	}
+
+	return s.GetAddress(w.Params)
+}
+
+// ChangeScript returns the first unused script of the change chain.
+func (w *Wallet) ChangeScript() *script.Script {
+	ch := w.chains[Change]
+	return ch.scripts[ch.used]
+}
+
+// PrivateKey returns the private key at path.
+func (w *Wallet) PrivateKey(path KeyPath) (*c.PrivateKey, error) {
+	if !w.account.IsPrivate() {
+		return nil, ErrWatchOnly
+	}
+	if _, err := w.Script(path); err != nil {
+		return nil, err
+	}
+
+	key, err := w.chains[path.Chain].key.Child(path.Index)
+	if err != nil {
+		return nil, err
+	}
+
+	return key.PrivateKey(), nil
+}
+
+// ScanTx updates the UTXO set with a transaction, at the height of its block
+// or 0 when unconfirmed. It reports whether the transaction is the wallet's,
+// a spend scanned before the output it spends isn't known to be. Blocks can
+// be scanned out of order: a spend of an output not scanned yet is kept until
+// the output is, when its witness has a key of the wallet within the gap
+// limit.
+func (w *Wallet) ScanTx(transaction *tx.Tx, height int32) (bool, error) {
+	mine := false
+
+	if !transaction.IsCoinbase() {
+		for _, txIn := range transaction.TxIns {
+			outPoint := tx.OutPoint{TxId: txIn.PreTxId, Index: txIn.PreTxIdx}
+			if _, ok := w.utxos[outPoint]; ok {
+				delete(w.utxos, outPoint)
+				mine = true
+			} else if w.spendsOwnKey(txIn) {
+				w.spent[outPoint] = true
+			}
+		}
+	}
+
+	txId := transaction.TxId()
+	for i, txOut := range transaction.TxOuts {
+		path, ok := w.IsMine(txOut.ScriptPubKey)
+		if !ok {
+			continue
+		}
+		mine = true
+
+		outPoint := tx.OutPoint{TxId: txId, Index: uint32(i)}
+		if w.spent[outPoint] {
+			delete(w.spent, outPoint)
+		} else {
+			w.utxos[outPoint] = &Utxo{outPoint, txOut, path, height}
+		}
+		if err := w.markUsed(path); err != nil {
+			return mine, err
+		}
+	}
+
+	return mine, nil
+}
+
+// spendsOwnKey reports whether txIn could spend an output of the wallet, the
+// witness of a P2WPKH spend ends with its public key.
+func (w *Wallet) spendsOwnKey(txIn *tx.TxIn) bool {
+	if len(txIn.Witness) != 2 {
+		return false
+	}
+	_, ok := w.IsMine(script.P2wpkh(u.Hash160(txIn.Witness[1])))
+
+	return ok
+}
+
+// ScanBlock scans the transactions of a block parsed with
+// block.ParseWithTxs, the block becomes the tip when it is higher.
+func (w *Wallet) ScanBlock(b *block.Block, height int32) error {
+	for _, transaction := range b.Txs {
+		if _, err := w.ScanTx(transaction, height); err != nil {
+			return err
+		}
+	}
+
+	if height > w.height {
+		w.height = height
+	}
+
+	return nil
+}
+
+// Height is the height of the highest scanned block.
+func (w *Wallet) Height() int32 {
+	return w.height
+}
+
+// Confirmations returns the number of blocks confirming the UTXO.
+func (w *Wallet) Confirmations(utxo *Utxo) int32 {
+	if utxo.Height == 0 || utxo.Height > w.height {
+		return 0
+	}
+
+	return w.height - utxo.Height + 1
+}
+
+// Utxos returns the UTXOs with at least minConf confirmations, ordered by
+// outpoint.
+func (w *Wallet) Utxos(minConf int32) []*Utxo {
+	utxos := []*Utxo{}
+	for _, utxo := range w.utxos {
+		if w.Confirmations(utxo) >= minConf {
+			utxos = append(utxos, utxo)
+		}
+	}
+
+	sort.Slice(utxos, func(i, j int) bool {
+		if utxos[i].TxId != utxos[j].TxId {
+			return utxos[i].TxId < utxos[j].TxId
+		}
+		return utxos[i].Index < utxos[j].Index
+	})
+
+	return utxos
+}
+
+// Balance returns the value of the UTXOs with at least minConf
+// confirmations, 0 includes the unconfirmed ones.
+func (w *Wallet) Balance(minConf int32) uint64 {
+	var balance uint64
+	for _, utxo := range w.Utxos(minConf) {
+		balance += utxo.TxOut.Amount
+	}
+
+	return balance
+}
+
+// Spendable returns the UTXOs with at least minConf confirmations for a
+// tx.TxBuilder.
+func (w *Wallet) Spendable(minConf int32) []*tx.Utxo {
+	utxos := []*tx.Utxo{}
+	for _, utxo := range w.Utxos(minConf) {
+		utxos = append(utxos, &tx.Utxo{OutPoint: utxo.OutPoint, TxOut: utxo.TxOut})
+	}
+
+	return utxos
+}
+
+// FetchPrevOut makes the wallet a tx.PrevOutFetcher of its UTXOs.
+func (w *Wallet) FetchPrevOut(txId string, index uint32) (*tx.TxOut, error) {
+	utxo, ok := w.utxos[tx.OutPoint{TxId: txId, Index: index}]
+	if !ok {
+		return nil, tx.ErrTxPrevOutNotFound
+	}
+
+	return utxo.TxOut, nil
+}
@@ -0,0 +1,272 @@
+package wallet
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/lobiCode/prog_btc_go/block"
+	"github.com/lobiCode/prog_btc_go/chaincfg"
+	c "github.com/lobiCode/prog_btc_go/cryptography"
+	"github.com/lobiCode/prog_btc_go/mnemonic"
+	"github.com/lobiCode/prog_btc_go/script"
+	"github.com/lobiCode/prog_btc_go/tx"
+)
+
+// the account of the BIP84 test vector
+func testAccount(t *testing.T) *c.ExtendedKey {
+	t.Helper()
+	phrase := "abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon about"
+	master, err := mnemonic.NewMasterKey(phrase, "", mnemonic.English, &chaincfg.MainNetParams)
+	check(nil, err, t)
+	account, err := master.DerivePath("m/84'/0'/0'")
+	check(nil, err, t)
+
+	return account
+}
+
+func testWallet(t *testing.T) *Wallet {
+	t.Helper()
+	w, err := New(testAccount(t), 0)
+	check(nil, err, t)
+
+	return w
+}
+
+// payTo returns a transaction from outside the wallet paying amount to each
+// of the scripts.
+func payTo(amount uint64, scripts ...*script.Script) *tx.Tx {
+	txIn := &tx.TxIn{
+		PreTxId:   strings.Repeat("11", 32),
+		ScriptSig: &script.Script{},
+		Sequence:  0xffffffff,
+	}
+	transaction := &tx.Tx{Version: 2, TxIns: []*tx.TxIn{txIn}}
+	for _, s := range scripts {
+		transaction.TxOuts = append(transaction.TxOuts, &tx.TxOut{Amount: amount, ScriptPubKey: s})
+	}
+
+	return transaction
+}
+
+func mustScript(w *Wallet, path KeyPath, t *testing.T) *script.Script {
+	t.Helper()
+	s, err := w.Script(path)
+	check(nil, err, t)
+
+	return s
+}
+
+func TestAddresses(t *testing.T) {
+	w := testWallet(t)
+
+	address, err := w.ReceiveAddress()
+	check(nil, err, t)
+	check("bc1qcr8te4kr609gcawutmrza0j4xv80jy8z306fyu", address, t)
+
+	address, err = mustScript(w, KeyPath{Receive, 1}, t).GetAddress(w.Params)
+	check(nil, err, t)
+	check("bc1qnjg0jd8228aq7egyzacy8cys3knf9xvrerkf9g", address, t)
+
+	address, err = w.ChangeScript().GetAddress(w.Params)
+	check(nil, err, t)
+	check("bc1q8c6fshw2dlwun7ekn9qwf37cu2rn755upcp6el", address, t)
+
+	path, ok := w.IsMine(mustScript(w, KeyPath{Change, 19}, t))
+	check(true, ok, t)
+	check(KeyPath{Change, 19}, path, t)
+
+	_, err = w.Script(KeyPath{Receive, DefaultGapLimit})
+	check(ErrNotOwned, err, t)
+	_, ok = w.IsMine(script.P2wpkh(make([]byte, 20)))
+	check(false, ok, t)
+}
+
+func TestGapLimit(t *testing.T) {
+	w := testWallet(t)
+
+	// the last address in the gap moves it on
+	last := mustScript(w, KeyPath{Receive, DefaultGapLimit - 1}, t)
+	mine, err := w.ScanTx(payTo(1000, last), 0)
+	check(nil, err, t)
+	check(true, mine, t)
+
+	mustScript(w, KeyPath{Receive, 2*DefaultGapLimit - 1}, t)
+	_, err = w.Script(KeyPath{Receive, 2 * DefaultGapLimit})
+	check(ErrNotOwned, err, t)
+
+	address, _ := w.ReceiveAddress()
+	expected, _ := mustScript(w, KeyPath{Receive, DefaultGapLimit}, t).GetAddress(w.Params)
+	check(expected, address, t)
+
+	_, err = New(testAccount(t), MaxGapLimit+1)
+	check(ErrGapLimit, err, t)
+}
+
+func TestScan(t *testing.T) {
+	w := testWallet(t)
+	receive := mustScript(w, KeyPath{Receive, 0}, t)
+
+	credit := payTo(100000, receive, script.P2wpkh(make([]byte, 20)), receive)
+	mine, err := w.ScanTx(credit, 0)
+	check(nil, err, t)
+	check(true, mine, t)
+	check(uint64(200000), w.Balance(0), t)
+	check(uint64(0), w.Balance(1), t)
+
+	mine, err = w.ScanTx(payTo(5000, script.P2wpkh(make([]byte, 20))), 0)
+	check(nil, err, t)
+	check(false, mine, t)
+
+	// the credit confirms, then 5 more blocks
+	check(nil, w.ScanBlock(&block.Block{Txs: []*tx.Tx{credit}}, 100), t)
+	check(nil, w.ScanBlock(&block.Block{}, 105), t)
+	utxos := w.Utxos(6)
+	check(2, len(utxos), t)
+	check(int32(6), w.Confirmations(utxos[0]), t)
+	check(tx.OutPoint{TxId: credit.TxId(), Index: 2}, utxos[1].OutPoint, t)
+	check(0, len(w.Utxos(7)), t)
+
+	// spend the first output, sending the change back
+	change := w.ChangeScript()
+	spend := &tx.Tx{
+		Version: 2,
+		TxIns:   []*tx.TxIn{{PreTxId: credit.TxId(), PreTxIdx: 0, ScriptSig: &script.Script{}, Sequence: 0xffffffff}},
+		TxOuts: []*tx.TxOut{
+			{Amount: 60000, ScriptPubKey: script.P2wpkh(make([]byte, 20))},
+			{Amount: 39000, ScriptPubKey: change},
+		},
+	}
+	key, err := w.PrivateKey(utxos[0].Path)
+	check(nil, err, t)
+	check(nil, spend.SingInput(w, 0, key), t)
+	check(nil, spend.Verify(w), t)
+
+	mine, err = w.ScanTx(spend, 0)
+	check(nil, err, t)
+	check(true, mine, t)
+	check(uint64(139000), w.Balance(0), t)
+	check(uint64(100000), w.Balance(1), t)
+	check(false, reflect.DeepEqual(change, w.ChangeScript()), t)
+
+	spendable := w.Spendable(0)
+	check(2, len(spendable), t)
+	check(utxos[1].OutPoint, spendable[0].OutPoint, t)
+
+	// rescanning the blocks of the credit and the spend
+	check(nil, w.ScanBlock(&block.Block{Txs: []*tx.Tx{credit}}, 100), t)
+	check(nil, w.ScanBlock(&block.Block{Txs: []*tx.Tx{spend}}, 105), t)
+	check(uint64(139000), w.Balance(0), t)
+	check(0, len(w.spent), t)
+	check(int32(105), w.Height(), t)
+}
+
+func TestScanOutOfOrder(t *testing.T) {
+	w := testWallet(t)
+	receive := mustScript(w, KeyPath{Receive, 0}, t)
+	credit := payTo(100000, receive, receive)
+	spend := signedSpend(w, credit, 1, t)
+
+	// the block with the spend is scanned first, the spends of other keys
+	// in it aren't kept
+	other := payTo(5000, script.P2wpkh(make([]byte, 20)))
+	check(nil, w.ScanBlock(&block.Block{Txs: []*tx.Tx{spend, other}}, 101), t)
+	check(1, len(w.spent), t)
+	check(nil, w.ScanBlock(&block.Block{Txs: []*tx.Tx{credit}}, 100), t)
+	check(uint64(100000), w.Balance(0), t)
+	utxos := w.Utxos(0)
+	check(1, len(utxos), t)
+	check(tx.OutPoint{TxId: credit.TxId(), Index: 0}, utxos[0].OutPoint, t)
+	check(0, len(w.spent), t)
+}
+
+// signedSpend returns a transaction spending output index of credit, an
+// output paying to the wallet, signed with the key of the wallet.
+func signedSpend(w *Wallet, credit *tx.Tx, index uint32, t *testing.T) *tx.Tx {
+	t.Helper()
+	path, ok := w.IsMine(credit.TxOuts[index].ScriptPubKey)
+	check(true, ok, t)
+	key, err := w.PrivateKey(path)
+	check(nil, err, t)
+
+	spend := &tx.Tx{
+		Version: 2,
+		TxIns:   []*tx.TxIn{{PreTxId: credit.TxId(), PreTxIdx: index, ScriptSig: &script.Script{}, Sequence: 0xffffffff}},
+		TxOuts:  []*tx.TxOut{{Amount: credit.TxOuts[index].Amount - 1000, ScriptPubKey: script.P2wpkh(make([]byte, 20))}},
+	}
+	fetcher := tx.MapFetcher{}
+	fetcher.AddTx(credit)
+	check(nil, spend.SingInput(fetcher, 0, key), t)
+
+	return spend
+}
+
+func TestSaveLoad(t *testing.T) {
+	w := testWallet(t)
+	credit := payTo(100000, mustScript(w, KeyPath{Receive, 3}, t), mustScript(w, KeyPath{Change, 0}, t))
+	w.ScanBlock(&block.Block{Txs: []*tx.Tx{credit}}, 10)
+	w.ScanTx(&tx.Tx{
+		Version: 2,
+		TxIns:   []*tx.TxIn{{PreTxId: credit.TxId(), PreTxIdx: 1, ScriptSig: &script.Script{}}},
+		TxOuts:  []*tx.TxOut{{Amount: 90000, ScriptPubKey: script.P2wpkh(make([]byte, 20))}},
+	}, 0)
+	// spends of outputs not scanned yet
+	unseen := payTo(50000, mustScript(w, KeyPath{Receive, 0}, t), mustScript(w, KeyPath{Receive, 1}, t))
+	w.ScanTx(signedSpend(w, unseen, 0, t), 0)
+	w.ScanTx(signedSpend(w, unseen, 1, t), 0)
+	check(2, len(w.spent), t)
+
+	dir, err := ioutil.TempDir("", "wallet")
+	check(nil, err, t)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "wallet.json")
+	check(nil, w.SaveFile(path), t)
+
+	// a watch-only wallet of the same account
+	loaded, err := LoadFile(path, testAccount(t).Neuter())
+	check(nil, err, t)
+	check(utxoStrings(w), utxoStrings(loaded), t)
+	check(w.Height(), loaded.Height(), t)
+	check(w.chains[Receive].used, loaded.chains[Receive].used, t)
+	check(w.chains[Change].used, loaded.chains[Change].used, t)
+	check(w.spent, loaded.spent, t)
+	_, err = loaded.PrivateKey(KeyPath{Receive, 3})
+	check(ErrWatchOnly, err, t)
+
+	var b, again bytes.Buffer
+	check(nil, w.Save(&b), t)
+	check(nil, w.Save(&again), t)
+	check(b.String(), again.String(), t)
+	other, _ := testAccount(t).Child(0)
+	_, err = Load(&b, other)
+	check(ErrAccountMismatch, err, t)
+
+	for _, gapLimit := range []uint32{0, MaxGapLimit + 1} {
+		w.GapLimit = gapLimit
+		b.Reset()
+		check(nil, w.Save(&b), t)
+		_, err = Load(&b, testAccount(t))
+		check(ErrGapLimit, err, t)
+	}
+}
+
+func utxoStrings(w *Wallet) []string {
+	utxos := []string{}
+	for _, utxo := range w.Utxos(0) {
+		utxos = append(utxos, fmt.Sprintf("%s:%d %d %x %v %d", utxo.TxId, utxo.Index, utxo.TxOut.Amount, utxo.TxOut.ScriptPubKey.Serialize(), utxo.Path, utxo.Height))
+	}
+
+	return utxos
+}
+
+func check(expected, recived interface{}, t *testing.T) {
+	t.Helper()
+	if !reflect.DeepEqual(recived, expected) {
+		t.Errorf("Received\n%+v\ndoesn't match expected\n%+v\n", recived, expected)
+	}
+}